@@ -34,6 +34,30 @@ var (
 			Action:    nodeinfo,
 			Category:  "OPENW-CLI COMMANDS",
 		},
+		{
+			//keychain列表
+			Name:      "listkeychain",
+			Usage:     "show all local keychains",
+			ArgsUsage: "",
+			Action:    listkeychain,
+			Category:  "OPENW-CLI COMMANDS",
+		},
+		{
+			//轮换keychain
+			Name:      "rotatekeychain",
+			Usage:     "generate a new keychain, register it and switch to it, the old one is kept for rollback",
+			ArgsUsage: "",
+			Action:    rotatekeychain,
+			Category:  "OPENW-CLI COMMANDS",
+		},
+		{
+			//切换keychain
+			Name:      "usekeychain",
+			Usage:     "switch current keychain to a local keychain",
+			ArgsUsage: "",
+			Action:    usekeychain,
+			Category:  "OPENW-CLI COMMANDS",
+		},
 		{
 			//获取钱包列表信息
 			Name:     "listwallet",
@@ -49,6 +73,84 @@ var (
 			ArgsUsage: "<symbol>",
 			Action:    newwallet,
 			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				MnemonicFlag,
+			},
+		},
+		{
+
+			Name:      "importwallet",
+			Usage:     "import a wallet by mnemonic or hex seed",
+			ArgsUsage: "",
+			Action:    importwallet,
+			Category:  "WALLET COMMANDS",
+			Flags:     []cli.Flag{},
+		},
+		{
+			//修改钱包别名
+			Name:      "renamewallet",
+			Usage:     "rename wallet alias and key file, the alias registered on openw-server is not changed",
+			ArgsUsage: "",
+			Action:    renamewallet,
+			Category:  "WALLET COMMANDS",
+			Flags:     []cli.Flag{},
+		},
+		{
+			//归档钱包
+			Name:      "archivewallet",
+			Usage:     "move wallet key file to archive directory, the wallet is hidden from local wallet list",
+			ArgsUsage: "",
+			Action:    archivewallet,
+			Category:  "WALLET COMMANDS",
+			Flags:     []cli.Flag{},
+		},
+		{
+			//恢复归档钱包
+			Name:      "unarchivewallet",
+			Usage:     "move archived wallet key file back to key directory",
+			ArgsUsage: "",
+			Action:    unarchivewallet,
+			Category:  "WALLET COMMANDS",
+			Flags:     []cli.Flag{},
+		},
+		{
+
+			Name:      "splitwallet",
+			Usage:     "split wallet seed into shamir shares",
+			ArgsUsage: "",
+			Action:    splitwallet,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				SharesFlag,
+				ThresholdFlag,
+				OutDirFlag,
+			},
+		},
+		{
+
+			Name:      "combinewallet",
+			Usage:     "recover wallet from shamir shares",
+			ArgsUsage: "",
+			Action:    combinewallet,
+			Category:  "WALLET COMMANDS",
+			Flags:     []cli.Flag{},
+		},
+		{
+
+			Name:      "addwatchwallet",
+			Usage:     "add a watch-only wallet which has no local seed",
+			ArgsUsage: "",
+			Action:    addwatchwallet,
+			Category:  "WALLET COMMANDS",
+			Flags:     []cli.Flag{},
+		},
+		{
+
+			Name:      "removewatchwallet",
+			Usage:     "remove a watch-only wallet",
+			ArgsUsage: "",
+			Action:    removewatchwallet,
+			Category:  "WALLET COMMANDS",
 			Flags:     []cli.Flag{},
 		},
 		{
@@ -177,7 +279,55 @@ var (
 			ArgsUsage: "<symbol>",
 			Action:    trustserver,
 			Category:  "WALLET COMMANDS",
-			Flags:     []cli.Flag{},
+			Flags: []cli.Flag{
+				TTLFlag,
+			},
+		},
+		{
+			//守护进程
+			Name:      "daemon",
+			Usage:     "run transmit node, summary task and background jobs in one process, stop it by SIGINT or SIGTERM",
+			ArgsUsage: "",
+			Action:    daemon,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				FileFlag,
+				TTLFlag,
+				UnlockFlag,
+			},
+		},
+		{
+			//守护进程运行状态
+			Name:      "daemonstatus",
+			Usage:     "show state, readiness and liveness of running daemon",
+			ArgsUsage: "",
+			Action:    daemonstatus,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				ProbeFlag,
+			},
+		},
+		{
+			//远程签名服务
+			Name:      "signerserver",
+			Usage:     "start remote signer on signersocket of config, sign transactions for nodes with signer = remote",
+			ArgsUsage: "",
+			Action:    signerserver,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				TTLFlag,
+			},
+		},
+		{
+			//联合签名服务
+			Name:      "cosignserver",
+			Usage:     "start co-signer service, approve transactions of custody nodes in cosignclients of config",
+			ArgsUsage: "",
+			Action:    cosignserver,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				ListenFlag,
+			},
 		},
 		{
 
@@ -242,6 +392,41 @@ var (
 			Category:  "WALLET COMMANDS",
 			Flags:     []cli.Flag{},
 		},
+		{
+			//导出未签名交易文件
+			Name:      "exporttx",
+			Usage:     "export an unsigned transaction file for offline signing",
+			ArgsUsage: "",
+			Action:    exporttx,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				TxTypeFlag,
+				OutFlag,
+			},
+		},
+		{
+			//离线签名交易文件
+			Name:      "signtx",
+			Usage:     "sign an exported transaction file on an offline machine",
+			ArgsUsage: "",
+			Action:    signtx,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				InFlag,
+				OutFlag,
+			},
+		},
+		{
+			//广播已签名交易文件
+			Name:      "submittx",
+			Usage:     "submit a signed transaction file to openw-server",
+			ArgsUsage: "",
+			Action:    submittx,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				InFlag,
+			},
+		},
 		{
 
 			Name:      "signhash",
@@ -269,6 +454,184 @@ var (
 			Category:  "WALLET COMMANDS",
 			Flags:     []cli.Flag{},
 		},
+		{
+			//检查keystore
+			Name:      "checkkeys",
+			Usage:     "check keystore files and upgrade scrypt parameters",
+			ArgsUsage: "",
+			Action:    checkkeys,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				UpgradeFlag,
+				ScryptNFlag,
+				ScryptPFlag,
+			},
+		},
+		{
+
+			Name:      "trustclient",
+			Usage:     "start a local trusted server stand-in and call the routes of transmit node for debugging",
+			ArgsUsage: "",
+			Action:    trustclient,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				ListenFlag,
+				MethodFlag,
+				ParamsFlag,
+				LocalNodeFlag,
+			},
+		},
+		{
+
+			Name:      "listpending",
+			Usage:     "show transfer requests which are waiting for approval",
+			ArgsUsage: "",
+			Action:    listpending,
+			Category:  "WALLET COMMANDS",
+			Flags: []cli.Flag{
+				AllFlag,
+			},
+		},
+		{
+
+			Name:      "approve",
+			Usage:     "approve a pending transfer request and sign it",
+			ArgsUsage: "",
+			Action:    approve,
+			Category:  "WALLET COMMANDS",
+			Flags:     []cli.Flag{},
+		},
+		{
+
+			Name:      "reject",
+			Usage:     "reject a pending transfer request",
+			ArgsUsage: "",
+			Action:    reject,
+			Category:  "WALLET COMMANDS",
+			Flags:     []cli.Flag{},
+		},
+		{
+			//备份节点
+			Name:      "backup",
+			Usage:     "backup keystore, database and config to an encrypted archive",
+			ArgsUsage: "",
+			Action:    backup,
+			Category:  "OPENW-CLI COMMANDS",
+			Flags: []cli.Flag{
+				OutFlag,
+			},
+		},
+		{
+			//恢复节点
+			Name:      "restore",
+			Usage:     "verify and restore node from an encrypted archive",
+			ArgsUsage: "",
+			Action:    restore,
+			Category:  "OPENW-CLI COMMANDS",
+			Flags: []cli.Flag{
+				InFlag,
+			},
+		},
+		{
+			//加密数据库
+			Name:      "encryptdb",
+			Usage:     "encrypt sensitive fields stored in plaintext in local database",
+			ArgsUsage: "",
+			Action:    encryptdb,
+			Category:  "OPENW-CLI COMMANDS",
+		},
+		{
+			//解锁钱包会话
+			Name:      "unlockwallet",
+			Usage:     "unlock a wallet in the running trustserver, startsum or daemon",
+			ArgsUsage: "",
+			Action:    unlockwallet,
+			Category:  "OPENW-CLI COMMANDS",
+			Flags: []cli.Flag{
+				TTLFlag,
+			},
+		},
+		{
+			//锁定钱包会话
+			Name:      "lockwallet",
+			Usage:     "lock a wallet in the running trustserver, startsum or daemon",
+			ArgsUsage: "",
+			Action:    lockwallet,
+			Category:  "OPENW-CLI COMMANDS",
+			Flags: []cli.Flag{
+				LockAllFlag,
+			},
+		},
+		{
+			//数据库结构迁移
+			Name:     "dbmigrate",
+			Usage:    "show or apply local database schema migrations",
+			Category: "OPENW-CLI COMMANDS",
+			Subcommands: []cli.Command{
+				{
+					Name:   "status",
+					Usage:  "show database schema version and pending migrations",
+					Action: dbmigratestatus,
+				},
+				{
+					Name:   "up",
+					Usage:  "backup database and apply pending migrations",
+					Action: dbmigrateup,
+				},
+			},
+		},
+		{
+			//数据库维护
+			Name:     "db",
+			Usage:    "maintain local database: compact, verify, export and prune",
+			Category: "OPENW-CLI COMMANDS",
+			Subcommands: []cli.Command{
+				{
+					Name:   "compact",
+					Usage:  "rewrite database file to reclaim free space",
+					Action: dbcompact,
+				},
+				{
+					Name:   "verify",
+					Usage:  "check database consistency and rebuild indexes",
+					Action: dbverify,
+				},
+				{
+					Name:   "export",
+					Usage:  "dump all buckets with secrets redacted",
+					Action: dbexport,
+					Flags: []cli.Flag{
+						FormatFlag,
+						OutFlag,
+					},
+				},
+				{
+					Name:   "prune",
+					Usage:  "archive old summary task logs to a file and delete them",
+					Action: dbprune,
+					Flags: []cli.Flag{
+						BeforeFlag,
+						OutFlag,
+					},
+				},
+			},
+		},
+		{
+			//配置
+			Name:     "config",
+			Usage:    "show configuration with secrets masked",
+			Category: "OPENW-CLI COMMANDS",
+			Subcommands: []cli.Command{
+				{
+					Name:   "show",
+					Usage:  "print configuration, --effective merges environment variables and secret files",
+					Action: configshow,
+					Flags: []cli.Flag{
+						EffectiveFlag,
+					},
+				},
+			},
+		},
 	}
 )
 
@@ -293,6 +656,30 @@ func getCLI(c *cli.Context) *openwcli.CLI {
 	return cli
 }
 
+// getQueryCLI 查询命令以只读方式打开数据库，守护进程运行时通过守护进程读取一次快照，命令结束时调用Close释放
+func getQueryCLI(c *cli.Context) *openwcli.CLI {
+	var (
+		err error
+	)
+
+	conf := c.GlobalString("conf")
+	config, err := openwcli.LoadConfig(conf)
+	if err != nil {
+		log.Error("unexpected error: ", err)
+		return nil
+	}
+
+	config.SetDBReadOnlyMode(true)
+
+	cli, err := openwcli.NewCLI(config)
+	if err != nil {
+		log.Error("unexpected error: ", err)
+		return nil
+	}
+
+	return cli
+}
+
 // register 注册
 func noderegister(c *cli.Context) error {
 
@@ -309,7 +696,8 @@ func noderegister(c *cli.Context) error {
 // nodeinfo
 func nodeinfo(c *cli.Context) error {
 
-	if cli := getCLI(c); cli != nil {
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
 		err := cli.GetNodeInfoFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
@@ -320,11 +708,12 @@ func nodeinfo(c *cli.Context) error {
 	return nil
 }
 
-// newwallet 创建钱包
-func newwallet(c *cli.Context) error {
+// listkeychain keychain列表
+func listkeychain(c *cli.Context) error {
 
-	if cli := getCLI(c); cli != nil {
-		err := cli.NewWalletFlow()
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.ListKeychainFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -334,11 +723,11 @@ func newwallet(c *cli.Context) error {
 	return nil
 }
 
-// listwallet 钱包配置
-func listwallet(c *cli.Context) error {
+// rotatekeychain 轮换keychain
+func rotatekeychain(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.ListWalletFlow()
+		err := cli.RotateKeychainFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -348,11 +737,11 @@ func listwallet(c *cli.Context) error {
 	return nil
 }
 
-// newaccount 创建账户
-func newaccount(c *cli.Context) error {
+// usekeychain 切换keychain
+func usekeychain(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.NewAccountFlow()
+		err := cli.UseKeychainFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -362,11 +751,11 @@ func newaccount(c *cli.Context) error {
 	return nil
 }
 
-// listaccount 账户列表
-func listaccount(c *cli.Context) error {
+// newwallet 创建钱包
+func newwallet(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.ListAccountFlow()
+		err := cli.NewWalletFlow(c.Bool("mnemonic"))
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -376,11 +765,11 @@ func listaccount(c *cli.Context) error {
 	return nil
 }
 
-// newaddress 创建地址
-func newaddress(c *cli.Context) error {
+// importwallet 导入钱包
+func importwallet(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.NewAddressFlow()
+		err := cli.ImportWalletFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -390,11 +779,11 @@ func newaddress(c *cli.Context) error {
 	return nil
 }
 
-// searchaddress 查询地址
-func searchaddress(c *cli.Context) error {
+// splitwallet 拆分钱包种子
+func splitwallet(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.SearchAddressFlow()
+		err := cli.SplitWalletFlow(c.Int("shares"), c.Int("threshold"), c.String("outdir"))
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -404,11 +793,11 @@ func searchaddress(c *cli.Context) error {
 	return nil
 }
 
-// transfer 转账交易
-func transfer(c *cli.Context) error {
+// combinewallet 通过分片恢复钱包
+func combinewallet(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.TransferFlow()
+		err := cli.CombineWalletFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -418,11 +807,11 @@ func transfer(c *cli.Context) error {
 	return nil
 }
 
-// transferall 转账全部资产交易
-func transferall(c *cli.Context) error {
+// addwatchwallet 登记观察钱包
+func addwatchwallet(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.TransferAllFlow()
+		err := cli.AddWatchOnlyWalletFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -432,11 +821,11 @@ func transferall(c *cli.Context) error {
 	return nil
 }
 
-// setsum 设置汇总
-func setsum(c *cli.Context) error {
+// removewatchwallet 删除观察钱包
+func removewatchwallet(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.SetSumFlow()
+		err := cli.RemoveWatchOnlyWalletFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -446,13 +835,12 @@ func setsum(c *cli.Context) error {
 	return nil
 }
 
-// startsum 定时汇总
-func startsum(c *cli.Context) error {
-
-	if cli := getCLI(c); cli != nil {
+// listwallet 钱包配置
+func listwallet(c *cli.Context) error {
 
-		file := c.String("file")
-		err := cli.StartSumFlow(file)
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.ListWalletFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -462,11 +850,11 @@ func startsum(c *cli.Context) error {
 	return nil
 }
 
-// updateinfo 更新区块链资料库
-func updateinfo(c *cli.Context) error {
+// newaccount 创建账户
+func newaccount(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.UpdateInfoFlow()
+		err := cli.NewAccountFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -476,11 +864,12 @@ func updateinfo(c *cli.Context) error {
 	return nil
 }
 
-// listsymbol 查看所有币种信息列表
-func listsymbol(c *cli.Context) error {
+// listaccount 账户列表
+func listaccount(c *cli.Context) error {
 
-	if cli := getCLI(c); cli != nil {
-		err := cli.ListSymbolFlow()
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.ListAccountFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -490,11 +879,11 @@ func listsymbol(c *cli.Context) error {
 	return nil
 }
 
-// listtokencontract 查看某个区块链所有代币合约信息列表
-func listtokencontract(c *cli.Context) error {
+// newaddress 创建地址
+func newaddress(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
-		err := cli.ListTokenContractFlow()
+		err := cli.NewAddressFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -504,9 +893,123 @@ func listtokencontract(c *cli.Context) error {
 	return nil
 }
 
-// listaddress 查看账户所有地址
-func listaddress(c *cli.Context) error {
-
+// searchaddress 查询地址
+func searchaddress(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.SearchAddressFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transfer 转账交易
+func transfer(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.TransferFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transferall 转账全部资产交易
+func transferall(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.TransferAllFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setsum 设置汇总
+func setsum(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.SetSumFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startsum 定时汇总
+func startsum(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+
+		file := c.String("file")
+		err := cli.StartSumFlow(file)
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateinfo 更新区块链资料库
+func updateinfo(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.UpdateInfoFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listsymbol 查看所有币种信息列表
+func listsymbol(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.ListSymbolFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listtokencontract 查看某个区块链所有代币合约信息列表
+func listtokencontract(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.ListTokenContractFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listaddress 查看账户所有地址
+func listaddress(c *cli.Context) error {
+
 	if cli := getCLI(c); cli != nil {
 		err := cli.ListAddressFlow()
 		if err != nil {
@@ -523,7 +1026,64 @@ func trustserver(c *cli.Context) error {
 
 	if cli := getCLI(c); cli != nil {
 
-		err := cli.StartTrustServerFlow()
+		err := cli.StartTrustServerFlow(c.Duration("ttl"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signerserver 启动远程签名服务
+func signerserver(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.StartSignerServerFlow(c.Duration("ttl"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cosignserver 启动联合签名服务
+func cosignserver(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.StartCoSignServerFlow(c.String("listen"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// daemon 启动守护进程
+func daemon(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.DaemonFlow(c.String("file"), c.Duration("ttl"), c.Bool("unlock"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// daemonstatus 查看守护进程运行状态
+func daemonstatus(c *cli.Context) error {
+
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.DaemonStatusFlow(c.String("probe"))
 		if err != nil {
 			log.Error("unexpected error: ", err)
 			return err
@@ -546,7 +1106,8 @@ func genkeychain(c *cli.Context) error {
 
 func listsuminfo(c *cli.Context) error {
 
-	if cli := getCLI(c); cli != nil {
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
 		err := cli.ListSumInfoFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
@@ -588,7 +1149,8 @@ func addtrustaddress(c *cli.Context) error {
 // listtrustaddress
 func listtrustaddress(c *cli.Context) error {
 
-	if cli := getCLI(c); cli != nil {
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
 		err := cli.ListTrustAddressFlow()
 		if err != nil {
 			log.Error("unexpected error: ", err)
@@ -696,3 +1258,328 @@ func changepwd(c *cli.Context) error {
 
 	return nil
 }
+
+// checkkeys 检查keystore文件
+func checkkeys(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.CheckKeysFlow(c.Bool("upgrade"), c.Int("scryptn"), c.Int("scryptp"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listpending 查看待审批的转账请求
+func listpending(c *cli.Context) error {
+
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.ListPendingFlow(c.Bool("all"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// approve 审批通过转账请求
+func approve(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.ApprovePendingFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reject 拒绝转账请求
+func reject(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.RejectPendingFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trustclient 启动本地模拟的授信服务调试托管节点
+func trustclient(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.TrustClientFlow(c.String("listen"), c.String("method"), c.String("params"), c.Bool("local"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backup 备份节点到加密文件
+func backup(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.BackupFlow(c.String("out"), c.GlobalString("conf"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restore 从加密文件恢复节点
+func restore(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.RestoreFlow(c.String("in"), c.GlobalString("conf"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encryptdb 加密数据库
+func encryptdb(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.EncryptDBFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unlockwallet 在运行中的守护进程解锁钱包
+func unlockwallet(c *cli.Context) error {
+
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.UnlockWalletFlow(c.Duration("ttl"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockwallet 在运行中的守护进程锁定钱包
+func lockwallet(c *cli.Context) error {
+
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.LockWalletFlow(c.Bool("all"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbmigratestatus 查看数据库结构版本
+func dbmigratestatus(c *cli.Context) error {
+
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.DBMigrateStatusFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbmigrateup 执行数据库迁移
+func dbmigrateup(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.DBMigrateUpFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbcompact 压缩数据库
+func dbcompact(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.DBCompactFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbverify 校验数据库
+func dbverify(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.DBVerifyFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbexport 导出数据库
+func dbexport(c *cli.Context) error {
+
+	if cli := getQueryCLI(c); cli != nil {
+		defer cli.Close()
+		err := cli.DBExportFlow(c.String("format"), c.String("out"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbprune 归档并删除旧的汇总日志
+func dbprune(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.DBPruneFlow(c.String("before"), c.String("out"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configshow 打印配置，不需要打开数据库
+func configshow(c *cli.Context) error {
+
+	err := openwcli.ShowConfigFlow(c.GlobalString("conf"), c.Bool("effective"))
+	if err != nil {
+		log.Error("unexpected error: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// exporttx 导出未签名交易文件
+func exporttx(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.ExportTxFlow(c.String("type"), c.String("out"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signtx 离线签名交易文件
+func signtx(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.SignTxFlow(c.String("in"), c.String("out"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// submittx 广播已签名交易文件
+func submittx(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.SubmitTxFlow(c.String("in"))
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renamewallet 修改钱包别名
+func renamewallet(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.RenameWalletFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// archivewallet 归档钱包
+func archivewallet(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.ArchiveWalletFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unarchivewallet 恢复归档钱包
+func unarchivewallet(c *cli.Context) error {
+
+	if cli := getCLI(c); cli != nil {
+		err := cli.UnarchiveWalletFlow()
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -47,5 +47,122 @@ var (
 	ConfFlag = cli.StringFlag{
 		Name: "conf, c",
 		Usage: "config file path",
+		EnvVar: "OPENW_CONF",
+	}
+
+	TTLFlag = cli.DurationFlag{
+		Name: "ttl",
+		Usage: "unlocked wallet session time to live, such as 2h, default use unlockttl of config",
+	}
+
+	ListenFlag = cli.StringFlag{
+		Name: "listen, l",
+		Usage: "listen address, such as :9088",
+	}
+
+	MethodFlag = cli.StringFlag{
+		Name: "method, m",
+		Usage: "route method name",
+	}
+
+	ParamsFlag = cli.StringFlag{
+		Name: "params",
+		Usage: "route params in JSON object",
+	}
+
+	LocalNodeFlag = cli.BoolFlag{
+		Name: "local",
+		Usage: "start transmit node in the same process and connect to local trusted server",
+	}
+
+	AllFlag = cli.BoolFlag{
+		Name: "all, a",
+		Usage: "show all records",
+	}
+
+	OutFlag = cli.StringFlag{
+		Name: "out, o",
+		Usage: "output file path",
+	}
+
+	InFlag = cli.StringFlag{
+		Name: "in",
+		Usage: "input file path",
+	}
+
+	MnemonicFlag = cli.BoolFlag{
+		Name: "mnemonic",
+		Usage: "create wallet with BIP39 mnemonic",
+	}
+
+	OutDirFlag = cli.StringFlag{
+		Name: "outdir",
+		Usage: "output directory, each share is saved to a separate file",
+	}
+
+	SharesFlag = cli.IntFlag{
+		Name: "shares",
+		Usage: "total number of shares",
+		Value: 5,
+	}
+
+	ThresholdFlag = cli.IntFlag{
+		Name: "threshold",
+		Usage: "number of shares required to recover",
+		Value: 3,
+	}
+
+	UpgradeFlag = cli.BoolFlag{
+		Name: "upgrade",
+		Usage: "re-encrypt keys with weak scrypt parameters, password is not changed",
+	}
+
+	ScryptNFlag = cli.IntFlag{
+		Name: "scryptn",
+		Usage: "scrypt N parameter required for keystore, 1<<19 uses 512MB memory to unlock",
+		Value: 1 << 19,
+	}
+
+	ScryptPFlag = cli.IntFlag{
+		Name: "scryptp",
+		Usage: "scrypt P parameter required for keystore",
+		Value: 1,
+	}
+
+	TxTypeFlag = cli.StringFlag{
+		Name: "type",
+		Usage: "transaction type: transfer, summary or triggerABI",
+		Value: "transfer",
+	}
+
+	FormatFlag = cli.StringFlag{
+		Name: "format",
+		Usage: "export format, only json is supported",
+		Value: "json",
+	}
+
+	UnlockFlag = cli.BoolFlag{
+		Name: "unlock",
+		Usage: "unlock local wallets by entering passwords when daemon starts",
+	}
+
+	ProbeFlag = cli.StringFlag{
+		Name: "probe",
+		Usage: "exit with error when daemon is not live or not ready: live, ready",
+	}
+
+	BeforeFlag = cli.StringFlag{
+		Name: "before",
+		Usage: "prune records created before a date (2006-01-02) or a duration ago (720h)",
+	}
+
+	LockAllFlag = cli.BoolFlag{
+		Name: "all, a",
+		Usage: "lock all unlocked wallets",
+	}
+
+	EffectiveFlag = cli.BoolFlag{
+		Name: "effective",
+		Usage: "print the configuration merged with OPENW_* environment variables and secret files",
 	}
 )
@@ -11,8 +11,12 @@ require (
 	github.com/blocktree/openwallet/v2 v2.4.3
 	github.com/bndr/gotabulate v1.1.2
 	github.com/google/uuid v1.2.0
+	github.com/miekg/pkcs11 v1.1.1
+	github.com/mr-tron/base58 v1.2.0
 	github.com/shopspring/decimal v0.0.0-20200105231215-408a2507e114
+	github.com/tyler-smith/go-bip39 v1.1.0
 	go.etcd.io/bbolt v1.3.3
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	gopkg.in/urfave/cli.v1 v1.20.0
 )
 
@@ -0,0 +1,644 @@
+package openwcli
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+const (
+	//管理接口默认的本地socket，在datadir
+	adminSocketName = "openw-admin.sock"
+
+	//JSON-RPC请求路径
+	adminRPCPath = "/rpc"
+
+	//请求内容的最大长度
+	adminMaxBodySize = 1 << 20
+
+	//通过管理接口发起的审批请求的来源
+	adminPeerID = "admin"
+)
+
+// JSON-RPC 2.0 错误码
+const (
+	AdminErrorParse          = int64(-32700)
+	AdminErrorInvalidRequest = int64(-32600)
+	AdminErrorMethodNotFound = int64(-32601)
+	AdminErrorInvalidParams  = int64(-32602)
+	AdminErrorServer         = int64(-32000)
+)
+
+// AdminError 管理接口的错误，业务错误使用openwallet或本工具的错误码
+type AdminError struct {
+	Code    int64       `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Error 错误信息
+func (e *AdminError) Error() string {
+	return e.Message
+}
+
+// AdminMethod 管理接口方法，params为请求的原始参数
+type AdminMethod func(params json.RawMessage) (interface{}, error)
+
+// adminRoute 已注册的管理接口方法及需要的权限，权限与授信服务路由使用相同的开关
+type adminRoute struct {
+	method     AdminMethod
+	permission TrustPermission
+}
+
+// adminRequest JSON-RPC请求
+type adminRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// adminResponse JSON-RPC响应
+type adminResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *AdminError     `json:"error,omitempty"`
+}
+
+// RegisterAdminMethod 注册管理接口方法，同名方法会被覆盖，permission对应enablerequesttransfer等开关
+func (cli *CLI) RegisterAdminMethod(name string, method AdminMethod, permission TrustPermission) error {
+
+	if len(name) == 0 {
+		return fmt.Errorf("admin method name is empty")
+	}
+
+	if method == nil {
+		return fmt.Errorf("admin method: %s is nil", name)
+	}
+
+	cli.routeMu.Lock()
+	cli.adminMethods[name] = &adminRoute{
+		method:     method,
+		permission: permission,
+	}
+	cli.routeMu.Unlock()
+
+	return nil
+}
+
+// getAdminMethod 查找管理接口方法
+func (cli *CLI) getAdminMethod(name string) *adminRoute {
+	cli.routeMu.RLock()
+	defer cli.routeMu.RUnlock()
+	return cli.adminMethods[name]
+}
+
+// checkAdminPermission 检查本节点是否开启了方法需要的权限
+func (cli *CLI) checkAdminPermission(permission TrustPermission) *AdminError {
+
+	var enable bool
+	switch permission {
+	case TrustPermissionNone:
+		enable = true
+	case TrustPermissionTransfer:
+		enable = cli.config.enablerequesttransfer
+	case TrustPermissionExecuteSummaryTask:
+		enable = cli.config.enableexecutesummarytask
+	case TrustPermissionEditSummarySettings:
+		enable = cli.config.enableeditsummarysettings
+	}
+
+	if !enable {
+		return &AdminError{Code: int64(ErrorNodeAbilityDisabled), Message: fmt.Sprintf("the node has disabled [%s] ability", permission)}
+	}
+
+	return nil
+}
+
+// adminSocket 管理接口的本地socket路径
+func (cli *CLI) adminSocket() string {
+	if len(cli.config.adminsocket) > 0 {
+		return cli.config.adminsocket
+	}
+	return filepath.Join(cli.config.datadir, adminSocketName)
+}
+
+// ServeAdminAPI 在本地socket启动管理接口，配置adminlisten时同时监听TCP，TCP必须配置admintoken和TLS证书
+func (cli *CLI) ServeAdminAPI() error {
+
+	if len(cli.config.adminlisten) > 0 {
+		if len(cli.config.admintoken) == 0 {
+			return fmt.Errorf("admintoken is required when adminlisten is set")
+		}
+		//token和钱包密码不能明文传输
+		if len(cli.config.admintlscert) == 0 || len(cli.config.admintlskey) == 0 {
+			return fmt.Errorf("admintlscert and admintlskey are required when adminlisten is set")
+		}
+	}
+
+	listener, err := listenUnixSocket(cli.adminSocket())
+	if err != nil {
+		return err
+	}
+	cli.serveAdminListener(listener, len(cli.config.admintoken) > 0, false)
+
+	log.Infof("Admin API is serving on %s", cli.adminSocket())
+
+	if len(cli.config.adminlisten) > 0 {
+		tcpListener, err := net.Listen("tcp", cli.config.adminlisten)
+		if err != nil {
+			cli.CloseAdminAPI()
+			return err
+		}
+		cli.serveAdminListener(tcpListener, true, true)
+
+		log.Infof("Admin API is serving on %s", tcpListener.Addr())
+	}
+
+	return nil
+}
+
+// serveAdminListener 在监听上启动管理接口服务，useTLS为true时使用admintlscert和admintlskey
+func (cli *CLI) serveAdminListener(listener net.Listener, requireToken, useTLS bool) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(adminRPCPath, func(w http.ResponseWriter, r *http.Request) {
+		if requireToken && !cli.checkAdminToken(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !cli.beginDaemonRequest() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		defer cli.endDaemonRequest()
+		cli.serveAdminRPC(w, r)
+	})
+
+	server := &http.Server{
+		Handler:     mux,
+		ReadTimeout: time.Duration(cli.config.requesttimeout) * time.Second,
+	}
+
+	cli.adminServers = append(cli.adminServers, server)
+
+	go func() {
+		var err error
+		if useTLS {
+			err = server.ServeTLS(listener, cli.config.admintlscert, cli.config.admintlskey)
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("admin API on %s stopped, unexpected error: %v", listener.Addr(), err)
+		}
+	}()
+}
+
+// CloseAdminAPI 关闭管理接口
+func (cli *CLI) CloseAdminAPI() {
+	for _, server := range cli.adminServers {
+		server.Close()
+	}
+	cli.adminServers = nil
+}
+
+// checkAdminToken 检查请求头的Authorization: Bearer <admintoken>
+func (cli *CLI) checkAdminToken(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(cli.config.admintoken)) == 1
+}
+
+// serveAdminRPC 处理JSON-RPC请求
+func (cli *CLI) serveAdminRPC(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req adminRequest
+	resp := &adminResponse{JSONRPC: "2.0"}
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminMaxBodySize)).Decode(&req)
+	if err != nil {
+		resp.Error = &AdminError{Code: AdminErrorParse, Message: err.Error()}
+	} else {
+		resp.ID = req.ID
+		resp.Result, resp.Error = cli.callAdminMethod(&req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// callAdminMethod 调用管理接口方法，转换错误码
+func (cli *CLI) callAdminMethod(req *adminRequest) (interface{}, *AdminError) {
+
+	if req.JSONRPC != "2.0" || len(req.Method) == 0 {
+		return nil, &AdminError{Code: AdminErrorInvalidRequest, Message: "invalid JSON-RPC 2.0 request"}
+	}
+
+	route := cli.getAdminMethod(req.Method)
+	if route == nil {
+		return nil, &AdminError{Code: AdminErrorMethodNotFound, Message: fmt.Sprintf("method: %s is not found", req.Method)}
+	}
+
+	if err := cli.checkAdminPermission(route.permission); err != nil {
+		return nil, err
+	}
+
+	log.Debugf("admin API call: %s", req.Method)
+
+	result, err := route.method(req.Params)
+	if err != nil {
+		switch e := err.(type) {
+		case *AdminError:
+			return nil, e
+		case *openwallet.Error:
+			return nil, &AdminError{Code: int64(e.Code()), Message: e.Error()}
+		default:
+			return nil, &AdminError{Code: AdminErrorServer, Message: err.Error()}
+		}
+	}
+
+	return result, nil
+}
+
+// decodeAdminParams 解析请求参数，没有参数时使用默认值
+func decodeAdminParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	err := json.Unmarshal(params, v)
+	if err != nil {
+		return &AdminError{Code: AdminErrorInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// requireAdminParams 检查必填参数，参数按名称和值成对传入
+func requireAdminParams(pairs ...string) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if len(pairs[i+1]) == 0 {
+			return &AdminError{Code: AdminErrorInvalidParams, Message: fmt.Sprintf("%s is required", pairs[i])}
+		}
+	}
+	return nil
+}
+
+// adminAccountParams 钱包账户参数
+type adminAccountParams struct {
+	WalletID  string `json:"walletID"`
+	AccountID string `json:"accountID"`
+	Symbol    string `json:"symbol"`
+	CoinType  int    `json:"coinType"`
+	LastID    int64  `json:"lastID"`
+	Limit     int64  `json:"limit"`
+}
+
+// adminTransferParams 转账参数，与sendTransactionViaTrustNode一致
+type adminTransferParams struct {
+	AccountID       string `json:"accountID"`
+	Symbol          string `json:"symbol"`
+	Sid             string `json:"sid"`
+	ContractAddress string `json:"contractAddress"`
+	Address         string `json:"address"`
+	Amount          string `json:"amount"`
+	FeeRate         string `json:"feeRate"`
+	Memo            string `json:"memo"`
+	ExtParam        string `json:"extParam"`
+	Password        string `json:"password"`
+}
+
+// adminSummaryParams 汇总任务参数，与startSummaryTaskViaTrustNode一致
+type adminSummaryParams struct {
+	SummaryTask *openwsdk.SummaryTask `json:"summaryTask"`
+	OperateType int64                 `json:"operateType"`
+	CycleSec    int64                 `json:"cycleSec"`
+	WalletID    string                `json:"walletID"`
+	AccountID   string                `json:"accountID"`
+	Offset      int64                 `json:"offset"`
+	Limit       int64                 `json:"limit"`
+}
+
+// adminTrustAddressParams 信任地址参数
+type adminTrustAddressParams struct {
+	Symbol string `json:"symbol"`
+}
+
+// registerDefaultAdminMethods 注册内置的管理接口方法，
+// 信任地址名单是转账的限制，与转账使用同一个token时不能起到保护作用，只提供查询，修改只能在本地执行命令
+func (cli *CLI) registerDefaultAdminMethods() {
+
+	//钱包、账户、地址和余额
+	cli.RegisterAdminMethod("listWallets", cli.adminListWallets, TrustPermissionNone)
+	cli.RegisterAdminMethod("listAccounts", cli.adminListAccounts, TrustPermissionNone)
+	cli.RegisterAdminMethod("listAddresses", cli.adminListAddresses, TrustPermissionNone)
+	cli.RegisterAdminMethod("getAccountBalance", cli.adminGetAccountBalance, TrustPermissionNone)
+	cli.RegisterAdminMethod("listTokenBalances", cli.adminListTokenBalances, TrustPermissionNone)
+	cli.RegisterAdminMethod("listAddressBalances", cli.adminListAddressBalances, TrustPermissionNone)
+
+	//转账
+	cli.RegisterAdminMethod("transfer", cli.adminTransfer, TrustPermissionTransfer)
+	cli.RegisterAdminMethod("getPendingTransfer", cli.adminGetPendingTransfer, TrustPermissionNone)
+
+	//汇总任务
+	cli.RegisterAdminMethod("startSummaryTask", cli.adminStartSummaryTask, TrustPermissionExecuteSummaryTask)
+	cli.RegisterAdminMethod("stopSummaryTask", cli.adminStopSummaryTask, TrustPermissionExecuteSummaryTask)
+	cli.RegisterAdminMethod("appendSummaryTask", cli.adminAppendSummaryTask, TrustPermissionExecuteSummaryTask)
+	cli.RegisterAdminMethod("removeSummaryTask", cli.adminRemoveSummaryTask, TrustPermissionExecuteSummaryTask)
+	cli.RegisterAdminMethod("getSummaryTask", cli.adminGetSummaryTask, TrustPermissionNone)
+	cli.RegisterAdminMethod("getSummaryTaskLog", cli.adminGetSummaryTaskLog, TrustPermissionNone)
+
+	//信任地址名单
+	cli.RegisterAdminMethod("listTrustAddresses", cli.adminListTrustAddresses, TrustPermissionNone)
+	cli.RegisterAdminMethod("getTrustAddressStatus", cli.adminGetTrustAddressStatus, TrustPermissionNone)
+}
+
+func (cli *CLI) adminListWallets(params json.RawMessage) (interface{}, error) {
+	return cli.GetWalletsOnServer()
+}
+
+func (cli *CLI) adminListAccounts(params json.RawMessage) (interface{}, error) {
+
+	var p adminAccountParams
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := requireAdminParams("walletID", p.WalletID); err != nil {
+		return nil, err
+	}
+
+	return cli.GetAccountsOnServer(p.WalletID)
+}
+
+func (cli *CLI) adminListAddresses(params json.RawMessage) (interface{}, error) {
+
+	p := adminAccountParams{Limit: 100}
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := requireAdminParams("walletID", p.WalletID, "accountID", p.AccountID, "symbol", p.Symbol); err != nil {
+		return nil, err
+	}
+
+	return cli.GetAddressesOnServer(p.WalletID, p.AccountID, p.Symbol, p.LastID, p.Limit)
+}
+
+func (cli *CLI) adminGetAccountBalance(params json.RawMessage) (interface{}, error) {
+
+	var p adminAccountParams
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := requireAdminParams("accountID", p.AccountID, "symbol", p.Symbol); err != nil {
+		return nil, err
+	}
+
+	return cli.GetAccountByAccountID(p.Symbol, p.AccountID)
+}
+
+func (cli *CLI) adminListTokenBalances(params json.RawMessage) (interface{}, error) {
+
+	var p adminAccountParams
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := requireAdminParams("walletID", p.WalletID, "accountID", p.AccountID, "symbol", p.Symbol); err != nil {
+		return nil, err
+	}
+
+	return cli.GetAllTokenContractBalance(p.WalletID, p.AccountID, p.Symbol)
+}
+
+func (cli *CLI) adminListAddressBalances(params json.RawMessage) (interface{}, error) {
+
+	p := adminAccountParams{Limit: 100}
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := requireAdminParams("walletID", p.WalletID, "accountID", p.AccountID, "symbol", p.Symbol); err != nil {
+		return nil, err
+	}
+
+	return cli.GetAddressesBalance(p.WalletID, p.AccountID, p.Symbol, p.CoinType, int(p.LastID), int(p.Limit))
+}
+
+// adminTransfer 转账，目标地址需要在信任名单内，超过阈值的转账进入审批队列
+func (cli *CLI) adminTransfer(params json.RawMessage) (interface{}, error) {
+
+	var p adminTransferParams
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := requireAdminParams("accountID", p.AccountID, "symbol", p.Symbol, "address", p.Address, "amount", p.Amount); err != nil {
+		return nil, err
+	}
+
+	if cli.config.rejectpasswordparam && len(p.Password) > 0 {
+		return nil, &AdminError{Code: int64(ErrorPasswordParamRejected), Message: "the node rejects request carrying password, please unlock wallet on local node"}
+	}
+
+	account, err := cli.GetAccountByAccountID(p.Symbol, p.AccountID)
+	if err != nil {
+		return nil, &AdminError{Code: int64(openwallet.ErrAccountNotFound), Message: err.Error()}
+	}
+
+	wallet, err := cli.GetWalletByWalletID(account.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	//超过阈值的转账等待人工审批，数量不能解析时拒绝
+	amountDec, err := parseTransferAmount(p.Amount)
+	if err != nil {
+		return nil, err
+	}
+	needApproval, err := cli.isNeedApproval(p.Symbol, p.ContractAddress, amountDec)
+	if err != nil {
+		return nil, err
+	}
+	if needApproval {
+		pending := &PendingTransfer{
+			Type:            PendingTypeTransfer,
+			PeerID:          adminPeerID,
+			Sid:             p.Sid,
+			WalletID:        wallet.WalletID,
+			AccountID:       p.AccountID,
+			Symbol:          p.Symbol,
+			ContractAddress: p.ContractAddress,
+			Address:         p.Address,
+			Amount:          p.Amount,
+			FeeRate:         p.FeeRate,
+			Memo:            p.Memo,
+			ExtParam:        p.ExtParam,
+		}
+		err = cli.SavePendingTransfer(pending)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Infof("[%s] request from %s is waiting for approval, pending ID: %s", pending.Type, pending.PeerID, pending.ID)
+
+		return nil, &AdminError{
+			Code:    int64(ErrorTransferIsPending),
+			Message: "the request is waiting for approval",
+			Data: map[string]interface{}{
+				"pendingID": pending.ID,
+				"status":    pending.Status,
+			},
+		}
+	}
+
+	retTx, retFailed, exErr := cli.TransferExt(wallet, account, p.Symbol, p.ContractAddress, p.Address, p.Amount, p.Sid, p.FeeRate, p.Memo, p.ExtParam, p.Password)
+	if exErr != nil {
+		return nil, exErr
+	}
+
+	return map[string]interface{}{
+		"failure": retFailed,
+		"success": retTx,
+	}, nil
+}
+
+// adminGetPendingTransfer 查询审批请求的状态和结果
+func (cli *CLI) adminGetPendingTransfer(params json.RawMessage) (interface{}, error) {
+
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := requireAdminParams("id", p.ID); err != nil {
+		return nil, err
+	}
+
+	return cli.GetPendingTransfer(p.ID)
+}
+
+func (cli *CLI) adminStartSummaryTask(params json.RawMessage) (interface{}, error) {
+
+	p := adminSummaryParams{OperateType: openwsdk.SummaryTaskOperateTypeReset}
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.SummaryTask == nil {
+		return nil, &AdminError{Code: AdminErrorInvalidParams, Message: "summaryTask is required"}
+	}
+
+	if err := cli.checkAdminSummaryPasswords(p.SummaryTask); err != nil {
+		return nil, err
+	}
+
+	if exErr := cli.StartSummaryTask(p.SummaryTask, p.OperateType, time.Duration(p.CycleSec)*time.Second); exErr != nil {
+		return nil, exErr
+	}
+
+	return true, nil
+}
+
+func (cli *CLI) adminStopSummaryTask(params json.RawMessage) (interface{}, error) {
+	cli.StopSummaryTask()
+	return true, nil
+}
+
+func (cli *CLI) adminAppendSummaryTask(params json.RawMessage) (interface{}, error) {
+
+	var p adminSummaryParams
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.SummaryTask == nil {
+		return nil, &AdminError{Code: AdminErrorInvalidParams, Message: "summaryTask is required"}
+	}
+
+	if err := cli.checkAdminSummaryPasswords(p.SummaryTask); err != nil {
+		return nil, err
+	}
+
+	if exErr := cli.AppendSummaryTask(p.SummaryTask); exErr != nil {
+		return nil, exErr
+	}
+
+	return true, nil
+}
+
+func (cli *CLI) adminRemoveSummaryTask(params json.RawMessage) (interface{}, error) {
+
+	var p adminSummaryParams
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := requireAdminParams("walletID", p.WalletID); err != nil {
+		return nil, err
+	}
+
+	if exErr := cli.RemoveSummaryTask(p.WalletID, p.AccountID); exErr != nil {
+		return nil, exErr
+	}
+
+	return true, nil
+}
+
+func (cli *CLI) adminGetSummaryTask(params json.RawMessage) (interface{}, error) {
+	task, exErr := cli.CurrentSummaryTask()
+	if exErr != nil {
+		return nil, exErr
+	}
+	return task, nil
+}
+
+func (cli *CLI) adminGetSummaryTaskLog(params json.RawMessage) (interface{}, error) {
+
+	p := adminSummaryParams{Limit: 100}
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	return cli.GetSummaryTaskLog(p.Offset, p.Limit)
+}
+
+// checkAdminSummaryPasswords 汇总任务参数是否传入密码，没有密码使用已解锁的钱包会话
+func (cli *CLI) checkAdminSummaryPasswords(summaryTask *openwsdk.SummaryTask) error {
+	if !cli.config.rejectpasswordparam {
+		return nil
+	}
+	for _, w := range summaryTask.Wallets {
+		if len(w.Password) > 0 {
+			return &AdminError{Code: int64(ErrorPasswordParamRejected), Message: "the node rejects request carrying password, please unlock wallet on local node"}
+		}
+	}
+	return nil
+}
+
+func (cli *CLI) adminListTrustAddresses(params json.RawMessage) (interface{}, error) {
+
+	var p adminTrustAddressParams
+	if err := decodeAdminParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	return cli.ListTrustAddress(strings.ToUpper(p.Symbol))
+}
+
+func (cli *CLI) adminGetTrustAddressStatus(params json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"enabled": cli.TrustAddressStatus(),
+	}, nil
+}
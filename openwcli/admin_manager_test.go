@@ -0,0 +1,117 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+)
+
+func testAdminCall(cli *CLI, body string) *adminResponse {
+	req := httptest.NewRequest(http.MethodPost, adminRPCPath, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	cli.serveAdminRPC(w, req)
+
+	var resp adminResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return &resp
+}
+
+func TestCLI_AdminRPC(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	cli.adminMethods = make(map[string]*adminRoute)
+	cli.registerDefaultAdminMethods()
+
+	resp := testAdminCall(cli, `{"jsonrpc":"2.0","id":1,"method":"notExist"}`)
+	if resp.Error == nil || resp.Error.Code != AdminErrorMethodNotFound {
+		t.Errorf("call not exist method response is not match: %+v", resp)
+		return
+	}
+
+	resp = testAdminCall(cli, `{"jsonrpc":"2.0","id":1,"method":"listAccounts","params":{}}`)
+	if resp.Error == nil || resp.Error.Code != AdminErrorInvalidParams {
+		t.Errorf("call without required params response is not match: %+v", resp)
+		return
+	}
+
+	resp = testAdminCall(cli, `{"jsonrpc":"2.0","id":1,"method":`)
+	if resp.Error == nil || resp.Error.Code != AdminErrorParse {
+		t.Errorf("call with invalid json response is not match: %+v", resp)
+		return
+	}
+
+	//信任地址名单只能本地修改，管理接口只能查询
+	cli.getDB()
+	cli.db.Save(openwsdk.NewTrustAddress("addr1", "BTC", ""))
+	cli.closeDB()
+
+	for _, method := range []string{"addTrustAddress", "removeTrustAddress", "enableTrustAddress", "disableTrustAddress"} {
+		resp = testAdminCall(cli, `{"jsonrpc":"2.0","id":2,"method":"`+method+`","params":{"address":"addr1","symbol":"btc"}}`)
+		if resp.Error == nil || resp.Error.Code != AdminErrorMethodNotFound {
+			t.Errorf("%s should not be served by admin API: %+v", method, resp)
+			return
+		}
+	}
+
+	resp = testAdminCall(cli, `{"jsonrpc":"2.0","id":3,"method":"getTrustAddressStatus"}`)
+	if resp.Error != nil || string(resp.ID) != "3" {
+		t.Errorf("getTrustAddressStatus response is not match: %+v", resp.Error)
+		return
+	}
+
+	//本节点没有开启转账权限
+	cli.config.enablerequesttransfer = false
+	resp = testAdminCall(cli, `{"jsonrpc":"2.0","id":4,"method":"transfer","params":{"accountID":"A1","symbol":"BTC","address":"addr1","amount":"0.1","sid":"1"}}`)
+	if resp.Error == nil || resp.Error.Code != int64(ErrorNodeAbilityDisabled) {
+		t.Errorf("transfer should be rejected when enablerequesttransfer is off: %+v", resp)
+		return
+	}
+
+	//自定义方法
+	cli.RegisterAdminMethod("echo", func(params json.RawMessage) (interface{}, error) {
+		return params, nil
+	}, TrustPermissionNone)
+	resp = testAdminCall(cli, `{"jsonrpc":"2.0","id":5,"method":"echo","params":"hello"}`)
+	if resp.Error != nil || resp.Result != "hello" {
+		t.Errorf("custom method response is not match: %+v", resp)
+		return
+	}
+}
+
+func TestCLI_AdminToken(t *testing.T) {
+
+	cli := &CLI{config: &Config{admintoken: "secret"}}
+
+	req := httptest.NewRequest(http.MethodPost, adminRPCPath, nil)
+	if cli.checkAdminToken(req) {
+		t.Errorf("request without token should be rejected")
+		return
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	if cli.checkAdminToken(req) {
+		t.Errorf("request with wrong token should be rejected")
+		return
+	}
+
+	req.Header.Set("Authorization", "Bearer secret")
+	if !cli.checkAdminToken(req) {
+		t.Errorf("request with token should be accepted")
+		return
+	}
+}
+
+func TestCLI_AdminAPIRequireTLS(t *testing.T) {
+
+	cli := &CLI{config: &Config{adminlisten: "127.0.0.1:0", admintoken: "secret"}}
+	if err := cli.ServeAdminAPI(); err == nil {
+		t.Errorf("admin API on TCP should require TLS certificate")
+		return
+	}
+}
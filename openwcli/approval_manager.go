@@ -0,0 +1,497 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/common"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/owtp"
+	"github.com/bndr/gotabulate"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	//授信服务接收审批结果的路由
+	pendingTransferResultMethod = "pendingTransferResult"
+)
+
+// parseTransferAmount 解析转账数量，不能解析或为负数时返回错误，不能当作0处理
+func parseTransferAmount(amount string) (decimal.Decimal, error) {
+	amountDec, err := decimal.NewFromString(amount)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("amount: %s is invalid", amount)
+	}
+	if amountDec.IsNegative() {
+		return decimal.Zero, fmt.Errorf("amount: %s can not be negative", amount)
+	}
+	return amountDec, nil
+}
+
+// approvalThreshold 查找币种或合约的审批阈值，没有对应配置时使用不带币种的默认阈值，found为false表示都没有配置
+func (cli *CLI) approvalThreshold(symbol, contractAddress string) (threshold decimal.Decimal, found bool, err error) {
+
+	var (
+		defaultThreshold decimal.Decimal
+		hasDefault       bool
+	)
+
+	//格式：默认阈值,币种:阈值,币种/合约地址:阈值
+	for _, item := range strings.Split(cli.config.transferapprovalthreshold, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		key, value := "", item
+		if i := strings.LastIndex(item, ":"); i >= 0 {
+			key, value = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+
+		amount, parseErr := parseTransferAmount(value)
+		if parseErr != nil {
+			return decimal.Zero, false, fmt.Errorf("transferapprovalthreshold is invalid: %v", parseErr)
+		}
+
+		if len(key) == 0 {
+			defaultThreshold, hasDefault = amount, true
+			continue
+		}
+
+		keySymbol, keyContract := key, ""
+		if i := strings.Index(key, "/"); i >= 0 {
+			keySymbol, keyContract = strings.TrimSpace(key[:i]), strings.TrimSpace(key[i+1:])
+		}
+
+		//代币只匹配合约地址的阈值，主链币只匹配币种的阈值
+		if strings.EqualFold(keySymbol, symbol) && strings.EqualFold(keyContract, contractAddress) {
+			threshold, found = amount, true
+		}
+	}
+
+	if found {
+		return threshold, true, nil
+	}
+	return defaultThreshold, hasDefault, nil
+}
+
+// isNeedApproval 转账数量是否需要人工审批，阈值按币种或合约查找，没有配置阈值的币种全部需要审批，审批阈值不能解析时返回错误
+func (cli *CLI) isNeedApproval(symbol, contractAddress string, amount decimal.Decimal) (bool, error) {
+	if !cli.config.enabletransferapproval {
+		return false, nil
+	}
+	threshold, found, err := cli.approvalThreshold(symbol, contractAddress)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return true, nil
+	}
+	return amount.GreaterThan(threshold), nil
+}
+
+// isSigningNeedApproval 合约调用和哈希签名不能判断转账数量，开启审批时全部等待审批
+func (cli *CLI) isSigningNeedApproval() bool {
+	return cli.config.enabletransferapproval
+}
+
+// SavePendingTransfer 保存待审批的转账请求
+func (cli *CLI) SavePendingTransfer(pending *PendingTransfer) error {
+
+	isNew := len(pending.ID) == 0
+	if isNew {
+		pending.ID = uuid.New().String()
+	}
+	if len(pending.Status) == 0 {
+		pending.Status = PendingStatusPending
+	}
+	if pending.CreateTime == 0 {
+		pending.CreateTime = time.Now().Unix()
+	}
+	pending.UpdateTime = time.Now().Unix()
+
+	_, err := cli.getDB()
+	if err != nil {
+		return err
+	}
+	defer cli.closeDB()
+
+	err = cli.db.Save(pending)
+	if err != nil {
+		return err
+	}
+
+	if isNew && pending.Type == PendingTypeTransfer {
+		cli.Metrics().Inc(MetricTransfers, pending.Symbol, pending.ContractAddress, MetricStatusPending)
+	}
+
+	return nil
+}
+
+// GetPendingTransfer 查找审批请求
+func (cli *CLI) GetPendingTransfer(id string) (*PendingTransfer, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	var pending PendingTransfer
+	err = cli.db.One("ID", id, &pending)
+	if err != nil {
+		return nil, fmt.Errorf("can not find pending transfer: %s", id)
+	}
+	return &pending, nil
+}
+
+// ListPendingTransfer 审批请求列表，status为空查询全部
+func (cli *CLI) ListPendingTransfer(status string) ([]*PendingTransfer, error) {
+
+	var (
+		list []*PendingTransfer
+		err  error
+	)
+
+	_, err = cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	if len(status) == 0 {
+		err = cli.db.AllByIndex("CreateTime", &list)
+	} else {
+		err = cli.db.Find("Status", status, &list)
+	}
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+// changePendingTransferStatus 在同一个写事务中检查审批请求仍是待审批状态并修改状态，
+// 避免多个进程或管理接口同时审批同一个请求
+func (cli *CLI) changePendingTransferStatus(id, status, reason string) (*PendingTransfer, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	tx, err := cli.db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var pending PendingTransfer
+	err = tx.One("ID", id, &pending)
+	if err != nil {
+		return nil, fmt.Errorf("can not find pending transfer: %s", id)
+	}
+
+	if pending.Status != PendingStatusPending {
+		return nil, fmt.Errorf("pending transfer: %s has been %s", id, pending.Status)
+	}
+
+	pending.Status = status
+	pending.Reason = reason
+	pending.Notified = false
+	pending.UpdateTime = time.Now().Unix()
+
+	err = tx.Save(&pending)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pending, nil
+}
+
+// ApprovePendingTransfer 审批通过，执行转账或签名，结果等待回调授信服务
+func (cli *CLI) ApprovePendingTransfer(id, password string) (*PendingTransfer, error) {
+
+	//先把请求改为审批中，同一个请求只能被执行一次
+	pending, err := cli.changePendingTransferStatus(id, PendingStatusApproving, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+
+	switch pending.Type {
+	case PendingTypeTransfer:
+		result, err = cli.executePendingTransfer(pending, password)
+	case PendingTypeSignTransaction:
+		result, err = cli.executePendingSignTransaction(pending, password)
+	case PendingTypeTriggerABI:
+		result, err = cli.executePendingTriggerABI(pending, password)
+	case PendingTypeSignHash:
+		result, err = cli.executePendingSignHash(pending, password)
+	default:
+		err = fmt.Errorf("unknown pending transfer type: %s", pending.Type)
+	}
+
+	if err != nil {
+		pending.Status = PendingStatusFailed
+		pending.Reason = err.Error()
+	} else {
+		pending.Status = PendingStatusApproved
+		resultJSON, _ := json.Marshal(result)
+		pending.Result = string(resultJSON)
+	}
+	pending.Notified = false
+
+	saveErr := cli.SavePendingTransfer(pending)
+	if saveErr != nil {
+		return nil, saveErr
+	}
+
+	return pending, err
+}
+
+// RejectPendingTransfer 拒绝审批请求
+func (cli *CLI) RejectPendingTransfer(id, reason string) (*PendingTransfer, error) {
+	return cli.changePendingTransferStatus(id, PendingStatusRejected, reason)
+}
+
+// executePendingTransfer 执行已审批的转账
+func (cli *CLI) executePendingTransfer(pending *PendingTransfer, password string) (interface{}, error) {
+
+	account, err := cli.GetAccountByAccountID(pending.Symbol, pending.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := cli.GetWalletByWalletID(account.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	retTx, retFailed, exErr := cli.TransferExt(wallet, account, pending.Symbol, pending.ContractAddress,
+		pending.Address, pending.Amount, pending.Sid, pending.FeeRate, pending.Memo, pending.ExtParam, password)
+	if exErr != nil {
+		return nil, exErr
+	}
+
+	return map[string]interface{}{
+		"failure": retFailed,
+		"success": retTx,
+	}, nil
+}
+
+// executePendingSignTransaction 签名已审批的交易单
+func (cli *CLI) executePendingSignTransaction(pending *PendingTransfer, password string) (interface{}, error) {
+
+	var rawTx openwsdk.RawTransaction
+	err := json.Unmarshal([]byte(pending.RawTx), &rawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := cli.GetWalletByWalletID(pending.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := cli.getSignerKey(wallet, password)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := cli.signRawTransaction(&rawTx, key)
+	if err != nil {
+		return nil, err
+	}
+	rawTx.Signatures = signature
+
+	return map[string]interface{}{
+		"signedRawTx": rawTx,
+	}, nil
+}
+
+// pendingTriggerABIParams 待审批的合约调用参数
+type pendingTriggerABIParams struct {
+	ContractABI string   `json:"contractABI"`
+	AbiParam    []string `json:"abiParam"`
+	Raw         string   `json:"raw"`
+	RawType     uint64   `json:"rawType"`
+	AwaitResult bool     `json:"awaitResult"`
+}
+
+// pendingSignHashParams 待审批的哈希签名参数
+type pendingSignHashParams struct {
+	Message string `json:"message"`
+	HdPath  string `json:"hdPath"`
+	Rsv     bool   `json:"rsv"`
+}
+
+// setPendingParams 保存合约调用和哈希签名的请求参数
+func (pending *PendingTransfer) setPendingParams(params interface{}) {
+	data, _ := json.Marshal(params)
+	pending.Params = string(data)
+}
+
+// executePendingTriggerABI 执行已审批的合约调用
+func (cli *CLI) executePendingTriggerABI(pending *PendingTransfer, password string) (interface{}, error) {
+
+	var p pendingTriggerABIParams
+	err := json.Unmarshal([]byte(pending.Params), &p)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := cli.GetAccountByAccountID(pending.Symbol, pending.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := cli.GetWalletByWalletID(account.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	retTx, exErr := cli.TriggerABI(wallet, account, pending.Symbol, pending.ContractAddress, p.ContractABI,
+		pending.Amount, pending.Sid, pending.FeeRate, password, p.AbiParam, p.Raw, p.RawType, p.AwaitResult)
+	if exErr != nil {
+		return nil, exErr
+	}
+
+	return retTx, nil
+}
+
+// executePendingSignHash 执行已审批的哈希签名
+func (cli *CLI) executePendingSignHash(pending *PendingTransfer, password string) (interface{}, error) {
+
+	var p pendingSignHashParams
+	err := json.Unmarshal([]byte(pending.Params), &p)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := &openwsdk.Address{
+		AppID:     cli.config.appid,
+		WalletID:  pending.WalletID,
+		AccountID: pending.AccountID,
+		Symbol:    pending.Symbol,
+		Address:   pending.Address,
+		HdPath:    p.HdPath,
+	}
+
+	signature, err := cli.SignHash(addr, pending.Symbol, p.Message, password, p.Rsv)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"signature": signature,
+	}, nil
+}
+
+// notifyPendingTransferResults 把审批结果回调给发起请求的授信服务
+func (cli *CLI) notifyPendingTransferResults() {
+
+	if cli.transmitNode == nil {
+		return
+	}
+
+	var list []*PendingTransfer
+
+	_, err := cli.getDB()
+	if err != nil {
+		log.Errorf("cli database open failed")
+		return
+	}
+	cli.db.Select(
+		q.And(
+			q.Not(q.In("Status", []string{PendingStatusPending, PendingStatusApproving})),
+			q.Eq("Notified", false),
+		)).Find(&list)
+	cli.closeDB()
+
+	for _, pending := range list {
+
+		var (
+			notified bool
+			result   interface{}
+		)
+
+		//管理接口发起的请求通过getPendingTransfer查询结果
+		if pending.PeerID == adminPeerID {
+			continue
+		}
+
+		if len(pending.Result) > 0 {
+			json.Unmarshal([]byte(pending.Result), &result)
+		}
+
+		params := map[string]interface{}{
+			"appID":     cli.config.appid,
+			"pendingID": pending.ID,
+			"type":      pending.Type,
+			"sid":       pending.Sid,
+			"status":    pending.Status,
+			"reason":    pending.Reason,
+			"result":    result,
+		}
+
+		err = cli.transmitNode.Call(pending.PeerID, pendingTransferResultMethod, params,
+			true, func(resp owtp.Response) {
+				if resp.Status != owtp.StatusSuccess {
+					log.Errorf("notify pending transfer: %s result failed, unexpected error: %s", pending.ID, resp.Msg)
+					return
+				}
+				notified = true
+			})
+		if err != nil {
+			log.Debugf("notify pending transfer: %s result failed, unexpected error: %v", pending.ID, err)
+			continue
+		}
+
+		if notified {
+			pending.Notified = true
+			err = cli.SavePendingTransfer(pending)
+			if err != nil {
+				log.Errorf("update pending transfer: %s failed, unexpected error: %v", pending.ID, err)
+			}
+		}
+	}
+}
+
+// printPendingTransferList 打印审批请求列表
+func (cli *CLI) printPendingTransferList(list []*PendingTransfer) {
+
+	if len(list) == 0 {
+		fmt.Println("No pending transfer. ")
+		return
+	}
+
+	tableInfo := make([][]interface{}, 0)
+
+	for _, p := range list {
+		t := time.Unix(p.CreateTime, 0)
+		strTime := common.TimeFormat("2006-01-02 15:04:05", t)
+		tableInfo = append(tableInfo, []interface{}{
+			p.ID, p.Type, p.Status, p.Symbol, p.AccountID, p.Address, p.Amount, p.PeerID, strTime,
+		})
+	}
+
+	t := gotabulate.Create(tableInfo)
+	// Set Headers
+	t.SetHeaders([]string{"ID", "Type", "Status", "Symbol", "AccountID", "To Address", "Amount", "Request By", "CreateTime"})
+
+	//打印信息
+	fmt.Println(t.Render("simple"))
+}
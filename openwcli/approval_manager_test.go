@@ -0,0 +1,151 @@
+package openwcli
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCLI_IsNeedApproval(t *testing.T) {
+
+	cli := &CLI{config: &Config{
+		enabletransferapproval:    true,
+		transferapprovalthreshold: "10",
+	}}
+
+	//不能解析或负数的转账数量不能当作0跳过审批
+	for _, amount := range []string{"", "abc", "1e", "-1"} {
+		if _, err := parseTransferAmount(amount); err == nil {
+			t.Errorf("amount: %s should be invalid", amount)
+			return
+		}
+	}
+
+	need, err := cli.isNeedApproval("BTC", "", decimal.RequireFromString("10.1"))
+	if err != nil || !need {
+		t.Errorf("amount greater than threshold should need approval")
+		return
+	}
+
+	need, err = cli.isNeedApproval("BTC", "", decimal.RequireFromString("10"))
+	if err != nil || need {
+		t.Errorf("amount not greater than threshold should not need approval")
+		return
+	}
+
+	//按币种和合约配置阈值，代币不使用主链币的阈值
+	cli.config.transferapprovalthreshold = "BTC:1, ETH:10, ETH/0xdAC17F958D2ee523a2206206994597C13D831ec7:1000"
+	cases := []struct {
+		symbol   string
+		contract string
+		amount   string
+		need     bool
+	}{
+		{"BTC", "", "1", false},
+		{"BTC", "", "1.1", true},
+		{"eth", "", "10", false},
+		{"ETH", "0xdac17f958d2ee523a2206206994597c13d831ec7", "100", false},
+		{"ETH", "0xdac17f958d2ee523a2206206994597c13d831ec7", "1000.1", true},
+		//没有配置阈值的币种和合约全部需要审批
+		{"ETH", "0x6B175474E89094C44Da98b954EedeAC495271d0F", "1", true},
+		{"TRX", "", "0.1", true},
+	}
+	for _, c := range cases {
+		need, err = cli.isNeedApproval(c.symbol, c.contract, decimal.RequireFromString(c.amount))
+		if err != nil || need != c.need {
+			t.Errorf("%s %s amount: %s need approval: %v, expected: %v, err: %v", c.symbol, c.contract, c.amount, need, c.need, err)
+			return
+		}
+	}
+
+	//默认阈值用于没有单独配置的币种
+	cli.config.transferapprovalthreshold = "5,BTC:1"
+	need, err = cli.isNeedApproval("TRX", "", decimal.RequireFromString("5"))
+	if err != nil || need {
+		t.Errorf("amount not greater than default threshold should not need approval")
+		return
+	}
+
+	//阈值配置错误时拒绝
+	cli.config.transferapprovalthreshold = "ten"
+	_, err = cli.isNeedApproval("BTC", "", decimal.RequireFromString("1"))
+	if err == nil {
+		t.Errorf("invalid threshold should return error")
+		return
+	}
+
+	cli.config.transferapprovalthreshold = "BTC:one"
+	_, err = cli.isNeedApproval("ETH", "", decimal.RequireFromString("1"))
+	if err == nil {
+		t.Errorf("invalid symbol threshold should return error")
+		return
+	}
+
+	if !cli.isSigningNeedApproval() {
+		t.Errorf("contract call and hash signing should need approval")
+		return
+	}
+}
+
+func TestCLI_ApprovePendingTransferOnce(t *testing.T) {
+
+	cli, clean := getTestLocalCLI(t)
+	defer clean()
+	defer cli.Close()
+
+	pending := &PendingTransfer{
+		Type:     "unknown",
+		PeerID:   adminPeerID,
+		WalletID: "W123",
+		Amount:   "1",
+	}
+	err := cli.SavePendingTransfer(pending)
+	if err != nil {
+		t.Errorf("SavePendingTransfer unexpected error: %v", err)
+		return
+	}
+
+	//同时审批同一个请求，只能有一个进入执行
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		executed int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, approveErr := cli.ApprovePendingTransfer(pending.ID, "")
+			if approveErr != nil && strings.Contains(approveErr.Error(), "has been") {
+				return
+			}
+			mu.Lock()
+			executed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if executed != 1 {
+		t.Errorf("pending transfer executed %d times", executed)
+		return
+	}
+
+	result, err := cli.GetPendingTransfer(pending.ID)
+	if err != nil {
+		t.Errorf("GetPendingTransfer unexpected error: %v", err)
+		return
+	}
+	if result.Status != PendingStatusFailed {
+		t.Errorf("pending transfer status: %s is not failed", result.Status)
+		return
+	}
+
+	_, err = cli.RejectPendingTransfer(pending.ID, "reject")
+	if err == nil {
+		t.Errorf("finished pending transfer should not be rejected")
+		return
+	}
+}
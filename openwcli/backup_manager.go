@@ -0,0 +1,688 @@
+package openwcli
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/common/file"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	//备份文件格式版本
+	backupVersion = 1
+	//备份文件的加密参数
+	backupScryptN   = 1 << 18
+	backupScryptR   = 8
+	backupScryptP   = 1
+	backupKeyLength = 32
+
+	//解密时允许的scrypt参数上限，备份文件头不可信，避免构造的参数耗尽内存和CPU
+	backupScryptMaxN      = 1 << 20
+	backupScryptMaxR      = 32
+	backupScryptMaxP      = 16
+	backupScryptMaxMemory = 1 << 30
+
+	//备份文件中的分类
+	backupKindKey     = "key"
+	backupKindDB      = "db"
+	backupKindConfig  = "config"
+	backupKindDataKey = "datakey"
+
+	backupDirName = "backup"
+)
+
+// BackupManifest 备份清单，记录节点信息和所有文件的校验值
+type BackupManifest struct {
+	Version    int             `json:"version"`
+	AppID      string          `json:"appID"`
+	NodeID     string          `json:"nodeID"`
+	CreateTime int64           `json:"createTime"`
+	Wallets    []*BackupWallet `json:"wallets"`
+	Files      []*BackupFile   `json:"files"`
+}
+
+// BackupWallet 备份的钱包
+type BackupWallet struct {
+	WalletID string `json:"walletID"`
+	Alias    string `json:"alias"`
+	File     string `json:"file"`
+}
+
+// BackupFile 备份的文件
+type BackupFile struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// backupPayload 加密前的备份内容
+type backupPayload struct {
+	Manifest *BackupManifest   `json:"manifest"`
+	Files    map[string][]byte `json:"files"`
+}
+
+// backupArchive 备份文件，内容使用scrypt派生的密钥进行AES-GCM加密
+type backupArchive struct {
+	Version  int    `json:"version"`
+	KDF      string `json:"kdf"`
+	N        int    `json:"n"`
+	R        int    `json:"r"`
+	P        int    `json:"p"`
+	Salt     string `json:"salt"`
+	Nonce    string `json:"nonce"`
+	Checksum string `json:"checksum"` //明文的sha256
+	Data     []byte `json:"data"`
+}
+
+// BackupNode 备份keystore、数据库和配置文件到加密的备份文件
+func (cli *CLI) BackupNode(out, configFile, password string) (*BackupManifest, error) {
+
+	if len(password) == 0 {
+		return nil, fmt.Errorf("backup password is empty. ")
+	}
+
+	keychain, err := cli.GetKeychain()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &backupPayload{
+		Manifest: &BackupManifest{
+			Version:    backupVersion,
+			AppID:      cli.config.appid,
+			NodeID:     keychain.NodeID,
+			CreateTime: time.Now().Unix(),
+			Wallets:    make([]*BackupWallet, 0),
+			Files:      make([]*BackupFile, 0),
+		},
+		Files: make(map[string][]byte),
+	}
+
+	//keystore文件
+	wallets, err := openwallet.GetWalletsByKeyDir(cli.config.keydir)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range wallets {
+		name := filepath.Base(w.KeyFile)
+		err = payload.addFile(backupKindKey, name, w.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		payload.Manifest.Wallets = append(payload.Manifest.Wallets, &BackupWallet{
+			WalletID: w.WalletID,
+			Alias:    w.Alias,
+			File:     name,
+		})
+	}
+
+	//数据库文件，通过只读事务导出一致的快照
+	dbContent, err := cli.snapshotDB()
+	if err != nil {
+		return nil, err
+	}
+	payload.addContent(backupKindDB, cli.config.appid+".db", dbContent)
+
+	//数据密钥文件，没有它无法解密数据库中的keychain私钥，使用dbpassphrase时不需要
+	if len(cli.config.dbpassphrase) == 0 && file.Exists(cli.dataKeyFile()) {
+		err = payload.addFile(backupKindDataKey, dataKeyFileName, cli.dataKeyFile())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//配置文件
+	if len(configFile) > 0 {
+		err = payload.addFile(backupKindConfig, filepath.Base(configFile), configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	archive, err := encryptBackup(payload, password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(out, archive, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload.Manifest, nil
+}
+
+// RestoreNode 从备份文件恢复节点，先校验keychain、钱包和数据库，通过后才覆盖本地文件
+// 被覆盖的文件移动到datadir/backup/restore-时间 目录
+func (cli *CLI) RestoreNode(in, configFile, password string) (*BackupManifest, error) {
+
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := decryptBackup(data, password)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := payload.Manifest
+
+	if manifest.AppID != cli.config.appid {
+		return nil, fmt.Errorf("backup appID: %s is not match with config appID: %s", manifest.AppID, cli.config.appid)
+	}
+
+	//解压到临时目录校验
+	tmpDir, err := ioutil.TempDir(cli.config.datadir, "restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, f := range manifest.Files {
+		dir := filepath.Join(tmpDir, f.Kind)
+		file.MkdirAll(dir)
+		err = ioutil.WriteFile(filepath.Join(dir, f.Name), payload.Files[f.Kind+"/"+f.Name], 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = verifyBackupWallets(manifest, filepath.Join(tmpDir, backupKindKey))
+	if err != nil {
+		return nil, err
+	}
+
+	backupDBFile := filepath.Join(tmpDir, backupKindDB, manifest.AppID+".db")
+
+	//数据密钥来自备份的密钥文件，或者使用本地配置的dbpassphrase派生
+	var dataKey []byte
+	if content, exist := payload.Files[backupKindDataKey+"/"+dataKeyFileName]; exist {
+		dataKey, err = decodeDataKey(content)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(cli.config.dbpassphrase) > 0 {
+		dataKey, err = backupPassphraseKey(backupDBFile, cli.config.dbpassphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = verifyBackupDB(manifest, backupDBFile, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	//校验通过，覆盖本地文件前确认没有其它进程在使用数据库
+	if cli.db != nil {
+		return nil, fmt.Errorf("database is in use, please stop the running service first")
+	}
+
+	if isUnixSocketAlive(cli.daemonSocket()) {
+		return nil, fmt.Errorf("openw-cli daemon is running on %s, please stop the running service first", cli.daemonSocket())
+	}
+
+	//持有数据库文件锁直到替换完成，期间其它openw-cli进程无法打开数据库
+	if file.Exists(cli.dbFile()) {
+		lockDB, lockErr := cli.openDB(false)
+		if lockErr != nil {
+			return nil, lockErr
+		}
+		defer lockDB.Close()
+	}
+
+	files := make([]*restoreFile, 0)
+	for _, f := range manifest.Files {
+		var target string
+		switch f.Kind {
+		case backupKindKey:
+			target = filepath.Join(cli.config.keydir, f.Name)
+		case backupKindDB:
+			target = cli.dbFile()
+		case backupKindDataKey:
+			target = cli.dataKeyFile()
+		case backupKindConfig:
+			if len(configFile) == 0 {
+				continue
+			}
+			target = configFile
+		default:
+			continue
+		}
+		files = append(files, &restoreFile{
+			kind:    f.Kind,
+			target:  target,
+			content: payload.Files[f.Kind+"/"+f.Name],
+		})
+	}
+
+	oldDir := filepath.Join(cli.config.datadir, backupDirName, "restore-"+time.Now().Format("20060102150405"))
+
+	err = swapRestoreFiles(files, oldDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// restoreFile 恢复的文件
+type restoreFile struct {
+	kind    string
+	target  string
+	content []byte
+	//写入目标目录的临时文件
+	staged string
+	//被覆盖的原文件移动后的路径
+	moved string
+}
+
+// swapRestoreFiles 先把全部文件写入目标所在目录的临时文件，全部成功后再逐个替换，
+// 替换中途失败时还原已替换的文件，不会留下只恢复了一部分的节点
+func swapRestoreFiles(files []*restoreFile, oldDir string) (err error) {
+
+	defer func() {
+		for _, f := range files {
+			if len(f.staged) > 0 {
+				os.Remove(f.staged)
+			}
+		}
+	}()
+
+	for _, f := range files {
+		dir := filepath.Dir(f.target)
+		file.MkdirAll(dir)
+		tmp, tmpErr := ioutil.TempFile(dir, "."+filepath.Base(f.target)+".restore-*")
+		if tmpErr != nil {
+			return tmpErr
+		}
+		f.staged = tmp.Name()
+		_, err = tmp.Write(f.content)
+		if err == nil {
+			err = tmp.Sync()
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	replaced := make([]*restoreFile, 0, len(files))
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		//倒序还原已替换的文件
+		for i := len(replaced) - 1; i >= 0; i-- {
+			f := replaced[i]
+			os.Remove(f.target)
+			if len(f.moved) > 0 {
+				if rollbackErr := os.Rename(f.moved, f.target); rollbackErr != nil {
+					log.Errorf("Restore rollback: %s failed, original file is kept in %s: %v", f.target, f.moved, rollbackErr)
+				}
+			}
+		}
+	}()
+
+	for _, f := range files {
+		if file.Exists(f.target) {
+			file.MkdirAll(filepath.Join(oldDir, f.kind))
+			moved := filepath.Join(oldDir, f.kind, filepath.Base(f.target))
+			err = os.Rename(f.target, moved)
+			if err != nil {
+				return err
+			}
+			f.moved = moved
+		}
+		replaced = append(replaced, f)
+
+		err = os.Rename(f.staged, f.target)
+		if err != nil {
+			return err
+		}
+		f.staged = ""
+	}
+
+	for _, f := range replaced {
+		if len(f.moved) > 0 {
+			log.Infof("Existing file: %s has been moved to %s", f.target, f.moved)
+		}
+	}
+
+	return nil
+}
+
+// dbFile 数据库文件路径
+func (cli *CLI) dbFile() string {
+	return filepath.Join(cli.config.dbdir, cli.config.appid+".db")
+}
+
+// snapshotDB 导出数据库快照
+func (cli *CLI) snapshotDB() ([]byte, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	var buf bytes.Buffer
+	err = cli.db.Bolt.View(func(tx *bolt.Tx) error {
+		_, writeErr := tx.WriteTo(&buf)
+		return writeErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// addFile 读取文件加入备份
+func (payload *backupPayload) addFile(kind, name, path string) error {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	payload.addContent(kind, name, content)
+
+	return nil
+}
+
+// addContent 加入备份内容
+func (payload *backupPayload) addContent(kind, name string, content []byte) {
+
+	hash := sha256.Sum256(content)
+	payload.Files[kind+"/"+name] = content
+	payload.Manifest.Files = append(payload.Manifest.Files, &BackupFile{
+		Name:   name,
+		Kind:   kind,
+		Size:   int64(len(content)),
+		SHA256: hex.EncodeToString(hash[:]),
+	})
+}
+
+// verifyFiles 校验清单中所有文件的大小和sha256
+func (payload *backupPayload) verifyFiles() error {
+
+	if payload.Manifest == nil {
+		return fmt.Errorf("backup manifest is missing")
+	}
+
+	if payload.Manifest.Version > backupVersion {
+		return fmt.Errorf("backup version: %d is not supported", payload.Manifest.Version)
+	}
+
+	for _, f := range payload.Manifest.Files {
+		switch f.Kind {
+		case backupKindKey, backupKindDB, backupKindConfig, backupKindDataKey:
+		default:
+			return fmt.Errorf("backup file kind: %s is invalid", f.Kind)
+		}
+		if strings.ContainsAny(f.Name, `/\`) || f.Name == "." || f.Name == ".." {
+			return fmt.Errorf("backup file name: %s is invalid", f.Name)
+		}
+		content, exist := payload.Files[f.Kind+"/"+f.Name]
+		if !exist {
+			return fmt.Errorf("backup file: %s/%s is missing", f.Kind, f.Name)
+		}
+		hash := sha256.Sum256(content)
+		if int64(len(content)) != f.Size || hex.EncodeToString(hash[:]) != f.SHA256 {
+			return fmt.Errorf("backup file: %s/%s checksum is not match", f.Kind, f.Name)
+		}
+	}
+
+	return nil
+}
+
+// verifyBackupWallets 校验解压的keystore文件与清单的钱包一致
+func verifyBackupWallets(manifest *BackupManifest, keyDir string) error {
+
+	expected := make([]string, 0)
+	for _, w := range manifest.Wallets {
+		expected = append(expected, w.WalletID)
+	}
+
+	actual := make([]string, 0)
+	if file.Exists(keyDir) {
+		wallets, err := openwallet.GetWalletsByKeyDir(keyDir)
+		if err != nil {
+			return err
+		}
+		for _, w := range wallets {
+			actual = append(actual, w.WalletID)
+		}
+	}
+
+	sort.Strings(expected)
+	sort.Strings(actual)
+	if strings.Join(expected, ",") != strings.Join(actual, ",") {
+		return fmt.Errorf("backup wallets are not match with manifest")
+	}
+
+	return nil
+}
+
+// verifyBackupDB 校验解压的数据库可以打开，并且当前keychain与清单一致，加密的私钥可以用备份的数据密钥解密
+func verifyBackupDB(manifest *BackupManifest, dbFile string, dataKey []byte) error {
+
+	db, err := OpenStormDB(dbFile)
+	if err != nil {
+		return fmt.Errorf("backup database can not be opened: %v", err)
+	}
+	defer db.Close()
+
+	var current string
+	err = db.Get(CLIBucket, CurrentKeychainKey, &current)
+	if err != nil {
+		return fmt.Errorf("backup database has no keychain")
+	}
+
+	var keychain Keychain
+	err = db.One("NodeID", current, &keychain)
+	if err != nil {
+		return fmt.Errorf("backup database has no keychain")
+	}
+
+	if keychain.NodeID != manifest.NodeID {
+		return fmt.Errorf("backup keychain: %s is not match with manifest: %s", keychain.NodeID, manifest.NodeID)
+	}
+
+	if isEncryptedSecret(keychain.PrivateKey) {
+		if len(dataKey) == 0 {
+			return fmt.Errorf("backup has no data key to decrypt keychain")
+		}
+		_, err = decryptSecret(dataKey, keychain.PrivateKey, keychain.NodeID)
+		if err != nil {
+			return fmt.Errorf("backup keychain can not be decrypted: %v", err)
+		}
+	}
+
+	var check string
+	db.Get(CLIBucket, DataKeyCheckKey, &check)
+	if len(check) > 0 && len(dataKey) > 0 {
+		err = checkDataKey(dataKey, check)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backupPassphraseKey 使用备份数据库的盐值和dbpassphrase派生数据密钥
+func backupPassphraseKey(dbFile, passphrase string) ([]byte, error) {
+
+	db, err := OpenStormDB(dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("backup database can not be opened: %v", err)
+	}
+	defer db.Close()
+
+	var salt string
+	db.Get(CLIBucket, DataKeySaltKey, &salt)
+	if len(salt) == 0 {
+		return nil, nil
+	}
+
+	return derivePassphraseKey(passphrase, salt)
+}
+
+// encryptBackup 加密备份内容
+func encryptBackup(payload *backupPayload, password string) ([]byte, error) {
+
+	plain, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 32)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	archive := &backupArchive{
+		Version: backupVersion,
+		KDF:     "scrypt",
+		N:       backupScryptN,
+		R:       backupScryptR,
+		P:       backupScryptP,
+		Salt:    hex.EncodeToString(salt),
+	}
+
+	gcm, err := archive.cipher(password)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(plain)
+	archive.Nonce = hex.EncodeToString(nonce)
+	archive.Checksum = hex.EncodeToString(checksum[:])
+	archive.Data = gcm.Seal(nil, nonce, plain, nil)
+
+	return json.Marshal(archive)
+}
+
+// decryptBackup 解密备份内容，并校验所有文件
+func decryptBackup(data []byte, password string) (*backupPayload, error) {
+
+	var archive backupArchive
+	err := json.Unmarshal(data, &archive)
+	if err != nil {
+		return nil, fmt.Errorf("backup file is invalid: %v", err)
+	}
+
+	if archive.Version > backupVersion {
+		return nil, fmt.Errorf("backup version: %d is not supported", archive.Version)
+	}
+
+	if archive.KDF != "scrypt" {
+		return nil, fmt.Errorf("backup kdf: %s is not supported", archive.KDF)
+	}
+
+	err = archive.checkKDF()
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := archive.cipher(password)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hex.DecodeString(archive.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("backup nonce is invalid")
+	}
+
+	plain, err := gcm.Open(nil, nonce, archive.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("backup password is incorrect or file is damaged")
+	}
+
+	checksum := sha256.Sum256(plain)
+	if hex.EncodeToString(checksum[:]) != archive.Checksum {
+		return nil, fmt.Errorf("backup checksum is not match")
+	}
+
+	var payload backupPayload
+	err = json.Unmarshal(plain, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = payload.verifyFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return &payload, nil
+}
+
+// checkKDF 检查备份文件头的scrypt参数，超出上限的参数不进行密钥派生
+func (archive *backupArchive) checkKDF() error {
+
+	if archive.N <= 1 || archive.N > backupScryptMaxN || archive.N&(archive.N-1) != 0 {
+		return fmt.Errorf("backup scrypt N: %d is invalid", archive.N)
+	}
+
+	if archive.R <= 0 || archive.R > backupScryptMaxR || archive.P <= 0 || archive.P > backupScryptMaxP {
+		return fmt.Errorf("backup scrypt r: %d, p: %d is invalid", archive.R, archive.P)
+	}
+
+	//scrypt需要128*N*r字节的内存
+	if int64(128)*int64(archive.N)*int64(archive.R) > backupScryptMaxMemory {
+		return fmt.Errorf("backup scrypt N: %d, r: %d needs too much memory", archive.N, archive.R)
+	}
+
+	return nil
+}
+
+// cipher 通过密码派生AES-GCM加密器
+func (archive *backupArchive) cipher(password string) (cipher.AEAD, error) {
+
+	salt, err := hex.DecodeString(archive.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("backup salt is invalid")
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, archive.N, archive.R, archive.P, backupKeyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,191 @@
+package openwcli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptBackup(t *testing.T) {
+
+	payload := &backupPayload{
+		Manifest: &BackupManifest{
+			Version: backupVersion,
+			AppID:   "test",
+			NodeID:  "node",
+		},
+		Files: make(map[string][]byte),
+	}
+	payload.addContent(backupKindKey, "wallet.key", []byte("keystore"))
+	payload.addContent(backupKindDB, "test.db", []byte("database"))
+
+	archive, err := encryptBackup(payload, "12345678")
+	if err != nil {
+		t.Errorf("encryptBackup unexpected error: %v", err)
+		return
+	}
+
+	_, err = decryptBackup(archive, "87654321")
+	if err == nil {
+		t.Errorf("decryptBackup should failed with incorrect password")
+		return
+	}
+
+	restored, err := decryptBackup(archive, "12345678")
+	if err != nil {
+		t.Errorf("decryptBackup unexpected error: %v", err)
+		return
+	}
+
+	if string(restored.Files["key/wallet.key"]) != "keystore" || len(restored.Manifest.Files) != 2 {
+		t.Errorf("restored backup is not match")
+		return
+	}
+
+	//篡改文件内容
+	restored.Files["db/test.db"] = []byte("damaged")
+	err = restored.verifyFiles()
+	if err == nil {
+		t.Errorf("verifyFiles should failed with damaged file")
+		return
+	}
+}
+
+func TestVerifyBackupDB(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "openwcli-backup")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	dbFile := filepath.Join(dir, "test.db")
+	db, err := OpenStormDB(dbFile)
+	if err != nil {
+		t.Errorf("OpenStormDB unexpected error: %v", err)
+		return
+	}
+	db.Save(&Keychain{NodeID: "node"})
+	db.Set(CLIBucket, CurrentKeychainKey, "node")
+	db.Close()
+
+	err = verifyBackupDB(&BackupManifest{NodeID: "node"}, dbFile, nil)
+	if err != nil {
+		t.Errorf("verifyBackupDB unexpected error: %v", err)
+		return
+	}
+
+	err = verifyBackupDB(&BackupManifest{NodeID: "other"}, dbFile, nil)
+	if err == nil {
+		t.Errorf("verifyBackupDB should failed with other node")
+		return
+	}
+
+	//加密的keychain需要备份中的数据密钥
+	dataKey := make([]byte, dataKeyLength)
+	privateKey, _ := encryptSecret(dataKey, "private", "node")
+	db, err = OpenStormDB(dbFile)
+	if err != nil {
+		t.Errorf("OpenStormDB unexpected error: %v", err)
+		return
+	}
+	db.Save(&Keychain{NodeID: "node", PrivateKey: privateKey})
+	db.Close()
+
+	err = verifyBackupDB(&BackupManifest{NodeID: "node"}, dbFile, nil)
+	if err == nil {
+		t.Errorf("verifyBackupDB should failed without data key")
+		return
+	}
+
+	err = verifyBackupDB(&BackupManifest{NodeID: "node"}, dbFile, dataKey)
+	if err != nil {
+		t.Errorf("verifyBackupDB unexpected error: %v", err)
+		return
+	}
+}
+
+func TestSwapRestoreFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "openwcli-backup")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key", "wallet.key")
+	dbFile := filepath.Join(dir, "db", "test.db")
+	os.MkdirAll(filepath.Dir(keyFile), 0700)
+	os.MkdirAll(filepath.Dir(dbFile), 0700)
+	ioutil.WriteFile(keyFile, []byte("old key"), 0600)
+	ioutil.WriteFile(dbFile, []byte("old db"), 0600)
+
+	//第二个文件替换失败时，已替换的文件需要还原
+	oldDir := filepath.Join(dir, "old")
+	os.MkdirAll(oldDir, 0700)
+	ioutil.WriteFile(filepath.Join(oldDir, backupKindDB), []byte("not a directory"), 0600)
+
+	err = swapRestoreFiles([]*restoreFile{
+		{kind: backupKindKey, target: keyFile, content: []byte("new key")},
+		{kind: backupKindDB, target: dbFile, content: []byte("new db")},
+	}, oldDir)
+	if err == nil {
+		t.Errorf("swapRestoreFiles should failed when the original file can not be moved")
+		return
+	}
+
+	key, _ := ioutil.ReadFile(keyFile)
+	db, _ := ioutil.ReadFile(dbFile)
+	if string(key) != "old key" || string(db) != "old db" {
+		t.Errorf("files should be rolled back: %s, %s", key, db)
+		return
+	}
+
+	entries, _ := ioutil.ReadDir(filepath.Dir(keyFile))
+	if len(entries) != 1 {
+		t.Errorf("staged files should be removed")
+		return
+	}
+
+	os.Remove(filepath.Join(oldDir, backupKindDB))
+	err = swapRestoreFiles([]*restoreFile{
+		{kind: backupKindKey, target: keyFile, content: []byte("new key")},
+		{kind: backupKindDB, target: dbFile, content: []byte("new db")},
+	}, oldDir)
+	if err != nil {
+		t.Errorf("swapRestoreFiles unexpected error: %v", err)
+		return
+	}
+
+	key, _ = ioutil.ReadFile(keyFile)
+	old, _ := ioutil.ReadFile(filepath.Join(oldDir, backupKindKey, "wallet.key"))
+	if string(key) != "new key" || string(old) != "old key" {
+		t.Errorf("files are not replaced: %s, %s", key, old)
+		return
+	}
+}
+
+func TestBackupArchive_CheckKDF(t *testing.T) {
+
+	valid := &backupArchive{N: backupScryptN, R: backupScryptR, P: backupScryptP}
+	if err := valid.checkKDF(); err != nil {
+		t.Errorf("checkKDF unexpected error: %v", err)
+		return
+	}
+
+	invalid := []*backupArchive{
+		{N: 1 << 30, R: 8, P: 1},
+		{N: 1000, R: 8, P: 1},
+		{N: 1 << 18, R: 1 << 20, P: 1},
+		{N: 1 << 18, R: 8, P: 1 << 20},
+		{N: 1 << 20, R: 32, P: 1},
+	}
+	for _, archive := range invalid {
+		if err := archive.checkKDF(); err == nil {
+			t.Errorf("checkKDF should failed with N: %d, r: %d, p: %d", archive.N, archive.R, archive.P)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/DisposaBoy/JsonConfigReader"
-	"github.com/asdine/storm"
 	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
 	"github.com/blocktree/openwallet/v2/common/file"
 	"github.com/blocktree/openwallet/v2/console"
@@ -14,8 +13,10 @@ import (
 	"github.com/blocktree/openwallet/v2/timer"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
-	bolt "go.etcd.io/bbolt"
 	"io/ioutil"
+	mathrand "math/rand"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -34,15 +35,38 @@ type SignTxHashFunc func(signatures map[string][]*openwsdk.KeySignature, key *hd
 
 type CLI struct {
 	mu               sync.RWMutex
-	config           *Config               //工具配置
-	db               *StormDB              //本地数据库
-	api              *openwsdk.APINode     //api
-	summaryTask      *openwsdk.SummaryTask //汇总任务
-	summaryTaskTimer *timer.TaskTimer      //汇总任务定时器
-	transmitNode     *owtp.OWTPNode        //转发节点，被托管钱包种子的节点
-	unlockWallets    map[string]string     //已解锁的钱包
-	txSigner         SignTxHashFunc        //自定义签名函数
-	keepOpen         bool                  //数据库文件保持打开状态
+	config           *Config                   //工具配置
+	db               *StormDB                  //本地数据库
+	api              *openwsdk.APINode         //api
+	summaryTask      *openwsdk.SummaryTask     //汇总任务
+	summaryTaskTimer *timer.TaskTimer          //汇总任务定时器
+	transmitNode     *owtp.OWTPNode            //转发节点，被托管钱包种子的节点
+	unlockSessions   map[string]*unlockSession //已解锁的钱包会话
+	sessionMu        sync.RWMutex              //钱包会话锁
+	txSigner         SignTxHashFunc            //自定义签名函数
+	trustRoutes      map[string]*TrustRoute    //授信服务路由
+	trustRouteNames  []string                  //路由注册顺序
+	trustMiddlewares []TrustMiddleware         //路由中间件
+	routeMu          sync.RWMutex              //路由锁
+	keepOpen         bool                      //守护进程模式
+	dbMu             sync.Mutex                //数据库句柄锁
+	dbRefs           int                       //正在使用数据库的调用数
+	dbHeld           bool                      //数据库保持打开，不随closeDB关闭
+	coSignNode       *owtp.OWTPNode            //连接联合签名节点
+	passphraseKey    []byte                    //dbpassphrase派生的数据密钥
+	passphraseSalt   string                    //派生数据密钥的盐值
+	daemonListener   net.Listener              //守护进程的本地socket
+	daemonMux        *http.ServeMux            //守护进程本地socket的路由
+	daemon           *daemonSupervisor         //守护进程状态和后台任务
+	daemonOnce       sync.Once                 //初始化守护进程管理器
+	adminMethods     map[string]*adminRoute    //管理接口方法
+	adminServers     []*http.Server            //管理接口服务
+	metrics          *MetricsRegistry          //运行指标
+	metricsOnce      sync.Once                 //初始化运行指标
+	metricsServer    *http.Server              //指标服务
+	notifyRunning    int32                     //正在发送通知
+	notifyMu         sync.Mutex                //通知限流锁
+	notifyLastTime   map[string]time.Time      //限流通知的上次发送时间
 }
 
 // 初始化工具
@@ -60,18 +84,59 @@ func NewCLI(c *Config) (*CLI, error) {
 		return nil, fmt.Errorf("remoteserver is empty. ")
 	}
 
+	//签名方法默认为openwsdk提供的，可配置外部签名后端
+	txSigner, err := newSignerBackend(c)
+	if err != nil {
+		return nil, err
+	}
+
 	cli := &CLI{
-		config:        c,
-		unlockWallets: make(map[string]string),
-		txSigner:      openwsdk.SignTxHash, //默认签名方法为openwsdk提供的
+		config:         c,
+		unlockSessions: make(map[string]*unlockSession),
+		trustRoutes:    make(map[string]*TrustRoute),
+		adminMethods:   make(map[string]*adminRoute),
+		txSigner:       txSigner,
 	}
 
+	//注册内置的授信服务路由
+	cli.registerDefaultTrustRoutes()
+
+	//注册内置的管理接口方法
+	cli.registerDefaultAdminMethods()
+
 	//配置日志
-	SetupLog(c.logdir, "openwcli.log", c.logdebug)
+	SetupLog(c.logdir, "openwcli.log", c.logdebug, c.logformat, c.logmaxdays)
+
+	//数据库结构迁移，只读模式的查询命令不迁移
+	if c.dbautomigrate && !c.dbReadOnlyMode {
+		_, err = cli.autoMigrateDB()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		status, err := cli.DBMigrationStatus()
+		if err != nil {
+			return nil, err
+		}
+		err = status.checkSupported()
+		if err != nil {
+			return nil, err
+		}
+		if len(status.Pending) > 0 {
+			log.Warningf("database schema version: %d is behind: %d, please run dbmigrate up", status.Current, status.Latest)
+		}
+	}
 
-	keychain, _ := cli.GetKeychain()
+	keychain, err := cli.GetKeychain()
+	if _, ok := err.(*dataKeyError); ok {
+		//数据密钥缺失或不匹配，不能使用节点证书，只提示不退出，以便恢复密钥或备份
+		log.Error("load keychain failed: ", err)
+	}
 	if keychain != nil {
 		cli.setupAPISDK(keychain)
+		if c.cosignthreshold > 0 {
+			cli.setupCoSignNode(keychain)
+		}
 	}
 
 	return cli, nil
@@ -114,38 +179,107 @@ func (cli *CLI) checkConfig() error {
 	return nil
 }
 
-// getDB 获取数据库
+// getDB 获取数据库，同一进程的调用共用一个句柄，最后一个调用closeDB时关闭，
+// 守护进程模式和查询命令的快照保持打开，查询命令以只读方式打开
 func (cli *CLI) getDB() (*StormDB, error) {
-	if !cli.keepOpen {
+
+	cli.dbMu.Lock()
+	defer cli.dbMu.Unlock()
+
+	if cli.db == nil {
 
 		//加载数据
-		dbfile := filepath.Join(cli.config.dbdir, cli.config.appid+".db")
-		db, err := OpenStormDB(
-			dbfile,
-			storm.BoltOptions(
-				0600,
-				&bolt.Options{
-					Timeout: 5 * time.Second,
-					//ReadOnly: true,
-				}),
-		)
+		db, err := cli.openDB(cli.config.dbReadOnlyMode)
 		if err != nil {
 			return nil, err
 		}
 
 		cli.db = db
+
+		//守护进程的快照在整个命令期间只获取一次
+		if db.Snapshot {
+			cli.dbHeld = true
+		}
 	}
 
+	cli.dbRefs++
+
 	return cli.db, nil
 }
 
 // closeDB 关闭数据库
 func (cli *CLI) closeDB() {
+
+	cli.dbMu.Lock()
+	defer cli.dbMu.Unlock()
+
+	if cli.dbRefs > 0 {
+		cli.dbRefs--
+	}
+	cli.releaseDB()
+}
+
+// dbInUse 是否有调用正在使用数据库
+func (cli *CLI) dbInUse() bool {
+
+	cli.dbMu.Lock()
+	defer cli.dbMu.Unlock()
+
+	return cli.dbRefs > 0
+}
+
+// viewDB 以只读方式读取数据库，已打开时共用句柄，否则只读打开(守护进程运行时读取快照)，读取后关闭
+func (cli *CLI) viewDB(fn func(db *StormDB) error) error {
+
+	cli.dbMu.Lock()
+	if cli.db != nil {
+		cli.dbRefs++
+		db := cli.db
+		cli.dbMu.Unlock()
+		defer cli.closeDB()
+		return fn(db)
+	}
+	cli.dbMu.Unlock()
+
+	db, err := cli.openDB(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		db.Close()
+		if db.Snapshot {
+			os.Remove(db.FileName)
+		}
+	}()
+
+	return fn(db)
+}
+
+// releaseDB 没有调用在使用且不需要保持打开时关闭数据库，调用前需要持有dbMu
+func (cli *CLI) releaseDB() {
+
+	if cli.dbRefs > 0 || cli.dbHeld || cli.db == nil {
+		return
+	}
+
 	//区块链数据文件
-	if !cli.keepOpen && cli.db != nil {
-		cli.db.Close()
-		cli.db = nil
+	cli.db.Close()
+	if cli.db.Snapshot {
+		os.Remove(cli.db.FileName)
+	}
+	cli.db = nil
+}
+
+// Close 命令结束时释放保持打开的数据库快照
+func (cli *CLI) Close() {
+
+	cli.dbMu.Lock()
+	defer cli.dbMu.Unlock()
+
+	if cli.db != nil && cli.db.Snapshot {
+		cli.dbHeld = false
 	}
+	cli.releaseDB()
 }
 
 // GenKeychainFlow 生成新的keychain流程
@@ -231,19 +365,93 @@ func (cli *CLI) GetNodeInfoFlow() error {
 	return nil
 }
 
+// ListKeychainFlow 列出本地所有keychain
+func (cli *CLI) ListKeychainFlow() error {
+
+	list, current, previous, err := cli.ListKeychains()
+	if err != nil {
+		return err
+	}
+
+	if len(list) == 0 {
+		fmt.Println("No keychain was created locally. ")
+		return nil
+	}
+
+	printKeychainList(list, current, previous)
+
+	return nil
+}
+
+// RotateKeychainFlow 轮换keychain流程，新keychain登记成功后才切换
+func (cli *CLI) RotateKeychainFlow() error {
+
+	confirm, _ := console.Stdin.PromptConfirm("Generate a new keychain and register it on openw-server?")
+	if !confirm {
+		return nil
+	}
+
+	keychain, err := cli.RotateKeychain()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Keychain has been rotated, current node ID: %s", keychain.NodeID)
+	log.Infof("The previous keychain is kept, use usekeychain to roll back if necessary.")
+
+	return nil
+}
+
+// UseKeychainFlow 选择本地已有的keychain作为当前keychain
+func (cli *CLI) UseKeychainFlow() error {
+
+	list, current, previous, err := cli.ListKeychains()
+	if err != nil {
+		return err
+	}
+
+	if len(list) == 0 {
+		fmt.Println("No keychain was created locally. ")
+		return nil
+	}
+
+	printKeychainList(list, current, previous)
+
+	fmt.Printf("[Please select a keychain] \n")
+
+	num, err := console.InputNumber("Enter keychain No.: ", true)
+	if err != nil {
+		return err
+	}
+
+	if int(num) >= len(list) {
+		return fmt.Errorf("Input number is out of index! ")
+	}
+
+	keychain, err := cli.UseKeychain(list[num].NodeID)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Current keychain has been switched to node ID: %s", keychain.NodeID)
+
+	return nil
+}
+
 // printKeychain 打印证书钥匙串
 func printKeychain(keychain *Keychain) {
 	//打印证书信息
-	log.Notice("--------------- PRIVATE KEY ---------------")
-	log.Notice(keychain.PrivateKey)
-	log.Notice("--------------- PUBLIC KEY ---------------")
-	log.Notice(keychain.PublicKey)
-	log.Notice("--------------- NODE ID ---------------")
-	log.Notice(keychain.NodeID)
+	//私钥只打印到终端，不写入日志
+	fmt.Println("--------------- PRIVATE KEY ---------------")
+	fmt.Println(keychain.PrivateKey)
+	fmt.Println("--------------- PUBLIC KEY ---------------")
+	fmt.Println(keychain.PublicKey)
+	fmt.Println("--------------- NODE ID ---------------")
+	fmt.Println(keychain.NodeID)
 }
 
-// NewWalletFlow 创建钱包流程
-func (cli *CLI) NewWalletFlow() error {
+// NewWalletFlow 创建钱包流程，withMnemonic为true时显示助记词并确认后创建
+func (cli *CLI) NewWalletFlow(withMnemonic bool) error {
 
 	var (
 		password string
@@ -261,11 +469,100 @@ func (cli *CLI) NewWalletFlow() error {
 	// 等待用户输入密码
 	password, err = console.InputPassword(false, 3)
 
-	_, err = cli.CreateWalletOnServer(name, password)
+	if !withMnemonic {
+		_, err = cli.CreateWalletOnServer(name, password)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		return err
+	}
+
+	//助记词只打印到终端，不写入日志
+	fmt.Println("--------------- MNEMONIC ---------------")
+	fmt.Println(mnemonic)
+	fmt.Println("Please write down the mnemonic and keep it safe, it is the only way to recover the wallet")
+
+	err = confirmMnemonicStep(mnemonic)
+	if err != nil {
+		return err
+	}
+
+	seed, err := ParseWalletSeed(mnemonic)
+	if err != nil {
+		return err
+	}
+
+	_, err = cli.CreateWalletWithSeedOnServer(name, password, seed)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ImportWalletFlow 通过助记词或十六进制种子导入钱包流程
+func (cli *CLI) ImportWalletFlow() error {
+
+	if cli.api == nil {
+		return fmt.Errorf("local node is not registed")
+	}
+
+	input, err := console.InputText("Enter mnemonic or hex seed: ", true)
+	if err != nil {
+		return err
+	}
+
+	seed, err := ParseWalletSeed(input)
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入钱包名字
+	name, err := console.InputText("Enter wallet's name: ", true)
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入密码
+	password, err := console.InputPassword(true, 3)
+	if err != nil {
+		return err
+	}
+
+	wallet, err := cli.CreateWalletWithSeedOnServer(name, password, seed)
 	if err != nil {
 		return err
 	}
 
+	log.Infof("Wallet: %s has been imported", wallet.WalletID)
+
+	return nil
+}
+
+// confirmMnemonicStep 随机抽查助记词单词，确认用户已抄写
+func confirmMnemonicStep(mnemonic string) error {
+
+	words := strings.Fields(mnemonic)
+	if len(words) == 0 {
+		return fmt.Errorf("mnemonic is empty")
+	}
+
+	r := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+	for _, i := range r.Perm(len(words))[:3] {
+		word, err := console.InputText(fmt.Sprintf("Enter word #%d of mnemonic: ", i+1), true)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(strings.ToLower(word)) != words[i] {
+			return fmt.Errorf("word #%d is incorrect, wallet is not created", i+1)
+		}
+	}
+
 	return nil
 }
 
@@ -644,6 +941,12 @@ func (cli *CLI) StartSumFlow(file string) error {
 		return err
 	}
 
+	//守护进程共用一个数据库句柄
+	err = cli.OpenDaemonDB()
+	if err != nil {
+		return err
+	}
+
 	cycleTime := cli.config.summaryperiod
 	if len(cycleTime) == 0 {
 		cycleTime = "1m"
@@ -663,18 +966,8 @@ func (cli *CLI) StartSumFlow(file string) error {
 		taskFile = file
 	}
 
-	taskJSON, err := ioutil.ReadFile(taskFile)
-	if err == nil {
-
-		//err = json.Unmarshal(taskJSON, &summaryTask)
-		//if err != nil {
-		//	return err
-		//}
-
-		str := strings.NewReader(string(taskJSON))
-		r := JsonConfigReader.New(str)
-		err = json.NewDecoder(r).Decode(&summaryTask)
-
+	if task, readErr := readSummaryTaskFile(taskFile); readErr == nil {
+		summaryTask = *task
 		manual = false
 	}
 
@@ -719,24 +1012,9 @@ func (cli *CLI) StartSumFlow(file string) error {
 		}
 	} else {
 		//检查文件是否有解锁密码
-		for _, w := range summaryTask.Wallets {
-
-			wallet, err := cli.GetWalletByWalletIDOnLocal(w.WalletID)
-			if err != nil {
-				return fmt.Errorf("can not find local wallet with ID: %s", w.WalletID)
-			}
-			w.Wallet = wallet
-
-			if len(w.Password) == 0 {
-				//要求输入钱包解锁密码
-				log.Std.Notice("[Please enter password to unlock wallet: %s-%s]", wallet.Alias, w.WalletID)
-				// 等待用户输入密码
-				password, selectErr := console.InputPassword(false, 3)
-				if selectErr != nil {
-					return selectErr
-				}
-				w.Password = password
-			}
+		err = cli.inputSummaryTaskPasswords(&summaryTask)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -749,6 +1027,13 @@ func (cli *CLI) StartSumFlow(file string) error {
 	cli.summaryTask = &summaryTask
 	cli.mu.Unlock()
 
+	err = cli.ServeMetrics()
+	if err != nil {
+		return err
+	}
+
+	cli.startNotifyJob()
+
 	log.Infof("The timer for summary task start now. Execute by every %v seconds.", cycleSec.Seconds())
 
 	//马上执行一次汇总
@@ -765,6 +1050,93 @@ func (cli *CLI) StartSumFlow(file string) error {
 	return nil
 }
 
+// readSummaryTaskFile 读取汇总任务json文件，文件内容允许注释
+func readSummaryTaskFile(taskFile string) (*openwsdk.SummaryTask, error) {
+
+	taskJSON, err := ioutil.ReadFile(taskFile)
+	if err != nil {
+		return nil, err
+	}
+
+	//去掉注释，再解析汇总任务和钱包密码文件
+	taskJSON, err = ioutil.ReadAll(JsonConfigReader.New(strings.NewReader(string(taskJSON))))
+	if err != nil {
+		return nil, err
+	}
+
+	var summaryTask openwsdk.SummaryTask
+	err = json.Unmarshal(taskJSON, &summaryTask)
+	if err != nil {
+		return nil, fmt.Errorf("summary task file: %s is invalid: %v", taskFile, err)
+	}
+
+	err = readSummaryTaskPasswordFiles(taskJSON, &summaryTask)
+	if err != nil {
+		return nil, fmt.Errorf("summary task file: %s is invalid: %v", taskFile, err)
+	}
+
+	return &summaryTask, nil
+}
+
+// readSummaryTaskPasswordFiles 钱包配置了passwordFile时，从文件读取钱包解锁密码，用于容器挂载的密钥文件
+func readSummaryTaskPasswordFiles(taskJSON []byte, summaryTask *openwsdk.SummaryTask) error {
+
+	var passwordFiles struct {
+		Wallets []struct {
+			WalletID     string `json:"walletID"`
+			PasswordFile string `json:"passwordFile"`
+		} `json:"wallets"`
+	}
+	err := json.Unmarshal(taskJSON, &passwordFiles)
+	if err != nil {
+		return err
+	}
+
+	for i, w := range passwordFiles.Wallets {
+		if len(w.PasswordFile) == 0 || i >= len(summaryTask.Wallets) {
+			continue
+		}
+		if len(summaryTask.Wallets[i].Password) > 0 {
+			return fmt.Errorf("wallet: %s can not set both password and passwordFile", w.WalletID)
+		}
+		password, err := readSecretFile(w.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("wallet: %s read passwordFile failed: %v", w.WalletID, err)
+		}
+		summaryTask.Wallets[i].Password = password
+	}
+
+	return nil
+}
+
+// inputSummaryTaskPasswords 汇总任务的钱包没有解锁密码，并且没有已解锁的会话时，要求输入密码
+func (cli *CLI) inputSummaryTaskPasswords(summaryTask *openwsdk.SummaryTask) error {
+
+	for _, w := range summaryTask.Wallets {
+
+		wallet, err := cli.GetWalletByWalletIDOnLocal(w.WalletID)
+		if err != nil {
+			return fmt.Errorf("can not find local wallet with ID: %s", w.WalletID)
+		}
+		w.Wallet = wallet
+
+		if len(w.Password) > 0 || cli.getUnlockedKey(w.WalletID) != nil {
+			continue
+		}
+
+		//要求输入钱包解锁密码
+		log.Std.Notice("[Please enter password to unlock wallet: %s-%s]", wallet.Alias, w.WalletID)
+		// 等待用户输入密码
+		password, err := console.InputPassword(false, 3)
+		if err != nil {
+			return err
+		}
+		w.Password = password
+	}
+
+	return nil
+}
+
 // UpdateInfoFlow
 func (cli *CLI) UpdateInfoFlow() error {
 
@@ -843,7 +1215,7 @@ func (cli *CLI) ListAddressFlow() error {
 }
 
 // StartTrustServerFlow
-func (cli *CLI) StartTrustServerFlow() error {
+func (cli *CLI) StartTrustServerFlow(ttl time.Duration) error {
 
 	var (
 		endRunning = make(chan bool, 1)
@@ -860,24 +1232,30 @@ func (cli *CLI) StartTrustServerFlow() error {
 		return err
 	}
 
+	//守护进程共用一个数据库句柄
+	err = cli.OpenDaemonDB()
+	if err != nil {
+		return err
+	}
+
 	confirm, _ := console.Stdin.PromptConfirm("Do you want to unlock local wallets?")
 
 	if confirm {
 		// 是否需要解锁本地的钱包，解锁后，发起转账和汇总不需要输入密码。
-		err = cli.unlockLocalWalletsByInputPassword()
+		err = cli.unlockLocalWalletsByInputPassword(ttl)
 		if err != nil {
 			return err
 		}
 	}
 
-	updateInfo := func() {
-		cli.UpdateSymbols()
+	err = cli.ServeTransmitNode(true)
+	if err != nil {
+		return err
 	}
-	//定时1个小时执行一次更新主链信息
-	updateInfoTimer := timer.NewTask(1*time.Hour, updateInfo)
-	updateInfoTimer.Start()
 
-	err = cli.ServeTransmitNode(true)
+	cli.startTrustServerJobs()
+
+	err = cli.ServeMetrics()
 	if err != nil {
 		return err
 	}
@@ -961,8 +1339,8 @@ func (cli *CLI) ListTokenBalanceFlow() error {
 	return nil
 }
 
-// unlockLocalWalletsByInputPassword 输入密码解锁钱包
-func (cli *CLI) unlockLocalWalletsByInputPassword() error {
+// unlockLocalWalletsByInputPassword 输入密码解锁钱包，解锁会话在ttl后过期
+func (cli *CLI) unlockLocalWalletsByInputPassword(ttl time.Duration) error {
 
 	localWallets, err := cli.GetWalletsOnServer()
 	if err != nil {
@@ -979,15 +1357,11 @@ func (cli *CLI) unlockLocalWalletsByInputPassword() error {
 			return err
 		}
 
-		_, err = cli.getLocalKeyByWallet(w, password)
+		err = cli.UnlockWallet(w, password, ttl)
 		if err != nil {
 			return err
 		}
 
-		cli.mu.Lock()
-		cli.unlockWallets[w.WalletID] = password
-		cli.mu.Unlock()
-
 	}
 
 	return nil
@@ -1333,12 +1707,6 @@ func (cli *CLI) ChangePwdFlow() error {
 		return err
 	}
 
-	keystore := hdkeystore.NewHDKeystore(
-		cli.config.keydir,
-		hdkeystore.StandardScryptN,
-		hdkeystore.StandardScryptP,
-	)
-
 	//:输入钱包密码
 	// 等待用户输入密码
 	password, err := console.InputPassword(false, 3)
@@ -1360,9 +1728,16 @@ func (cli *CLI) ChangePwdFlow() error {
 		return err
 	}
 
-	//用新密码加密
-	filePath := keystore.JoinPath(hdkeystore.KeyFileName(key.Alias, key.KeyID) + ".key")
-	err = keystore.StoreKey(filePath, key, newPwd)
+	//用新密码加密，保持原有的scrypt参数，不低于标准参数
+	filePath := filepath.Join(cli.config.keydir, cli.keyFileName(wallet))
+	scryptN, scryptP, _ := keyFileScryptParams(filePath)
+	if scryptN < hdkeystore.StandardScryptN {
+		scryptN = hdkeystore.StandardScryptN
+	}
+	if scryptP < hdkeystore.StandardScryptP {
+		scryptP = hdkeystore.StandardScryptP
+	}
+	err = cli.reencryptKey(key, filePath, newPwd, scryptN, scryptP)
 	if err != nil {
 		return err
 	}
@@ -1371,3 +1746,1041 @@ func (cli *CLI) ChangePwdFlow() error {
 
 	return nil
 }
+
+// ListPendingFlow 查看审批请求
+func (cli *CLI) ListPendingFlow(all bool) error {
+
+	status := PendingStatusPending
+	if all {
+		status = ""
+	}
+
+	list, err := cli.ListPendingTransfer(status)
+	if err != nil {
+		return err
+	}
+
+	cli.printPendingTransferList(list)
+
+	return nil
+}
+
+// ApprovePendingFlow 审批通过远程转账请求
+func (cli *CLI) ApprovePendingFlow() error {
+
+	id, err := console.InputText("Enter pending ID: ", true)
+	if err != nil {
+		return err
+	}
+
+	pending, err := cli.GetPendingTransfer(id)
+	if err != nil {
+		return err
+	}
+
+	cli.printPendingTransferList([]*PendingTransfer{pending})
+
+	confirm, _ := console.Stdin.PromptConfirm("Do you want to approve this request?")
+	if !confirm {
+		return nil
+	}
+
+	// 等待用户输入密码
+	password, err := console.InputPassword(false, 3)
+	if err != nil {
+		return err
+	}
+
+	pending, err = cli.ApprovePendingTransfer(id, password)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("pending transfer: %s has been approved, the result will be sent to trusted server", pending.ID)
+
+	return nil
+}
+
+// RejectPendingFlow 拒绝远程转账请求
+func (cli *CLI) RejectPendingFlow() error {
+
+	id, err := console.InputText("Enter pending ID: ", true)
+	if err != nil {
+		return err
+	}
+
+	reason, err := console.InputText("Enter reject reason: ", false)
+	if err != nil {
+		return err
+	}
+
+	pending, err := cli.RejectPendingTransfer(id, reason)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("pending transfer: %s has been rejected, the result will be sent to trusted server", pending.ID)
+
+	return nil
+}
+
+// BackupFlow 备份节点流程
+func (cli *CLI) BackupFlow(out, configFile string) error {
+
+	if len(out) == 0 {
+		return fmt.Errorf("backup output file is empty, use --out to set it")
+	}
+
+	if file.Exists(out) {
+		return fmt.Errorf("backup file: %s already exists", out)
+	}
+
+	// 等待用户输入备份密码
+	log.Notice("Please set a password to encrypt the backup file")
+	password, err := console.InputPassword(true, 8)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := cli.BackupNode(out, configFile, password)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Backup %d wallets and %d files to %s successfully", len(manifest.Wallets), len(manifest.Files), out)
+
+	return nil
+}
+
+// RestoreFlow 恢复节点流程
+func (cli *CLI) RestoreFlow(in, configFile string) error {
+
+	if len(in) == 0 {
+		return fmt.Errorf("backup input file is empty, use --in to set it")
+	}
+
+	confirm, _ := console.Stdin.PromptConfirm("Local keystore, database and config will be replaced by the backup, continue?")
+	if !confirm {
+		return nil
+	}
+
+	// 等待用户输入备份密码
+	password, err := console.InputPassword(false, 8)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := cli.RestoreNode(in, configFile, password)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Restore node: %s with %d wallets from %s successfully", manifest.NodeID, len(manifest.Wallets), in)
+
+	return nil
+}
+
+// EncryptDBFlow 加密数据库中明文保存的敏感字段
+func (cli *CLI) EncryptDBFlow() error {
+
+	result, err := cli.EncryptDB()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Database is encrypted, %d keychains, %d summary settings and %d trust addresses are migrated",
+		result.Keychains, result.SummarySettings, result.TrustAddresses)
+	if len(cli.config.dbpassphrase) == 0 {
+		log.Infof("Please keep the data key file: %s safe, the database can not be decrypted without it", cli.dataKeyFile())
+	}
+
+	return nil
+}
+
+// DBMigrateStatusFlow 查看数据库结构版本
+func (cli *CLI) DBMigrateStatusFlow() error {
+
+	status, err := cli.DBMigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	printDBMigrationStatus(status)
+
+	return nil
+}
+
+// DBMigrateUpFlow 执行待执行的数据库迁移
+func (cli *CLI) DBMigrateUpFlow() error {
+
+	status, err := cli.MigrateDB()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Database schema version is %d now", status.Current)
+
+	return nil
+}
+
+// DBCompactFlow 压缩数据库流程
+func (cli *CLI) DBCompactFlow() error {
+
+	result, err := cli.CompactDB()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Database is compacted from %d bytes to %d bytes", result.Before, result.After)
+
+	return nil
+}
+
+// DBVerifyFlow 校验数据库流程
+func (cli *CLI) DBVerifyFlow() error {
+
+	result, err := cli.VerifyDB()
+	if err != nil {
+		return err
+	}
+
+	if len(result.Errors) > 0 {
+		for _, e := range result.Errors {
+			log.Error(e)
+		}
+		return fmt.Errorf("database is inconsistent, found %d errors, please restore it from backup", len(result.Errors))
+	}
+
+	log.Infof("Database is consistent, rebuild indexes of: %s", strings.Join(result.Reindexed, ", "))
+
+	return nil
+}
+
+// DBExportFlow 导出数据库流程，没有指定输出文件时输出到标准输出
+func (cli *CLI) DBExportFlow(format, out string) error {
+
+	if len(out) == 0 {
+		return cli.ExportDB(format, os.Stdout)
+	}
+
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = cli.ExportDB(format, f)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Database has been exported into: %s", out)
+
+	return nil
+}
+
+// DBPruneFlow 归档并删除旧的汇总日志流程
+func (cli *CLI) DBPruneFlow(before, out string) error {
+
+	if len(before) == 0 {
+		return fmt.Errorf("use --before to set which summary logs to prune")
+	}
+
+	beforeTime, err := parseBeforeTime(before)
+	if err != nil {
+		return err
+	}
+
+	if len(out) == 0 {
+		out = filepath.Join(cli.config.datadir, backupDirName,
+			fmt.Sprintf("summarylog-%s.json", beforeTime.Format("20060102")))
+	}
+
+	count, err := cli.PruneSummaryLogs(beforeTime, out)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		log.Infof("No summary logs created before %s", beforeTime.Format("2006-01-02 15:04:05"))
+		return nil
+	}
+
+	log.Infof("%d summary logs have been archived into: %s and deleted", count, out)
+
+	return nil
+}
+
+// SplitWalletFlow 拆分钱包种子流程
+func (cli *CLI) SplitWalletFlow(total, threshold int, outDir string) error {
+
+	//:选择钱包
+	wallet, err := cli.SelectWalletStep()
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入密码
+	password, err := console.InputPassword(false, 3)
+	if err != nil {
+		return err
+	}
+
+	shares, err := cli.SplitWallet(wallet, password, total, threshold)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Any %d of %d shares can recover the wallet, please hand each share to a different keeper \n", threshold, total)
+
+	//指定输出目录时每个分片保存为一个文件，不在终端显示
+	if len(outDir) > 0 {
+		files, saveErr := SaveWalletShares(outDir, shares)
+		if saveErr != nil {
+			return saveErr
+		}
+		for _, f := range files {
+			fmt.Println(f)
+		}
+		log.Infof("Wallet: %s has been split into %d share files, threshold: %d", wallet.WalletID, total, threshold)
+		return nil
+	}
+
+	//分片只打印到终端，不写入日志，逐个显示，确认抄写后清屏再显示下一个
+	for _, share := range shares {
+		err = showWalletShareStep(share, total)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Wallet: %s has been split into %d shares, threshold: %d", wallet.WalletID, total, threshold)
+
+	return nil
+}
+
+// showWalletShareStep 显示一个分片，输入分片末尾的字符确认已抄写，然后清屏
+func showWalletShareStep(share *WalletShare, total int) error {
+
+	text := share.String()
+	suffix := text[len(text)-6:]
+
+	fmt.Printf("--------------- SHARE %d OF %d ---------------\n", share.Index, total)
+	fmt.Println(text)
+
+	for {
+		input, err := console.InputText(fmt.Sprintf("Enter the last 6 characters of share #%d to confirm: ", share.Index), true)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(input) == suffix {
+			break
+		}
+		fmt.Println("Input is not match, please check the share and try again")
+	}
+
+	//清屏，避免下一个保管人看到上一个分片
+	fmt.Print("\033[H\033[2J")
+
+	return nil
+}
+
+// CombineWalletFlow 通过分片恢复钱包流程
+func (cli *CLI) CombineWalletFlow() error {
+
+	if cli.api == nil {
+		return fmt.Errorf("local node is not registed")
+	}
+
+	shares := make([]*WalletShare, 0)
+
+	for {
+		input, err := console.InputText(fmt.Sprintf("Enter share #%d text or file path: ", len(shares)+1), true)
+		if err != nil {
+			return err
+		}
+
+		//输入文件路径时读取文件内容
+		if file.Exists(input) {
+			content, readErr := ioutil.ReadFile(input)
+			if readErr != nil {
+				return readErr
+			}
+			input = string(content)
+		}
+
+		share, err := ParseWalletShare(input)
+		if err != nil {
+			log.Error("unexpected error: ", err)
+			continue
+		}
+
+		shares = append(shares, share)
+
+		if len(shares) >= shares[0].Threshold {
+			break
+		}
+	}
+
+	// 等待用户输入钱包名字
+	name, err := console.InputText("Enter wallet's name: ", true)
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入密码
+	password, err := console.InputPassword(true, 3)
+	if err != nil {
+		return err
+	}
+
+	wallet, err := cli.CombineWallet(name, password, shares)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Wallet: %s has been recovered", wallet.WalletID)
+
+	return nil
+}
+
+// CheckKeysFlow 检查keystore文件，upgrade为true时逐个输入密码，使用更高的scrypt参数重新加密
+func (cli *CLI) CheckKeysFlow(upgrade bool, scryptN, scryptP int) error {
+
+	if scryptN < hdkeystore.StandardScryptN {
+		scryptN = hdkeystore.StandardScryptN
+	}
+	if scryptP < hdkeystore.StandardScryptP {
+		scryptP = hdkeystore.StandardScryptP
+	}
+
+	results, err := cli.CheckKeys(scryptN, scryptP, true)
+	if err != nil {
+		return err
+	}
+
+	cli.printKeyCheckResults(results)
+
+	if !upgrade {
+		return nil
+	}
+
+	for _, r := range results {
+		if !r.hasStatus(KeyStatusWeakScrypt) {
+			continue
+		}
+
+		wallet, findErr := cli.GetWalletByWalletIDOnLocal(r.WalletID)
+		if findErr != nil {
+			log.Error("unexpected error: ", findErr)
+			continue
+		}
+
+		log.Infof("Upgrade scrypt of key: %s to N: %d, P: %d", r.FileName, scryptN, scryptP)
+
+		// 等待用户输入密码
+		password, inputErr := console.InputPassword(false, 3)
+		if inputErr != nil {
+			return inputErr
+		}
+
+		err = cli.UpgradeKeyScrypt(wallet, r.FilePath, password, scryptN, scryptP)
+		if err != nil {
+			log.Errorf("Upgrade key: %s failed, unexpected error: %v", r.FileName, err)
+			continue
+		}
+
+		log.Infof("Key: %s has been upgraded successfully", r.FileName)
+	}
+
+	return nil
+}
+
+// AddWatchOnlyWalletFlow 登记观察钱包流程
+func (cli *CLI) AddWatchOnlyWalletFlow() error {
+
+	if cli.api == nil {
+		return fmt.Errorf("local node is not registed")
+	}
+
+	walletID, err := console.InputText("Enter walletID: ", true)
+	if err != nil {
+		return err
+	}
+
+	input, err := console.InputText("Enter account public keys separated by comma (empty to watch all accounts): ", false)
+	if err != nil {
+		return err
+	}
+
+	publicKeys := make([]string, 0)
+	for _, pub := range strings.Split(input, ",") {
+		pub = strings.TrimSpace(pub)
+		if len(pub) > 0 {
+			publicKeys = append(publicKeys, pub)
+		}
+	}
+
+	wallet, accounts, err := cli.AddWatchOnlyWallet(walletID, publicKeys)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Watch-only wallet: %s has been added with %d accounts", wallet.WalletID, len(accounts))
+
+	return nil
+}
+
+// RemoveWatchOnlyWalletFlow 删除观察钱包流程
+func (cli *CLI) RemoveWatchOnlyWalletFlow() error {
+
+	walletID, err := console.InputText("Enter walletID: ", true)
+	if err != nil {
+		return err
+	}
+
+	err = cli.RemoveWatchOnlyWallet(walletID)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Watch-only wallet: %s has been removed", walletID)
+
+	return nil
+}
+
+// ExportTxFlow 导出未签名交易文件流程
+func (cli *CLI) ExportTxFlow(txType, out string) error {
+
+	var (
+		txFile *OfflineTxFile
+	)
+
+	if len(out) == 0 {
+		return fmt.Errorf("transaction output file is empty, use --out to set it")
+	}
+
+	if file.Exists(out) {
+		return fmt.Errorf("transaction file: %s already exists", out)
+	}
+
+	//:选择钱包
+	wallet, err := cli.SelectWalletStep()
+	if err != nil {
+		return err
+	}
+
+	//:选择账户
+	account, err := cli.SelectAccountStep(wallet.WalletID)
+	if err != nil {
+		return err
+	}
+
+	switch txType {
+	case OfflineTxTypeTransfer:
+
+		// 等待用户输入symbol
+		symbol, err := console.InputText("Enter symbol: ", true)
+		if err != nil {
+			return err
+		}
+
+		// 等待用户输入合约地址
+		contractAddress, err := console.InputText("Enter contract address: ", false)
+		if err != nil {
+			return err
+		}
+
+		// 等待用户输入接收地址
+		to, err := console.InputText("Enter received address: ", true)
+		if err != nil {
+			return err
+		}
+
+		// 等待用户输入发送数量
+		amount, err := console.InputRealNumber("Enter amount to send: ", true)
+		if err != nil {
+			return err
+		}
+
+		feeRate, err := cli.inputFeeRateStep()
+		if err != nil {
+			return err
+		}
+
+		memo, err := console.InputText("Enter memo: ", false)
+		if err != nil {
+			return err
+		}
+
+		txFile, err = cli.ExportTransferTx(account, symbol, contractAddress, to, amount, feeRate, memo)
+		if err != nil {
+			return err
+		}
+
+	case OfflineTxTypeSummary:
+
+		feeRate, err := cli.inputFeeRateStep()
+		if err != nil {
+			return err
+		}
+
+		memo, err := console.InputText("Enter memo: ", false)
+		if err != nil {
+			return err
+		}
+
+		txFile, err = cli.ExportSummaryTx(account, feeRate, memo)
+		if err != nil {
+			return err
+		}
+
+	case OfflineTxTypeTriggerABI:
+
+		// 等待用户输入合约地址
+		contractAddress, err := console.InputText("Enter contract address: ", true)
+		if err != nil {
+			return err
+		}
+
+		// 等待用户输入合约ABI JSON
+		abiJSonInput, err := console.InputText("Enter Contract ABI:", false)
+		if err != nil {
+			return err
+		}
+
+		// 等待用户输入ABI参数
+		abiInput, err := console.InputText("Enter ABI parameters: ", false)
+		if err != nil {
+			return err
+		}
+
+		feeRate, err := cli.inputFeeRateStep()
+		if err != nil {
+			return err
+		}
+
+		txFile, err = cli.ExportTriggerABITx(account, contractAddress, abiJSonInput, "0", feeRate, strings.Split(abiInput, ","))
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("transaction type: %s is not supported, it should be %s, %s or %s",
+			txType, OfflineTxTypeTransfer, OfflineTxTypeSummary, OfflineTxTypeTriggerABI)
+	}
+
+	err = SaveOfflineTxFile(out, txFile)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Export unsigned transaction file: %s successfully", out)
+
+	return nil
+}
+
+// SignTxFlow 离线签名交易文件流程
+func (cli *CLI) SignTxFlow(in, out string) error {
+
+	if len(in) == 0 {
+		return fmt.Errorf("transaction input file is empty, use --in to set it")
+	}
+
+	if len(out) == 0 {
+		out = in
+	}
+
+	txFile, err := LoadOfflineTxFile(in)
+	if err != nil {
+		return err
+	}
+
+	//打印交易摘要，用户确认后才签名
+	fmt.Println("------------------------------------------------------------------")
+	for _, line := range txFile.Summary {
+		fmt.Println(line)
+	}
+	fmt.Println("------------------------------------------------------------------")
+	for _, line := range txFile.Details() {
+		fmt.Println(line)
+	}
+	fmt.Println("------------------------------------------------------------------")
+
+	confirm, _ := console.Stdin.PromptConfirm("Do you want to sign these transactions?")
+	if !confirm {
+		return nil
+	}
+
+	// 等待用户输入密码
+	password, err := console.InputPassword(false, 3)
+	if err != nil {
+		return err
+	}
+
+	err = cli.SignOfflineTx(txFile, password)
+	if err != nil {
+		return err
+	}
+
+	err = SaveOfflineTxFile(out, txFile)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Sign transaction file: %s successfully", out)
+
+	return nil
+}
+
+// SubmitTxFlow 广播已签名交易文件流程
+func (cli *CLI) SubmitTxFlow(in string) error {
+
+	if len(in) == 0 {
+		return fmt.Errorf("transaction input file is empty, use --in to set it")
+	}
+
+	txFile, err := LoadOfflineTxFile(in)
+	if err != nil {
+		return err
+	}
+
+	return cli.SubmitOfflineTx(txFile)
+}
+
+// inputFeeRateStep 输入手续费率
+func (cli *CLI) inputFeeRateStep() (string, error) {
+
+	// 等待用户费率
+	feeRate, err := console.InputRealNumber("Enter fee rate: ", false)
+	if err != nil {
+		return "", err
+	}
+
+	feeRateDec, _ := decimal.NewFromString(feeRate)
+	if feeRateDec.LessThan(decimal.Zero) {
+		return "", fmt.Errorf("fee rate can not be negative")
+	}
+
+	return feeRate, nil
+}
+
+// StartSignerServerFlow 启动远程签名服务流程，只需要本地keystore，不需要连接openw-server
+func (cli *CLI) StartSignerServerFlow(ttl time.Duration) error {
+
+	err := CheckBackgroundProcess("signerserver")
+	if err != nil {
+		return err
+	}
+
+	wallets, err := getKeyDirWallets(cli.config.keydir)
+	if err != nil {
+		return err
+	}
+
+	if len(wallets) == 0 {
+		return fmt.Errorf("no local wallet keystore")
+	}
+
+	for _, w := range wallets {
+
+		log.Std.Notice("[Please enter password to unlock wallet: %s-%s]", w.Alias, w.WalletID)
+
+		// 等待用户输入密码
+		password, err := console.InputPassword(false, 3)
+		if err != nil {
+			return err
+		}
+
+		err = cli.UnlockWallet(&openwsdk.Wallet{WalletID: w.WalletID, Alias: w.Alias}, password, ttl)
+		if err != nil {
+			return err
+		}
+	}
+
+	//定时锁定已过期的钱包
+	relockTimer := timer.NewTask(1*time.Minute, cli.relockExpiredWallets)
+	relockTimer.Start()
+
+	return cli.ServeRemoteSigner(cli.config.signersocket)
+}
+
+// StartCoSignServerFlow 启动联合签名服务流程
+func (cli *CLI) StartCoSignServerFlow(address string) error {
+
+	var (
+		endRunning = make(chan bool, 1)
+	)
+
+	err := CheckBackgroundProcess("cosignserver")
+	if err != nil {
+		return err
+	}
+
+	//守护进程共用一个数据库句柄
+	err = cli.OpenDaemonDB()
+	if err != nil {
+		return err
+	}
+
+	err = cli.ServeCoSigner(address)
+	if err != nil {
+		return err
+	}
+
+	<-endRunning
+
+	return nil
+}
+
+// DaemonFlow 启动守护进程流程，同时运行转发节点、汇总任务和后台任务
+func (cli *CLI) DaemonFlow(file string, ttl time.Duration, unlock bool) error {
+
+	var (
+		summaryTask  *openwsdk.SummaryTask
+		summaryCycle time.Duration
+	)
+
+	shutdownTimeout := defaultShutdownTimeout
+	if len(cli.config.shutdowntimeout) > 0 {
+		timeout, err := time.ParseDuration(cli.config.shutdowntimeout)
+		if err != nil {
+			return fmt.Errorf("shutdowntimeout: %s is invalid: %v", cli.config.shutdowntimeout, err)
+		}
+		shutdownTimeout = timeout
+	}
+
+	err := cli.writeDaemonPidFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(cli.daemonPidFile())
+
+	if unlock {
+		// 解锁本地的钱包，发起转账和汇总不需要输入密码。
+		err = cli.unlockLocalWalletsByInputPassword(ttl)
+		if err != nil {
+			return err
+		}
+	}
+
+	//指定汇总任务文件时，启动后马上开始汇总，否则等待授信服务启动汇总任务
+	if len(file) > 0 {
+
+		cycleTime := cli.config.summaryperiod
+		if len(cycleTime) == 0 {
+			cycleTime = "1m"
+		}
+
+		summaryCycle, err = time.ParseDuration(cycleTime)
+		if err != nil {
+			return err
+		}
+
+		summaryTask, err = readSummaryTaskFile(file)
+		if err != nil {
+			return err
+		}
+
+		err = cli.inputSummaryTaskPasswords(summaryTask)
+		if err != nil {
+			return err
+		}
+
+		err = cli.checkSummaryTaskIsHaveSettings(summaryTask)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cli.RunDaemon(summaryTask, summaryCycle, shutdownTimeout)
+}
+
+// DaemonStatusFlow 查看守护进程运行状态，probe为live或ready时检查失败返回错误
+func (cli *CLI) DaemonStatusFlow(probe string) error {
+
+	health, err := cli.GetDaemonHealth()
+	if err != nil {
+		return err
+	}
+
+	printDaemonHealth(health)
+
+	switch probe {
+	case "":
+	case "live":
+		if !health.Live {
+			return fmt.Errorf("openw-cli daemon is not live")
+		}
+	case "ready":
+		if !health.Ready {
+			return fmt.Errorf("openw-cli daemon is not ready")
+		}
+	default:
+		return fmt.Errorf("probe: %s is not supported, it should be live or ready", probe)
+	}
+
+	return nil
+}
+
+// UnlockWalletFlow 选择钱包并输入密码，在运行中的守护进程解锁钱包会话，ttl为0时使用守护进程配置的unlockttl
+func (cli *CLI) UnlockWalletFlow(ttl time.Duration) error {
+
+	if ttl < 0 {
+		return fmt.Errorf("ttl can not be negative")
+	}
+
+	//:选择钱包
+	wallet, err := cli.SelectWalletStep()
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入密码
+	password, err := console.InputPassword(false, 3)
+	if err != nil {
+		return err
+	}
+
+	unlocked, err := cli.requestDaemonWalletSession(daemonUnlockWalletPath, &daemonWalletSessionRequest{
+		WalletID: wallet.WalletID,
+		Password: password,
+		TTL:      int64(ttl / time.Second),
+	})
+	if err != nil {
+		return err
+	}
+
+	if expireTime := unlocked[wallet.WalletID]; expireTime > 0 {
+		log.Infof("Wallet: %s has been unlocked until %s", wallet.WalletID, time.Unix(expireTime, 0).Format("2006-01-02 15:04:05"))
+	} else {
+		log.Infof("Wallet: %s has been unlocked until it is locked", wallet.WalletID)
+	}
+
+	return nil
+}
+
+// LockWalletFlow 在运行中的守护进程锁定钱包会话，all为true时锁定全部钱包
+func (cli *CLI) LockWalletFlow(all bool) error {
+
+	walletID := ""
+	if !all {
+		//:选择钱包
+		wallet, err := cli.SelectWalletStep()
+		if err != nil {
+			return err
+		}
+		walletID = wallet.WalletID
+	}
+
+	unlocked, err := cli.requestDaemonWalletSession(daemonLockWalletPath, &daemonWalletSessionRequest{
+		WalletID: walletID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if all {
+		log.Infof("All wallets have been locked")
+	} else {
+		log.Infof("Wallet: %s has been locked", walletID)
+	}
+	log.Infof("Unlocked wallets: %d", len(unlocked))
+
+	return nil
+}
+
+// RenameWalletFlow 修改钱包别名流程
+func (cli *CLI) RenameWalletFlow() error {
+
+	//:选择钱包
+	wallet, err := cli.SelectWalletStep()
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入钱包名字
+	alias, err := console.InputText("Enter wallet's new name: ", true)
+	if err != nil {
+		return err
+	}
+
+	err = checkWalletAlias(alias)
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入密码
+	password, err := console.InputPassword(false, 3)
+	if err != nil {
+		return err
+	}
+
+	err = cli.RenameWallet(wallet, alias, password)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Wallet: %s has been renamed to %s", wallet.WalletID, alias)
+
+	return nil
+}
+
+// ArchiveWalletFlow 归档钱包流程
+func (cli *CLI) ArchiveWalletFlow() error {
+
+	//:选择钱包
+	wallet, err := cli.SelectWalletStep()
+	if err != nil {
+		return err
+	}
+
+	confirm, _ := console.Stdin.PromptConfirm(fmt.Sprintf("Do you want to archive wallet: %s-%s?", wallet.Alias, wallet.WalletID))
+	if !confirm {
+		return nil
+	}
+
+	archivePath, err := cli.ArchiveWallet(wallet.WalletID)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Wallet: %s has been archived to %s", wallet.WalletID, archivePath)
+
+	return nil
+}
+
+// UnarchiveWalletFlow 恢复归档钱包流程
+func (cli *CLI) UnarchiveWalletFlow() error {
+
+	archived, err := cli.GetArchivedWallets()
+	if err != nil {
+		return err
+	}
+
+	if len(archived) == 0 {
+		return fmt.Errorf("No archived wallet ")
+	}
+
+	cli.printArchivedWalletList(archived)
+
+	fmt.Printf("[Please select a wallet] \n")
+
+	num, err := console.InputNumber("Enter wallet No.: ", true)
+	if err != nil {
+		return err
+	}
+
+	if int(num) >= len(archived) {
+		return fmt.Errorf("Input number is out of index! ")
+	}
+
+	keyPath, err := cli.UnarchiveWallet(archived[num].WalletID)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Wallet: %s has been restored to %s", archived[num].WalletID, keyPath)
+
+	return nil
+}
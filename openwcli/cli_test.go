@@ -6,6 +6,8 @@ import (
 	"github.com/blocktree/openwallet/v2/hdkeystore"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/owtp"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -34,6 +36,33 @@ func getTestOpenwCLI() *CLI {
 
 }
 
+// getTestLocalCLI 创建使用临时数据目录的CLI，只用于本地数据库的测试，测试结束后调用返回的函数删除临时目录
+func getTestLocalCLI(t *testing.T) (*CLI, func()) {
+
+	dir, err := ioutil.TempDir("", "openwcli-test")
+	if err != nil {
+		t.Fatalf("TempDir unexpected error: %v", err)
+	}
+
+	return newTestLocalCLI(dir, ""), func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// newTestLocalCLI 使用已有的数据目录创建CLI，用于同一目录的多个实例或不同的dbpassphrase
+func newTestLocalCLI(dir, passphrase string) *CLI {
+	cli := &CLI{
+		config: &Config{
+			appid:        "test",
+			datadir:      dir,
+			dbdir:        filepath.Join(dir, "db"),
+			dbpassphrase: passphrase,
+		},
+	}
+	os.MkdirAll(cli.config.dbdir, 0700)
+	return cli
+}
+
 func TestChangePwd(t *testing.T) {
 	cli := getTestOpenwCLI()
 	if cli == nil {
@@ -1,10 +1,13 @@
 package openwcli
 
 import (
+	"fmt"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/v2/common/file"
 	"github.com/blocktree/openwallet/v2/owtp"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // 默认配置
@@ -59,15 +62,149 @@ requesttimeout = 60
 # Terminal print log of debug 
 logdebug = false
 
+# Log format, text or json. Passwords, private keys, mnemonics and seed shares are redacted in both formats
+logformat = "text"
+
+# Days to keep rotated log files, 0 keeps all
+logmaxdays = 7
+
 # Enable trusted server connect with https or wss
 enabletrustserverssl = false
 
+# Enable human approval of transfers requested by trusted server
+enabletransferapproval = false
+
+# The transfers amount greater than threshold will wait for approval, 0 means all transfers
+# Thresholds can be set per coin or token: "default,SYMBOL:amount,SYMBOL/contractAddress:amount"
+# Tokens only match their contract threshold. Coins without a matched or default threshold always wait for approval
+transferapprovalthreshold = "0"
+
+# Unlocked wallet session will be locked after ttl, 0 means until it is locked manually
+unlockttl = "2h"
+
+# Unlocked wallet session will be locked after it is idle for a while, 0 means disable
+unlockidletimeout = "0"
+
+# Reject any trusted server request carrying wallet password, wallets must be unlocked locally
+rejectpasswordparam = false
+
+# Multiple trusted servers, separated by comma, every server is configured by a section with the same name.
+# When it is empty, the node only connect to [trustedserver].
+trustedservers = ""
+
+# The connect mode of multiple trusted servers. active: connect all servers; failover: connect the first available server
+trustservermode = "active"
+
+# Transaction signer backend. local: decrypt keystore in this process; remote: request the signer listening on signersocket;
+# pkcs11: sign by the private keys in a PKCS#11 token, the key object label is the address, build with -tags pkcs11
+signer = "local"
+
+# The unix socket of remote signer, it is also the socket of signerserver command
+signersocket = ""
+
+# PKCS#11 module library path, token label and user pin
+pkcs11module = ""
+pkcs11tokenlabel = ""
+pkcs11pin = ""
+
+# Co-signing threshold k, transactions must be approved by k co-signers before signing, 0 means disable
+cosignthreshold = 0
+
+# Co-signers, separated by comma, every co-signer is configured by a section with the same name
+cosigners = ""
+
+# The node IDs of custody nodes allowed to request co-signature when this node runs cosignserver, separated by comma
+cosignclients = ""
+
+# The key file to encrypt sensitive fields of local database, default is datadir/datakey.
+# The default key file sits next to the database and only protects against the database file leaking alone,
+# keep the key file outside datadir (another disk, secret mount) to protect against the whole datadir leaking
+dbkeyfile = ""
+
+# Derive the database key from passphrase instead of key file. It can not be changed after the database is encrypted.
+# Do not write the passphrase here in production, use dbpassphrase_file or the environment variable OPENW_DBPASSPHRASE
+dbpassphrase = ""
+
+# Migrate local database schema automatically when openw-cli starts, otherwise run dbmigrate up.
+# The migration encrypting sensitive fields is never run automatically, run dbmigrate up after dbkeyfile or dbpassphrase is set
+dbautomigrate = true
+
+# The unix socket of trustserver, startsum, cosignserver and daemon, query commands read database through it while they are running.
+# Default is datadir/openw-cli.sock
+daemonsocket = ""
+
+# The pid file of daemon command, default is ./pid/daemon.pid
+pidfile = ""
+
+# How long daemon waits for running jobs and requests to finish when it receives SIGINT or SIGTERM
+shutdowntimeout = "30s"
+
+# Enable local admin JSON-RPC API when daemon is running
+enableadminapi = false
+
+# The unix socket of admin API, default is datadir/openw-admin.sock
+adminsocket = ""
+
+# Also serve admin API on TCP address, such as 127.0.0.1:9099. admintoken, admintlscert and admintlskey are required
+adminlisten = ""
+
+# Requests must carry header "Authorization: Bearer <admintoken>" when it is set
+admintoken = ""
+
+# The TLS certificate and key files of admin API on TCP, the token and wallet password are never sent in plaintext
+admintlscert = ""
+admintlskey = ""
+
+# Post operational events as JSON to these webhook URLs, separated by comma
+notifywebhooks = ""
+
+# Run this local command for each event, the event JSON is passed on stdin and the event type in OPENW_EVENT
+notifycommand = ""
+
+# Only notify these events, separated by comma. Empty notifies all events:
+# transfer.sent, transfer.failed, summary.completed, feessupport.lowbalance,
+# trustserver.disconnected, trustlist.changed, trustlist.rejected
+notifyevents = ""
+
+# Sign webhook body with HMAC-SHA256, sent in header "X-Openw-Signature: sha256=<hex>"
+notifysecret = ""
+
+# Stop retrying a notification after this many failed attempts
+notifymaxattempts = 10
+
+# Serve Prometheus metrics on http://<metricslisten>/metrics, such as 127.0.0.1:9100. Empty is disabled
+metricslisten = ""
+
+# Every key can be overridden by environment variable OPENW_<KEY>, such as OPENW_APPKEY, OPENW_PRODUCTION_ADDRESS.
+# An empty environment variable also overrides this file.
+# Secrets can be read from files by OPENW_<KEY>_FILE or <key>_file, such as appkey_file = "/run/secrets/appkey"
+
+# [cosigner1]
+# address = "cosigner1.blocktree.top:9090"
+# enablessl = true
+# publickey = ""
+
+# [production]
+# address = "client.blocktree.top"
+# enablessl = true
+# enablerequesttransfer = true
+# enableexecutesummarytask = false
+# enableeditsummarysettings = false
+# publickey = ""
+
 `
 
 	keyDirName     = "key"
 	dbDirName      = "db"
 	exportDirName  = "export"
 	addressDirName = "address"
+	archiveDirName = "archive"
+
+	trustServerModeActive   = "active"
+	trustServerModeFailover = "failover"
+
+	defaultUnlockTTL         = "2h"
+	defaultUnlockIdleTimeout = "0"
 )
 
 var (
@@ -118,14 +255,121 @@ type Config struct {
 	localname string
 	//是否输出LogDebugg日志
 	logdebug bool
+	//日志格式，text或json
+	logformat string
+	//日志文件保留天数
+	logmaxdays int
 	//导出路径
 	exportdir string
 	//导出地址路径
 	exportaddressdir string
+	//归档钱包keystore路径
+	archivedir string
 	//开启SSL访问授信节点
 	enabletrustserverssl bool
+	//是否开启远程转账请求的人工审批
+	enabletransferapproval bool
+	//转账数量超过阈值需要人工审批，可以按币种和合约配置
+	transferapprovalthreshold string
+	//钱包解锁会话有效时间
+	unlockttl time.Duration
+	//钱包解锁会话空闲超时
+	unlockidletimeout time.Duration
+	//是否拒绝携带钱包密码的请求
+	rejectpasswordparam bool
+	//多个授信服务的连接模式
+	trustservermode string
+	//授信服务列表
+	trustservers []*TrustServerConfig
+	//签名后端：local，remote，pkcs11
+	signer string
+	//远程签名服务的unix socket
+	signersocket string
+	//PKCS#11模块路径
+	pkcs11module string
+	//PKCS#11 token标签
+	pkcs11tokenlabel string
+	//PKCS#11 用户PIN
+	pkcs11pin string
+	//联合签名门限
+	cosignthreshold int
+	//联合签名节点列表
+	cosigners []*CoSignerConfig
+	//允许请求联合签名的托管节点ID
+	cosignclients []string
+	//数据库字段加密的密钥文件
+	dbkeyfile string
+	//数据库字段加密的口令
+	dbpassphrase string
+	//启动时自动迁移数据库结构
+	dbautomigrate bool
+	//守护进程的本地socket
+	daemonsocket string
+	//daemon命令的pid文件
+	pidfile string
+	//daemon退出时等待任务结束的时间
+	shutdowntimeout string
+	//开启管理接口
+	enableadminapi bool
+	//管理接口的本地socket
+	adminsocket string
+	//管理接口的TCP监听地址
+	adminlisten string
+	//管理接口的访问令牌
+	admintoken string
+	//管理接口TCP监听的TLS证书
+	admintlscert string
+	//管理接口TCP监听的TLS私钥
+	admintlskey string
+	//Prometheus指标服务的监听地址
+	metricslisten string
+	//事件通知的webhook地址，逗号分隔
+	notifywebhooks string
+	//事件通知执行的本地命令
+	notifycommand string
+	//需要通知的事件，逗号分隔，为空时通知所有事件
+	notifyevents string
+	//webhook签名密钥
+	notifysecret string
+	//通知最大发送次数
+	notifymaxattempts int
 	//db是否只读模式
-	//dbReadOnlyMode bool
+	dbReadOnlyMode bool
+}
+
+// SetDBReadOnlyMode 查询命令以只读方式打开数据库，守护进程运行时通过守护进程读取
+func (c *Config) SetDBReadOnlyMode(readOnly bool) {
+	c.dbReadOnlyMode = readOnly
+}
+
+// 授信服务配置
+type TrustServerConfig struct {
+	//配置名
+	name string
+	//连接的节点ID
+	hostID string
+	//服务地址
+	address string
+	//是否开启SSL
+	enablessl bool
+	//是否接受该授信服务发起的转账请求
+	enablerequesttransfer bool
+	//是否接受该授信服务执行汇总任务
+	enableexecutesummarytask bool
+	//是否接收该授信服务修改钱包汇总设置
+	enableeditsummarysettings bool
+	//固定的授信服务公钥，为空不检查
+	publickey string
+}
+
+// Name 授信服务配置名
+func (ts *TrustServerConfig) Name() string {
+	return ts.name
+}
+
+// Address 授信服务地址
+func (ts *TrustServerConfig) Address() string {
+	return ts.address
 }
 
 // 初始化一个配置对象
@@ -145,22 +389,59 @@ func NewConfig(c config.Configer) *Config {
 	conf.enablessl, _ = c.Bool("enablessl")
 	conf.requesttimeout, _ = c.Int("requesttimeout")
 	conf.logdebug, _ = c.Bool("logdebug")
+	conf.logformat = c.String("logformat")
+	conf.logmaxdays = c.DefaultInt("logmaxdays", defaultLogMaxDays)
 	conf.enabletrustserverssl, _ = c.Bool("enabletrustserverssl")
 
+	conf.enabletransferapproval, _ = c.Bool("enabletransferapproval")
+	conf.transferapprovalthreshold = c.DefaultString("transferapprovalthreshold", "0")
+	conf.unlockttl, _ = parseConfigDuration(c, "unlockttl", defaultUnlockTTL)
+	conf.unlockidletimeout, _ = parseConfigDuration(c, "unlockidletimeout", defaultUnlockIdleTimeout)
+	conf.rejectpasswordparam, _ = c.Bool("rejectpasswordparam")
+	conf.trustservermode = c.DefaultString("trustservermode", trustServerModeActive)
+	conf.trustservers = newTrustServerConfigs(c, conf)
+	conf.signer = c.DefaultString("signer", SignerLocal)
+	conf.signersocket = c.String("signersocket")
+	conf.pkcs11module = c.String("pkcs11module")
+	conf.pkcs11tokenlabel = c.String("pkcs11tokenlabel")
+	conf.pkcs11pin = c.String("pkcs11pin")
+	conf.cosignthreshold, _ = c.Int("cosignthreshold")
+	conf.cosigners = newCoSignerConfigs(c)
+	conf.cosignclients = splitConfigList(c.String("cosignclients"))
+	conf.dbkeyfile = c.String("dbkeyfile")
+	conf.dbpassphrase = c.String("dbpassphrase")
+	conf.dbautomigrate = c.DefaultBool("dbautomigrate", true)
+	conf.daemonsocket = c.String("daemonsocket")
+	conf.pidfile = c.String("pidfile")
+	conf.shutdowntimeout = c.String("shutdowntimeout")
+	conf.enableadminapi, _ = c.Bool("enableadminapi")
+	conf.adminsocket = c.String("adminsocket")
+	conf.adminlisten = c.String("adminlisten")
+	conf.admintoken = c.String("admintoken")
+	conf.admintlscert = c.String("admintlscert")
+	conf.admintlskey = c.String("admintlskey")
+	conf.metricslisten = c.String("metricslisten")
+	conf.notifywebhooks = c.String("notifywebhooks")
+	conf.notifycommand = c.String("notifycommand")
+	conf.notifyevents = c.String("notifyevents")
+	conf.notifysecret = c.String("notifysecret")
+	conf.notifymaxattempts = c.DefaultInt("notifymaxattempts", defaultNotifyMaxAttempts)
+
 	conf.keydir = filepath.Join(conf.datadir, keyDirName)
 	conf.dbdir = filepath.Join(conf.datadir, dbDirName)
 	conf.exportdir = filepath.Join(conf.datadir, exportDirName)
 	conf.exportaddressdir = filepath.Join(conf.exportdir, addressDirName)
+	conf.archivedir = filepath.Join(conf.datadir, archiveDirName)
 
 	//默认使用命令行编译时附带的appid和appkey
 	conf.appid = FixAppID
 	conf.appkey = FixAppKey
 
-	//读取配置文件的appkey和appid
+	//读取配置文件或环境变量的appkey和appid
 	appkey := c.String("appkey")
 	appid := c.String("appid")
 
-	//配置文件的appid和appkey有值即覆盖填充
+	//配置文件或环境变量的appid和appkey有值即覆盖填充
 	if len(appkey) > 0 {
 		conf.appkey = appkey
 	}
@@ -174,13 +455,109 @@ func NewConfig(c config.Configer) *Config {
 	file.MkdirAll(conf.keydir)
 	file.MkdirAll(conf.dbdir)
 	file.MkdirAll(conf.exportaddressdir)
+	file.MkdirAll(conf.archivedir)
 
 	owtp.Debug = conf.logdebug
 
 	return conf
 }
 
-// 加载工具配置
+// parseConfigDuration 解析时长配置，格式错误或为负数时返回错误
+func parseConfigDuration(c config.Configer, key, defaultValue string) (time.Duration, error) {
+	value := c.DefaultString(key, defaultValue)
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s is invalid: %v", key, value, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s: %s can not be negative", key, value)
+	}
+	return d, nil
+}
+
+// checkConfig 检查配置格式，解锁会话的时长写错时不能当作0（直到手动锁定）处理
+func checkConfig(c config.Configer) error {
+	if _, err := parseConfigDuration(c, "unlockttl", defaultUnlockTTL); err != nil {
+		return err
+	}
+	if _, err := parseConfigDuration(c, "unlockidletimeout", defaultUnlockIdleTimeout); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newTrustServerConfigs 加载授信服务列表，没有配置trustedservers时，使用trustedserver作为唯一的授信服务
+func newTrustServerConfigs(c config.Configer, conf *Config) []*TrustServerConfig {
+
+	servers := make([]*TrustServerConfig, 0)
+
+	names := strings.Split(c.String("trustedservers"), ",")
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		section := name + "::"
+		servers = append(servers, &TrustServerConfig{
+			name:                      name,
+			hostID:                    trustHostID + "-" + name,
+			address:                   c.String(section + "address"),
+			enablessl:                 c.DefaultBool(section+"enablessl", conf.enabletrustserverssl),
+			enablerequesttransfer:     c.DefaultBool(section+"enablerequesttransfer", conf.enablerequesttransfer),
+			enableexecutesummarytask:  c.DefaultBool(section+"enableexecutesummarytask", conf.enableexecutesummarytask),
+			enableeditsummarysettings: c.DefaultBool(section+"enableeditsummarysettings", conf.enableeditsummarysettings),
+			publickey:                 c.String(section + "publickey"),
+		})
+	}
+
+	if len(servers) == 0 && len(conf.trustedserver) > 0 {
+		servers = append(servers, &TrustServerConfig{
+			name:                      "default",
+			hostID:                    trustHostID,
+			address:                   conf.trustedserver,
+			enablessl:                 conf.enabletrustserverssl,
+			enablerequesttransfer:     conf.enablerequesttransfer,
+			enableexecutesummarytask:  conf.enableexecutesummarytask,
+			enableeditsummarysettings: conf.enableeditsummarysettings,
+		})
+	}
+
+	return servers
+}
+
+// newCoSignerConfigs 加载联合签名节点列表
+func newCoSignerConfigs(c config.Configer) []*CoSignerConfig {
+
+	cosigners := make([]*CoSignerConfig, 0)
+
+	for _, name := range splitConfigList(c.String("cosigners")) {
+		section := name + "::"
+		cosigners = append(cosigners, &CoSignerConfig{
+			name:      name,
+			hostID:    coSignerHostIDPrefix + name,
+			address:   c.String(section + "address"),
+			enablessl: c.DefaultBool(section+"enablessl", false),
+			publickey: c.String(section + "publickey"),
+		})
+	}
+
+	return cosigners
+}
+
+// splitConfigList 分割逗号分隔的配置项，忽略空值
+func splitConfigList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// 加载工具配置，环境变量OPENW_<KEY>和密钥文件可覆盖配置文件，用于容器部署
 func LoadConfig(path string) (*Config, error) {
 
 	c, err := config.NewConfig("ini", path)
@@ -188,7 +565,16 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	conf := NewConfig(c)
+	ec := newEnvConfiger(c)
+	err = checkConfig(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := NewConfig(ec)
+	if ec.err != nil {
+		return nil, ec.err
+	}
 	return conf, nil
 }
 
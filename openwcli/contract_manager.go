@@ -16,7 +16,6 @@
 package openwcli
 
 import (
-	"encoding/json"
 	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
@@ -52,14 +51,22 @@ func (cli *CLI) CallABI(account *openwsdk.Account, contractAddress string, abiPa
 	}
 
 	api := cli.api
-	err = api.CallSmartContractABI(account.AccountID, coin, abiParam, "", 0,
-		true, func(status uint64, msg string, callResult *openwsdk.SmartContractCallResult) {
-			if status != owtp.StatusSuccess {
-				createErr = openwallet.Errorf(status, msg)
-				return
-			}
-			retCallResult = callResult
-		})
+	err = cli.callAPI("CallSmartContractABI", func() error {
+		var statusErr error
+		err := api.CallSmartContractABI(account.AccountID, coin, abiParam, "", 0,
+			true, func(status uint64, msg string, callResult *openwsdk.SmartContractCallResult) {
+				statusErr = apiStatusError(status, msg)
+				if status != owtp.StatusSuccess {
+					createErr = openwallet.Errorf(status, msg)
+					return
+				}
+				retCallResult = callResult
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, openwallet.ConvertError(err)
 	}
@@ -89,55 +96,22 @@ func (cli *CLI) CallABI(account *openwsdk.Account, contractAddress string, abiPa
 func (cli *CLI) TriggerABI(wallet *openwsdk.Wallet, account *openwsdk.Account, symbol, contractAddress, contractABI, amount, sid, feeRate, password string, abiParam []string, raw string, rawType uint64, awaitResult bool) (*openwsdk.SmartContractReceipt, *openwallet.Error) {
 
 	var (
-		isContract  bool
 		retReceipt  *openwsdk.SmartContractReceipt
 		retTx       []*openwsdk.SmartContractReceipt
 		retFailed   []*openwsdk.FailureSmartContractLog
 		retRawTx    *openwsdk.SmartContractRawTransaction
 		err         error
 		createErr   *openwallet.Error
-		contractID  string
 		tokenSymbol string
 	)
 
-	if len(password) == 0 {
-		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "unlock wallet password is empty. ")
-	}
-
 	//获取种子文件
-	key, err := cli.getLocalKeyByWallet(wallet, password)
+	key, err := cli.getSignerKey(wallet, password)
 	if err != nil {
 		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, err.Error())
 	}
 
-	if len(contractAddress) > 0 {
-		isContract = true
-		token, findErr := cli.GetTokenContractList("Symbol", account.Symbol, "Address", contractAddress)
-		if findErr == nil && len(token) > 0 {
-			contractID = token[0].ContractID
-			tokenSymbol = token[0].Token
-		}
-	}
-	coin := openwsdk.Coin{
-		Symbol:          symbol,
-		IsContract:      isContract,
-		ContractID:      contractID,
-		ContractAddress: contractAddress,
-		ContractABI:     contractABI,
-	}
-
-	api := cli.api
-	err = api.CreateSmartContractTrade(sid, account.AccountID, coin, abiParam, raw, rawType, feeRate, amount,
-		true, func(status uint64, msg string, rawTx *openwsdk.SmartContractRawTransaction) {
-			if status != owtp.StatusSuccess {
-				createErr = openwallet.Errorf(status, msg)
-				return
-			}
-			retRawTx = rawTx
-		})
-	if err != nil {
-		return nil, openwallet.ConvertError(err)
-	}
+	retRawTx, tokenSymbol, createErr = cli.createSmartContractRawTx(account, symbol, contractAddress, contractABI, amount, sid, feeRate, abiParam, raw, rawType)
 	if createErr != nil {
 		return nil, createErr
 	}
@@ -145,7 +119,7 @@ func (cli *CLI) TriggerABI(wallet *openwsdk.Wallet, account *openwsdk.Account, s
 	//:打印交易单明细
 	log.Infof("-----------------------------------------------")
 	log.Infof("[%s %s TriggerABI]", account.Symbol, tokenSymbol)
-	log.Infof("SID: %s", retRawTx.Sid)
+	log.Infof("%s", LogFields("sid", retRawTx.Sid))
 	log.Infof("From Account: %s", account.AccountID)
 	log.Infof("Contract Address: %s", contractAddress)
 	log.Infof("ABI Param: %s", strings.Join(abiParam, ","))
@@ -153,7 +127,7 @@ func (cli *CLI) TriggerABI(wallet *openwsdk.Wallet, account *openwsdk.Account, s
 	log.Infof("-----------------------------------------------")
 
 	//签名交易单
-	signatures, sigErr := cli.txSigner(retRawTx.Signatures, key)
+	signatures, sigErr := cli.signSmartContractRawTransaction(retRawTx, account.AccountID, symbol, contractAddress, amount, key)
 	if sigErr != nil {
 		return nil, openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, sigErr.Error())
 	}
@@ -161,16 +135,24 @@ func (cli *CLI) TriggerABI(wallet *openwsdk.Wallet, account *openwsdk.Account, s
 	retRawTx.AwaitResult = awaitResult
 	retRawTx.AwaitTimeout = uint64(cli.config.requesttimeout)
 	//广播交易单
-	err = api.SubmitSmartContractTrade([]*openwsdk.SmartContractRawTransaction{retRawTx}, true,
-		func(status uint64, msg string, successTx []*openwsdk.SmartContractReceipt, failedRawTxs []*openwsdk.FailureSmartContractLog) {
-			if status != owtp.StatusSuccess {
-				createErr = openwallet.Errorf(status, msg)
-				return
-			}
+	err = cli.callAPI("SubmitSmartContractTrade", func() error {
+		var statusErr error
+		err := cli.api.SubmitSmartContractTrade([]*openwsdk.SmartContractRawTransaction{retRawTx}, true,
+			func(status uint64, msg string, successTx []*openwsdk.SmartContractReceipt, failedRawTxs []*openwsdk.FailureSmartContractLog) {
+				statusErr = apiStatusError(status, msg)
+				if status != owtp.StatusSuccess {
+					createErr = openwallet.Errorf(status, msg)
+					return
+				}
 
-			retTx = successTx
-			retFailed = failedRawTxs
-		})
+				retTx = successTx
+				retFailed = failedRawTxs
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, openwallet.ConvertError(err)
 	}
@@ -181,7 +163,7 @@ func (cli *CLI) TriggerABI(wallet *openwsdk.Wallet, account *openwsdk.Account, s
 	if len(retTx) > 0 {
 		//打印交易单
 		log.Info("send transaction successfully.")
-		log.Info("transaction id:", retTx[0].TxID)
+		log.Infof("transaction has been sent, %s", LogFields("txid", retTx[0].TxID))
 		retReceipt = retTx[0]
 	} else if len(retFailed) > 0 {
 		//打印交易单
@@ -189,16 +171,7 @@ func (cli *CLI) TriggerABI(wallet *openwsdk.Wallet, account *openwsdk.Account, s
 		tx := retFailed[0]
 		log.Warningf("[Failed] reason: %s", tx.Reason)
 		if tx.RawTx != nil {
-			log.Warningf("[Failed] rawHex: %s", tx.RawTx.Raw)
-			for accountID, signatures := range tx.RawTx.Signatures {
-				log.Warningf("[Failed] signature accountID: %s", accountID)
-				for _, keySignature := range signatures {
-					signaturesJSON, jsonErr := json.Marshal(keySignature)
-					if jsonErr == nil {
-						log.Warningf("[Failed] keySignature: %s", string(signaturesJSON))
-					}
-				}
-			}
+			logFailedSignatures(tx.RawTx.Raw, tx.RawTx.Signatures)
 		}
 
 		return nil, openwallet.Errorf(openwallet.ErrSubmitRawSmartContractTransactionFailed, tx.Reason)
@@ -220,3 +193,56 @@ func (cli *CLI) TriggerABI(wallet *openwsdk.Wallet, account *openwsdk.Account, s
 
 	return retReceipt, nil
 }
+
+// createSmartContractRawTx 创建智能合约交易单，返回待签名的交易单和代币symbol
+func (cli *CLI) createSmartContractRawTx(account *openwsdk.Account, symbol, contractAddress, contractABI, amount, sid, feeRate string, abiParam []string, raw string, rawType uint64) (*openwsdk.SmartContractRawTransaction, string, *openwallet.Error) {
+
+	var (
+		isContract  bool
+		retRawTx    *openwsdk.SmartContractRawTransaction
+		createErr   *openwallet.Error
+		contractID  string
+		tokenSymbol string
+	)
+
+	if len(contractAddress) > 0 {
+		isContract = true
+		token, findErr := cli.GetTokenContractList("Symbol", account.Symbol, "Address", contractAddress)
+		if findErr == nil && len(token) > 0 {
+			contractID = token[0].ContractID
+			tokenSymbol = token[0].Token
+		}
+	}
+	coin := openwsdk.Coin{
+		Symbol:          symbol,
+		IsContract:      isContract,
+		ContractID:      contractID,
+		ContractAddress: contractAddress,
+		ContractABI:     contractABI,
+	}
+
+	err := cli.callAPI("CreateSmartContractTrade", func() error {
+		var statusErr error
+		err := cli.api.CreateSmartContractTrade(sid, account.AccountID, coin, abiParam, raw, rawType, feeRate, amount,
+			true, func(status uint64, msg string, rawTx *openwsdk.SmartContractRawTransaction) {
+				statusErr = apiStatusError(status, msg)
+				if status != owtp.StatusSuccess {
+					createErr = openwallet.Errorf(status, msg)
+					return
+				}
+				retRawTx = rawTx
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
+	if err != nil {
+		return nil, "", openwallet.ConvertError(err)
+	}
+	if createErr != nil {
+		return nil, "", createErr
+	}
+
+	return retRawTx, tokenSymbol, nil
+}
@@ -0,0 +1,491 @@
+package openwcli
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/owtp"
+)
+
+const (
+	//联合签名节点的路由方法
+	coSignTransactionMethod = "coSignTransaction"
+	//联合签名节点的hostID前缀
+	coSignerHostIDPrefix = "CoSigner-"
+	//联合签名请求允许的时间偏差
+	coSignRequestMaxSkew = 5 * time.Minute
+	//默认的联合签名服务监听地址
+	defaultCoSignServerAddress = ":9090"
+
+	//联合签名请求的类型
+	coSignKindTransfer   = "transfer"
+	coSignKindTriggerABI = "triggerABI"
+	coSignKindSignHash   = "signHash"
+)
+
+// CoSignerConfig 联合签名节点配置
+type CoSignerConfig struct {
+	//配置名
+	name string
+	//连接的节点ID
+	hostID string
+	//服务地址
+	address string
+	//是否开启SSL
+	enablessl bool
+	//联合签名节点证书的公钥，用于校验审批签名
+	publickey string
+}
+
+// Name 联合签名节点配置名
+func (cs *CoSignerConfig) Name() string {
+	return cs.name
+}
+
+// CoSignRequest 联合签名请求，联合签名节点对请求摘要签名表示审批通过
+// 联合签名节点只能校验To和数量是否符合自己的策略，无法解析各链的交易哈希，
+// Messages与To的对应关系需要链上多签或openw-server校验，本模式不能防止托管节点伪造Messages
+type CoSignRequest struct {
+	Kind      string            `json:"kind"`
+	AppID     string            `json:"appID"`
+	NodeID    string            `json:"nodeID"`
+	WalletID  string            `json:"walletID"`
+	AccountID string            `json:"accountID"`
+	Sid       string            `json:"sid"`
+	Symbol    string            `json:"symbol"`
+	To        map[string]string `json:"to"`
+	Fees      string            `json:"fees"`
+	//待签名的交易哈希，已排序
+	Messages []string `json:"messages"`
+	Time     int64    `json:"time"`
+}
+
+// Digest 请求摘要，字段按固定顺序拼接后sha256
+func (r *CoSignRequest) Digest() []byte {
+
+	addresses := make([]string, 0, len(r.To))
+	for address := range r.To {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	to := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		to = append(to, address+"="+r.To[address])
+	}
+
+	fields := []string{
+		r.Kind, r.AppID, r.NodeID, r.WalletID, r.AccountID, r.Sid, r.Symbol,
+		strings.Join(to, ","), r.Fees, strings.Join(r.Messages, ","),
+		fmt.Sprintf("%d", r.Time),
+	}
+	digest := sha256.Sum256([]byte(strings.Join(fields, "|")))
+	return digest[:]
+}
+
+// CoSignApproval 联合签名节点的审批签名
+type CoSignApproval struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+// coSignEnabled 是否开启联合签名
+func (cli *CLI) coSignEnabled() bool {
+	return cli.config.cosignthreshold > 0
+}
+
+// newCoSignRequest 根据待签名的哈希创建联合签名请求
+func (cli *CLI) newCoSignRequest(kind, walletID, accountID, sid, symbol string, to map[string]string, fees string, signatures map[string][]*openwsdk.KeySignature) *CoSignRequest {
+
+	messages := make([]string, 0)
+	for _, keySignatures := range signatures {
+		for _, ks := range keySignatures {
+			messages = append(messages, ks.Message)
+		}
+	}
+	sort.Strings(messages)
+
+	nodeID := ""
+	if cli.coSignNode != nil {
+		nodeID = cli.coSignNode.NodeID()
+	}
+
+	return &CoSignRequest{
+		Kind:      kind,
+		AppID:     cli.config.appid,
+		NodeID:    nodeID,
+		WalletID:  walletID,
+		AccountID: accountID,
+		Sid:       sid,
+		Symbol:    symbol,
+		To:        to,
+		Fees:      fees,
+		Messages:  messages,
+		Time:      time.Now().Unix(),
+	}
+}
+
+// signRawTransaction 签名转账交易单
+func (cli *CLI) signRawTransaction(rawTx *openwsdk.RawTransaction, key *hdkeystore.HDKey) (map[string][]*openwsdk.KeySignature, error) {
+	req := cli.newCoSignRequest(coSignKindTransfer, key.KeyID, rawTx.AccountID, rawTx.Sid, rawTx.Coin.Symbol, rawTx.To, rawTx.Fees, rawTx.Signatures)
+	return cli.signWithCoSign(req, rawTx.Signatures, key)
+}
+
+// signSmartContractRawTransaction 签名合约交易单，审批的目标为合约地址和转入合约的数量
+func (cli *CLI) signSmartContractRawTransaction(rawTx *openwsdk.SmartContractRawTransaction, accountID, symbol, contractAddress, amount string, key *hdkeystore.HDKey) (map[string][]*openwsdk.KeySignature, error) {
+	to := map[string]string{contractAddress: amount}
+	req := cli.newCoSignRequest(coSignKindTriggerABI, key.KeyID, accountID, rawTx.Sid, symbol, to, rawTx.Fees, rawTx.Signatures)
+	return cli.signWithCoSign(req, rawTx.Signatures, key)
+}
+
+// approveSignHash 哈希签名在本地派生私钥签名，开启联合签名时先取得审批，与交易签名使用相同的门限
+func (cli *CLI) approveSignHash(walletID string, address *openwsdk.Address, symbol, message string) error {
+
+	if !cli.coSignEnabled() {
+		return nil
+	}
+
+	signatures := map[string][]*openwsdk.KeySignature{
+		address.AccountID: {{Message: message}},
+	}
+	req := cli.newCoSignRequest(coSignKindSignHash, walletID, address.AccountID, "", symbol, map[string]string{address.Address: ""}, "", signatures)
+
+	approvals, err := cli.RequestCoSignatures(req)
+	if err != nil {
+		return err
+	}
+	log.Infof("%s address: %s is approved by %d co-signers", req.Kind, address.Address, len(approvals))
+
+	return nil
+}
+
+// signWithCoSign 所有交易签名的统一入口，开启联合签名时，先取得k个不同联合签名节点对请求的审批才签名。
+// 签名后端为remote时，审批随签名请求发送，由持有私钥的远程签名服务再次校验，托管节点跳过审批无法签名
+func (cli *CLI) signWithCoSign(req *CoSignRequest, signatures map[string][]*openwsdk.KeySignature, key *hdkeystore.HDKey) (map[string][]*openwsdk.KeySignature, error) {
+
+	if !cli.coSignEnabled() {
+		return cli.txSigner(signatures, key)
+	}
+
+	approvals, err := cli.RequestCoSignatures(req)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("%s is approved by %d co-signers, %s", req.Kind, len(approvals), LogFields("sid", req.Sid))
+
+	if cli.config.signer == SignerRemote {
+		return remoteSignTxHash(cli.config.signersocket, time.Duration(cli.config.requesttimeout)*time.Second, &remoteSignRequest{
+			WalletID:   key.KeyID,
+			Signatures: signatures,
+			CoSign:     req,
+			Approvals:  approvals,
+		})
+	}
+
+	return cli.txSigner(signatures, key)
+}
+
+// distinctCoSigners 按公钥去重的联合签名节点，同一个公钥配置多次只计算一次
+func (cli *CLI) distinctCoSigners() map[string]*CoSignerConfig {
+	cosigners := make(map[string]*CoSignerConfig)
+	for _, cs := range cli.config.cosigners {
+		if len(cs.publickey) == 0 {
+			continue
+		}
+		if _, exist := cosigners[cs.publickey]; !exist {
+			cosigners[cs.publickey] = cs
+		}
+	}
+	return cosigners
+}
+
+// RequestCoSignatures 向配置的联合签名节点请求审批，校验签名，不同公钥的审批达到门限返回审批列表
+func (cli *CLI) RequestCoSignatures(req *CoSignRequest) ([]*CoSignApproval, error) {
+
+	var (
+		approvals = make([]*CoSignApproval, 0)
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+	)
+
+	threshold := cli.config.cosignthreshold
+	cosigners := cli.distinctCoSigners()
+	if len(cosigners) < threshold {
+		return nil, fmt.Errorf("co-signers with distinct public keys: %d are less than threshold: %d", len(cosigners), threshold)
+	}
+
+	node, err := cli.getCoSignNode()
+	if err != nil {
+		return nil, err
+	}
+
+	digest := req.Digest()
+
+	for _, cosigner := range cosigners {
+		wg.Add(1)
+		go func(cosigner *CoSignerConfig) {
+			defer wg.Done()
+
+			approval, reqErr := cli.requestCoSignature(node, cosigner, req, digest)
+			if reqErr != nil {
+				log.Warningf("co-signer: %s rejected %s, reason: %v, %s", cosigner.name, req.Kind, reqErr, LogFields("sid", req.Sid))
+				return
+			}
+
+			mu.Lock()
+			approvals = append(approvals, approval)
+			mu.Unlock()
+		}(cosigner)
+	}
+
+	wg.Wait()
+
+	if len(approvals) < threshold {
+		return nil, fmt.Errorf("%s sid: %s is approved by %d co-signers, less than threshold: %d", req.Kind, req.Sid, len(approvals), threshold)
+	}
+
+	return approvals, nil
+}
+
+// VerifyCoSignApprovals 校验审批签名，只计算配置的不同公钥的有效签名，达到门限才通过
+func (cli *CLI) VerifyCoSignApprovals(req *CoSignRequest, approvals []*CoSignApproval) error {
+
+	if req == nil {
+		return fmt.Errorf("co-sign request is missing")
+	}
+
+	threshold := cli.config.cosignthreshold
+	cosigners := cli.distinctCoSigners()
+	digest := req.Digest()
+
+	approved := make(map[string]bool)
+	for _, approval := range approvals {
+		if _, pinned := cosigners[approval.PublicKey]; !pinned || approved[approval.PublicKey] {
+			continue
+		}
+		if VerifyCoSignature(approval.PublicKey, digest, approval.Signature) != nil {
+			continue
+		}
+		approved[approval.PublicKey] = true
+	}
+
+	if len(approved) < threshold {
+		return fmt.Errorf("%s sid: %s has %d valid co-signer approvals, less than threshold: %d", req.Kind, req.Sid, len(approved), threshold)
+	}
+
+	return nil
+}
+
+// requestCoSignature 请求单个联合签名节点
+func (cli *CLI) requestCoSignature(node *owtp.OWTPNode, cosigner *CoSignerConfig, req *CoSignRequest, digest []byte) (*CoSignApproval, error) {
+
+	var (
+		approval *CoSignApproval
+		retErr   error
+	)
+
+	if !node.IsConnectPeer(cosigner.hostID) {
+		connectCfg := owtp.ConnectConfig{}
+		connectCfg.Address = cosigner.address
+		connectCfg.ConnectType = owtp.Websocket
+		connectCfg.EnableSSL = cosigner.enablessl
+		connectCfg.EnableKeyAgreement = cli.config.enablekeyagreement
+		_, err := node.Connect(cosigner.hostID, connectCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params := map[string]interface{}{
+		"request": req,
+	}
+
+	err := node.Call(cosigner.hostID, coSignTransactionMethod, params, true, func(resp owtp.Response) {
+		if resp.Status != owtp.StatusSuccess {
+			retErr = fmt.Errorf(resp.Msg)
+			return
+		}
+		approval = &CoSignApproval{
+			Name:      cosigner.name,
+			PublicKey: resp.JsonData().Get("publicKey").String(),
+			Signature: resp.JsonData().Get("signature").String(),
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if retErr != nil {
+		return nil, retErr
+	}
+
+	//只接受配置公钥的签名
+	if approval.PublicKey != cosigner.publickey {
+		return nil, fmt.Errorf("public key: %s is not equal to pinned key", approval.PublicKey)
+	}
+
+	err = VerifyCoSignature(cosigner.publickey, digest, approval.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+// setupCoSignNode 创建连接联合签名节点使用的owtp节点，证书为本节点的keychain
+func (cli *CLI) setupCoSignNode(keychain *Keychain) error {
+
+	cert, err := keychain.Certificate()
+	if err != nil {
+		return err
+	}
+
+	cli.coSignNode = owtp.NewNode(owtp.NodeConfig{
+		Cert:       cert,
+		TimeoutSEC: cli.config.requesttimeout,
+	})
+
+	return nil
+}
+
+// getCoSignNode 连接联合签名节点使用的owtp节点
+func (cli *CLI) getCoSignNode() (*owtp.OWTPNode, error) {
+	if cli.coSignNode == nil {
+		return nil, fmt.Errorf("co-sign node is not ready, keychain is not generated")
+	}
+	return cli.coSignNode, nil
+}
+
+// SignCoSignDigest 使用节点证书私钥签名请求摘要
+func SignCoSignDigest(keychain *Keychain, digest []byte) (string, error) {
+
+	cert, err := keychain.Certificate()
+	if err != nil {
+		return "", err
+	}
+
+	return SignNodeDigest(cert, digest)
+}
+
+// VerifyCoSignature 使用联合签名节点证书公钥校验审批签名
+func VerifyCoSignature(publicKey string, digest []byte, signature string) error {
+	err := VerifyNodeSignature(publicKey, digest, signature)
+	if err != nil {
+		return fmt.Errorf("co-sign %v", err)
+	}
+	return nil
+}
+
+/*********** 联合签名节点 ***********/
+
+// ServeCoSigner 启动联合签名服务，托管节点连接后请求审批交易
+func (cli *CLI) ServeCoSigner(address string) error {
+
+	if len(address) == 0 {
+		address = defaultCoSignServerAddress
+	}
+
+	if len(cli.config.cosignclients) == 0 {
+		return fmt.Errorf("cosignclients is empty, no custody node is allowed to request co-signature")
+	}
+
+	keychain, err := cli.GetKeychain()
+	if err != nil {
+		return err
+	}
+	cert, err := keychain.Certificate()
+	if err != nil {
+		return err
+	}
+
+	node := owtp.NewNode(owtp.NodeConfig{
+		Cert:       cert,
+		TimeoutSEC: cli.config.requesttimeout,
+	})
+	node.HandleFunc(coSignTransactionMethod, func(ctx *owtp.Context) {
+		cli.coSignTransaction(ctx, keychain)
+	})
+
+	log.Infof("Co-signer: %s is listening on %s", keychain.NodeID, address)
+	log.Infof("Co-signer public key: %s", keychain.PublicKey)
+
+	return node.Listen(owtp.ConnectConfig{
+		Address:     address,
+		ConnectType: owtp.Websocket,
+	})
+}
+
+// checkCoSignRequest 联合签名节点检查请求：托管节点在白名单，时间有效，目标地址在信任名单
+// 哈希签名没有目标地址和数量，联合签名节点无法判断，全部拒绝
+func (cli *CLI) checkCoSignRequest(peerID string, req *CoSignRequest) error {
+
+	switch req.Kind {
+	case coSignKindTransfer, coSignKindTriggerABI:
+	default:
+		return fmt.Errorf("%s request can not be verified by co-signer", req.Kind)
+	}
+
+	if !containsString(cli.config.cosignclients, peerID) || req.NodeID != peerID {
+		return fmt.Errorf("node: %s is not allowed to request co-signature", peerID)
+	}
+
+	if req.AppID != cli.config.appid {
+		return fmt.Errorf("appID: %s is not match", req.AppID)
+	}
+
+	skew := time.Since(time.Unix(req.Time, 0))
+	if skew > coSignRequestMaxSkew || skew < -coSignRequestMaxSkew {
+		return fmt.Errorf("request time is expired")
+	}
+
+	if len(req.Messages) == 0 {
+		return fmt.Errorf("request has no transaction hash")
+	}
+
+	for address := range req.To {
+		if !cli.checkTrustAddress(address, req.Symbol) {
+			return fmt.Errorf("%s is not in trust address list", address)
+		}
+	}
+
+	return nil
+}
+
+func (cli *CLI) coSignTransaction(ctx *owtp.Context, keychain *Keychain) {
+
+	var req CoSignRequest
+	err := json.Unmarshal([]byte(ctx.Params().Get("request").Raw), &req)
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, "request is invalid")
+		return
+	}
+
+	err = cli.checkCoSignRequest(ctx.PeerID, &req)
+	if err != nil {
+		log.Warningf("[CoSign] reject %s, reason: %v, %s", req.Kind, err, LogFields("peer", ctx.PeerID, "sid", req.Sid))
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+
+	signature, err := SignCoSignDigest(keychain, req.Digest())
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+
+	log.Infof("[CoSign] approve %s, %s", req.Kind, LogFields("peer", ctx.PeerID, "walletID", req.WalletID, "accountID", req.AccountID, "sid", req.Sid))
+
+	ctx.Response(map[string]interface{}{
+		"publicKey": keychain.PublicKey,
+		"signature": signature,
+	}, owtp.StatusSuccess, "success")
+}
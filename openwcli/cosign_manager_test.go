@@ -0,0 +1,194 @@
+package openwcli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+)
+
+func testCoSignRequest() *CoSignRequest {
+	return &CoSignRequest{
+		Kind:      coSignKindTransfer,
+		AppID:     "app",
+		NodeID:    "node",
+		WalletID:  "W1",
+		AccountID: "A1",
+		Sid:       "sid",
+		Symbol:    "BTC",
+		To:        map[string]string{"addr1": "0.1", "addr2": "0.2"},
+		Fees:      "0.0001",
+		Messages:  []string{"hash1", "hash2"},
+		Time:      time.Now().Unix(),
+	}
+}
+
+func TestCoSignRequestDigest(t *testing.T) {
+
+	req := testCoSignRequest()
+	digest := req.Digest()
+
+	//map顺序不影响摘要
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(digest, testCoSignRequestAt(req.Time).Digest()) {
+			t.Errorf("digest is not stable")
+			return
+		}
+	}
+
+	req.To["addr1"] = "1"
+	if bytes.Equal(digest, req.Digest()) {
+		t.Errorf("digest should change with amount")
+		return
+	}
+}
+
+func testCoSignRequestAt(timestamp int64) *CoSignRequest {
+	req := testCoSignRequest()
+	req.Time = timestamp
+	return req
+}
+
+func TestCoSignSignature(t *testing.T) {
+
+	keychain, err := GenKeychain()
+	if err != nil {
+		t.Errorf("GenKeychain unexpected error: %v", err)
+		return
+	}
+
+	digest := testCoSignRequest().Digest()
+	signature, err := SignCoSignDigest(keychain, digest)
+	if err != nil {
+		t.Errorf("SignCoSignDigest unexpected error: %v", err)
+		return
+	}
+
+	err = VerifyCoSignature(keychain.PublicKey, digest, signature)
+	if err != nil {
+		t.Errorf("VerifyCoSignature unexpected error: %v", err)
+		return
+	}
+
+	other, _ := GenKeychain()
+	err = VerifyCoSignature(other.PublicKey, digest, signature)
+	if err == nil {
+		t.Errorf("VerifyCoSignature should failed with other public key")
+		return
+	}
+}
+
+func TestCheckCoSignRequest(t *testing.T) {
+
+	cli := &CLI{
+		config: &Config{
+			appid:         "app",
+			cosignclients: []string{"node"},
+		},
+	}
+
+	req := testCoSignRequest()
+	req.To = nil
+
+	err := cli.checkCoSignRequest("node", req)
+	if err != nil {
+		t.Errorf("checkCoSignRequest unexpected error: %v", err)
+		return
+	}
+
+	err = cli.checkCoSignRequest("other", req)
+	if err == nil {
+		t.Errorf("checkCoSignRequest should reject node not in cosignclients")
+		return
+	}
+
+	req.Time = time.Now().Add(-time.Hour).Unix()
+	err = cli.checkCoSignRequest("node", req)
+	if err == nil {
+		t.Errorf("checkCoSignRequest should reject expired request")
+		return
+	}
+
+	//哈希签名无法校验，联合签名节点拒绝
+	req = testCoSignRequest()
+	req.To = nil
+	req.Kind = coSignKindSignHash
+	err = cli.checkCoSignRequest("node", req)
+	if err == nil {
+		t.Errorf("checkCoSignRequest should reject sign hash request")
+		return
+	}
+}
+
+func TestCLI_VerifyCoSignApprovals(t *testing.T) {
+
+	keychain1, _ := GenKeychain()
+	keychain2, _ := GenKeychain()
+
+	//同一个公钥配置两次只计算一次
+	cli := &CLI{
+		config: &Config{
+			appid:           "app",
+			cosignthreshold: 2,
+			cosigners: []*CoSignerConfig{
+				{name: "cs1", publickey: keychain1.PublicKey},
+				{name: "cs1-copy", publickey: keychain1.PublicKey},
+				{name: "cs2", publickey: keychain2.PublicKey},
+			},
+		},
+	}
+
+	if len(cli.distinctCoSigners()) != 2 {
+		t.Errorf("distinctCoSigners should dedupe public keys")
+		return
+	}
+
+	req := testCoSignRequest()
+	signature1, _ := SignCoSignDigest(keychain1, req.Digest())
+	signature2, _ := SignCoSignDigest(keychain2, req.Digest())
+
+	approval1 := &CoSignApproval{Name: "cs1", PublicKey: keychain1.PublicKey, Signature: signature1}
+	approval1Copy := &CoSignApproval{Name: "cs1-copy", PublicKey: keychain1.PublicKey, Signature: signature1}
+	approval2 := &CoSignApproval{Name: "cs2", PublicKey: keychain2.PublicKey, Signature: signature2}
+
+	err := cli.VerifyCoSignApprovals(req, []*CoSignApproval{approval1, approval1Copy})
+	if err == nil {
+		t.Errorf("VerifyCoSignApprovals should not count the same public key twice")
+		return
+	}
+
+	err = cli.VerifyCoSignApprovals(req, []*CoSignApproval{approval1, approval2})
+	if err != nil {
+		t.Errorf("VerifyCoSignApprovals unexpected error: %v", err)
+		return
+	}
+
+	//远程签名服务只签名审批过的哈希
+	signReq := &remoteSignRequest{
+		WalletID:   req.WalletID,
+		Signatures: map[string][]*openwsdk.KeySignature{"A1": {{Message: "hash1"}}},
+		CoSign:     req,
+		Approvals:  []*CoSignApproval{approval1, approval2},
+	}
+	err = cli.checkRemoteSignCoSign(signReq)
+	if err != nil {
+		t.Errorf("checkRemoteSignCoSign unexpected error: %v", err)
+		return
+	}
+
+	signReq.Signatures["A1"] = append(signReq.Signatures["A1"], &openwsdk.KeySignature{Message: "other"})
+	err = cli.checkRemoteSignCoSign(signReq)
+	if err == nil {
+		t.Errorf("checkRemoteSignCoSign should reject hash not approved")
+		return
+	}
+
+	signReq.Signatures = map[string][]*openwsdk.KeySignature{"A1": {{Message: "hash1"}}}
+	signReq.CoSign = nil
+	err = cli.checkRemoteSignCoSign(signReq)
+	if err == nil {
+		t.Errorf("checkRemoteSignCoSign should reject request without approvals")
+		return
+	}
+}
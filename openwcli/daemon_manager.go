@@ -0,0 +1,511 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/common/file"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/timer"
+	"github.com/bndr/gotabulate"
+)
+
+const (
+	//守护进程状态
+	DaemonStateStarting = "starting"
+	DaemonStateReady    = "ready"
+	DaemonStateStopping = "stopping"
+	DaemonStateStopped  = "stopped"
+
+	//守护进程在本地socket提供运行状态的接口路径
+	daemonHealthPath = "/daemon/health"
+
+	//默认等待任务结束的时间
+	defaultShutdownTimeout = 30 * time.Second
+
+	//任务执行超过该时间，且超过3个周期时，认为任务已卡住
+	daemonJobStallTime = 30 * time.Minute
+)
+
+// DaemonJobStatus 后台任务的运行状态
+type DaemonJobStatus struct {
+	Name      string `json:"name"`
+	Interval  string `json:"interval"`
+	Running   bool   `json:"running"`
+	LastStart int64  `json:"lastStart"`
+	LastEnd   int64  `json:"lastEnd"`
+	Panics    int    `json:"panics"`
+	Stalled   bool   `json:"stalled"`
+
+	interval time.Duration
+}
+
+// DaemonHealth 守护进程的运行状态，ready表示可以处理请求，live表示进程没有卡住
+type DaemonHealth struct {
+	State        string             `json:"state"`
+	Ready        bool               `json:"ready"`
+	Live         bool               `json:"live"`
+	Pid          int                `json:"pid"`
+	StartTime    int64              `json:"startTime"`
+	TrustServers map[string]bool    `json:"trustServers"`
+	SummaryTask  bool               `json:"summaryTask"`
+	Jobs         []*DaemonJobStatus `json:"jobs"`
+}
+
+// daemonSupervisor 管理守护进程的状态和后台任务
+type daemonSupervisor struct {
+	mu         sync.Mutex
+	state      string
+	startTime  int64
+	jobs       map[string]*DaemonJobStatus
+	jobNames   []string
+	timers     []*timer.TaskTimer
+	trustPeers map[string]bool
+	running    sync.WaitGroup
+	stopping   bool
+}
+
+// supervisor 守护进程管理器
+func (cli *CLI) supervisor() *daemonSupervisor {
+	cli.daemonOnce.Do(func() {
+		cli.daemon = &daemonSupervisor{
+			jobs:       make(map[string]*DaemonJobStatus),
+			trustPeers: make(map[string]bool),
+		}
+	})
+	return cli.daemon
+}
+
+// setDaemonState 更新守护进程状态
+func (cli *CLI) setDaemonState(state string) {
+	d := cli.supervisor()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state = state
+	if state == DaemonStateStarting {
+		d.startTime = time.Now().Unix()
+		d.stopping = false
+	}
+	if state == DaemonStateStopping {
+		d.stopping = true
+	}
+}
+
+// isDaemonStopping 守护进程是否正在退出
+func (cli *CLI) isDaemonStopping() bool {
+	d := cli.supervisor()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopping
+}
+
+// setTrustPeerState 记录授信服务的连接状态
+func (cli *CLI) setTrustPeerState(hostID string, connected bool) {
+	d := cli.supervisor()
+	d.mu.Lock()
+	wasConnected := d.trustPeers[hostID]
+	d.trustPeers[hostID] = connected
+	d.mu.Unlock()
+
+	//连接断开时通知，守护进程退出时主动断开的不通知
+	if wasConnected && !connected && !cli.isDaemonStopping() {
+		cli.Notify(NotifyEventTrustServerDisconnect, map[string]interface{}{
+			"hostID": hostID,
+		})
+	}
+
+	state := 0.0
+	if connected {
+		state = 1
+	}
+	cli.Metrics().Set(MetricTrustServerConnected, state, hostID)
+}
+
+// superviseJob 包装后台任务，记录运行状态，捕获panic避免守护进程退出，退出时不再执行新的任务
+func (cli *CLI) superviseJob(name string, interval time.Duration, fn func()) func() {
+
+	d := cli.supervisor()
+	d.mu.Lock()
+	if _, exist := d.jobs[name]; !exist {
+		d.jobNames = append(d.jobNames, name)
+	}
+	status := &DaemonJobStatus{
+		Name:     name,
+		Interval: interval.String(),
+		interval: interval,
+	}
+	d.jobs[name] = status
+	d.mu.Unlock()
+
+	return func() {
+
+		d.mu.Lock()
+		if d.stopping || status.Running {
+			d.mu.Unlock()
+			return
+		}
+		status.Running = true
+		status.LastStart = time.Now().Unix()
+		d.running.Add(1)
+		d.mu.Unlock()
+
+		defer func() {
+			r := recover()
+			d.mu.Lock()
+			if r != nil {
+				status.Panics++
+				log.Errorf("daemon job: %s panic: %v", name, r)
+			}
+			status.Running = false
+			status.LastEnd = time.Now().Unix()
+			d.mu.Unlock()
+			d.running.Done()
+		}()
+
+		fn()
+	}
+}
+
+// beginDaemonRequest 记录正在处理的授信服务或管理接口请求，守护进程退出时等待其完成，
+// 正在退出时返回false，不再接受新的请求
+func (cli *CLI) beginDaemonRequest() bool {
+	d := cli.supervisor()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopping {
+		return false
+	}
+	d.running.Add(1)
+	return true
+}
+
+// endDaemonRequest 请求处理完成
+func (cli *CLI) endDaemonRequest() {
+	cli.supervisor().running.Done()
+}
+
+// startDaemonJob 定时执行受管理的后台任务
+func (cli *CLI) startDaemonJob(name string, interval time.Duration, fn func()) *timer.TaskTimer {
+
+	task := timer.NewTask(interval, cli.superviseJob(name, interval, fn))
+	task.Start()
+
+	d := cli.supervisor()
+	d.mu.Lock()
+	d.timers = append(d.timers, task)
+	d.mu.Unlock()
+
+	return task
+}
+
+// startTrustServerJobs 启动授信服务的后台任务
+func (cli *CLI) startTrustServerJobs() {
+
+	//定时锁定已过期的钱包
+	cli.startDaemonJob("relockwallets", 1*time.Minute, cli.relockExpiredWallets)
+
+	//定时1个小时执行一次更新主链信息
+	cli.startDaemonJob("updateinfo", 1*time.Hour, func() {
+		cli.UpdateSymbols()
+	})
+
+	if cli.config.enabletransferapproval {
+		//定时回调审批结果给授信服务
+		cli.startDaemonJob("notifypending", 10*time.Second, cli.notifyPendingTransferResults)
+	}
+
+	//定时重试发送失败的事件通知
+	cli.startNotifyJob()
+}
+
+// startSummaryScheduler 启动汇总任务定时器，与授信服务启动的汇总任务共用定时器
+func (cli *CLI) startSummaryScheduler(summaryTask *openwsdk.SummaryTask, cycle time.Duration) {
+
+	cli.mu.Lock()
+	cli.summaryTask = summaryTask
+	cli.mu.Unlock()
+
+	cli.startSummaryTimer(cycle)
+}
+
+// DaemonHealth 守护进程的运行状态
+func (cli *CLI) DaemonHealth() *DaemonHealth {
+
+	d := cli.supervisor()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	health := &DaemonHealth{
+		State:        d.state,
+		Pid:          os.Getpid(),
+		StartTime:    d.startTime,
+		TrustServers: make(map[string]bool),
+		SummaryTask:  cli.summaryTaskTimer != nil && cli.summaryTaskTimer.Running(),
+	}
+
+	health.Live = d.state == DaemonStateStarting || d.state == DaemonStateReady
+	for _, name := range d.jobNames {
+		status := *d.jobs[name]
+		stallTime := 3 * status.interval
+		if stallTime < daemonJobStallTime {
+			stallTime = daemonJobStallTime
+		}
+		status.Stalled = status.Running && now.Sub(time.Unix(status.LastStart, 0)) > stallTime
+		if status.Stalled {
+			health.Live = false
+		}
+		health.Jobs = append(health.Jobs, &status)
+	}
+
+	//至少连接一个授信服务才能处理请求
+	connected := false
+	for _, server := range cli.config.trustservers {
+		health.TrustServers[server.hostID] = d.trustPeers[server.hostID]
+		if d.trustPeers[server.hostID] {
+			connected = true
+		}
+	}
+	health.Ready = health.Live && d.state == DaemonStateReady && connected
+
+	return health
+}
+
+// serveDaemonHealth 返回守护进程运行状态，参数probe=live或ready时，检查失败返回503
+func (cli *CLI) serveDaemonHealth(w http.ResponseWriter, r *http.Request) {
+
+	health := cli.DaemonHealth()
+
+	status := http.StatusOK
+	switch r.URL.Query().Get("probe") {
+	case "live":
+		if !health.Live {
+			status = http.StatusServiceUnavailable
+		}
+	case "ready":
+		if !health.Ready {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
+
+// GetDaemonHealth 通过本地socket查询运行中的守护进程状态
+func (cli *CLI) GetDaemonHealth() (*DaemonHealth, error) {
+
+	if !isUnixSocketAlive(cli.daemonSocket()) {
+		return nil, fmt.Errorf("openw-cli daemon is not running on %s", cli.daemonSocket())
+	}
+
+	client := newUnixHTTPClient(cli.daemonSocket(), time.Duration(cli.config.requesttimeout)*time.Second)
+	resp, err := client.Get("http://unix" + daemonHealthPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	//trustserver等其它守护进程没有运行状态接口
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("process on %s is not an openw-cli daemon", cli.daemonSocket())
+	}
+
+	var health DaemonHealth
+	err = json.NewDecoder(resp.Body).Decode(&health)
+	if err != nil {
+		return nil, err
+	}
+
+	return &health, nil
+}
+
+// daemonPidFile daemon命令的pid文件
+func (cli *CLI) daemonPidFile() string {
+	if len(cli.config.pidfile) > 0 {
+		return cli.config.pidfile
+	}
+	return filepath.Join(".", "pid", "daemon.pid")
+}
+
+// writeDaemonPidFile 检查守护进程是否已运行，写入当前进程的pid
+func (cli *CLI) writeDaemonPidFile() error {
+
+	//与单独运行的trustserver和startsum互斥
+	for _, name := range []string{"trustserver", "startsum"} {
+		err := ProcExsit(filepath.Join(".", "pid", name+".pid"), name)
+		if err != nil {
+			return err
+		}
+	}
+
+	pidFile := cli.daemonPidFile()
+	err := ProcExsit(pidFile, "daemon")
+	if err != nil {
+		return err
+	}
+
+	file.MkdirAll(filepath.Dir(pidFile))
+	return ioutil.WriteFile(pidFile, []byte(fmt.Sprint(os.Getpid())), 0644)
+}
+
+// StopDaemon 停止所有定时任务，断开授信服务，等待运行中的任务和请求结束后关闭数据库，
+// 超时仍有任务运行时不关闭数据库，由进程退出释放
+func (cli *CLI) StopDaemon(timeout time.Duration) error {
+
+	cli.setDaemonState(DaemonStateStopping)
+
+	d := cli.supervisor()
+	d.mu.Lock()
+	timers := d.timers
+	d.timers = nil
+	d.mu.Unlock()
+
+	for _, task := range timers {
+		task.Stop()
+	}
+
+	if cli.summaryTaskTimer != nil && cli.summaryTaskTimer.Running() {
+		cli.summaryTaskTimer.Stop()
+	}
+
+	cli.CloseAdminAPI()
+	cli.CloseMetrics()
+
+	if cli.transmitNode != nil {
+		for _, server := range cli.config.trustservers {
+			cli.transmitNode.ClosePeer(server.hostID)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		//不关闭正在使用的数据库句柄
+		cli.setDaemonState(DaemonStateStopped)
+		return fmt.Errorf("daemon jobs are still running after %v", timeout)
+	}
+
+	cli.CloseDaemonDB()
+	cli.setDaemonState(DaemonStateStopped)
+
+	return nil
+}
+
+// RunDaemon 在一个进程内运行转发节点、汇总任务和后台任务，收到SIGINT或SIGTERM时优雅退出
+func (cli *CLI) RunDaemon(summaryTask *openwsdk.SummaryTask, summaryCycle, shutdownTimeout time.Duration) error {
+
+	cli.setDaemonState(DaemonStateStarting)
+
+	err := cli.OpenDaemonDB()
+	if err != nil {
+		return err
+	}
+
+	cli.daemonMux.HandleFunc(daemonHealthPath, cli.serveDaemonHealth)
+
+	err = cli.ServeTransmitNode(true)
+	if err != nil {
+		cli.StopDaemon(shutdownTimeout)
+		return err
+	}
+
+	cli.startTrustServerJobs()
+
+	err = cli.ServeMetrics()
+	if err != nil {
+		cli.StopDaemon(shutdownTimeout)
+		return err
+	}
+
+	if cli.config.enableadminapi {
+		err = cli.ServeAdminAPI()
+		if err != nil {
+			cli.StopDaemon(shutdownTimeout)
+			return err
+		}
+	}
+
+	if summaryTask != nil {
+		cli.startSummaryScheduler(summaryTask, summaryCycle)
+	}
+
+	cli.setDaemonState(DaemonStateReady)
+
+	log.Infof("openw-cli daemon is running, pid: %d", os.Getpid())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	sig := <-signals
+	log.Infof("Receive signal: %v, daemon is shutting down, waiting for running jobs at most %v", sig, shutdownTimeout)
+
+	err = cli.StopDaemon(shutdownTimeout)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("openw-cli daemon stopped")
+
+	return nil
+}
+
+// printDaemonHealth 打印守护进程运行状态
+func printDaemonHealth(health *DaemonHealth) {
+
+	fmt.Printf("Daemon pid: %d, state: %s, live: %v, ready: %v, start time: %s \n",
+		health.Pid, health.State, health.Live, health.Ready,
+		time.Unix(health.StartTime, 0).Format("2006-01-02 15:04:05"))
+
+	hostIDs := make([]string, 0, len(health.TrustServers))
+	for hostID := range health.TrustServers {
+		hostIDs = append(hostIDs, hostID)
+	}
+	sort.Strings(hostIDs)
+	for _, hostID := range hostIDs {
+		fmt.Printf("Trust server: %s, connected: %v \n", hostID, health.TrustServers[hostID])
+	}
+
+	fmt.Printf("Summary task running: %v \n", health.SummaryTask)
+
+	tableInfo := make([][]interface{}, 0)
+
+	for _, job := range health.Jobs {
+		lastStart := ""
+		if job.LastStart > 0 {
+			lastStart = time.Unix(job.LastStart, 0).Format("2006-01-02 15:04:05")
+		}
+		tableInfo = append(tableInfo, []interface{}{
+			job.Name, job.Interval, job.Running, lastStart, job.Panics, job.Stalled,
+		})
+	}
+
+	if len(tableInfo) == 0 {
+		return
+	}
+
+	t := gotabulate.Create(tableInfo)
+	// Set Headers
+	t.SetHeaders([]string{"Job", "Interval", "Running", "LastStart", "Panics", "Stalled"})
+
+	//打印信息
+	fmt.Println(t.Render("simple"))
+}
@@ -0,0 +1,86 @@
+package openwcli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCLI_DaemonSupervisor(t *testing.T) {
+
+	cli := &CLI{
+		config: &Config{
+			trustservers: []*TrustServerConfig{
+				{hostID: "server1"},
+			},
+		},
+	}
+
+	cli.setDaemonState(DaemonStateStarting)
+
+	//任务panic不影响守护进程
+	cli.superviseJob("panic", time.Minute, func() {
+		panic("job failed")
+	})()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slowJob := cli.superviseJob("slow", time.Minute, func() {
+		close(started)
+		<-release
+	})
+	go slowJob()
+	<-started
+
+	cli.setDaemonState(DaemonStateReady)
+
+	health := cli.DaemonHealth()
+	if !health.Live || health.Ready {
+		t.Errorf("daemon should be live but not ready before trust server connected: %+v", health)
+		return
+	}
+	if len(health.Jobs) != 2 || health.Jobs[0].Panics != 1 || !health.Jobs[1].Running {
+		t.Errorf("daemon jobs status is not match: %+v", health.Jobs)
+		return
+	}
+
+	cli.setTrustPeerState("server1", true)
+	if !cli.DaemonHealth().Ready {
+		t.Errorf("daemon should be ready after trust server connected")
+		return
+	}
+
+	//处理中的授信服务请求
+	if !cli.beginDaemonRequest() {
+		t.Errorf("request should be accepted before daemon stopping")
+		return
+	}
+	close(release)
+
+	//运行中的请求没有结束，超时返回错误
+	err := cli.StopDaemon(100 * time.Millisecond)
+	if err == nil {
+		t.Errorf("StopDaemon should failed when request is still running")
+		return
+	}
+	if cli.beginDaemonRequest() {
+		t.Errorf("request should be rejected after daemon stopping")
+		return
+	}
+	cli.endDaemonRequest()
+
+	health = cli.DaemonHealth()
+	if health.State != DaemonStateStopped || health.Live || health.Ready {
+		t.Errorf("daemon state is not match after stopped: %+v", health)
+		return
+	}
+
+	//退出后不再执行任务
+	executed := false
+	cli.superviseJob("after", time.Minute, func() {
+		executed = true
+	})()
+	if executed {
+		t.Errorf("job should not be executed after daemon stopped")
+		return
+	}
+}
@@ -9,6 +9,7 @@ type StormDB struct {
 	*storm.DB
 	FileName string
 	Opened bool
+	Snapshot bool //守护进程导出的临时快照，关闭时删除
 }
 
 //OpenStormDB
@@ -0,0 +1,270 @@
+package openwcli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/v2/common/file"
+	"github.com/blocktree/openwallet/v2/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	//数据库文件锁等待时间
+	dbLockTimeout = 5 * time.Second
+
+	//守护进程的本地socket，默认在datadir
+	daemonSocketName = "openw-cli.sock"
+
+	//守护进程导出数据库快照的接口路径
+	daemonSnapshotPath = "/db/snapshot"
+
+	//其它守护进程请求共用数据库的接口路径
+	daemonShareDBPath = "/db/share"
+)
+
+// daemonSocket 守护进程的本地socket路径
+func (cli *CLI) daemonSocket() string {
+	if len(cli.config.daemonsocket) > 0 {
+		return cli.config.daemonsocket
+	}
+	return filepath.Join(cli.config.datadir, daemonSocketName)
+}
+
+// openDB 打开数据库文件，只读模式下数据库被守护进程占用时，通过守护进程读取数据库快照，
+// 单次执行的命令需要写入时，先通知守护进程在空闲时释放数据库文件
+func (cli *CLI) openDB(readOnly bool) (*StormDB, error) {
+
+	dbfile := cli.dbFile()
+
+	//新节点还没有数据库文件，只读模式无法创建
+	if readOnly && !file.Exists(dbfile) {
+		readOnly = false
+	}
+
+	//守护进程长期持有数据库，直接通过守护进程读取，不需要等待文件锁
+	if readOnly && isUnixSocketAlive(cli.daemonSocket()) {
+		return cli.openDaemonSnapshot()
+	}
+
+	//守护进程改为按需打开数据库，写入的命令等待文件锁
+	if !readOnly && !cli.keepOpen && isUnixSocketAlive(cli.daemonSocket()) {
+		err := cli.requestDaemonShareDB()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := OpenStormDB(
+		dbfile,
+		storm.BoltOptions(
+			0600,
+			&bolt.Options{
+				Timeout:  dbLockTimeout,
+				ReadOnly: readOnly,
+			}),
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), bolt.ErrTimeout.Error()) {
+			return nil, fmt.Errorf("database is locked by another openw-cli process, stop the running service or retry later")
+		}
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// OpenDaemonDB 守护进程模式，整个进程共用一个长期打开的数据库句柄，
+// 并在本地socket提供数据库快照，其它CLI查询命令可以通过守护进程读取数据。
+// 已有其它守护进程持有数据库时，通知它在空闲时释放数据库文件，两个进程各自共用一个句柄，按需轮流打开
+func (cli *CLI) OpenDaemonDB() error {
+
+	if cli.keepOpen {
+		return nil
+	}
+
+	if isUnixSocketAlive(cli.daemonSocket()) {
+		err := cli.requestDaemonShareDB()
+		if err != nil {
+			return err
+		}
+		cli.keepOpen = true
+		log.Infof("Database is shared with the openw-cli daemon on %s, it is opened only when needed", cli.daemonSocket())
+		return nil
+	}
+
+	db, err := cli.openDB(false)
+	if err != nil {
+		return err
+	}
+
+	listener, err := listenUnixSocket(cli.daemonSocket())
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(daemonSnapshotPath, cli.serveDBSnapshot)
+	mux.HandleFunc(daemonShareDBPath, cli.serveDaemonShareDB)
+	mux.HandleFunc(daemonUnlockWalletPath, cli.serveDaemonWalletSession)
+	mux.HandleFunc(daemonLockWalletPath, cli.serveDaemonWalletSession)
+
+	cli.dbMu.Lock()
+	cli.db = db
+	cli.dbHeld = true
+	cli.dbMu.Unlock()
+
+	cli.keepOpen = true
+	cli.daemonListener = listener
+	cli.daemonMux = mux
+
+	go func() {
+		err := http.Serve(listener, mux)
+		if err != nil && cli.daemonListener != nil {
+			log.Warningf("daemon socket: %s is closed: %v", cli.daemonSocket(), err)
+		}
+	}()
+
+	log.Infof("Database is kept open by daemon, CLI queries can read it through %s", cli.daemonSocket())
+
+	return nil
+}
+
+// CloseDaemonDB 关闭守护进程的本地socket，不再保持数据库打开，
+// 正在使用数据库的调用完成后才关闭句柄
+func (cli *CLI) CloseDaemonDB() {
+
+	if !cli.keepOpen {
+		return
+	}
+
+	if cli.daemonListener != nil {
+		listener := cli.daemonListener
+		cli.daemonListener = nil
+		listener.Close()
+	}
+
+	cli.dbMu.Lock()
+	cli.dbHeld = false
+	cli.releaseDB()
+	cli.dbMu.Unlock()
+}
+
+// serveDaemonShareDB 其它守护进程或写入数据库的命令需要使用数据库，之后空闲时释放数据库文件
+func (cli *CLI) serveDaemonShareDB(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli.dbMu.Lock()
+	if cli.dbHeld {
+		cli.dbHeld = false
+		cli.releaseDB()
+		log.Infof("Another openw-cli process shares the database, it will be released when idle")
+	}
+	cli.dbMu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// requestDaemonShareDB 请求运行中的守护进程在空闲时释放数据库文件，之后守护进程按需打开数据库
+func (cli *CLI) requestDaemonShareDB() error {
+
+	client := newUnixHTTPClient(cli.daemonSocket(), time.Duration(cli.config.requesttimeout)*time.Second)
+
+	resp, err := client.Post("http://unix"+daemonShareDBPath, "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("database is held by the daemon on %s, but it is unavailable: %v", cli.daemonSocket(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("database is held by the daemon on %s, share database response status: %d", cli.daemonSocket(), resp.StatusCode)
+	}
+
+	return nil
+}
+
+// serveDBSnapshot 在只读事务中导出一致的数据库快照
+func (cli *CLI) serveDBSnapshot(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, err := cli.getDB()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer cli.closeDB()
+
+	err = cli.db.Bolt.View(func(tx *bolt.Tx) error {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, writeErr := tx.WriteTo(w)
+		return writeErr
+	})
+	if err != nil {
+		log.Errorf("export database snapshot failed, unexpected error: %v", err)
+	}
+}
+
+// openDaemonSnapshot 从守护进程获取数据库快照，以只读方式打开临时文件。
+// 打开后马上删除文件，进程异常退出也不会遗留快照，不能删除打开的文件时(windows)在关闭时删除
+func (cli *CLI) openDaemonSnapshot() (*StormDB, error) {
+
+	client := newUnixHTTPClient(cli.daemonSocket(), time.Duration(cli.config.requesttimeout)*time.Second)
+
+	resp, err := client.Get("http://unix" + daemonSnapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("database is held by daemon, but daemon is unavailable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("daemon database snapshot response status: %d", resp.StatusCode)
+	}
+
+	f, err := ioutil.TempFile("", "openw-cli-snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	snapshot := f.Name()
+
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
+	if err != nil {
+		os.Remove(snapshot)
+		return nil, err
+	}
+
+	db, err := OpenStormDB(
+		snapshot,
+		storm.BoltOptions(
+			0600,
+			&bolt.Options{
+				Timeout:  dbLockTimeout,
+				ReadOnly: true,
+			}),
+	)
+	if err != nil {
+		os.Remove(snapshot)
+		return nil, err
+	}
+
+	db.Snapshot = true
+	os.Remove(snapshot)
+
+	return db, nil
+}
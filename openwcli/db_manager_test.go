@@ -0,0 +1,161 @@
+package openwcli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCLI_DaemonDBSnapshot(t *testing.T) {
+
+	daemon, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	daemon.config.requesttimeout = 10
+
+	err := daemon.OpenDaemonDB()
+	if err != nil {
+		t.Errorf("OpenDaemonDB unexpected error: %v", err)
+		return
+	}
+	defer daemon.CloseDaemonDB()
+
+	//守护进程内的调用共用句柄
+	daemon.getDB()
+	daemon.db.Save(&WatchOnlyWallet{WalletID: "W1", Alias: "watch"})
+	daemon.closeDB()
+	if daemon.db == nil {
+		t.Errorf("daemon database should be kept open")
+		return
+	}
+
+	//查询命令通过守护进程读取快照
+	query := newTestLocalCLI(daemon.config.datadir, "")
+	query.config.requesttimeout = 10
+	query.config.SetDBReadOnlyMode(true)
+
+	db, err := query.getDB()
+	if err != nil {
+		t.Errorf("query getDB unexpected error: %v", err)
+		return
+	}
+	snapshot := query.db.FileName
+
+	//快照打开后马上删除，不会遗留临时文件
+	if _, statErr := os.Stat(snapshot); statErr == nil {
+		t.Errorf("snapshot file should be removed after opened")
+		return
+	}
+	if snapshot == filepath.Join(daemon.config.dbdir, "test.db") {
+		t.Errorf("query should not open the daemon database file")
+		return
+	}
+
+	var watchWallet WatchOnlyWallet
+	err = query.db.One("WalletID", "W1", &watchWallet)
+	if err != nil || watchWallet.Alias != "watch" {
+		t.Errorf("query snapshot data is not match: %v", err)
+		return
+	}
+
+	err = query.db.Save(&WatchOnlyWallet{WalletID: "W2"})
+	if err == nil {
+		t.Errorf("query snapshot should be read-only")
+		return
+	}
+
+	//一个命令只获取一次快照
+	query.closeDB()
+	again, _ := query.getDB()
+	query.closeDB()
+	if again != db {
+		t.Errorf("query should reuse the snapshot in one command")
+		return
+	}
+	query.Close()
+	if query.db != nil {
+		t.Errorf("snapshot should be closed after the command")
+		return
+	}
+
+	//另一个守护进程共用数据库，两个进程空闲时都释放数据库文件
+	other := newTestLocalCLI(daemon.config.datadir, "")
+	other.config.requesttimeout = 10
+	err = other.OpenDaemonDB()
+	if err != nil {
+		t.Errorf("OpenDaemonDB should share the database with the running daemon: %v", err)
+		return
+	}
+	defer other.CloseDaemonDB()
+
+	if daemon.db != nil {
+		t.Errorf("daemon database should be released when idle after shared")
+		return
+	}
+
+	_, err = other.getDB()
+	if err != nil {
+		t.Errorf("shared daemon getDB unexpected error: %v", err)
+		return
+	}
+	other.db.Save(&WatchOnlyWallet{WalletID: "W2", Alias: "other"})
+	other.closeDB()
+
+	daemon.getDB()
+	err = daemon.db.One("WalletID", "W2", &watchWallet)
+	daemon.closeDB()
+	if err != nil || watchWallet.Alias != "other" {
+		t.Errorf("shared daemon data is not match: %v", err)
+		return
+	}
+}
+
+func TestCLI_DaemonDBLocalWriter(t *testing.T) {
+
+	daemon, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	daemon.config.requesttimeout = 10
+
+	err := daemon.OpenDaemonDB()
+	if err != nil {
+		t.Errorf("OpenDaemonDB unexpected error: %v", err)
+		return
+	}
+	defer daemon.CloseDaemonDB()
+
+	//迁移状态只读检查，守护进程不释放数据库
+	writer := newTestLocalCLI(daemon.config.datadir, "")
+	writer.config.requesttimeout = 10
+	_, err = writer.DBMigrationStatus()
+	if err != nil {
+		t.Errorf("DBMigrationStatus unexpected error: %v", err)
+		return
+	}
+	if daemon.db == nil {
+		t.Errorf("daemon database should be kept open after read-only check")
+		return
+	}
+
+	//单次执行的写入命令通知守护进程释放数据库，不等待到超时
+	_, err = writer.getDB()
+	if err != nil {
+		t.Errorf("writer getDB should not be locked by the daemon: %v", err)
+		return
+	}
+	err = writer.db.Save(&WatchOnlyWallet{WalletID: "W1", Alias: "local"})
+	writer.closeDB()
+	if err != nil {
+		t.Errorf("writer save unexpected error: %v", err)
+		return
+	}
+
+	var watchWallet WatchOnlyWallet
+	daemon.getDB()
+	err = daemon.db.One("WalletID", "W1", &watchWallet)
+	daemon.closeDB()
+	if err != nil || watchWallet.Alias != "local" {
+		t.Errorf("daemon should read the data written by local command: %v", err)
+		return
+	}
+}
@@ -0,0 +1,234 @@
+package openwcli
+
+import (
+	"github.com/asdine/storm"
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+)
+
+// DBEncryptResult 数据库加密迁移的结果
+type DBEncryptResult struct {
+	Keychains       int
+	SummarySettings int
+	TrustAddresses  int
+}
+
+// saveSummarySetting 加密汇总地址后保存汇总设置，调用前需要已打开数据库
+func (cli *CLI) saveSummarySetting(obj *openwsdk.SummarySetting) error {
+
+	key, err := cli.loadDataKey()
+	if err != nil {
+		return err
+	}
+
+	//数据库只保存密文，传入的设置保持明文
+	stored := *obj
+	stored.SumAddress, err = encryptSecret(key, obj.SumAddress, obj.AccountID)
+	if err != nil {
+		return err
+	}
+
+	return cli.db.Save(&stored)
+}
+
+// decryptSummarySettings 解密汇总设置的汇总地址，调用前需要已打开数据库
+func (cli *CLI) decryptSummarySettings(list ...*openwsdk.SummarySetting) error {
+
+	var key []byte
+
+	for _, s := range list {
+		if !isEncryptedSecret(s.SumAddress) {
+			continue
+		}
+		if key == nil {
+			k, err := cli.loadDataKey()
+			if err != nil {
+				return err
+			}
+			key = k
+		}
+		sumAddress, err := decryptSecret(key, s.SumAddress, s.AccountID)
+		if err != nil {
+			return err
+		}
+		s.SumAddress = sumAddress
+	}
+
+	return nil
+}
+
+// saveTrustAddress 加密地址和备注后保存信任地址，调用前需要已打开数据库
+func (cli *CLI) saveTrustAddress(obj *openwsdk.TrustAddress) error {
+
+	key, err := cli.loadDataKey()
+	if err != nil {
+		return err
+	}
+
+	stored := *obj
+	stored.Address, err = encryptSecret(key, obj.Address, obj.ID)
+	if err != nil {
+		return err
+	}
+	stored.Memo, err = encryptSecret(key, obj.Memo, obj.ID)
+	if err != nil {
+		return err
+	}
+
+	return cli.db.Save(&stored)
+}
+
+// decryptTrustAddresses 解密信任地址的地址和备注，调用前需要已打开数据库
+func (cli *CLI) decryptTrustAddresses(list ...*openwsdk.TrustAddress) error {
+
+	var key []byte
+
+	for _, t := range list {
+		if !isEncryptedSecret(t.Address) {
+			continue
+		}
+		if key == nil {
+			k, err := cli.loadDataKey()
+			if err != nil {
+				return err
+			}
+			key = k
+		}
+		address, err := decryptSecret(key, t.Address, t.ID)
+		if err != nil {
+			return err
+		}
+		t.Address = address
+		if isEncryptedSecret(t.Memo) {
+			memo, err := decryptSecret(key, t.Memo, t.ID)
+			if err != nil {
+				return err
+			}
+			t.Memo = memo
+		}
+	}
+
+	return nil
+}
+
+// findTrustAddresses 查找地址和币种匹配的信任地址，返回数据库保存的原记录。
+// 地址加密后不能按索引查询，按币种读取后解密比较，调用前需要已打开数据库
+func (cli *CLI) findTrustAddresses(address, symbol string) ([]*openwsdk.TrustAddress, error) {
+
+	var list []*openwsdk.TrustAddress
+	err := cli.db.Find("Symbol", symbol, &list)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plains := make([]*openwsdk.TrustAddress, len(list))
+	for i, t := range list {
+		plain := *t
+		plains[i] = &plain
+	}
+	err = cli.decryptTrustAddresses(plains...)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]*openwsdk.TrustAddress, 0)
+	for i, t := range plains {
+		if t.Address == address {
+			matched = append(matched, list[i])
+		}
+	}
+	return matched, nil
+}
+
+// EncryptDB 加密数据库中旧版本明文保存的敏感字段，已加密的记录不会重复处理
+func (cli *CLI) EncryptDB() (*DBEncryptResult, error) {
+
+	if check := cli.checkConfig(); check != nil {
+		return nil, check
+	}
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	return cli.encryptDBRecords()
+}
+
+// encryptDBRecords 加密明文保存的keychain私钥、汇总地址和信任地址，调用前需要已打开数据库
+func (cli *CLI) encryptDBRecords() (*DBEncryptResult, error) {
+
+	//先获取密钥，密钥缺失或不匹配时不修改任何记录
+	key, err := cli.loadDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DBEncryptResult{}
+
+	var keychains []*Keychain
+	err = cli.db.All(&keychains)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	for _, k := range keychains {
+		if isEncryptedSecret(k.PrivateKey) {
+			//校验密文可以解密
+			_, err = decryptSecret(key, k.PrivateKey, k.NodeID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = cli.saveKeychain(k)
+		if err != nil {
+			return nil, err
+		}
+		result.Keychains++
+	}
+
+	var sumSets []*openwsdk.SummarySetting
+	err = cli.db.All(&sumSets)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	for _, s := range sumSets {
+		if isEncryptedSecret(s.SumAddress) {
+			_, err = decryptSecret(key, s.SumAddress, s.AccountID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = cli.saveSummarySetting(s)
+		if err != nil {
+			return nil, err
+		}
+		result.SummarySettings++
+	}
+
+	var trustAddrs []*openwsdk.TrustAddress
+	err = cli.db.All(&trustAddrs)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	for _, t := range trustAddrs {
+		if isEncryptedSecret(t.Address) {
+			err = cli.decryptTrustAddresses(t)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = cli.saveTrustAddress(t)
+		if err != nil {
+			return nil, err
+		}
+		result.TrustAddresses++
+	}
+
+	return result, nil
+}
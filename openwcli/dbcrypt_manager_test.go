@@ -0,0 +1,137 @@
+package openwcli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+)
+
+func TestCLI_EncryptDB(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	//旧版本明文保存的记录
+	keychain, _ := GenKeychain()
+	sumSets := &openwsdk.SummarySetting{
+		WalletID:   "W1",
+		AccountID:  "A1",
+		Symbol:     "BTC",
+		SumAddress: "sumaddress",
+	}
+	trustAddr := openwsdk.NewTrustAddress("trustaddress", "BTC", "memo")
+	cli.getDB()
+	cli.db.Save(keychain)
+	cli.db.Save(sumSets)
+	cli.db.Save(trustAddr)
+	cli.db.Set(CLIBucket, EnableTrustAddress, true)
+	cli.closeDB()
+
+	result, err := cli.EncryptDB()
+	if err != nil {
+		t.Errorf("EncryptDB unexpected error: %v", err)
+		return
+	}
+	if result.Keychains != 1 || result.SummarySettings != 1 || result.TrustAddresses != 1 {
+		t.Errorf("EncryptDB result is not match: %+v", result)
+		return
+	}
+
+	//重复执行不会再处理
+	result, err = cli.EncryptDB()
+	if err != nil || result.Keychains != 0 || result.SummarySettings != 0 || result.TrustAddresses != 0 {
+		t.Errorf("EncryptDB should not migrate encrypted records again: %+v, %v", result, err)
+		return
+	}
+
+	var (
+		stored      openwsdk.SummarySetting
+		storedTrust []*openwsdk.TrustAddress
+	)
+	cli.getDB()
+	cli.db.One("AccountID", "A1", &stored)
+	cli.db.All(&storedTrust)
+	cli.closeDB()
+	if !isEncryptedSecret(stored.SumAddress) {
+		t.Errorf("summary address is not encrypted")
+		return
+	}
+	if len(storedTrust) != 1 || !isEncryptedSecret(storedTrust[0].Address) || !isEncryptedSecret(storedTrust[0].Memo) {
+		t.Errorf("trust address is not encrypted")
+		return
+	}
+
+	//加密后仍然可以查询和删除信任地址
+	list, err := cli.ListTrustAddress("BTC")
+	if err != nil || len(list) != 1 || list[0].Address != "trustaddress" || list[0].Memo != "memo" {
+		t.Errorf("ListTrustAddress is not match: %+v, %v", list, err)
+		return
+	}
+	if !cli.IsTrustAddress("trustaddress", "BTC") || cli.IsTrustAddress("otheraddress", "BTC") {
+		t.Errorf("IsTrustAddress is not match")
+		return
+	}
+	err = cli.RemoveTrustAddress("trustaddress", "BTC")
+	if err != nil || cli.IsTrustAddress("trustaddress", "BTC") {
+		t.Errorf("RemoveTrustAddress failed: %v", err)
+		return
+	}
+
+	decrypted, err := cli.getSummarySettingByAccount("A1")
+	if err != nil || decrypted.SumAddress != "sumaddress" {
+		t.Errorf("getSummarySettingByAccount failed: %v", err)
+		return
+	}
+
+	//密钥文件丢失时明确提示，不会生成新的密钥
+	os.Remove(cli.dataKeyFile())
+	_, err = cli.EncryptDB()
+	if _, ok := err.(*dataKeyError); !ok {
+		t.Errorf("EncryptDB should failed with missing data key, got: %v", err)
+		return
+	}
+	if _, statErr := os.Stat(cli.dataKeyFile()); statErr == nil {
+		t.Errorf("data key file should not be generated for encrypted database")
+		return
+	}
+}
+
+func TestCLI_PassphraseDataKey(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	dir := cli.config.datadir
+	cli.config.dbpassphrase = "passphrase"
+
+	keychain, _ := GenKeychain()
+	err := cli.SaveCurrentKeychain(keychain)
+	if err != nil {
+		t.Errorf("SaveCurrentKeychain unexpected error: %v", err)
+		return
+	}
+
+	if _, statErr := os.Stat(cli.dataKeyFile()); statErr == nil {
+		t.Errorf("data key file should not be generated with dbpassphrase")
+		return
+	}
+
+	loaded, err := newTestLocalCLI(dir, "passphrase").GetKeychain()
+	if err != nil || loaded.PrivateKey != keychain.PrivateKey {
+		t.Errorf("GetKeychain with passphrase failed: %v", err)
+		return
+	}
+
+	_, err = newTestLocalCLI(dir, "wrong").GetKeychain()
+	if _, ok := err.(*dataKeyError); !ok {
+		t.Errorf("GetKeychain should failed with wrong passphrase, got: %v", err)
+		return
+	}
+
+	_, err = newTestLocalCLI(dir, "").GetKeychain()
+	if _, ok := err.(*dataKeyError); !ok {
+		t.Errorf("GetKeychain should failed without passphrase, got: %v", err)
+		return
+	}
+}
@@ -0,0 +1,502 @@
+package openwcli
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/common/file"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	//压缩时每个写事务的最大数据量
+	compactTxMaxSize = 64 * 1024 * 1024
+
+	//导出格式
+	DBExportFormatJSON = "json"
+
+	//导出时替换敏感字段的值
+	redactedValue = "[REDACTED]"
+)
+
+// redactedFields 导出时需要隐藏的字段名，不区分大小写
+var redactedFields = map[string]bool{
+	"privatekey":    true,
+	"password":      true,
+	"seed":          true,
+	"mnemonic":      true,
+	"pin":           true,
+	"appkey":        true,
+	DataKeyCheckKey: true,
+	DataKeySaltKey:  true,
+}
+
+// DBCompactResult 数据库压缩结果
+type DBCompactResult struct {
+	Before int64
+	After  int64
+}
+
+// DBVerifyResult 数据库校验结果
+type DBVerifyResult struct {
+	Errors    []string
+	Reindexed []string
+}
+
+// storedTypes 数据库保存的所有结构，用于重建storm索引
+func storedTypes() map[string]interface{} {
+	return map[string]interface{}{
+		"Keychain":         &Keychain{},
+		"PendingTransfer":  &PendingTransfer{},
+		"NotifyMessage":    &NotifyMessage{},
+		"WatchOnlyWallet":  &WatchOnlyWallet{},
+		"WatchOnlyAccount": &WatchOnlyAccount{},
+		"SummarySetting":   &openwsdk.SummarySetting{},
+		"SummaryTaskLog":   &openwsdk.SummaryTaskLog{},
+		"TrustAddress":     &openwsdk.TrustAddress{},
+		"Symbol":           &openwsdk.Symbol{},
+		"TokenContract":    &openwsdk.TokenContract{},
+	}
+}
+
+// checkMaintainable 维护命令需要独占数据库，守护进程和只读模式下不能执行
+func (cli *CLI) checkMaintainable() error {
+	if cli.keepOpen || isUnixSocketAlive(cli.daemonSocket()) {
+		return fmt.Errorf("database is held by a running daemon, please stop it first")
+	}
+	if cli.config.dbReadOnlyMode {
+		return fmt.Errorf("database is opened read-only")
+	}
+	return nil
+}
+
+// CompactDB 复制所有bucket到新文件来回收空间，完成后替换原数据库文件
+func (cli *CLI) CompactDB() (*DBCompactResult, error) {
+
+	err := cli.checkMaintainable()
+	if err != nil {
+		return nil, err
+	}
+
+	dbfile := cli.dbFile()
+	if !file.Exists(dbfile) {
+		return nil, fmt.Errorf("database file: %s is not exist", dbfile)
+	}
+
+	//压缩期间持有原数据库的文件锁，防止其它进程写入
+	src, err := cli.openDB(false)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	tmpFile := dbfile + ".compact"
+	os.Remove(tmpFile)
+
+	dst, err := bolt.Open(tmpFile, 0600, &bolt.Options{Timeout: dbLockTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = compactBolt(dst, src.Bolt, compactTxMaxSize)
+	if err == nil {
+		err = checkBolt(dst)
+	}
+	dst.Close()
+	if err != nil {
+		os.Remove(tmpFile)
+		return nil, fmt.Errorf("compact database failed: %v", err)
+	}
+
+	result := &DBCompactResult{
+		Before: fileSize(dbfile),
+		After:  fileSize(tmpFile),
+	}
+
+	err = os.Rename(tmpFile, dbfile)
+	if err != nil {
+		os.Remove(tmpFile)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// VerifyDB 检查bolt文件的一致性，一致时重建所有storm索引
+func (cli *CLI) VerifyDB() (*DBVerifyResult, error) {
+
+	err := cli.checkMaintainable()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	result := &DBVerifyResult{}
+
+	err = cli.db.Bolt.View(func(tx *bolt.Tx) error {
+		for checkErr := range tx.Check() {
+			result.Errors = append(result.Errors, checkErr.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//文件不一致时不修改数据
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	for name, data := range storedTypes() {
+		//storm重建不存在的bucket时会panic，没有保存过的结构直接跳过
+		if !hasBucket(cli.db.Bolt, name) {
+			continue
+		}
+		err = cli.db.ReIndex(data)
+		if err != nil {
+			return nil, fmt.Errorf("reindex %s failed: %v", name, err)
+		}
+		result.Reindexed = append(result.Reindexed, name)
+	}
+
+	sort.Strings(result.Reindexed)
+
+	return result, nil
+}
+
+// ExportDB 导出数据库所有bucket，敏感字段替换为[REDACTED]，守护进程运行时导出其快照
+func (cli *CLI) ExportDB(format string, w io.Writer) error {
+
+	if format != DBExportFormatJSON {
+		return fmt.Errorf("export format: %s is not supported, it should be %s", format, DBExportFormatJSON)
+	}
+
+	db, err := cli.openDB(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		db.Close()
+		if db.Snapshot {
+			os.Remove(db.FileName)
+		}
+	}()
+
+	buckets := make(map[string]map[string]interface{})
+
+	err = walkBolt(db.Bolt, func(keys [][]byte, k, v []byte, seq uint64) error {
+		//bucket本身
+		if v == nil {
+			path := bucketPath(append(keys, k))
+			if _, exist := buckets[path]; !exist {
+				buckets[path] = make(map[string]interface{})
+			}
+			return nil
+		}
+		path := bucketPath(keys)
+		key := exportKey(k)
+		buckets[path][key] = redactValue(key, exportValue(v))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(buckets)
+}
+
+// PruneSummaryLogs 归档并删除创建时间早于before的汇总日志，先写归档文件，成功后才删除
+func (cli *CLI) PruneSummaryLogs(before time.Time, out string) (int, error) {
+
+	err := cli.checkMaintainable()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = cli.getDB()
+	if err != nil {
+		return 0, err
+	}
+	defer cli.closeDB()
+
+	var logs []*openwsdk.SummaryTaskLog
+	err = cli.db.Select(q.Lt("CreateTime", before.Unix())).Find(&logs)
+	if err == storm.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	content, err := json.MarshalIndent(logs, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	file.MkdirAll(filepath.Dir(out))
+	err = writeFileExclusive(out, content)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := cli.db.Begin(true)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, l := range logs {
+		err = tx.DeleteStruct(l)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(logs), nil
+}
+
+// walkFunc 遍历bolt的回调，keys为所在bucket的路径，v为nil时k是bucket
+type walkFunc func(keys [][]byte, k, v []byte, seq uint64) error
+
+// walkBolt 在只读事务中遍历所有bucket和键值
+func walkBolt(db *bolt.DB, fn walkFunc) error {
+	return db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return walkBucket(b, nil, name, nil, b.Sequence(), fn)
+		})
+	})
+}
+
+// walkBucket 递归遍历bucket
+func walkBucket(b *bolt.Bucket, keys [][]byte, k, v []byte, seq uint64, fn walkFunc) error {
+
+	err := fn(keys, k, v, seq)
+	if err != nil {
+		return err
+	}
+
+	if v != nil {
+		return nil
+	}
+
+	//复制路径，避免子bucket共用底层数组
+	path := make([][]byte, len(keys), len(keys)+1)
+	copy(path, keys)
+	path = append(path, k)
+
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			child := b.Bucket(k)
+			return walkBucket(child, path, k, nil, child.Sequence(), fn)
+		}
+		return walkBucket(b, path, k, v, b.Sequence(), fn)
+	})
+}
+
+// compactBolt 把src的所有bucket和键值复制到dst，超过txMaxSize分批提交
+func compactBolt(dst, src *bolt.DB, txMaxSize int64) error {
+
+	var size int64
+
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	err = walkBolt(src, func(keys [][]byte, k, v []byte, seq uint64) error {
+
+		sz := int64(len(k) + len(v))
+		if txMaxSize > 0 && size+sz > txMaxSize {
+			commitErr := tx.Commit()
+			if commitErr != nil {
+				return commitErr
+			}
+			tx, commitErr = dst.Begin(true)
+			if commitErr != nil {
+				return commitErr
+			}
+			size = 0
+		}
+		size += sz
+
+		//根bucket
+		if len(keys) == 0 {
+			bkt, createErr := tx.CreateBucket(k)
+			if createErr != nil {
+				return createErr
+			}
+			return bkt.SetSequence(seq)
+		}
+
+		b := tx.Bucket(keys[0])
+		for _, name := range keys[1:] {
+			b = b.Bucket(name)
+		}
+		//压缩后按顺序写入，数据页填满
+		b.FillPercent = 1.0
+
+		if v == nil {
+			bkt, createErr := b.CreateBucket(k)
+			if createErr != nil {
+				return createErr
+			}
+			return bkt.SetSequence(seq)
+		}
+
+		return b.Put(k, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkBolt 检查bolt文件一致性
+func checkBolt(db *bolt.DB) error {
+	return db.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			return err
+		}
+		return nil
+	})
+}
+
+// hasBucket 根bucket是否存在
+func hasBucket(db *bolt.DB, name string) bool {
+	exist := false
+	db.View(func(tx *bolt.Tx) error {
+		exist = tx.Bucket([]byte(name)) != nil
+		return nil
+	})
+	return exist
+}
+
+// bucketPath bucket路径
+func bucketPath(keys [][]byte) string {
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, exportKey(k))
+	}
+	return strings.Join(names, "/")
+}
+
+// exportKey 可读的键名原样导出，二进制的键名使用hex
+func exportKey(k []byte) string {
+	if utf8.Valid(k) && !strings.ContainsRune(string(k), 0) {
+		return string(k)
+	}
+	return "hex:" + hex.EncodeToString(k)
+}
+
+// exportValue storm默认使用json保存，其它内容按字符串或base64导出
+func exportValue(v []byte) interface{} {
+	var data interface{}
+	if json.Unmarshal(v, &data) == nil {
+		return data
+	}
+	if utf8.Valid(v) {
+		return string(v)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(v)
+}
+
+// redactValue 隐藏敏感字段和加密字段的值
+func redactValue(key string, value interface{}) interface{} {
+
+	if redactedFields[strings.ToLower(key)] {
+		return redactedValue
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = redactValue(k, child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue("", child)
+		}
+		return v
+	case string:
+		if isEncryptedSecret(v) {
+			return redactedValue
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// parseBeforeTime 解析日期(2006-01-02)或时长(720h)，时长表示当前时间之前
+func parseBeforeTime(before string) (time.Time, error) {
+
+	t, err := time.ParseInLocation("2006-01-02", before, time.Local)
+	if err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(before)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("before: %s should be a date like 2006-01-02 or a duration like 720h", before)
+	}
+
+	return time.Now().Add(-d), nil
+}
+
+// fileSize 文件大小
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// writeFileExclusive 写入新文件，文件已存在时返回错误，避免覆盖之前的归档
+func writeFileExclusive(path string, content []byte) error {
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+
+	return err
+}
@@ -0,0 +1,138 @@
+package openwcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+)
+
+func TestCLI_CompactAndVerifyDB(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	cli.getDB()
+	for i := 0; i < 100; i++ {
+		cli.db.Save(&WatchOnlyWallet{WalletID: fmt.Sprintf("W%d", i+2), Alias: strings.Repeat("x", 1024)})
+	}
+	cli.db.Save(&WatchOnlyWallet{WalletID: "W1", Alias: "watch"})
+	cli.closeDB()
+
+	result, err := cli.CompactDB()
+	if err != nil {
+		t.Errorf("CompactDB unexpected error: %v", err)
+		return
+	}
+	t.Logf("compact database from %d to %d", result.Before, result.After)
+
+	var watchWallet WatchOnlyWallet
+	cli.getDB()
+	err = cli.db.One("WalletID", "W1", &watchWallet)
+	cli.closeDB()
+	if err != nil || watchWallet.Alias != "watch" {
+		t.Errorf("compacted database data is not match: %v", err)
+		return
+	}
+
+	verify, err := cli.VerifyDB()
+	if err != nil {
+		t.Errorf("VerifyDB unexpected error: %v", err)
+		return
+	}
+	if len(verify.Errors) > 0 || len(verify.Reindexed) != 1 || verify.Reindexed[0] != "WatchOnlyWallet" {
+		t.Errorf("VerifyDB result is not match: %+v", verify)
+		return
+	}
+}
+
+func TestCLI_ExportDB(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	keychain, _ := GenKeychain()
+	cli.getDB()
+	cli.saveKeychain(keychain)
+	cli.db.Save(&WatchOnlyWallet{WalletID: "W1", Alias: "watch"})
+	cli.closeDB()
+
+	buf := new(bytes.Buffer)
+	err := cli.ExportDB(DBExportFormatJSON, buf)
+	if err != nil {
+		t.Errorf("ExportDB unexpected error: %v", err)
+		return
+	}
+
+	if strings.Contains(buf.String(), keychain.PrivateKey) {
+		t.Errorf("exported data should not contain private key")
+		return
+	}
+
+	var buckets map[string]map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &buckets)
+	if err != nil {
+		t.Errorf("exported data is not json: %v", err)
+		return
+	}
+
+	stored, ok := buckets["Keychain"][keychain.NodeID].(map[string]interface{})
+	if !ok || stored["privateKey"] != redactedValue || stored["nodeID"] != keychain.NodeID {
+		t.Errorf("exported keychain is not match: %v", buckets["Keychain"])
+		return
+	}
+
+	if _, ok := buckets["WatchOnlyWallet"]; !ok {
+		t.Errorf("exported data should contain all buckets")
+		return
+	}
+}
+
+func TestCLI_PruneSummaryLogs(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	now := time.Now()
+	cli.getDB()
+	cli.db.Save(&openwsdk.SummaryTaskLog{Sid: "old", CreateTime: now.AddDate(0, 0, -60).Unix()})
+	cli.db.Save(&openwsdk.SummaryTaskLog{Sid: "new", CreateTime: now.Unix()})
+	cli.closeDB()
+
+	out := filepath.Join(cli.config.datadir, backupDirName, "summarylog.json")
+	count, err := cli.PruneSummaryLogs(now.AddDate(0, 0, -30), out)
+	if err != nil || count != 1 {
+		t.Errorf("PruneSummaryLogs result is not match: %d, %v", count, err)
+		return
+	}
+
+	var archived []*openwsdk.SummaryTaskLog
+	content, _ := ioutil.ReadFile(out)
+	json.Unmarshal(content, &archived)
+	if len(archived) != 1 || archived[0].Sid != "old" {
+		t.Errorf("archived summary logs are not match: %s", content)
+		return
+	}
+
+	var logs []*openwsdk.SummaryTaskLog
+	cli.getDB()
+	cli.db.All(&logs)
+	cli.closeDB()
+	if len(logs) != 1 || logs[0].Sid != "new" {
+		t.Errorf("old summary logs are not deleted")
+		return
+	}
+
+	//不覆盖已有的归档文件
+	_, err = cli.PruneSummaryLogs(now.Add(time.Hour), out)
+	if err == nil {
+		t.Errorf("PruneSummaryLogs should failed when archive file exists")
+		return
+	}
+}
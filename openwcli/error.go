@@ -6,4 +6,7 @@ var (
 	ErrorSummaryTaskTimerIsNotStart = uint64(20003)
 	ErrorNodeAbilityDisabled        = uint64(20004)
 	ErrorSummarySettingFailed       = uint64(20005)
+	ErrorTransferIsPending          = uint64(20006)
+	ErrorPasswordParamRejected      = uint64(20007)
+	ErrorNodeShuttingDown           = uint64(20008)
 )
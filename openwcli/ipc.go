@@ -0,0 +1,58 @@
+package openwcli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// newUnixHTTPClient 通过unix socket访问本地HTTP服务的客户端，请求地址的host固定为unix
+func newUnixHTTPClient(socket string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// listenUnixSocket 监听unix socket，清理上次异常退出遗留的socket文件，只允许同一用户访问
+func listenUnixSocket(socket string) (net.Listener, error) {
+
+	if _, err := os.Stat(socket); err == nil {
+		if isUnixSocketAlive(socket) {
+			return nil, fmt.Errorf("unix socket: %s is already listening", socket)
+		}
+		os.Remove(socket)
+	}
+
+	//socket文件在创建时就只允许同一用户访问，不存在先创建后chmod的间隙
+	listener, err := listenUnixPrivate(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(socket, 0600)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// isUnixSocketAlive unix socket是否有服务在监听
+func isUnixSocketAlive(socket string) bool {
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package openwcli
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umask是进程级的设置，修改期间不允许其它socket同时创建
+var umaskMu sync.Mutex
+
+// listenUnixPrivate 在umask 0177下监听unix socket，socket文件创建时权限即为0600
+func listenUnixPrivate(socket string) (net.Listener, error) {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+
+	return net.Listen("unix", socket)
+}
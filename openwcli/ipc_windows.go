@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package openwcli
+
+import (
+	"net"
+)
+
+// listenUnixPrivate windows没有umask，socket文件的访问权限由所在目录的ACL控制
+func listenUnixPrivate(socket string) (net.Listener, error) {
+	return net.Listen("unix", socket)
+}
@@ -0,0 +1,275 @@
+package openwcli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bndr/gotabulate"
+)
+
+// saveKeychain 加密私钥后保存keychain，调用前需要已打开数据库
+func (cli *CLI) saveKeychain(keychain *Keychain) error {
+
+	key, err := cli.loadDataKey()
+	if err != nil {
+		return err
+	}
+
+	if keychain.CreateTime == 0 {
+		keychain.CreateTime = time.Now().Unix()
+	}
+
+	//数据库只保存密文，传入的keychain保持明文
+	stored := *keychain
+	stored.PrivateKey, err = encryptSecret(key, keychain.PrivateKey, keychain.NodeID)
+	if err != nil {
+		return err
+	}
+
+	return cli.db.Save(&stored)
+}
+
+// loadKeychain 读取并解密keychain，只读取不写入，旧版本明文保存的私钥由encryptdb或数据库迁移加密，调用前需要已打开数据库
+func (cli *CLI) loadKeychain(nodeID string) (*Keychain, error) {
+
+	var keychain Keychain
+	err := cli.db.One("NodeID", nodeID, &keychain)
+	if err != nil {
+		return nil, fmt.Errorf("The keychain: %s not exist, please register node first. ", nodeID)
+	}
+
+	if !isEncryptedSecret(keychain.PrivateKey) {
+		return &keychain, nil
+	}
+
+	key, err := cli.loadDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	keychain.PrivateKey, err = decryptSecret(key, keychain.PrivateKey, keychain.NodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keychain, nil
+}
+
+// getKeychainIDs 获取当前和上一个keychain的NodeID，调用前需要已打开数据库
+func (cli *CLI) getKeychainIDs() (current, previous string) {
+	cli.db.Get(CLIBucket, CurrentKeychainKey, &current)
+	cli.db.Get(CLIBucket, PreviousKeychainKey, &previous)
+	return
+}
+
+// switchKeychain 在同一个事务中切换当前keychain，并记录旧的keychain用于回滚，调用前需要已打开数据库
+func (cli *CLI) switchKeychain(current, previous string) error {
+
+	tx, err := cli.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.Set(CLIBucket, CurrentKeychainKey, current)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Set(CLIBucket, PreviousKeychainKey, previous)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListKeychains 列出本地所有keychain，返回的keychain不包含私钥
+func (cli *CLI) ListKeychains() ([]*Keychain, string, string, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer cli.closeDB()
+
+	var keychains []*Keychain
+	err = cli.db.All(&keychains)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	for _, k := range keychains {
+		k.PrivateKey = ""
+	}
+
+	current, previous := cli.getKeychainIDs()
+
+	return keychains, current, previous, nil
+}
+
+// RotateKeychain 生成新的keychain并登记到openw-server，登记成功才切换为当前keychain，
+// 旧的keychain保留在本地，可以通过UseKeychain回滚
+func (cli *CLI) RotateKeychain() (*Keychain, error) {
+
+	if check := cli.checkConfig(); check != nil {
+		return nil, check
+	}
+
+	old, err := cli.GetKeychain()
+	if err != nil {
+		return nil, err
+	}
+
+	keychain, err := GenKeychain()
+	if err != nil {
+		return nil, err
+	}
+
+	//先保存新keychain，但不切换当前keychain
+	_, err = cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	err = cli.saveKeychain(keychain)
+	cli.closeDB()
+	if err != nil {
+		return nil, fmt.Errorf("save new keychain failed. unexpected error: %v", err)
+	}
+
+	err = cli.bindKeychain(keychain)
+	if err != nil {
+		//登记失败，恢复使用旧keychain，并删除未登记的新keychain
+		cli.setupAPISDK(old)
+		if _, dbErr := cli.getDB(); dbErr == nil {
+			cli.db.DeleteStruct(keychain)
+			cli.closeDB()
+		}
+		return nil, fmt.Errorf("bind new keychain on server failed, current keychain is not changed: %v", err)
+	}
+
+	_, err = cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	err = cli.switchKeychain(keychain.NodeID, old.NodeID)
+	if err != nil {
+		cli.setupAPISDK(old)
+		return nil, fmt.Errorf("update current keychain failed. unexpected error: %v", err)
+	}
+
+	cli.setupKeychainNodes(keychain)
+
+	return keychain, nil
+}
+
+// UseKeychain 切换到本地已有的keychain，nodeID为空时回滚到上一个keychain
+func (cli *CLI) UseKeychain(nodeID string) (*Keychain, error) {
+
+	if check := cli.checkConfig(); check != nil {
+		return nil, check
+	}
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+
+	current, previous := cli.getKeychainIDs()
+	if len(nodeID) == 0 {
+		nodeID = previous
+	}
+	if len(nodeID) == 0 {
+		cli.closeDB()
+		return nil, fmt.Errorf("there is no previous keychain to roll back")
+	}
+	if nodeID == current {
+		cli.closeDB()
+		return nil, fmt.Errorf("keychain: %s is already in use", nodeID)
+	}
+
+	keychain, err := cli.loadKeychain(nodeID)
+	cli.closeDB()
+	if err != nil {
+		return nil, err
+	}
+
+	old, _ := cli.GetKeychain()
+
+	//重新登记，确保openw-server已绑定该keychain
+	err = cli.bindKeychain(keychain)
+	if err != nil {
+		if old != nil {
+			cli.setupAPISDK(old)
+		}
+		return nil, fmt.Errorf("bind keychain on server failed, current keychain is not changed: %v", err)
+	}
+
+	_, err = cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	err = cli.switchKeychain(keychain.NodeID, current)
+	if err != nil {
+		if old != nil {
+			cli.setupAPISDK(old)
+		}
+		return nil, fmt.Errorf("update current keychain failed. unexpected error: %v", err)
+	}
+
+	cli.setupKeychainNodes(keychain)
+
+	return keychain, nil
+}
+
+// bindKeychain 使用keychain配置APISDK并登记节点到openw-server
+func (cli *CLI) bindKeychain(keychain *Keychain) error {
+
+	err := cli.setupAPISDK(keychain)
+	if err != nil {
+		return err
+	}
+
+	return cli.RegisterOnServer()
+}
+
+// setupKeychainNodes 切换keychain后，更新使用节点证书的联合签名节点
+func (cli *CLI) setupKeychainNodes(keychain *Keychain) {
+	if cli.config.cosignthreshold > 0 {
+		cli.setupCoSignNode(keychain)
+	}
+}
+
+// printKeychainList 打印keychain列表
+func printKeychainList(list []*Keychain, current, previous string) {
+
+	tableInfo := make([][]interface{}, 0)
+
+	for i, k := range list {
+		status := ""
+		switch k.NodeID {
+		case current:
+			status = "current"
+		case previous:
+			status = "previous"
+		}
+		createTime := ""
+		if k.CreateTime > 0 {
+			createTime = time.Unix(k.CreateTime, 0).Format("2006-01-02 15:04:05")
+		}
+		tableInfo = append(tableInfo, []interface{}{
+			i, k.NodeID, createTime, status,
+		})
+	}
+
+	t := gotabulate.Create(tableInfo)
+	// Set Headers
+	t.SetHeaders([]string{"No.", "NodeID", "CreateTime", "Status"})
+
+	//打印信息
+	fmt.Println(t.Render("simple"))
+}
@@ -0,0 +1,95 @@
+package openwcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCLI_SaveKeychainEncrypted(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	first, err := GenKeychain()
+	if err != nil {
+		t.Errorf("GenKeychain unexpected error: %v", err)
+		return
+	}
+
+	err = cli.SaveCurrentKeychain(first)
+	if err != nil {
+		t.Errorf("SaveCurrentKeychain unexpected error: %v", err)
+		return
+	}
+
+	//数据库中的私钥是密文
+	cli.getDB()
+	var stored Keychain
+	cli.db.One("NodeID", first.NodeID, &stored)
+	cli.closeDB()
+	if !isEncryptedSecret(stored.PrivateKey) || stored.PrivateKey == first.PrivateKey {
+		t.Errorf("keychain private key is not encrypted")
+		return
+	}
+
+	keychain, err := cli.GetKeychain()
+	if err != nil {
+		t.Errorf("GetKeychain unexpected error: %v", err)
+		return
+	}
+	if keychain.PrivateKey != first.PrivateKey {
+		t.Errorf("decrypted private key is not match")
+		return
+	}
+
+	//旧版本明文保存的私钥只读取，不在读取时写入，由encryptdb或数据库迁移加密
+	legacy, _ := GenKeychain()
+	cli.getDB()
+	cli.db.Save(legacy)
+	loaded, err := cli.loadKeychain(legacy.NodeID)
+	cli.db.One("NodeID", legacy.NodeID, &stored)
+	cli.closeDB()
+	if err != nil || loaded.PrivateKey != legacy.PrivateKey {
+		t.Errorf("loadKeychain legacy keychain failed: %v", err)
+		return
+	}
+	if stored.PrivateKey != legacy.PrivateKey {
+		t.Errorf("legacy keychain should not be rewritten when loaded")
+		return
+	}
+
+	second, _ := GenKeychain()
+	err = cli.SaveCurrentKeychain(second)
+	if err != nil {
+		t.Errorf("SaveCurrentKeychain unexpected error: %v", err)
+		return
+	}
+
+	list, current, previous, err := cli.ListKeychains()
+	if err != nil {
+		t.Errorf("ListKeychains unexpected error: %v", err)
+		return
+	}
+	if len(list) != 3 || current != second.NodeID || previous != first.NodeID {
+		t.Errorf("keychain list is not match, current: %s, previous: %s", current, previous)
+		return
+	}
+	for _, k := range list {
+		if len(k.PrivateKey) > 0 {
+			t.Errorf("keychain list should not contain private key")
+			return
+		}
+	}
+
+	//其它数据密钥无法解密
+	err = ioutil.WriteFile(cli.dataKeyFile(), []byte(strings.Repeat("00", dataKeyLength)), 0600)
+	if err != nil {
+		t.Errorf("WriteFile unexpected error: %v", err)
+		return
+	}
+	_, err = cli.GetKeychain()
+	if err == nil {
+		t.Errorf("GetKeychain should failed with other data key")
+		return
+	}
+}
@@ -0,0 +1,451 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/owtp"
+	"github.com/bndr/gotabulate"
+)
+
+const (
+	//keystore检查结果
+	KeyStatusOK          = "ok"
+	KeyStatusUnparsable  = "unparsable"
+	KeyStatusNameInvalid = "filename mismatch"
+	KeyStatusDuplicate   = "duplicate"
+	KeyStatusOrphan      = "not on server"
+	KeyStatusUnknown     = "server unreachable"
+	KeyStatusWeakScrypt  = "weak scrypt"
+)
+
+// KeyCheckResult keystore文件检查结果
+type KeyCheckResult struct {
+	FileName string
+	FilePath string
+	WalletID string
+	Alias    string
+	ScryptN  int
+	ScryptP  int
+	Status   []string
+}
+
+// OK 是否没有任何问题
+func (r *KeyCheckResult) OK() bool {
+	return len(r.Status) == 0
+}
+
+// hasStatus 是否存在某个问题
+func (r *KeyCheckResult) hasStatus(status string) bool {
+	for _, s := range r.Status {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckKeys 检查keydir下所有keystore文件：能否解析、文件名与WalletID是否一致、是否重复、是否登记到openw-server、scrypt参数是否低于要求
+func (cli *CLI) CheckKeys(scryptN, scryptP int, checkServer bool) ([]*KeyCheckResult, error) {
+
+	wallets, err := openwallet.GetWalletsByKeyDir(cli.config.keydir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*KeyCheckResult, 0)
+	parsed := make(map[string]bool)
+	walletFiles := make(map[string]int)
+
+	for _, w := range wallets {
+		result := &KeyCheckResult{
+			FileName: filepath.Base(w.KeyFile),
+			FilePath: w.KeyFile,
+			WalletID: w.WalletID,
+			Alias:    w.Alias,
+		}
+		parsed[result.FileName] = true
+		walletFiles[w.WalletID]++
+
+		if result.FileName != hdkeystore.KeyFileName(w.Alias, w.WalletID)+".key" {
+			result.Status = append(result.Status, KeyStatusNameInvalid)
+		}
+
+		result.ScryptN, result.ScryptP, err = keyFileScryptParams(w.KeyFile)
+		if err != nil {
+			result.Status = append(result.Status, KeyStatusUnparsable)
+		} else if result.ScryptN < scryptN || result.ScryptP < scryptP {
+			result.Status = append(result.Status, KeyStatusWeakScrypt)
+		}
+
+		if checkServer && cli.api != nil {
+			var found bool
+			apiErr := cli.callAPI("FindWalletByWalletID", func() error {
+				var statusErr error
+				err := cli.api.FindWalletByWalletID(w.WalletID, true,
+					func(status uint64, msg string, wallet *openwsdk.Wallet) {
+						statusErr = apiStatusError(status, msg)
+						if status == owtp.StatusSuccess && wallet != nil {
+							found = true
+						}
+					})
+				if err != nil {
+					return err
+				}
+				return statusErr
+			})
+			//连接失败或服务端返回错误时不能判断钱包是否存在，只有服务端明确查不到钱包才是孤立的key
+			if apiErr != nil {
+				log.Warningf("check wallet: %s on server failed, unexpected error: %v", w.WalletID, apiErr)
+				result.Status = append(result.Status, KeyStatusUnknown)
+			} else if !found {
+				result.Status = append(result.Status, KeyStatusOrphan)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	for _, result := range results {
+		if walletFiles[result.WalletID] > 1 {
+			result.Status = append(result.Status, KeyStatusDuplicate)
+		}
+	}
+
+	//无法解析的key文件
+	files, err := ioutil.ReadDir(cli.config.keydir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".key") || parsed[f.Name()] {
+			continue
+		}
+		results = append(results, &KeyCheckResult{
+			FileName: f.Name(),
+			FilePath: filepath.Join(cli.config.keydir, f.Name()),
+			Status:   []string{KeyStatusUnparsable},
+		})
+	}
+
+	return results, nil
+}
+
+// reencryptKey 使用新的密码和scrypt参数重新加密keystore，先写入临时文件再替换，避免中断时损坏原文件
+func (cli *CLI) reencryptKey(key *hdkeystore.HDKey, filePath, password string, scryptN, scryptP int) error {
+
+	if len(password) == 0 {
+		return fmt.Errorf("wallet password is empty. ")
+	}
+
+	keystore := hdkeystore.NewHDKeystore(
+		cli.config.keydir,
+		scryptN,
+		scryptP,
+	)
+
+	//替换成功前任何失败都删除临时文件，避免残留在key目录
+	tmpPath := filePath + ".tmp"
+	replaced := false
+	defer func() {
+		if !replaced {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	err := keystore.StoreKey(tmpPath, key, password)
+	if err != nil {
+		return err
+	}
+
+	//校验临时文件可以解密
+	_, err = keystore.GetKey(key.KeyID, filepath.Base(tmpPath), password)
+	if err != nil {
+		return fmt.Errorf("verify re-encrypted key failed: %v", err)
+	}
+
+	err = os.Rename(tmpPath, filePath)
+	if err != nil {
+		return err
+	}
+	replaced = true
+
+	return nil
+}
+
+// UpgradeKeyScrypt 保持密码不变，使用更高的scrypt参数重新加密keystore
+func (cli *CLI) UpgradeKeyScrypt(wallet *openwsdk.Wallet, filePath, password string, scryptN, scryptP int) error {
+
+	key, err := cli.getLocalKeyByWallet(wallet, password)
+	if err != nil {
+		return err
+	}
+
+	return cli.reencryptKey(key, filePath, password, scryptN, scryptP)
+}
+
+// keyFileScryptParams 读取keystore文件的scrypt参数
+func keyFileScryptParams(filePath string) (int, int, error) {
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var keyJSON map[string]json.RawMessage
+	err = json.Unmarshal(content, &keyJSON)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cryptoJSON, exist := keyJSON["crypto"]
+	if !exist {
+		cryptoJSON, exist = keyJSON["Crypto"]
+	}
+	if !exist {
+		return 0, 0, fmt.Errorf("key file has no crypto")
+	}
+
+	var crypto struct {
+		KDF       string `json:"kdf"`
+		KDFParams struct {
+			N int `json:"n"`
+			P int `json:"p"`
+		} `json:"kdfparams"`
+	}
+	err = json.Unmarshal(cryptoJSON, &crypto)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if crypto.KDF != "scrypt" {
+		return 0, 0, fmt.Errorf("key file kdf: %s is not scrypt", crypto.KDF)
+	}
+
+	return crypto.KDFParams.N, crypto.KDFParams.P, nil
+}
+
+// printKeyCheckResults 打印keystore检查结果
+func (cli *CLI) printKeyCheckResults(results []*KeyCheckResult) {
+
+	if len(results) == 0 {
+		fmt.Println("No key file. ")
+		return
+	}
+
+	tableInfo := make([][]interface{}, 0)
+
+	for _, r := range results {
+		status := KeyStatusOK
+		if !r.OK() {
+			status = strings.Join(r.Status, ", ")
+		}
+		tableInfo = append(tableInfo, []interface{}{
+			r.FileName, r.WalletID, r.Alias, r.ScryptN, r.ScryptP, status,
+		})
+	}
+
+	t := gotabulate.Create(tableInfo)
+	// Set Headers
+	t.SetHeaders([]string{"File", "WalletID", "Alias", "ScryptN", "ScryptP", "Status"})
+
+	//打印信息
+	fmt.Println(t.Render("simple"))
+}
+
+// keyFileName 查找钱包在keydir的keystore文件名，钱包改名后文件名与openw-server的别名可能不一致
+func (cli *CLI) keyFileName(wallet *openwsdk.Wallet) string {
+	return findKeyFileName(cli.config.keydir, wallet.WalletID, wallet.Alias)
+}
+
+// getKeyDirWallets 加载目录中的keystore钱包，改名中断留下同一个WalletID的多个文件时只保留最新写入的文件
+func getKeyDirWallets(dir string) ([]*openwallet.Wallet, error) {
+
+	wallets, err := openwallet.GetWalletsByKeyDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*openwallet.Wallet, 0, len(wallets))
+	index := make(map[string]int)
+	modTimes := make(map[string]time.Time)
+	for _, w := range wallets {
+		var modTime time.Time
+		if info, statErr := os.Stat(w.KeyFile); statErr == nil {
+			modTime = info.ModTime()
+		}
+
+		i, exist := index[w.WalletID]
+		if !exist {
+			index[w.WalletID] = len(list)
+			modTimes[w.WalletID] = modTime
+			list = append(list, w)
+			continue
+		}
+		if modTime.After(modTimes[w.WalletID]) {
+			modTimes[w.WalletID] = modTime
+			list[i] = w
+		}
+	}
+
+	return list, nil
+}
+
+// findKeyFileName 在目录中按WalletID查找keystore文件名，找不到使用默认命名
+func findKeyFileName(dir, walletID, alias string) string {
+	wallets, err := getKeyDirWallets(dir)
+	if err == nil {
+		for _, w := range wallets {
+			if w.WalletID == walletID {
+				return filepath.Base(w.KeyFile)
+			}
+		}
+	}
+	return hdkeystore.KeyFileName(alias, walletID) + ".key"
+}
+
+// checkWalletAlias 检查钱包别名能否作为文件名
+func checkWalletAlias(alias string) error {
+	if len(alias) == 0 {
+		return fmt.Errorf("wallet alias is empty. ")
+	}
+	if strings.ContainsAny(alias, `/\:*?"<>|`) || strings.TrimSpace(alias) != alias {
+		return fmt.Errorf("wallet alias: %s contains invalid characters", alias)
+	}
+	return nil
+}
+
+// RenameWallet 修改钱包别名，用原密码和原scrypt参数重新加密到新文件名，成功后删除原文件。
+// 只修改本地keystore的别名，openw-server登记的别名不变
+func (cli *CLI) RenameWallet(wallet *openwsdk.Wallet, alias, password string) error {
+
+	err := checkWalletAlias(alias)
+	if err != nil {
+		return err
+	}
+
+	key, err := cli.getLocalKeyByWallet(wallet, password)
+	if err != nil {
+		return err
+	}
+
+	oldPath := filepath.Join(cli.config.keydir, cli.keyFileName(wallet))
+	newPath := filepath.Join(cli.config.keydir, hdkeystore.KeyFileName(alias, wallet.WalletID)+".key")
+	if oldPath == newPath {
+		return nil
+	}
+
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("key file: %s already exists", filepath.Base(newPath))
+	}
+
+	scryptN, scryptP, err := keyFileScryptParams(oldPath)
+	if err != nil {
+		return err
+	}
+
+	//先写入临时文件再原子替换到新文件名，删除原文件前两个文件同时存在时按最新的文件查找
+	key.Alias = alias
+	err = cli.reencryptKey(key, newPath, password, scryptN, scryptP)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(oldPath)
+	if err != nil {
+		return fmt.Errorf("wallet has been renamed to: %s, but remove old key file: %s failed, unexpected error: %v",
+			filepath.Base(newPath), filepath.Base(oldPath), err)
+	}
+
+	return nil
+}
+
+// ArchiveWallet 把钱包keystore移动到归档目录，钱包不再出现在本地钱包列表
+func (cli *CLI) ArchiveWallet(walletID string) (string, error) {
+
+	if _, err := cli.getKeystoreWallet(walletID); err != nil {
+		return "", err
+	}
+
+	wallet := &openwsdk.Wallet{WalletID: walletID}
+	fileName := cli.keyFileName(wallet)
+	archivePath := filepath.Join(cli.config.archivedir, fileName)
+
+	if _, err := os.Stat(archivePath); err == nil {
+		return "", fmt.Errorf("archived key file: %s already exists", fileName)
+	}
+
+	err := os.Rename(filepath.Join(cli.config.keydir, fileName), archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	//归档的钱包不能保持解锁
+	cli.LockWallet(walletID)
+
+	return archivePath, nil
+}
+
+// UnarchiveWallet 把归档的钱包keystore移回keydir
+func (cli *CLI) UnarchiveWallet(walletID string) (string, error) {
+
+	if _, err := cli.getKeystoreWallet(walletID); err == nil {
+		return "", fmt.Errorf("wallet: %s already exists in key directory", walletID)
+	}
+
+	archived, err := cli.GetArchivedWallets()
+	if err != nil {
+		return "", err
+	}
+
+	for _, w := range archived {
+		if w.WalletID != walletID {
+			continue
+		}
+		fileName := filepath.Base(w.KeyFile)
+		keyPath := filepath.Join(cli.config.keydir, fileName)
+		if _, err := os.Stat(keyPath); err == nil {
+			return "", fmt.Errorf("key file: %s already exists", fileName)
+		}
+		err = os.Rename(w.KeyFile, keyPath)
+		if err != nil {
+			return "", err
+		}
+		return keyPath, nil
+	}
+
+	return "", fmt.Errorf("can not find archived wallet: %s", walletID)
+}
+
+// GetArchivedWallets 归档的钱包列表
+func (cli *CLI) GetArchivedWallets() ([]*openwallet.Wallet, error) {
+	return openwallet.GetWalletsByKeyDir(cli.config.archivedir)
+}
+
+// printArchivedWalletList 打印归档的钱包列表
+func (cli *CLI) printArchivedWalletList(list []*openwallet.Wallet) {
+
+	tableInfo := make([][]interface{}, 0)
+
+	for i, w := range list {
+		tableInfo = append(tableInfo, []interface{}{
+			i, w.Alias, w.WalletID, filepath.Base(w.KeyFile),
+		})
+	}
+
+	t := gotabulate.Create(tableInfo)
+	// Set Headers
+	t.SetHeaders([]string{"No.", "Name", "WalletID", "File"})
+
+	//打印信息
+	fmt.Println(t.Render("simple"))
+}
@@ -0,0 +1,173 @@
+package openwcli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+)
+
+func TestCLI_CheckKeys(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "openwcli-keys")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{
+		config: &Config{keydir: dir},
+	}
+
+	key, filePath, err := hdkeystore.StoreHDKey(
+		dir,
+		"check",
+		"12345678",
+		hdkeystore.StandardScryptN,
+		hdkeystore.StandardScryptP,
+	)
+	if err != nil {
+		t.Errorf("StoreHDKey unexpected error: %v", err)
+		return
+	}
+
+	//无法解析的key文件
+	ioutil.WriteFile(filepath.Join(dir, "broken.key"), []byte("{}"), 0600)
+
+	results, err := cli.CheckKeys(hdkeystore.StandardScryptN, hdkeystore.StandardScryptP+1, false)
+	if err != nil {
+		t.Errorf("CheckKeys unexpected error: %v", err)
+		return
+	}
+
+	statuses := make(map[string]*KeyCheckResult)
+	for _, r := range results {
+		statuses[r.FileName] = r
+	}
+
+	if r := statuses[filepath.Base(filePath)]; r == nil || !r.hasStatus(KeyStatusWeakScrypt) {
+		t.Errorf("key: %s should be weak scrypt", filePath)
+		return
+	}
+
+	if r := statuses["broken.key"]; r == nil || !r.hasStatus(KeyStatusUnparsable) {
+		t.Errorf("broken.key should be unparsable")
+		return
+	}
+
+	//保持密码不变，提高scrypt参数
+	err = cli.reencryptKey(key, filePath, "12345678", hdkeystore.StandardScryptN, hdkeystore.StandardScryptP+1)
+	if err != nil {
+		t.Errorf("reencryptKey unexpected error: %v", err)
+		return
+	}
+
+	n, p, err := keyFileScryptParams(filePath)
+	if err != nil || n != hdkeystore.StandardScryptN || p != hdkeystore.StandardScryptP+1 {
+		t.Errorf("keyFileScryptParams n: %d, p: %d, err: %v", n, p, err)
+		return
+	}
+
+	keystore := hdkeystore.NewHDKeystore(dir, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP)
+	_, err = keystore.GetKey(key.KeyID, filepath.Base(filePath), "12345678")
+	if err != nil {
+		t.Errorf("re-encrypted key can not be unlocked: %v", err)
+		return
+	}
+}
+
+func TestCLI_RenameAndArchiveWallet(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "openwcli-keys")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{
+		config: &Config{
+			appid:      "test",
+			keydir:     filepath.Join(dir, "key"),
+			dbdir:      filepath.Join(dir, "db"),
+			archivedir: filepath.Join(dir, "archive"),
+		},
+		unlockSessions: make(map[string]*unlockSession),
+	}
+	os.MkdirAll(cli.config.keydir, 0700)
+	os.MkdirAll(cli.config.dbdir, 0700)
+	os.MkdirAll(cli.config.archivedir, 0700)
+
+	key, _, err := hdkeystore.StoreHDKey(
+		cli.config.keydir,
+		"before",
+		"12345678",
+		hdkeystore.StandardScryptN,
+		hdkeystore.StandardScryptP,
+	)
+	if err != nil {
+		t.Errorf("StoreHDKey unexpected error: %v", err)
+		return
+	}
+
+	wallet := &openwsdk.Wallet{WalletID: key.KeyID, Alias: "before"}
+
+	err = cli.RenameWallet(wallet, "after", "12345678")
+	if err != nil {
+		t.Errorf("RenameWallet unexpected error: %v", err)
+		return
+	}
+
+	//openw-server的别名仍为旧名，也能找到改名后的key文件
+	if name := cli.keyFileName(wallet); name != hdkeystore.KeyFileName("after", key.KeyID)+".key" {
+		t.Errorf("renamed key file: %s is not match", name)
+		return
+	}
+
+	_, err = cli.getLocalKeyByWallet(wallet, "12345678")
+	if err != nil {
+		t.Errorf("renamed key can not be unlocked: %v", err)
+		return
+	}
+
+	//改名中断留下的旧文件不影响查找改名后的key文件
+	newPath := filepath.Join(cli.config.keydir, hdkeystore.KeyFileName("after", key.KeyID)+".key")
+	oldPath := filepath.Join(cli.config.keydir, hdkeystore.KeyFileName("before", key.KeyID)+".key")
+	content, _ := ioutil.ReadFile(newPath)
+	ioutil.WriteFile(oldPath, content, 0600)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(oldPath, past, past)
+
+	if name := cli.keyFileName(wallet); name != filepath.Base(newPath) {
+		t.Errorf("leftover key file: %s should not be selected", name)
+		return
+	}
+	os.Remove(oldPath)
+
+	_, err = cli.ArchiveWallet(key.KeyID)
+	if err != nil {
+		t.Errorf("ArchiveWallet unexpected error: %v", err)
+		return
+	}
+
+	if _, err = cli.getKeystoreWallet(key.KeyID); err == nil {
+		t.Errorf("archived wallet should not be in key directory")
+		return
+	}
+
+	_, err = cli.UnarchiveWallet(key.KeyID)
+	if err != nil {
+		t.Errorf("UnarchiveWallet unexpected error: %v", err)
+		return
+	}
+
+	if _, err = cli.getKeystoreWallet(key.KeyID); err != nil {
+		t.Errorf("unarchived wallet should be in key directory")
+		return
+	}
+}
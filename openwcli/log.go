@@ -1,16 +1,16 @@
 package openwcli
 
 import (
+	"encoding/json"
 	"fmt"
 	"path/filepath"
 
-	"github.com/astaxie/beego/logs"
 	"github.com/blocktree/openwallet/v2/common/file"
 	"github.com/blocktree/openwallet/v2/log"
 )
 
-//SetupLog 配置日志
-func SetupLog(logDir, logFile string, debug bool) {
+//SetupLog 配置日志，format为text或json，日志内容经过敏感信息隐藏后输出，maxDays为日志文件保留天数
+func SetupLog(logDir, logFile string, debug bool, format string, maxDays int) {
 
 	//记录日志
 	logLevel := log.LevelInformational
@@ -18,14 +18,27 @@ func SetupLog(logDir, logFile string, debug bool) {
 		logLevel = log.LevelDebug
 	}
 
+	if format != LogFormatText && format != LogFormatJSON {
+		if len(format) > 0 {
+			fmt.Printf("logformat: %s is not supported, use %s\n", format, LogFormatText)
+		}
+		format = LogFormatText
+	}
+
+	filename := ""
 	if len(logDir) > 0 {
 		file.MkdirAll(logDir)
-		logFile := filepath.Join(logDir, logFile)
-		logConfig := fmt.Sprintf(`{"filename":"%s","level":%d,"daily":true,"maxdays":7,"maxsize":0}`, logFile, logLevel)
-		//log.Println(logConfig)
-		log.SetLogger(logs.AdapterFile, logConfig)
-		log.SetLogger(logs.AdapterConsole, logConfig)
-	} else {
-		log.SetLevel(logLevel)
+		filename = filepath.Join(logDir, logFile)
 	}
+
+	logConfig, _ := json.Marshal(redactLogWriterConfig{
+		Filename: filename,
+		Level:    logLevel,
+		Format:   format,
+		MaxDays:  maxDays,
+		Console:  true,
+	})
+	//log.Println(logConfig)
+	log.SetLogger(logAdapterName, string(logConfig))
+	log.SetLevel(logLevel)
 }
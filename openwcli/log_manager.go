@@ -0,0 +1,443 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	LogFormatText = "text" //普通文本日志
+	LogFormatJSON = "json" //每行一条JSON日志
+
+	logAdapterName    = "openwcli"
+	defaultLogMaxDays = 7
+	redactedLogValue  = "******"
+
+	//LogFields字段的分隔符，不会出现在普通日志内容中
+	logFieldsDelimiter = "\x1e"
+
+	//助记词最少的单词数
+	minMnemonicWords = 12
+)
+
+// logLevelNames 日志等级名称，与beego的日志等级对应
+var logLevelNames = map[int]string{
+	logs.LevelEmergency:     "emergency",
+	logs.LevelAlert:         "alert",
+	logs.LevelCritical:      "critical",
+	logs.LevelError:         "error",
+	logs.LevelWarning:       "warning",
+	logs.LevelNotice:        "notice",
+	logs.LevelInformational: "info",
+	logs.LevelDebug:         "debug",
+}
+
+var (
+	//beego添加的等级前缀和调用位置，如：[I] [cli.go:100]
+	logLevelPrefix  = regexp.MustCompile(`^\[[MACEWNID]\] `)
+	logCallerPrefix = regexp.MustCompile(`^\[([^\]\s]+\.go:\d+)\] `)
+
+	//敏感字段的值，如：password: xxx、"privateKey":"xxx"、Password:xxx
+	sensitiveLogKeys   = `[\w-]*(?:password|passwd|passphrase|private_?key|prikey|secret|mnemonic|seed|appkey|admintoken|accesstoken)`
+	sensitiveJSONValue = regexp.MustCompile(`(?i)("` + sensitiveLogKeys + `"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	sensitiveTextValue = regexp.MustCompile(`(?i)\b(` + sensitiveLogKeys + `)(\s*[:=]\s*)[^\s,;"'}\]]+`)
+	bearerTokenValue   = regexp.MustCompile(`(?i)\b(Bearer\s+)\S+`)
+	extendedPrivateKey = regexp.MustCompile(`\b[xt]prv[1-9A-HJ-NP-Za-km-z]{100,}`)
+	//种子分片，如：owshare:walletID:threshold:index:hex
+	walletShareText = regexp.MustCompile(`\b` + shareTextPrefix + `:\S+`)
+	//连续12个以上的单词，其中属于BIP39单词表的部分按助记词隐藏
+	mnemonicWordRun = regexp.MustCompile(`(?i)\b[a-z]{3,8}(?:\s+[a-z]{3,8}){11,}\b`)
+	mnemonicWord    = regexp.MustCompile(`\S+`)
+
+	//LogFields编码的字段，如：\x1e["sid","xxx","walletID","xxx"]\x1e
+	logFieldsValue = regexp.MustCompile(logFieldsDelimiter + `([^` + logFieldsDelimiter + `]*)` + logFieldsDelimiter)
+
+	//BIP39英文单词表
+	bip39WordsOnce sync.Once
+	bip39Words     map[string]bool
+)
+
+func init() {
+	logs.Register(logAdapterName, newRedactLogWriter)
+}
+
+// RedactLogMessage 隐藏日志中的密码、私钥、助记词和种子分片等敏感信息
+func RedactLogMessage(msg string) string {
+	msg = sensitiveJSONValue.ReplaceAllString(msg, `$1"`+redactedLogValue+`"`)
+	msg = sensitiveTextValue.ReplaceAllString(msg, "${1}${2}"+redactedLogValue)
+	msg = bearerTokenValue.ReplaceAllString(msg, "${1}"+redactedLogValue)
+	msg = extendedPrivateKey.ReplaceAllString(msg, redactedLogValue)
+	msg = walletShareText.ReplaceAllString(msg, redactedLogValue)
+	msg = mnemonicWordRun.ReplaceAllStringFunc(msg, redactMnemonicWords)
+	return msg
+}
+
+// isBIP39Word 是否BIP39英文单词表的单词
+func isBIP39Word(word string) bool {
+	bip39WordsOnce.Do(func() {
+		bip39Words = make(map[string]bool)
+		for _, w := range bip39.GetWordList() {
+			bip39Words[w] = true
+		}
+	})
+	return bip39Words[strings.ToLower(word)]
+}
+
+// redactMnemonicWords 隐藏连续单词中，连续12个以上都属于BIP39单词表的部分
+func redactMnemonicWords(run string) string {
+
+	var (
+		buf   strings.Builder
+		last  = 0
+		start = 0
+		count = 0
+	)
+
+	words := mnemonicWord.FindAllStringIndex(run, -1)
+	for i := 0; i <= len(words); i++ {
+		if i < len(words) && isBIP39Word(run[words[i][0]:words[i][1]]) {
+			if count == 0 {
+				start = i
+			}
+			count++
+			continue
+		}
+		if count >= minMnemonicWords {
+			buf.WriteString(run[last:words[start][0]])
+			buf.WriteString(redactedLogValue)
+			last = words[i-1][1]
+		}
+		count = 0
+	}
+	buf.WriteString(run[last:])
+
+	return buf.String()
+}
+
+// logRecord JSON日志的字段
+type logRecord struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Caller    string `json:"caller,omitempty"`
+	Msg       string `json:"msg"`
+	Sid       string `json:"sid,omitempty"`
+	WalletID  string `json:"walletID,omitempty"`
+	AccountID string `json:"accountID,omitempty"`
+	Symbol    string `json:"symbol,omitempty"`
+	TxID      string `json:"txid,omitempty"`
+	Route     string `json:"route,omitempty"`
+	Peer      string `json:"peer,omitempty"`
+}
+
+// setField 设置字段，同一条日志只取第一次出现的值
+func (r *logRecord) setField(name, value string) {
+	var field *string
+	switch name {
+	case "sid":
+		field = &r.Sid
+	case "walletID":
+		field = &r.WalletID
+	case "accountID":
+		field = &r.AccountID
+	case "symbol":
+		field = &r.Symbol
+	case "txid":
+		field = &r.TxID
+	case "route":
+		field = &r.Route
+	case "peer":
+		field = &r.Peer
+	default:
+		return
+	}
+	if len(*field) == 0 {
+		*field = value
+	}
+}
+
+// newLogRecord 解析日志内容，生成JSON日志
+func newLogRecord(when time.Time, msg string, level int) *logRecord {
+
+	record := &logRecord{
+		Time:  when.Format(time.RFC3339Nano),
+		Level: logLevelNames[level],
+	}
+
+	msg = logLevelPrefix.ReplaceAllString(msg, "")
+	if m := logCallerPrefix.FindStringSubmatch(msg); m != nil {
+		record.Caller = m[1]
+		msg = msg[len(m[0]):]
+	}
+	record.Msg = strings.TrimSpace(formatLogFields(msg))
+
+	for _, m := range logFieldsValue.FindAllStringSubmatch(msg, -1) {
+		pairs := decodeLogFields(m[1])
+		for i := 0; i+1 < len(pairs); i += 2 {
+			record.setField(pairs[i], pairs[i+1])
+		}
+	}
+
+	return record
+}
+
+// LogFields 把日志字段编码到日志内容中，JSON日志输出为独立字段，文本日志输出为：sid=xxx walletID=xxx。
+// 字段名为sid、walletID、accountID、symbol、txid、route、peer，值为空的字段忽略
+func LogFields(pairs ...string) string {
+	fields := make([]string, 0, len(pairs))
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if len(pairs[i+1]) == 0 {
+			continue
+		}
+		fields = append(fields, pairs[i], strings.Replace(pairs[i+1], logFieldsDelimiter, "", -1))
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(fields)
+	return logFieldsDelimiter + string(data) + logFieldsDelimiter
+}
+
+// decodeLogFields 解析LogFields编码的字段
+func decodeLogFields(data string) []string {
+	var pairs []string
+	if json.Unmarshal([]byte(data), &pairs) != nil {
+		return nil
+	}
+	return pairs
+}
+
+// formatLogFields 把日志内容中LogFields编码的字段转为文本：sid=xxx walletID=xxx
+func formatLogFields(msg string) string {
+	return logFieldsValue.ReplaceAllStringFunc(msg, func(m string) string {
+		pairs := decodeLogFields(m[len(logFieldsDelimiter) : len(m)-len(logFieldsDelimiter)])
+		fields := make([]string, 0, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			fields = append(fields, pairs[i]+"="+pairs[i+1])
+		}
+		return strings.Join(fields, " ")
+	})
+}
+
+// logFailedSignatures 打印广播失败的交易签名信息，不输出签名数据
+func logFailedSignatures(rawHex string, signatures map[string][]*openwsdk.KeySignature) {
+	if len(rawHex) > 0 {
+		log.Warningf("[Failed] rawHex: %s", abbreviateLogValue(rawHex))
+	}
+	for accountID, keySignatures := range signatures {
+		log.Warningf("[Failed] signature %s", LogFields("accountID", accountID))
+		for _, keySignature := range keySignatures {
+			address := ""
+			if keySignature.Address != nil {
+				address = keySignature.Address.Address
+			}
+			log.Warningf("[Failed] keySignature address: %s, eccType: %d, message: %s",
+				address, keySignature.EccType, abbreviateLogValue(keySignature.Message))
+		}
+	}
+}
+
+// abbreviateLogValue 缩短过长的数据，只保留首尾用于排查
+func abbreviateLogValue(value string) string {
+	if len(value) <= 32 {
+		return value
+	}
+	return fmt.Sprintf("%s...%s(%d)", value[:16], value[len(value)-16:], len(value))
+}
+
+// redactLogWriterConfig 日志输出配置
+type redactLogWriterConfig struct {
+	Filename string `json:"filename"`
+	Level    int    `json:"level"`
+	Format   string `json:"format"`
+	MaxDays  int    `json:"maxdays"`
+	Console  bool   `json:"console"`
+}
+
+// redactLogWriter beego日志适配器，隐藏敏感信息后输出到控制台和按天切割的文件
+type redactLogWriter struct {
+	mu       sync.Mutex
+	config   redactLogWriterConfig
+	file     *os.File
+	fileDate string
+	console  io.Writer
+}
+
+func newRedactLogWriter() logs.Logger {
+	return &redactLogWriter{
+		config: redactLogWriterConfig{
+			Level:   logs.LevelDebug,
+			Format:  LogFormatText,
+			MaxDays: defaultLogMaxDays,
+		},
+		console: os.Stdout,
+	}
+}
+
+// Init 解析配置，打开日志文件
+func (w *redactLogWriter) Init(config string) error {
+
+	err := json.Unmarshal([]byte(config), &w.config)
+	if err != nil {
+		return err
+	}
+
+	if w.config.Format != LogFormatText && w.config.Format != LogFormatJSON {
+		return fmt.Errorf("log format: %s is not supported", w.config.Format)
+	}
+
+	if len(w.config.Filename) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.openFile(time.Now())
+}
+
+// WriteMsg 写入一条日志
+func (w *redactLogWriter) WriteMsg(when time.Time, msg string, level int) error {
+
+	if level > w.config.Level {
+		return nil
+	}
+
+	msg = RedactLogMessage(msg)
+
+	var line string
+	if w.config.Format == LogFormatJSON {
+		data, err := json.Marshal(newLogRecord(when, msg, level))
+		if err != nil {
+			return err
+		}
+		line = string(data) + "\n"
+	} else {
+		line = when.Format("2006/01/02 15:04:05.000") + " " + formatLogFields(msg) + "\n"
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.config.Console && w.console != nil {
+		io.WriteString(w.console, line)
+	}
+
+	if len(w.config.Filename) == 0 {
+		return nil
+	}
+
+	if when.Format("2006-01-02") != w.fileDate {
+		err := w.rotate(when)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w.file, line)
+	return err
+}
+
+// openFile 打开当天的日志文件
+func (w *redactLogWriter) openFile(now time.Time) error {
+
+	err := os.MkdirAll(filepath.Dir(w.config.Filename), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(w.config.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.fileDate = now.Format("2006-01-02")
+
+	//重启时，文件是之前的日期写入的，按文件的日期处理
+	if info, statErr := file.Stat(); statErr == nil && info.Size() > 0 {
+		w.fileDate = info.ModTime().Format("2006-01-02")
+	}
+
+	return nil
+}
+
+// rotate 日期变化时，把日志文件重命名为name.2006-01-02.ext，删除超过保留天数的文件
+func (w *redactLogWriter) rotate(now time.Time) error {
+
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+
+		ext := filepath.Ext(w.config.Filename)
+		rotated := strings.TrimSuffix(w.config.Filename, ext) + "." + w.fileDate + ext
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			os.Rename(w.config.Filename, rotated)
+		}
+	}
+
+	err := w.openFile(now)
+	if err != nil {
+		return err
+	}
+	w.fileDate = now.Format("2006-01-02")
+
+	w.deleteOldFiles(now)
+
+	return nil
+}
+
+// deleteOldFiles 删除超过保留天数的日志文件，maxdays小于等于0时不删除
+func (w *redactLogWriter) deleteOldFiles(now time.Time) {
+
+	if w.config.MaxDays <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(w.config.Filename)
+	pattern := strings.TrimSuffix(w.config.Filename, ext) + ".*" + ext
+	files, _ := filepath.Glob(pattern)
+
+	deadline := now.AddDate(0, 0, -w.config.MaxDays)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if info.ModTime().Before(deadline) {
+			os.Remove(path)
+		}
+	}
+}
+
+// Destroy 关闭日志文件
+func (w *redactLogWriter) Destroy() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+}
+
+// Flush 同步日志文件
+func (w *redactLogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil {
+		w.file.Sync()
+	}
+}
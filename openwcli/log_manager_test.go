@@ -0,0 +1,138 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+func TestRedactLogMessage(t *testing.T) {
+
+	tests := []struct {
+		msg    string
+		secret string
+	}{
+		{msg: `request params: {"walletID":"W1","password":"12345678"}`, secret: "12345678"},
+		{msg: `unlock wallet failed, password: abc123, walletID: W1`, secret: "abc123"},
+		{msg: `keychain: &{NodeID:N1 PrivateKey:5JvFq8bU9x}`, secret: "5JvFq8bU9x"},
+		{msg: `"dbpassphrase" : "p\"ass"`, secret: `p\"ass`},
+		{msg: `Authorization: Bearer token123`, secret: "token123"},
+		{msg: `key: xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi`, secret: "xprv9s21"},
+		{msg: `import failed: owshare:W1:2:1:01a3f5c7e9`, secret: "01a3f5c7e9"},
+		{msg: `input: Abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about is invalid`, secret: "abandon about"},
+	}
+
+	for _, test := range tests {
+		redacted := RedactLogMessage(test.msg)
+		if strings.Contains(redacted, test.secret) || !strings.Contains(redacted, redactedLogValue) {
+			t.Errorf("message is not redacted: %s", redacted)
+			return
+		}
+	}
+
+	//助记词前后的内容保留
+	redacted := RedactLogMessage(`seed input: abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about is invalid`)
+	if redacted != `seed input: `+redactedLogValue+` is invalid` {
+		t.Errorf("mnemonic is not redacted: %s", redacted)
+		return
+	}
+
+	//普通信息不受影响
+	for _, msg := range []string{
+		`[Success] txid: 0x6b2f9b7e45c1a0d3e0e2b6c4f5a8d9e7c1b3a5f7e9d1c3b5a7f9e1d3c5b7a9f1e3`,
+		`the node has disabled transfer ability, please check the config file and restart the node again`,
+	} {
+		if RedactLogMessage(msg) != msg {
+			t.Errorf("message should not be changed: %s", RedactLogMessage(msg))
+			return
+		}
+	}
+}
+
+func TestNewLogRecord(t *testing.T) {
+
+	record := newLogRecord(time.Now(), "[W] [summary_manager.go:120] Summary main coin unexpected error: timeout, "+
+		LogFields("walletID", "W1", "accountID", "A1"), logs.LevelWarning)
+	if record.Level != "warning" || record.Caller != "summary_manager.go:120" ||
+		record.WalletID != "W1" || record.AccountID != "A1" ||
+		record.Msg != "Summary main coin unexpected error: timeout, walletID=W1 accountID=A1" {
+		t.Errorf("log record is not match: %+v", record)
+		return
+	}
+
+	record = newLogRecord(time.Now(), "[D] trust route call finished, "+LogFields("route", "transfer", "peer", "P1", "sid", "")+" status=200", logs.LevelDebug)
+	if record.Route != "transfer" || record.Peer != "P1" || record.Sid != "" ||
+		record.Msg != "trust route call finished, route=transfer peer=P1 status=200" {
+		t.Errorf("log record fields are not match: %+v", record)
+		return
+	}
+
+	//字段只来自LogFields，不从普通内容中提取
+	record = newLogRecord(time.Now(), "[I] unknown wallet: W2, "+LogFields("sid", "123e4567", "symbol", "ETH", "txid", "0xabc"), logs.LevelInformational)
+	if record.Sid != "123e4567" || record.Symbol != "ETH" || record.TxID != "0xabc" || record.WalletID != "" {
+		t.Errorf("log record fields are not match: %+v", record)
+		return
+	}
+}
+
+func TestRedactLogWriter(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "openwcli-log")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "openwcli.log")
+
+	//超过保留天数的日志文件
+	oldFile := filepath.Join(dir, "openwcli.2020-01-01.log")
+	ioutil.WriteFile(oldFile, []byte("old"), 0640)
+	oldTime := time.Now().AddDate(0, 0, -10)
+	os.Chtimes(oldFile, oldTime, oldTime)
+
+	w := newRedactLogWriter().(*redactLogWriter)
+	err = w.Init(`{"filename":"` + filename + `","level":6,"format":"json","maxdays":7}`)
+	if err != nil {
+		t.Errorf("Init unexpected error: %v", err)
+		return
+	}
+	defer w.Destroy()
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	w.fileDate = yesterday.Format("2006-01-02")
+	w.WriteMsg(yesterday, "[I] unlock wallet: W1, password: 123456", logs.LevelInformational)
+	w.WriteMsg(time.Now(), "[D] debug message", logs.LevelDebug)
+	w.WriteMsg(time.Now(), "[I] "+LogFields("sid", "S1"), logs.LevelInformational)
+
+	rotated := filepath.Join(dir, "openwcli."+yesterday.Format("2006-01-02")+".log")
+	content, err := ioutil.ReadFile(rotated)
+	if err != nil {
+		t.Errorf("log file is not rotated: %v", err)
+		return
+	}
+	if strings.Contains(string(content), "123456") {
+		t.Errorf("password is written to log: %s", content)
+		return
+	}
+
+	var record logRecord
+	content, _ = ioutil.ReadFile(filename)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &record) != nil || record.Sid != "S1" || record.Msg != "sid=S1" {
+		t.Errorf("current log file is not match: %s", content)
+		return
+	}
+
+	if _, err := os.Stat(oldFile); !os.IsNotExist(err) {
+		t.Errorf("old log file is not deleted")
+		return
+	}
+}
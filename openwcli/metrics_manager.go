@@ -0,0 +1,370 @@
+package openwcli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/owtp"
+)
+
+const (
+	metricsPath = "/metrics"
+
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// 导出的指标名称
+const (
+	MetricTransfers            = "openw_transfers_total"
+	MetricSummaryCycles        = "openw_summary_cycles_total"
+	MetricSummaryLastCycle     = "openw_summary_last_cycle_timestamp_seconds"
+	MetricSummaryCycleDuration = "openw_summary_cycle_duration_seconds"
+	MetricSummaryTransactions  = "openw_summary_transactions_total"
+	MetricSummarySweptAmount   = "openw_summary_swept_amount_total"
+	MetricSummaryFees          = "openw_summary_fees_total"
+	MetricFeesSupportBalance   = "openw_fees_support_balance"
+	MetricTrustServerConnected = "openw_trust_server_connected"
+	MetricTrustRouteCalls      = "openw_trust_route_calls_total"
+	MetricTrustRouteDuration   = "openw_trust_route_duration_seconds"
+	MetricAPIRequestDuration   = "openw_api_request_duration_seconds"
+	MetricAPIRequestErrors     = "openw_api_request_errors_total"
+)
+
+// 转账和汇总交易的结果
+const (
+	MetricStatusSuccess  = "success"
+	MetricStatusFailed   = "failed"
+	MetricStatusRejected = "rejected"
+	MetricStatusPending  = "pending"
+)
+
+// defaultLatencyBuckets 耗时分布的区间，单位秒
+var defaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// metricSeries 一组标签值对应的数据
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64
+	count       uint64
+	sum         float64
+}
+
+// metricFamily 同名指标
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+// MetricsRegistry 运行指标，按Prometheus文本格式导出
+type MetricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+	names    []string
+}
+
+// NewMetricsRegistry 创建运行指标，注册内置的指标
+func NewMetricsRegistry() *MetricsRegistry {
+
+	m := &MetricsRegistry{
+		families: make(map[string]*metricFamily),
+	}
+
+	m.Register(MetricTransfers, metricCounter, "Transfers sent by the node.", "symbol", "contract_address", "status")
+	m.Register(MetricSummaryCycles, metricCounter, "Summary task cycles executed.")
+	m.Register(MetricSummaryLastCycle, metricGauge, "Unix time of the last finished summary task cycle.")
+	m.Register(MetricSummaryCycleDuration, metricHistogram, "Duration of summary task cycles.")
+	m.Register(MetricSummaryTransactions, metricCounter, "Summary transactions submitted.", "symbol", "contract_id", "status")
+	m.Register(MetricSummarySweptAmount, metricCounter, "Amount swept to summary addresses, main coin is net of fees.", "symbol", "contract_id")
+	m.Register(MetricSummaryFees, metricCounter, "Fees paid by summary transactions.", "symbol", "contract_id")
+	m.Register(MetricFeesSupportBalance, metricGauge, "Balance of fees support accounts checked by summary tasks.", "account_id", "symbol")
+	m.Register(MetricTrustServerConnected, metricGauge, "Whether the trust server is connected, 1 is connected.", "host_id")
+	m.Register(MetricTrustRouteCalls, metricCounter, "Trust server route calls.", "route", "status")
+	m.Register(MetricTrustRouteDuration, metricHistogram, "Duration of trust server route calls.", "route")
+	m.Register(MetricAPIRequestDuration, metricHistogram, "Duration of openw-server API requests.", "method")
+	m.Register(MetricAPIRequestErrors, metricCounter, "openw-server API requests failed.", "method")
+
+	return m
+}
+
+// Register 注册指标，同名指标不会重复注册
+func (m *MetricsRegistry) Register(name, kind, help string, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exist := m.families[name]; exist {
+		return
+	}
+
+	family := &metricFamily{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*metricSeries),
+	}
+	if kind == metricHistogram {
+		family.buckets = defaultLatencyBuckets
+	}
+
+	m.families[name] = family
+	m.names = append(m.names, name)
+	sort.Strings(m.names)
+}
+
+// getSeries 查找标签值对应的数据，没有则创建
+func (m *MetricsRegistry) getSeries(name string, labelValues []string) *metricSeries {
+
+	family, exist := m.families[name]
+	if !exist {
+		log.Warningf("metric: %s is not registered", name)
+		return nil
+	}
+
+	if len(labelValues) != len(family.labels) {
+		log.Warningf("metric: %s labels count is not match", name)
+		return nil
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	series, exist := family.series[key]
+	if !exist {
+		series = &metricSeries{
+			labelValues: append([]string(nil), labelValues...),
+		}
+		if family.kind == metricHistogram {
+			series.buckets = make([]uint64, len(family.buckets))
+		}
+		family.series[key] = series
+	}
+	return series
+}
+
+// Add 计数器增加value
+func (m *MetricsRegistry) Add(name string, value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if series := m.getSeries(name, labelValues); series != nil {
+		series.value += value
+	}
+}
+
+// Inc 计数器加1
+func (m *MetricsRegistry) Inc(name string, labelValues ...string) {
+	m.Add(name, 1, labelValues...)
+}
+
+// Set 设置仪表盘的值
+func (m *MetricsRegistry) Set(name string, value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if series := m.getSeries(name, labelValues); series != nil {
+		series.value = value
+	}
+}
+
+// Observe 记录一次分布数据
+func (m *MetricsRegistry) Observe(name string, value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := m.getSeries(name, labelValues)
+	if series == nil || series.buckets == nil {
+		return
+	}
+
+	family := m.families[name]
+	for i, bound := range family.buckets {
+		if value <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// Value 读取计数器或仪表盘的值，用于检查指标
+func (m *MetricsRegistry) Value(name string, labelValues ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	family, exist := m.families[name]
+	if !exist {
+		return 0
+	}
+	series, exist := family.series[strings.Join(labelValues, "\xff")]
+	if !exist {
+		return 0
+	}
+	if family.kind == metricHistogram {
+		return float64(series.count)
+	}
+	return series.value
+}
+
+// WriteText 按Prometheus文本格式输出所有指标
+func (m *MetricsRegistry) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf := new(bytes.Buffer)
+	for _, name := range m.names {
+		family := m.families[name]
+
+		fmt.Fprintf(buf, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(buf, "# TYPE %s %s\n", family.name, family.kind)
+
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		//没有标签的计数器和仪表盘默认输出0
+		if len(keys) == 0 && len(family.labels) == 0 && family.kind != metricHistogram {
+			fmt.Fprintf(buf, "%s 0\n", family.name)
+		}
+
+		leLabels := append(append([]string(nil), family.labels...), "le")
+
+		for _, key := range keys {
+			series := family.series[key]
+			labels := formatMetricLabels(family.labels, series.labelValues)
+
+			if family.kind != metricHistogram {
+				fmt.Fprintf(buf, "%s%s %s\n", family.name, labels, formatMetricValue(series.value))
+				continue
+			}
+
+			leValues := append(append([]string(nil), series.labelValues...), "")
+			for i, bound := range family.buckets {
+				leValues[len(leValues)-1] = formatMetricValue(bound)
+				le := formatMetricLabels(leLabels, leValues)
+				fmt.Fprintf(buf, "%s_bucket%s %d\n", family.name, le, series.buckets[i])
+			}
+			leValues[len(leValues)-1] = "+Inf"
+			le := formatMetricLabels(leLabels, leValues)
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", family.name, le, series.count)
+			fmt.Fprintf(buf, "%s_sum%s %s\n", family.name, labels, formatMetricValue(series.sum))
+			fmt.Fprintf(buf, "%s_count%s %d\n", family.name, labels, series.count)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// formatMetricLabels 输出标签，转义反斜杠、双引号和换行
+func formatMetricLabels(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for i, label := range labels {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatMetricValue 输出数值
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Metrics 返回CLI的运行指标
+func (cli *CLI) Metrics() *MetricsRegistry {
+	cli.metricsOnce.Do(func() {
+		if cli.metrics == nil {
+			cli.metrics = NewMetricsRegistry()
+		}
+	})
+	return cli.metrics
+}
+
+// callAPI 调用openw-server接口，记录耗时和错误。call需要返回调用的错误和回调中的非成功状态，两者都计入错误数
+func (cli *CLI) callAPI(method string, call func() error) error {
+	start := time.Now()
+	err := call()
+	cli.Metrics().Observe(MetricAPIRequestDuration, time.Since(start).Seconds(), method)
+	if err != nil {
+		cli.Metrics().Inc(MetricAPIRequestErrors, method)
+	}
+	return err
+}
+
+// apiStatusError openw-server回调的状态不是成功时，转为callAPI的错误
+func apiStatusError(status uint64, msg string) error {
+	if status == owtp.StatusSuccess {
+		return nil
+	}
+	return openwallet.Errorf(status, msg)
+}
+
+// serveMetrics 输出指标
+func (cli *CLI) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	cli.Metrics().WriteText(w)
+}
+
+// ServeMetrics 配置了metricslisten时，启动指标服务
+func (cli *CLI) ServeMetrics() error {
+
+	if len(cli.config.metricslisten) == 0 {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", cli.config.metricslisten)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, cli.serveMetrics)
+
+	cli.metricsServer = &http.Server{
+		Handler:     mux,
+		ReadTimeout: time.Duration(cli.config.requesttimeout) * time.Second,
+	}
+
+	go func(server *http.Server) {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("metrics on %s stopped, unexpected error: %v", listener.Addr(), err)
+		}
+	}(cli.metricsServer)
+
+	log.Infof("Metrics is serving on http://%s%s", listener.Addr(), metricsPath)
+
+	return nil
+}
+
+// CloseMetrics 关闭指标服务
+func (cli *CLI) CloseMetrics() {
+	if cli.metricsServer != nil {
+		cli.metricsServer.Close()
+		cli.metricsServer = nil
+	}
+}
@@ -0,0 +1,97 @@
+package openwcli
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/openwallet/v2/owtp"
+)
+
+func TestMetricsRegistry_WriteText(t *testing.T) {
+
+	m := NewMetricsRegistry()
+	m.Inc(MetricTransfers, "ETH", "", MetricStatusSuccess)
+	m.Inc(MetricTransfers, "ETH", "", MetricStatusSuccess)
+	m.Add(MetricSummarySweptAmount, 1.5, "ETH", "contract\"1")
+	m.Set(MetricTrustServerConnected, 1, "server1")
+	m.Observe(MetricAPIRequestDuration, 0.2, "SubmitTrade")
+	m.Observe(MetricAPIRequestDuration, 3, "SubmitTrade")
+
+	//标签数量不匹配的数据被忽略
+	m.Inc(MetricTransfers, "ETH")
+
+	buf := new(bytes.Buffer)
+	err := m.WriteText(buf)
+	if err != nil {
+		t.Errorf("WriteText unexpected error: %v", err)
+		return
+	}
+	text := buf.String()
+	t.Logf("%s", text)
+
+	lines := []string{
+		"# TYPE openw_transfers_total counter",
+		`openw_transfers_total{symbol="ETH",contract_address="",status="success"} 2`,
+		`openw_summary_swept_amount_total{symbol="ETH",contract_id="contract\"1"} 1.5`,
+		`openw_trust_server_connected{host_id="server1"} 1`,
+		`openw_api_request_duration_seconds_bucket{method="SubmitTrade",le="0.25"} 1`,
+		`openw_api_request_duration_seconds_bucket{method="SubmitTrade",le="5"} 2`,
+		`openw_api_request_duration_seconds_bucket{method="SubmitTrade",le="+Inf"} 2`,
+		`openw_api_request_duration_seconds_sum{method="SubmitTrade"} 3.2`,
+		`openw_api_request_duration_seconds_count{method="SubmitTrade"} 2`,
+		"openw_summary_cycles_total 0",
+	}
+	for _, line := range lines {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("metrics text should contain: %s", line)
+			return
+		}
+	}
+}
+
+func TestCLI_MetricsHooks(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	cli.callAPI("FindWalletByWalletID", func() error {
+		return nil
+	})
+	cli.callAPI("FindWalletByWalletID", func() error {
+		return fmt.Errorf("timeout")
+	})
+	//回调返回非成功状态也计入错误
+	cli.callAPI("FindWalletByWalletID", func() error {
+		return apiStatusError(404, "wallet not found")
+	})
+	if apiStatusError(owtp.StatusSuccess, "success") != nil {
+		t.Errorf("success status should not be an error")
+		return
+	}
+	if cli.Metrics().Value(MetricAPIRequestDuration, "FindWalletByWalletID") != 3 ||
+		cli.Metrics().Value(MetricAPIRequestErrors, "FindWalletByWalletID") != 2 {
+		t.Errorf("api request metrics are not match")
+		return
+	}
+
+	//新建的待审批转账计入pending，更新状态不重复计数
+	pending := &PendingTransfer{Type: PendingTypeTransfer, Symbol: "BTC", Amount: "10"}
+	cli.SavePendingTransfer(pending)
+	pending.Status = PendingStatusRejected
+	cli.SavePendingTransfer(pending)
+	if v := cli.Metrics().Value(MetricTransfers, "BTC", "", MetricStatusPending); v != 1 {
+		t.Errorf("pending transfer metric is not match: %v", v)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	cli.serveMetrics(w, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	if !strings.Contains(w.Body.String(), `openw_api_request_errors_total{method="FindWalletByWalletID"} 2`) {
+		t.Errorf("metrics response is not match: %s", w.Body.String())
+		return
+	}
+}
@@ -0,0 +1,246 @@
+package openwcli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/common/file"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/bndr/gotabulate"
+)
+
+// DBMigration 数据库结构迁移步骤，按版本号顺序执行，执行时数据库已打开
+type DBMigration struct {
+	Version int
+	Name    string
+	Migrate func(cli *CLI) error
+	//只能执行dbmigrate up手动迁移，dbautomigrate不会执行，用于需要先确认配置的迁移
+	Manual bool
+	//迁移前不备份数据库，迁移前的数据库含有明文敏感字段时，备份会一直保留明文
+	NoBackup bool
+}
+
+// DBMigrationStatus 数据库结构版本状态
+type DBMigrationStatus struct {
+	Current int
+	Latest  int
+	Pending []*DBMigration
+}
+
+// dbMigrations 所有迁移步骤，新增步骤只能追加到末尾，版本号递增
+var dbMigrations = []*DBMigration{
+	{
+		//没有版本号的旧数据库，记录为第一个版本
+		Version: 1,
+		Name:    "baseline",
+		Migrate: func(cli *CLI) error {
+			return nil
+		},
+		NoBackup: true,
+	},
+	{
+		//加密前需要确认dbkeyfile或dbpassphrase，加密不修改原值，密钥不匹配时不会修改任何记录
+		Version: 2,
+		Name:    "encrypt keychain private keys, summary addresses and trust addresses",
+		Migrate: func(cli *CLI) error {
+			_, err := cli.encryptDBRecords()
+			return err
+		},
+		Manual:   true,
+		NoBackup: true,
+	},
+}
+
+// checkSupported 检查数据库结构版本是否被当前程序支持，新版本程序写入的数据库不能降级使用
+func (status *DBMigrationStatus) checkSupported() error {
+	if status.Current > status.Latest {
+		return fmt.Errorf("database schema version: %d is newer than this program supported: %d, please upgrade openw-cli", status.Current, status.Latest)
+	}
+	return nil
+}
+
+// latestSchemaVersion 最新的数据库结构版本
+func latestSchemaVersion() int {
+	return dbMigrations[len(dbMigrations)-1].Version
+}
+
+// getSchemaVersion 读取数据库结构版本
+func getSchemaVersion(db *StormDB) int {
+	var version int
+	db.Get(CLIBucket, SchemaVersionKey, &version)
+	return version
+}
+
+// DBMigrationStatus 查询数据库结构版本和待执行的迁移，只读方式打开数据库，守护进程运行时也不需要等待文件锁
+func (cli *CLI) DBMigrationStatus() (*DBMigrationStatus, error) {
+
+	status := &DBMigrationStatus{
+		Latest: latestSchemaVersion(),
+	}
+
+	err := cli.viewDB(func(db *StormDB) error {
+		status.Current = getSchemaVersion(db)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range dbMigrations {
+		if m.Version > status.Current {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+
+	return status, nil
+}
+
+// MigrateDB 执行待执行的数据库迁移，迁移前备份数据库到datadir/backup，
+// 新建的数据库直接记录为最新版本
+func (cli *CLI) MigrateDB() (*DBMigrationStatus, error) {
+	return cli.migrateDB(false)
+}
+
+// autoMigrateDB 启动时自动执行数据库迁移，遇到需要手动执行的迁移时停止
+func (cli *CLI) autoMigrateDB() (*DBMigrationStatus, error) {
+	return cli.migrateDB(true)
+}
+
+// migrateDB 执行待执行的数据库迁移，auto为true时只执行到第一个需要手动执行的迁移之前
+func (cli *CLI) migrateDB(auto bool) (*DBMigrationStatus, error) {
+
+	if check := cli.checkConfig(); check != nil {
+		return nil, check
+	}
+
+	isNew := !file.Exists(cli.dbFile())
+
+	status, err := cli.DBMigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	err = status.checkSupported()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(status.Pending) == 0 {
+		return status, nil
+	}
+
+	//新建的数据库不需要迁移
+	if isNew {
+		_, err = cli.getDB()
+		if err != nil {
+			return nil, err
+		}
+		defer cli.closeDB()
+
+		err = cli.db.Set(CLIBucket, SchemaVersionKey, status.Latest)
+		if err != nil {
+			return nil, err
+		}
+		status.Current = status.Latest
+		status.Pending = nil
+		return status, nil
+	}
+
+	_, err = cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	backedUp := false
+	pending := status.Pending
+
+	for i, m := range pending {
+
+		if auto && m.Manual {
+			status.Pending = pending[i:]
+			log.Warningf("database migration: %d %s should be run manually, please check dbkeyfile or dbpassphrase, then run dbmigrate up", m.Version, m.Name)
+			return status, nil
+		}
+
+		//迁移前的数据库含有明文敏感字段时不备份，之后的迁移备份的是已加密的数据库
+		if !m.NoBackup && !backedUp {
+			backupFile, err := cli.backupDBBeforeMigrate(status.Current)
+			if err != nil {
+				return nil, fmt.Errorf("backup database before migrating failed: %v", err)
+			}
+			log.Infof("Database has been backed up to %s before migrating", backupFile)
+			backedUp = true
+		}
+
+		err = m.Migrate(cli)
+		if err != nil {
+			return nil, fmt.Errorf("database migration: %d %s failed: %v", m.Version, m.Name, err)
+		}
+
+		//每一步完成后记录版本，失败时从失败的步骤继续
+		err = cli.db.Set(CLIBucket, SchemaVersionKey, m.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		status.Current = m.Version
+
+		log.Infof("Database migration: %d %s done", m.Version, m.Name)
+	}
+
+	status.Pending = nil
+
+	return status, nil
+}
+
+// printDBMigrationStatus 打印数据库迁移状态
+func printDBMigrationStatus(status *DBMigrationStatus) {
+
+	fmt.Printf("Database schema version: %d, latest version: %d \n", status.Current, status.Latest)
+
+	tableInfo := make([][]interface{}, 0)
+
+	for _, m := range dbMigrations {
+		state := "applied"
+		if m.Version > status.Current {
+			state = "pending"
+			if m.Manual {
+				state = "pending (manual)"
+			}
+		}
+		tableInfo = append(tableInfo, []interface{}{
+			m.Version, m.Name, state,
+		})
+	}
+
+	t := gotabulate.Create(tableInfo)
+	// Set Headers
+	t.SetHeaders([]string{"Version", "Name", "Status"})
+
+	//打印信息
+	fmt.Println(t.Render("simple"))
+}
+
+// backupDBBeforeMigrate 迁移前导出数据库快照
+func (cli *CLI) backupDBBeforeMigrate(version int) (string, error) {
+
+	content, err := cli.snapshotDB()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(cli.config.datadir, backupDirName)
+	file.MkdirAll(dir)
+
+	backupFile := filepath.Join(dir, fmt.Sprintf("%s.db.v%d-%s", cli.config.appid, version, time.Now().Format("20060102150405")))
+
+	err = ioutil.WriteFile(backupFile, content, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	return backupFile, nil
+}
@@ -0,0 +1,93 @@
+package openwcli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCLI_MigrateDB(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	//没有版本号的旧数据库
+	keychain, _ := GenKeychain()
+	cli.getDB()
+	cli.db.Save(keychain)
+	cli.closeDB()
+
+	status, err := cli.DBMigrationStatus()
+	if err != nil || status.Current != 0 || len(status.Pending) != len(dbMigrations) {
+		t.Errorf("DBMigrationStatus is not match: %+v, %v", status, err)
+		return
+	}
+
+	//自动迁移不执行加密，不生成数据密钥
+	status, err = cli.autoMigrateDB()
+	if err != nil {
+		t.Errorf("autoMigrateDB unexpected error: %v", err)
+		return
+	}
+	if status.Current != 1 || len(status.Pending) != 1 || !status.Pending[0].Manual {
+		t.Errorf("autoMigrateDB status is not match: %+v", status)
+		return
+	}
+	if _, statErr := os.Stat(cli.dataKeyFile()); statErr == nil {
+		t.Errorf("data key file should not be generated by auto migration")
+		return
+	}
+
+	status, err = cli.MigrateDB()
+	if err != nil {
+		t.Errorf("MigrateDB unexpected error: %v", err)
+		return
+	}
+	if status.Current != latestSchemaVersion() || len(status.Pending) != 0 {
+		t.Errorf("MigrateDB status is not match: %+v", status)
+		return
+	}
+
+	//加密前的数据库含有明文私钥，不备份
+	backups, _ := filepath.Glob(filepath.Join(cli.config.datadir, backupDirName, "test.db.v*"))
+	if len(backups) != 0 {
+		t.Errorf("plaintext database should not be backed up before encrypting")
+		return
+	}
+
+	var stored Keychain
+	cli.getDB()
+	cli.db.One("NodeID", keychain.NodeID, &stored)
+	cli.closeDB()
+	if !isEncryptedSecret(stored.PrivateKey) {
+		t.Errorf("keychain private key is not encrypted by migration")
+		return
+	}
+
+	//新版本程序写入的数据库不能使用
+	cli.getDB()
+	cli.db.Set(CLIBucket, SchemaVersionKey, latestSchemaVersion()+1)
+	cli.closeDB()
+	_, err = cli.MigrateDB()
+	if err == nil {
+		t.Errorf("MigrateDB should failed with newer schema version")
+		return
+	}
+}
+
+func TestCLI_MigrateNewDB(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	status, err := cli.MigrateDB()
+	if err != nil || status.Current != latestSchemaVersion() {
+		t.Errorf("MigrateDB new database failed: %+v, %v", status, err)
+		return
+	}
+
+	if _, statErr := os.Stat(filepath.Join(cli.config.datadir, backupDirName)); statErr == nil {
+		t.Errorf("new database should not be backed up")
+		return
+	}
+}
@@ -5,17 +5,94 @@ import (
 )
 
 const (
-	CLIBucket          = "CLIBucket"
-	CurrentKeychainKey = "current_keychain"
-	EnableTrustAddress = "enable_trust_address"
-	InitTrustAddress   = "init_trust_address"
+	CLIBucket           = "CLIBucket"
+	CurrentKeychainKey  = "current_keychain"
+	PreviousKeychainKey = "previous_keychain"
+	EnableTrustAddress  = "enable_trust_address"
+	InitTrustAddress    = "init_trust_address"
+	DataKeyCheckKey     = "data_key_check"
+	DataKeySaltKey      = "data_key_salt"
+	SchemaVersionKey    = "schema_version"
 )
 
+const (
+	PendingTypeTransfer        = "transfer"
+	PendingTypeSignTransaction = "signTransaction"
+	PendingTypeTriggerABI      = "triggerABI"
+	PendingTypeSignHash        = "signHash"
+
+	PendingStatusPending   = "pending"
+	PendingStatusApproving = "approving" //已审批通过，正在执行
+	PendingStatusApproved  = "approved"
+	PendingStatusRejected  = "rejected"
+	PendingStatusFailed    = "failed"
+)
+
+const (
+	NotifyStatusPending = "pending"
+	NotifyStatusFailed  = "failed"
+)
+
+//待审批的远程转账请求
+type PendingTransfer struct {
+	ID              string `json:"id" storm:"id"`
+	Type            string `json:"type"`
+	PeerID          string `json:"peerID"`
+	Status          string `json:"status" storm:"index"`
+	Sid             string `json:"sid"`
+	WalletID        string `json:"walletID"`
+	AccountID       string `json:"accountID"`
+	Symbol          string `json:"symbol"`
+	ContractAddress string `json:"contractAddress"`
+	Address         string `json:"address"`
+	Amount          string `json:"amount"`
+	FeeRate         string `json:"feeRate"`
+	Memo            string `json:"memo"`
+	ExtParam        string `json:"extParam"`
+	RawTx           string `json:"rawTx"`
+	Params          string `json:"params"`
+	Result          string `json:"result"`
+	Reason          string `json:"reason"`
+	Notified        bool   `json:"notified" storm:"index"`
+	CreateTime      int64  `json:"createTime" storm:"index"`
+	UpdateTime      int64  `json:"updateTime"`
+}
+
+// NotifyMessage 事件通知的发件箱，每个通知目标一条，发送成功后删除，失败后按间隔重试
+type NotifyMessage struct {
+	ID         string `json:"id" storm:"id"`
+	EventID    string `json:"eventID"`
+	EventType  string `json:"eventType"`
+	Target     string `json:"target"`
+	Payload    string `json:"payload"`
+	Status     string `json:"status" storm:"index"`
+	Attempts   int    `json:"attempts"`
+	NextTime   int64  `json:"nextTime"`
+	LastError  string `json:"lastError"`
+	CreateTime int64  `json:"createTime" storm:"index"`
+}
+
+// WatchOnlyWallet 观察钱包，本地不保存种子，只能查询不能签名
+type WatchOnlyWallet struct {
+	WalletID   string `json:"walletID" storm:"id"`
+	Alias      string `json:"alias"`
+	CreateTime int64  `json:"createTime"`
+}
+
+// WatchOnlyAccount 观察钱包的资产账户，固定账户公钥
+type WatchOnlyAccount struct {
+	AccountID string `json:"accountID" storm:"id"`
+	WalletID  string `json:"walletID" storm:"index"`
+	Symbol    string `json:"symbol"`
+	PublicKey string `json:"publicKey"`
+}
+
 //密钥对
 type Keychain struct {
 	NodeID     string `json:"nodeID" storm:"id"`
 	PrivateKey string `json:"privateKey"`
 	PublicKey  string `json:"publicKey"`
+	CreateTime int64  `json:"createTime"`
 
 	privateKeyBytes []byte
 	publicKeyBytes  []byte
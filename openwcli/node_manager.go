@@ -49,13 +49,15 @@ func (cli *CLI) SaveCurrentKeychain(keychain *Keychain) error {
 	}
 	defer cli.closeDB()
 
-	//保存到数据库
-	err = cli.db.Save(keychain)
+	//保存到数据库，私钥加密保存
+	err = cli.saveKeychain(keychain)
 	if err != nil {
 		return fmt.Errorf("save new keychain failed. unexpected error: %v", err)
 	}
 
-	err = cli.db.Set(CLIBucket, CurrentKeychainKey, keychain.NodeID)
+	//旧的keychain保留用于回滚
+	current, _ := cli.getKeychainIDs()
+	err = cli.switchKeychain(keychain.NodeID, current)
 	if err != nil {
 		return fmt.Errorf("update current keychain failed. unexpected error: %v", err)
 	}
@@ -78,18 +80,17 @@ func (cli *CLI) GetKeychain() (*Keychain, error) {
 		return nil, fmt.Errorf("The keychain not exist, please register node first. ")
 	}
 
-	var keychain Keychain
-	err = cli.db.One("NodeID", current, &keychain)
+	keychain, err := cli.loadKeychain(current)
 	if err != nil {
-		return nil, fmt.Errorf("The keychain not exist, please register node first. ")
+		return nil, err
 	}
 
-	return &keychain, nil
+	return keychain, nil
 }
 
 //RegisterOnServer 注册节点到openw-server
 func (cli *CLI) RegisterOnServer() error {
 
 	//登记节点到openw-server
-	return cli.api.BindAppDevice()
+	return cli.callAPI("BindAppDevice", cli.api.BindAppDevice)
 }
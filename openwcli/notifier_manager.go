@@ -0,0 +1,397 @@
+package openwcli
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/google/uuid"
+)
+
+// 通知的事件类型
+const (
+	NotifyEventTransferSent          = "transfer.sent"
+	NotifyEventTransferFailed        = "transfer.failed"
+	NotifyEventSummaryCompleted      = "summary.completed"
+	NotifyEventFeesSupportLowBalance = "feessupport.lowbalance"
+	NotifyEventTrustServerDisconnect = "trustserver.disconnected"
+	NotifyEventTrustListChanged      = "trustlist.changed"
+	NotifyEventTrustListRejected     = "trustlist.rejected"
+	NotifyEventTest                  = "test"
+)
+
+const (
+	notifyCommandTarget      = "command"
+	notifySignatureHeader    = "X-Openw-Signature"
+	notifyEventHeader        = "X-Openw-Event"
+	notifyJobInterval        = 10 * time.Second
+	notifyMaxRetryInterval   = time.Hour
+	defaultNotifyMaxAttempts = 10
+	defaultNotifyTimeout     = 10 * time.Second
+	//相同的余额报警在间隔内只通知一次
+	notifyLowBalanceInterval = time.Hour
+)
+
+// NotifyEvent 发送给通知目标的内容
+type NotifyEvent struct {
+	ID   string                 `json:"id"`
+	Type string                 `json:"type"`
+	Node string                 `json:"node"`
+	Time int64                  `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// notifyTargets 配置的通知目标，webhook地址和本地命令
+func (cli *CLI) notifyTargets() []string {
+	targets := make([]string, 0)
+	for _, url := range strings.Split(cli.config.notifywebhooks, ",") {
+		url = strings.TrimSpace(url)
+		if len(url) > 0 {
+			targets = append(targets, url)
+		}
+	}
+	if len(strings.TrimSpace(cli.config.notifycommand)) > 0 {
+		targets = append(targets, notifyCommandTarget)
+	}
+	return targets
+}
+
+// isNotifyEnabled 是否配置了通知目标
+func (cli *CLI) isNotifyEnabled() bool {
+	return len(cli.notifyTargets()) > 0
+}
+
+// isNotifyEvent 事件是否需要通知，notifyevents为空时通知所有事件
+func (cli *CLI) isNotifyEvent(eventType string) bool {
+	if len(strings.TrimSpace(cli.config.notifyevents)) == 0 || eventType == NotifyEventTest {
+		return true
+	}
+	for _, e := range strings.Split(cli.config.notifyevents, ",") {
+		if strings.TrimSpace(e) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify 发送事件通知，先保存到发件箱，发送失败的通知由后台任务重试
+func (cli *CLI) Notify(eventType string, data map[string]interface{}) {
+
+	targets := cli.notifyTargets()
+	if len(targets) == 0 || !cli.isNotifyEvent(eventType) {
+		return
+	}
+
+	event := &NotifyEvent{
+		ID:   uuid.New().String(),
+		Type: eventType,
+		Node: cli.config.localname,
+		Time: time.Now().Unix(),
+		Data: data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("notify event: %s encode failed, unexpected error: %v", eventType, err)
+		return
+	}
+
+	messages := make([]*NotifyMessage, 0, len(targets))
+	for _, target := range targets {
+		messages = append(messages, &NotifyMessage{
+			ID:         uuid.New().String(),
+			EventID:    event.ID,
+			EventType:  eventType,
+			Target:     target,
+			Payload:    string(payload),
+			Status:     NotifyStatusPending,
+			NextTime:   event.Time,
+			CreateTime: event.Time,
+		})
+	}
+
+	err = cli.saveNotifyMessages(messages)
+	if err != nil {
+		log.Errorf("notify event: %s save failed, unexpected error: %v", eventType, err)
+		return
+	}
+
+	if cli.keepOpen {
+		go cli.DeliverNotifyMessages()
+	} else if !cli.dbInUse() {
+		//单次执行的命令马上发送，失败的通知等待下次重试。调用方还在使用数据库时不发送，调用方应在关闭数据库后通知
+		cli.DeliverNotifyMessages()
+	}
+}
+
+// notifyLimited 相同key的通知在间隔内只发送一次
+func (cli *CLI) notifyLimited(key string, interval time.Duration, eventType string, data map[string]interface{}) {
+
+	cli.notifyMu.Lock()
+	if cli.notifyLastTime == nil {
+		cli.notifyLastTime = make(map[string]time.Time)
+	}
+	last, exist := cli.notifyLastTime[key]
+	if exist && time.Since(last) < interval {
+		cli.notifyMu.Unlock()
+		return
+	}
+	cli.notifyLastTime[key] = time.Now()
+	cli.notifyMu.Unlock()
+
+	cli.Notify(eventType, data)
+}
+
+// saveNotifyMessages 保存通知到发件箱
+func (cli *CLI) saveNotifyMessages(messages []*NotifyMessage) error {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return err
+	}
+	defer cli.closeDB()
+
+	tx, err := cli.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, msg := range messages {
+		err = tx.Save(msg)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListNotifyMessages 发件箱的通知，status为空时返回所有
+func (cli *CLI) ListNotifyMessages(status string) ([]*NotifyMessage, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	var list []*NotifyMessage
+	if len(status) > 0 {
+		err = cli.db.Find("Status", status, &list)
+	} else {
+		err = cli.db.All(&list)
+	}
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+// dueNotifyMessages 到达重试时间的通知
+func (cli *CLI) dueNotifyMessages(now time.Time) ([]*NotifyMessage, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	var list []*NotifyMessage
+	err = cli.db.Select(
+		q.Eq("Status", NotifyStatusPending),
+		q.Lte("NextTime", now.Unix()),
+	).OrderBy("CreateTime").Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+// DeliverNotifyMessages 发送发件箱中到达重试时间的通知，同一时间只有一个发送过程
+func (cli *CLI) DeliverNotifyMessages() {
+
+	if !atomic.CompareAndSwapInt32(&cli.notifyRunning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&cli.notifyRunning, 0)
+
+	messages, err := cli.dueNotifyMessages(time.Now())
+	if err != nil {
+		log.Errorf("load notify messages failed, unexpected error: %v", err)
+		return
+	}
+
+	targets := make(map[string]bool)
+	for _, target := range cli.notifyTargets() {
+		targets[target] = true
+	}
+
+	for _, msg := range messages {
+
+		//通知目标已从配置中删除
+		if !targets[msg.Target] {
+			log.Warningf("notify event: %s target is not configured, drop it", msg.EventType)
+			cli.finishNotifyMessage(msg, nil)
+			continue
+		}
+
+		err = cli.sendNotifyMessage(msg)
+		if err != nil {
+			log.Warningf("notify event: %s send failed, attempts: %d, unexpected error: %v", msg.EventType, msg.Attempts+1, err)
+		}
+		cli.finishNotifyMessage(msg, err)
+	}
+}
+
+// finishNotifyMessage 发送成功删除通知，失败时记录错误并计算下次重试时间，超过最大次数标记为失败
+func (cli *CLI) finishNotifyMessage(msg *NotifyMessage, sendErr error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		log.Errorf("update notify message failed, unexpected error: %v", err)
+		return
+	}
+	defer cli.closeDB()
+
+	if sendErr == nil {
+		err = cli.db.DeleteStruct(msg)
+		if err != nil && err != storm.ErrNotFound {
+			log.Errorf("delete notify message failed, unexpected error: %v", err)
+		}
+		return
+	}
+
+	maxAttempts := cli.config.notifymaxattempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultNotifyMaxAttempts
+	}
+
+	msg.Attempts++
+	msg.LastError = sendErr.Error()
+	msg.NextTime = time.Now().Add(notifyRetryInterval(msg.Attempts)).Unix()
+	if msg.Attempts >= maxAttempts {
+		msg.Status = NotifyStatusFailed
+		log.Errorf("notify event: %s failed after %d attempts", msg.EventType, msg.Attempts)
+	}
+
+	err = cli.db.Save(msg)
+	if err != nil {
+		log.Errorf("update notify message failed, unexpected error: %v", err)
+	}
+}
+
+// notifyRetryInterval 重试间隔，从10秒开始每次翻倍，最长1小时
+func notifyRetryInterval(attempts int) time.Duration {
+	interval := notifyJobInterval
+	for i := 1; i < attempts && interval < notifyMaxRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > notifyMaxRetryInterval {
+		interval = notifyMaxRetryInterval
+	}
+	return interval
+}
+
+// notifyTimeout 发送通知的超时时间
+func (cli *CLI) notifyTimeout() time.Duration {
+	if cli.config.requesttimeout > 0 {
+		return time.Duration(cli.config.requesttimeout) * time.Second
+	}
+	return defaultNotifyTimeout
+}
+
+// sendNotifyMessage 发送通知到webhook或执行本地命令
+func (cli *CLI) sendNotifyMessage(msg *NotifyMessage) error {
+	if msg.Target == notifyCommandTarget {
+		return cli.runNotifyCommand(msg)
+	}
+	return cli.postNotifyWebhook(msg)
+}
+
+// postNotifyWebhook POST通知内容到webhook，配置notifysecret时附带HMAC-SHA256签名，返回2xx为成功
+func (cli *CLI) postNotifyWebhook(msg *NotifyMessage) error {
+
+	req, err := http.NewRequest(http.MethodPost, msg.Target, strings.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(notifyEventHeader, msg.EventType)
+	if len(cli.config.notifysecret) > 0 {
+		req.Header.Set(notifySignatureHeader, "sha256="+notifySignature(cli.config.notifysecret, msg.Payload))
+	}
+
+	client := &http.Client{Timeout: cli.notifyTimeout()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook response status: %s", resp.Status)
+	}
+	return nil
+}
+
+// runNotifyCommand 执行本地命令，通知内容从标准输入传入，事件类型通过环境变量OPENW_EVENT传入，退出码为0为成功
+func (cli *CLI) runNotifyCommand(msg *NotifyMessage) error {
+
+	args := strings.Fields(cli.config.notifycommand)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cli.notifyTimeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(msg.Payload)
+	cmd.Env = append(os.Environ(), "OPENW_EVENT="+msg.EventType)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// notifySignature 通知内容的HMAC-SHA256签名
+func notifySignature(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// startNotifyJob 启动后台任务定时重试发送失败的通知
+func (cli *CLI) startNotifyJob() {
+	if !cli.isNotifyEnabled() {
+		return
+	}
+	cli.startDaemonJob("notify", notifyJobInterval, cli.DeliverNotifyMessages)
+}
+
+// checkTrustAddress 检查目标地址是否在信任地址名单，不在名单时发送通知
+func (cli *CLI) checkTrustAddress(address, symbol string) bool {
+	if cli.IsTrustAddress(address, symbol) {
+		return true
+	}
+	cli.Notify(NotifyEventTrustListRejected, map[string]interface{}{
+		"address": address,
+		"symbol":  symbol,
+	})
+	return false
+}
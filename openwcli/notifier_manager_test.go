@@ -0,0 +1,166 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCLI_NotifyWebhook(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	var (
+		mu       sync.Mutex
+		received []*NotifyEvent
+		fail     = true
+	)
+
+	//本地模拟的webhook，第一次返回错误
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(notifySignatureHeader) != "sha256="+notifySignature("secret", string(body)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event NotifyEvent
+		json.Unmarshal(body, &event)
+		received = append(received, &event)
+	}))
+	defer server.Close()
+
+	cli.config.localname = "node1"
+	cli.config.notifywebhooks = server.URL
+	cli.config.notifysecret = "secret"
+	cli.config.notifyevents = NotifyEventTransferSent + "," + NotifyEventTrustListChanged
+
+	//没有订阅的事件不通知
+	cli.Notify(NotifyEventSummaryCompleted, map[string]interface{}{"accountID": "A1"})
+
+	cli.Notify(NotifyEventTransferSent, map[string]interface{}{"txid": "tx1"})
+
+	list, _ := cli.ListNotifyMessages(NotifyStatusPending)
+	if len(list) != 1 || list[0].Attempts != 1 || len(list[0].LastError) == 0 {
+		t.Errorf("failed notification should be kept in outbox: %+v", list)
+		return
+	}
+	if list[0].NextTime <= time.Now().Unix() {
+		t.Errorf("failed notification should wait for retry")
+		return
+	}
+
+	//未到重试时间不发送
+	cli.DeliverNotifyMessages()
+	if len(received) != 0 {
+		t.Errorf("notification should not be retried before next time")
+		return
+	}
+
+	//模拟重启后到达重试时间
+	list[0].NextTime = time.Now().Unix()
+	cli.getDB()
+	cli.db.Save(list[0])
+	cli.closeDB()
+
+	cli.DeliverNotifyMessages()
+	if len(received) != 1 || received[0].Type != NotifyEventTransferSent ||
+		received[0].Node != "node1" || received[0].Data["txid"] != "tx1" {
+		t.Errorf("received notification is not match: %+v", received)
+		return
+	}
+
+	list, _ = cli.ListNotifyMessages("")
+	if len(list) != 0 {
+		t.Errorf("sent notification should be deleted: %+v", list)
+		return
+	}
+}
+
+func TestCLI_NotifyCommand(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	out := filepath.Join(cli.config.datadir, "event.json")
+
+	cli.config.notifycommand = "tee " + out
+	cli.config.notifymaxattempts = 1
+
+	cli.Notify(NotifyEventTrustListRejected, map[string]interface{}{"address": "addr1", "symbol": "BTC"})
+
+	var event NotifyEvent
+	content, _ := ioutil.ReadFile(out)
+	json.Unmarshal(content, &event)
+	if event.Type != NotifyEventTrustListRejected || event.Data["address"] != "addr1" {
+		t.Errorf("command received notification is not match: %s", content)
+		return
+	}
+
+	//命令执行失败，达到最大次数后不再重试
+	cli.config.notifycommand = "false"
+	cli.Notify(NotifyEventTrustListRejected, map[string]interface{}{"address": "addr2", "symbol": "BTC"})
+
+	list, _ := cli.ListNotifyMessages(NotifyStatusFailed)
+	if len(list) != 1 || list[0].Attempts != 1 {
+		t.Errorf("notification should be failed after max attempts: %+v", list)
+		return
+	}
+}
+
+func TestCLI_NotifyTrustListChanged(t *testing.T) {
+
+	cli, cleanup := getTestLocalCLI(t)
+	defer cleanup()
+
+	out := filepath.Join(cli.config.datadir, "event.json")
+
+	cli.config.notifycommand = "tee " + out
+	cli.config.notifyevents = NotifyEventTrustListChanged
+
+	//单次执行的命令关闭数据库后马上发送
+	err := cli.DisableTrustAddress()
+	if err != nil {
+		t.Errorf("DisableTrustAddress unexpected error: %v", err)
+		return
+	}
+
+	var event NotifyEvent
+	content, _ := ioutil.ReadFile(out)
+	json.Unmarshal(content, &event)
+	if event.Type != NotifyEventTrustListChanged || event.Data["action"] != "disable" {
+		t.Errorf("trust list changed notification is not delivered: %s", content)
+		return
+	}
+
+	//调用方还在使用数据库时留在发件箱
+	cli.getDB()
+	cli.Notify(NotifyEventTrustListChanged, map[string]interface{}{"action": "enable"})
+	cli.closeDB()
+
+	list, _ := cli.ListNotifyMessages(NotifyStatusPending)
+	if len(list) != 1 {
+		t.Errorf("notification should be kept in outbox while database is in use: %+v", list)
+		return
+	}
+}
+
+func TestNotifyRetryInterval(t *testing.T) {
+	if notifyRetryInterval(1) != 10*time.Second || notifyRetryInterval(3) != 40*time.Second ||
+		notifyRetryInterval(100) != time.Hour {
+		t.Errorf("notify retry interval is not match")
+	}
+}
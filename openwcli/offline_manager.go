@@ -0,0 +1,404 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/common"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/owtp"
+	"github.com/google/uuid"
+)
+
+const (
+	//离线交易文件格式版本
+	offlineTxVersion = 1
+
+	//离线交易类型
+	OfflineTxTypeTransfer   = "transfer"
+	OfflineTxTypeSummary    = "summary"
+	OfflineTxTypeTriggerABI = "triggerABI"
+
+	//离线交易状态
+	OfflineTxStatusUnsigned = "unsigned"
+	OfflineTxStatusSigned   = "signed"
+)
+
+// OfflineTxFile 离线签名交易文件，在线主机导出未签名交易单，离线主机签名，在线主机广播
+type OfflineTxFile struct {
+	Version    int    `json:"version"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	AppID      string `json:"appID"`
+	WalletID   string `json:"walletID"`
+	AccountID  string `json:"accountID"`
+	CreateTime int64  `json:"createTime"`
+	SignTime   int64  `json:"signTime"`
+	//可读的交易摘要，用于离线主机核对
+	Summary             []string                                `json:"summary"`
+	RawTxs              []*openwsdk.RawTransaction              `json:"rawTxs,omitempty"`
+	SmartContractRawTxs []*openwsdk.SmartContractRawTransaction `json:"smartContractRawTxs,omitempty"`
+	//合约交易转入合约的数量，联合签名审批使用
+	Amount string `json:"amount,omitempty"`
+}
+
+// signatures 所有交易单的待签名列表
+func (f *OfflineTxFile) signatures() []map[string][]*openwsdk.KeySignature {
+	list := make([]map[string][]*openwsdk.KeySignature, 0)
+	for _, rawTx := range f.RawTxs {
+		list = append(list, rawTx.Signatures)
+	}
+	for _, rawTx := range f.SmartContractRawTxs {
+		list = append(list, rawTx.Signatures)
+	}
+	return list
+}
+
+// isSigned 所有交易单是否已完成签名
+func (f *OfflineTxFile) isSigned() bool {
+	for _, signatures := range f.signatures() {
+		for _, keySignatures := range signatures {
+			for _, ks := range keySignatures {
+				if len(ks.Signature) == 0 {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Details 根据交易单生成明细，离线主机不只依赖导出时写入的摘要
+func (f *OfflineTxFile) Details() []string {
+
+	details := make([]string, 0)
+	details = append(details, fmt.Sprintf("Type: %s, Status: %s, WalletID: %s, AccountID: %s", f.Type, f.Status, f.WalletID, f.AccountID))
+	details = append(details, fmt.Sprintf("Create Time: %s", common.TimeFormat("2006-01-02 15:04:05", time.Unix(f.CreateTime, 0))))
+
+	for i, rawTx := range f.RawTxs {
+		details = append(details, fmt.Sprintf("#%d SID: %s, Symbol: %s, Contract: %s, Fees: %s, FeeRate: %s",
+			i, rawTx.Sid, rawTx.Coin.Symbol, rawTx.Coin.ContractID, rawTx.Fees, rawTx.FeeRate))
+		addresses := make([]string, 0, len(rawTx.To))
+		for address := range rawTx.To {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
+		for _, address := range addresses {
+			details = append(details, fmt.Sprintf("#%d   To: %s, Amount: %s", i, address, rawTx.To[address]))
+		}
+	}
+
+	for i, rawTx := range f.SmartContractRawTxs {
+		details = append(details, fmt.Sprintf("#%d SID: %s, Symbol: %s, Contract: %s, Fees: %s",
+			i, rawTx.Sid, rawTx.Coin.Symbol, rawTx.Coin.ContractAddress, rawTx.Fees))
+	}
+
+	return details
+}
+
+// ExportTransferTx 创建未签名的转账交易单
+func (cli *CLI) ExportTransferTx(account *openwsdk.Account, symbol, contractAddress, to, amount, feeRate, memo string) (*OfflineTxFile, error) {
+
+	//:检查目标地址是否信任名单
+	if !cli.checkTrustAddress(to, symbol) {
+		return nil, fmt.Errorf("%s is not in trust address list", to)
+	}
+
+	sid := uuid.New().String()
+	rawTx, tokenSymbol, createErr := cli.createTransferRawTx(account, symbol, contractAddress, to, amount, sid, feeRate, memo, "")
+	if createErr != nil {
+		return nil, createErr
+	}
+
+	txFile := cli.newOfflineTxFile(OfflineTxTypeTransfer, account)
+	txFile.RawTxs = []*openwsdk.RawTransaction{rawTx}
+	txFile.Summary = []string{
+		fmt.Sprintf("[%s %s Transfer]", symbol, tokenSymbol),
+		fmt.Sprintf("From Account: %s", account.AccountID),
+		fmt.Sprintf("To Address: %s", to),
+		fmt.Sprintf("Send Amount: %s", amount),
+		fmt.Sprintf("Fees: %v", rawTx.Fees),
+		fmt.Sprintf("Memo: %s", memo),
+	}
+
+	return txFile, nil
+}
+
+// ExportSummaryTx 按账户的汇总设置创建未签名的汇总交易单
+func (cli *CLI) ExportSummaryTx(account *openwsdk.Account, feeRate, memo string) (*OfflineTxFile, error) {
+
+	const (
+		defaultLimit = 200
+	)
+
+	sumSets, err := cli.getSummarySettingByAccount(account.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("account: %s has not setup summary info", account.AccountID)
+	}
+
+	addressLimit := int(sumSets.AddressLimit)
+	if addressLimit == 0 {
+		addressLimit = defaultLimit
+	}
+
+	coin := openwsdk.Coin{
+		Symbol: account.Symbol,
+	}
+
+	rawTxs := make([]*openwsdk.RawTransaction, 0)
+	for i := 0; i < int(account.AddressIndex)+1; i = i + addressLimit {
+		var createErr error
+		sid := uuid.New().String()
+		err = cli.callAPI("CreateSummaryTx", func() error {
+			var statusErr error
+			err := cli.api.CreateSummaryTx(account.AccountID, sumSets.SumAddress, coin,
+				feeRate, sumSets.MinTransfer, sumSets.RetainedBalance,
+				i, addressLimit, sumSets.Confirms, sid, "", memo, true,
+				func(status uint64, msg string, txs []*openwsdk.RawTransaction) {
+					statusErr = apiStatusError(status, msg)
+					if status != owtp.StatusSuccess {
+						createErr = fmt.Errorf(msg)
+						return
+					}
+					for _, rawTx := range txs {
+						if rawTx.ErrorMsg != nil && rawTx.ErrorMsg.Code != "" {
+							log.Warning(rawTx.ErrorMsg.Err)
+							continue
+						}
+						rawTxs = append(rawTxs, rawTx)
+					}
+				})
+			if err != nil {
+				return err
+			}
+			return statusErr
+		})
+		if err != nil {
+			return nil, err
+		}
+		if createErr != nil {
+			return nil, createErr
+		}
+	}
+
+	if len(rawTxs) == 0 {
+		return nil, fmt.Errorf("account: %s has no balance to summary", account.AccountID)
+	}
+
+	txFile := cli.newOfflineTxFile(OfflineTxTypeSummary, account)
+	txFile.RawTxs = rawTxs
+	txFile.Summary = []string{
+		fmt.Sprintf("[%s Summary]", account.Symbol),
+		fmt.Sprintf("From Account: %s", account.AccountID),
+		fmt.Sprintf("Summary Address: %s", sumSets.SumAddress),
+		fmt.Sprintf("Transactions: %d", len(rawTxs)),
+	}
+
+	return txFile, nil
+}
+
+// ExportTriggerABITx 创建未签名的智能合约交易单
+func (cli *CLI) ExportTriggerABITx(account *openwsdk.Account, contractAddress, contractABI, amount, feeRate string, abiParam []string) (*OfflineTxFile, error) {
+
+	sid := uuid.New().String()
+	rawTx, tokenSymbol, createErr := cli.createSmartContractRawTx(account, account.Symbol, contractAddress, contractABI, amount, sid, feeRate, abiParam, "", 0)
+	if createErr != nil {
+		return nil, createErr
+	}
+
+	txFile := cli.newOfflineTxFile(OfflineTxTypeTriggerABI, account)
+	txFile.SmartContractRawTxs = []*openwsdk.SmartContractRawTransaction{rawTx}
+	txFile.Amount = amount
+	txFile.Summary = []string{
+		fmt.Sprintf("[%s %s TriggerABI]", account.Symbol, tokenSymbol),
+		fmt.Sprintf("From Account: %s", account.AccountID),
+		fmt.Sprintf("Contract Address: %s", contractAddress),
+		fmt.Sprintf("ABI Param: %s", strings.Join(abiParam, ",")),
+		fmt.Sprintf("Amount: %s", amount),
+		fmt.Sprintf("Fees: %v", rawTx.Fees),
+	}
+
+	return txFile, nil
+}
+
+// SignOfflineTx 离线签名交易文件，不需要连接openw-server
+func (cli *CLI) SignOfflineTx(txFile *OfflineTxFile, password string) error {
+
+	if txFile.Status == OfflineTxStatusSigned {
+		return fmt.Errorf("transactions have been signed")
+	}
+
+	//其它应用导出的交易文件不能用本应用的钱包签名
+	if txFile.AppID != cli.config.appid {
+		return fmt.Errorf("transactions file appID: %s is not match with config appid: %s", txFile.AppID, cli.config.appid)
+	}
+
+	wallet, err := cli.GetWalletByWalletIDOnLocal(txFile.WalletID)
+	if err != nil {
+		return err
+	}
+
+	key, err := cli.getSignerKey(wallet, password)
+	if err != nil {
+		return err
+	}
+
+	//开启联合签名时，离线主机同样需要取得联合签名节点的审批
+	for _, rawTx := range txFile.RawTxs {
+		signatures, sigErr := cli.signRawTransaction(rawTx, key)
+		if sigErr != nil {
+			return sigErr
+		}
+		rawTx.Signatures = signatures
+	}
+
+	for _, rawTx := range txFile.SmartContractRawTxs {
+		signatures, sigErr := cli.signSmartContractRawTransaction(rawTx, txFile.AccountID, rawTx.Coin.Symbol, rawTx.Coin.ContractAddress, txFile.Amount, key)
+		if sigErr != nil {
+			return sigErr
+		}
+		rawTx.Signatures = signatures
+	}
+
+	txFile.Status = OfflineTxStatusSigned
+	txFile.SignTime = time.Now().Unix()
+
+	return nil
+}
+
+// SubmitOfflineTx 广播已签名的交易文件
+func (cli *CLI) SubmitOfflineTx(txFile *OfflineTxFile) error {
+
+	var (
+		createErr *openwallet.Error
+		failed    []string
+	)
+
+	if txFile.Status != OfflineTxStatusSigned || !txFile.isSigned() {
+		return fmt.Errorf("transactions have not been signed")
+	}
+
+	if len(txFile.RawTxs) > 0 {
+		err := cli.callAPI("SubmitTrade", func() error {
+			var statusErr error
+			err := cli.api.SubmitTrade(txFile.RawTxs, true,
+				func(status uint64, msg string, successTx []*openwsdk.Transaction, failedRawTxs []*openwsdk.FailedRawTransaction) {
+					statusErr = apiStatusError(status, msg)
+					if status != owtp.StatusSuccess {
+						createErr = openwallet.Errorf(status, msg)
+						return
+					}
+					for _, tx := range successTx {
+						log.Infof("send transaction successfully, %s", LogFields("txid", tx.TxID))
+					}
+					for _, tx := range failedRawTxs {
+						log.Warningf("[Failed] reason: %s", tx.Reason)
+						sid := ""
+						if tx.RawTx != nil {
+							sid = tx.RawTx.Sid
+						}
+						failed = append(failed, fmt.Sprintf("%s: %s", sid, tx.Reason))
+					}
+				})
+			if err != nil {
+				return err
+			}
+			return statusErr
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(txFile.SmartContractRawTxs) > 0 {
+		err := cli.callAPI("SubmitSmartContractTrade", func() error {
+			var statusErr error
+			err := cli.api.SubmitSmartContractTrade(txFile.SmartContractRawTxs, true,
+				func(status uint64, msg string, successTx []*openwsdk.SmartContractReceipt, failedRawTxs []*openwsdk.FailureSmartContractLog) {
+					statusErr = apiStatusError(status, msg)
+					if status != owtp.StatusSuccess {
+						createErr = openwallet.Errorf(status, msg)
+						return
+					}
+					for _, tx := range successTx {
+						log.Infof("send transaction successfully, %s", LogFields("txid", tx.TxID))
+					}
+					for _, tx := range failedRawTxs {
+						log.Warningf("[Failed] reason: %s", tx.Reason)
+						sid := ""
+						if tx.RawTx != nil {
+							sid = tx.RawTx.Sid
+						}
+						failed = append(failed, fmt.Sprintf("%s: %s", sid, tx.Reason))
+					}
+				})
+			if err != nil {
+				return err
+			}
+			return statusErr
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if createErr != nil {
+		return createErr
+	}
+
+	//部分交易广播失败时返回失败的sid和原因
+	if len(failed) > 0 {
+		return openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "%d transactions submit failed: %s", len(failed), strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// newOfflineTxFile 创建离线交易文件
+func (cli *CLI) newOfflineTxFile(txType string, account *openwsdk.Account) *OfflineTxFile {
+	return &OfflineTxFile{
+		Version:    offlineTxVersion,
+		Type:       txType,
+		Status:     OfflineTxStatusUnsigned,
+		AppID:      cli.config.appid,
+		WalletID:   account.WalletID,
+		AccountID:  account.AccountID,
+		CreateTime: time.Now().Unix(),
+	}
+}
+
+// SaveOfflineTxFile 保存离线交易文件
+func SaveOfflineTxFile(path string, txFile *OfflineTxFile) error {
+	content, err := json.MarshalIndent(txFile, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0600)
+}
+
+// LoadOfflineTxFile 读取离线交易文件
+func LoadOfflineTxFile(path string) (*OfflineTxFile, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var txFile OfflineTxFile
+	err = json.Unmarshal(content, &txFile)
+	if err != nil {
+		return nil, fmt.Errorf("offline transaction file is invalid: %v", err)
+	}
+
+	if txFile.Version > offlineTxVersion {
+		return nil, fmt.Errorf("offline transaction file version: %d is not supported", txFile.Version)
+	}
+
+	return &txFile, nil
+}
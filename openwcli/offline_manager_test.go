@@ -0,0 +1,125 @@
+package openwcli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+)
+
+func TestOfflineTxFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "offlinetx")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	txFile := &OfflineTxFile{
+		Version:   offlineTxVersion,
+		Type:      OfflineTxTypeTransfer,
+		Status:    OfflineTxStatusUnsigned,
+		WalletID:  "W1",
+		AccountID: "A1",
+		Summary:   []string{"[BTC Transfer]"},
+		RawTxs: []*openwsdk.RawTransaction{
+			{
+				Sid: "sid",
+				To:  map[string]string{"addr": "0.1"},
+				Signatures: map[string][]*openwsdk.KeySignature{
+					"A1": {
+						{Message: "hash1"},
+						{Message: "hash2"},
+					},
+				},
+			},
+		},
+	}
+
+	if txFile.isSigned() {
+		t.Errorf("unsigned transaction file should not be signed")
+		return
+	}
+
+	path := filepath.Join(dir, "tx.json")
+	err = SaveOfflineTxFile(path, txFile)
+	if err != nil {
+		t.Errorf("SaveOfflineTxFile unexpected error: %v", err)
+		return
+	}
+
+	loaded, err := LoadOfflineTxFile(path)
+	if err != nil {
+		t.Errorf("LoadOfflineTxFile unexpected error: %v", err)
+		return
+	}
+
+	if loaded.WalletID != "W1" || len(loaded.RawTxs) != 1 || loaded.RawTxs[0].To["addr"] != "0.1" {
+		t.Errorf("loaded transaction file is not match")
+		return
+	}
+
+	//部分签名
+	loaded.RawTxs[0].Signatures["A1"][0].Signature = "sig1"
+	if loaded.isSigned() {
+		t.Errorf("partially signed transaction file should not be signed")
+		return
+	}
+
+	loaded.RawTxs[0].Signatures["A1"][1].Signature = "sig2"
+	if !loaded.isSigned() {
+		t.Errorf("fully signed transaction file should be signed")
+		return
+	}
+
+	for _, line := range loaded.Details() {
+		t.Log(line)
+	}
+}
+
+func TestLoadOfflineTxFileVersion(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "offlinetx")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tx.json")
+	err = SaveOfflineTxFile(path, &OfflineTxFile{Version: offlineTxVersion + 1})
+	if err != nil {
+		t.Errorf("SaveOfflineTxFile unexpected error: %v", err)
+		return
+	}
+
+	_, err = LoadOfflineTxFile(path)
+	if err == nil {
+		t.Errorf("LoadOfflineTxFile should failed with unsupported version")
+		return
+	}
+}
+
+func TestCLI_SignOfflineTxAppID(t *testing.T) {
+
+	cli := &CLI{config: &Config{appid: "app1"}}
+
+	txFile := &OfflineTxFile{
+		Version:  offlineTxVersion,
+		Type:     OfflineTxTypeTransfer,
+		Status:   OfflineTxStatusUnsigned,
+		AppID:    "app2",
+		WalletID: "W1",
+	}
+
+	//其它应用的交易文件在查找钱包前就被拒绝
+	err := cli.SignOfflineTx(txFile, "")
+	if err == nil {
+		t.Errorf("transactions file of other app should not be signed")
+		return
+	}
+	t.Logf("SignOfflineTx error: %v", err)
+}
@@ -0,0 +1,275 @@
+package openwcli
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blocktree/openwallet/v2/log"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	//本地数据密钥文件，保存在datadir，用于加密数据库中的敏感字段
+	dataKeyFileName = "datakey"
+	dataKeyLength   = 32
+
+	//加密字段的前缀，没有前缀的是旧版本的明文
+	encryptedSecretPrefix = "enc:v1:"
+
+	//数据密钥的校验明文
+	dataKeyCheckValue = "openw-cli"
+
+	//dbpassphrase派生数据密钥的scrypt参数
+	dataKeyScryptN = 1 << 15
+	dataKeyScryptR = 8
+	dataKeyScryptP = 1
+)
+
+// dataKeyError 数据密钥缺失或与数据库不匹配
+type dataKeyError struct {
+	msg string
+}
+
+func (e *dataKeyError) Error() string {
+	return e.msg
+}
+
+// dataKeyFile 数据密钥文件路径，默认保存在datadir
+func (cli *CLI) dataKeyFile() string {
+	if len(cli.config.dbkeyfile) > 0 {
+		return cli.config.dbkeyfile
+	}
+	return filepath.Join(cli.config.datadir, dataKeyFileName)
+}
+
+// loadDataKey 获取数据库字段加密的数据密钥，配置了dbpassphrase时由口令派生，否则读取密钥文件，
+// 数据库还没有加密记录时才会生成新的密钥，调用前需要已打开数据库
+func (cli *CLI) loadDataKey() ([]byte, error) {
+
+	if cli.db == nil {
+		return nil, fmt.Errorf("database is not opened. ")
+	}
+
+	var check string
+	cli.db.Get(CLIBucket, DataKeyCheckKey, &check)
+	create := len(check) == 0
+
+	if create && cli.config.dbReadOnlyMode {
+		return nil, &dataKeyError{"database is opened read-only, data key can not be initialized, please run encryptdb first"}
+	}
+
+	var (
+		key []byte
+		err error
+	)
+	if len(cli.config.dbpassphrase) > 0 {
+		key, err = cli.passphraseDataKey(create)
+	} else {
+		key, err = cli.fileDataKey(create)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//第一次使用，记录校验值，之后可以识别密钥是否匹配
+	if create {
+		check, err = encryptSecret(key, dataKeyCheckValue, DataKeyCheckKey)
+		if err != nil {
+			return nil, err
+		}
+		err = cli.db.Set(CLIBucket, DataKeyCheckKey, check)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	err = checkDataKey(key, check)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// checkDataKey 校验数据密钥与数据库记录的校验值是否匹配
+func checkDataKey(key []byte, check string) error {
+	_, err := decryptSecret(key, check, DataKeyCheckKey)
+	if err != nil {
+		return &dataKeyError{"data key is not match with the encrypted database, please check dbkeyfile or dbpassphrase"}
+	}
+	return nil
+}
+
+// fileDataKey 读取密钥文件，数据库已加密但密钥文件丢失时返回错误，不会生成新的密钥
+func (cli *CLI) fileDataKey(create bool) ([]byte, error) {
+
+	keyFile := cli.dataKeyFile()
+
+	content, err := ioutil.ReadFile(keyFile)
+	if err == nil {
+		return decodeDataKey(content)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if !create {
+		return nil, &dataKeyError{fmt.Sprintf("database is encrypted, but data key file: %s is missing, please restore it, or configure dbkeyfile or dbpassphrase", keyFile)}
+	}
+
+	key := make([]byte, dataKeyLength)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	//O_EXCL防止多个进程同时生成覆盖
+	f, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return cli.fileDataKey(create)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(hex.EncodeToString(key))
+	if err != nil {
+		return nil, err
+	}
+
+	//密钥文件与数据库在同一目录，只能防止数据库文件单独泄露
+	if len(cli.config.dbkeyfile) == 0 {
+		log.Warningf("data key file: %s is generated in datadir, it only protects against the database file leaking alone, "+
+			"please move it outside datadir and configure dbkeyfile, or use dbpassphrase_file / OPENW_DBPASSPHRASE", keyFile)
+	}
+
+	return key, nil
+}
+
+// passphraseDataKey 使用scrypt从dbpassphrase派生数据密钥，盐值保存在数据库
+func (cli *CLI) passphraseDataKey(create bool) ([]byte, error) {
+
+	var salt string
+	cli.db.Get(CLIBucket, DataKeySaltKey, &salt)
+
+	if len(salt) == 0 {
+		if !create {
+			return nil, &dataKeyError{"database is encrypted with data key file, dbpassphrase can not decrypt it"}
+		}
+		b := make([]byte, dataKeyLength)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		salt = hex.EncodeToString(b)
+		err = cli.db.Set(CLIBucket, DataKeySaltKey, salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//scrypt计算较慢，相同盐值缓存派生结果
+	if cli.passphraseKey != nil && cli.passphraseSalt == salt {
+		return cli.passphraseKey, nil
+	}
+
+	key, err := derivePassphraseKey(cli.config.dbpassphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	cli.passphraseKey = key
+	cli.passphraseSalt = salt
+
+	return key, nil
+}
+
+// derivePassphraseKey 使用scrypt派生数据密钥
+func derivePassphraseKey(passphrase, salt string) ([]byte, error) {
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		return nil, fmt.Errorf("data key salt is invalid")
+	}
+	return scrypt.Key([]byte(passphrase), saltBytes, dataKeyScryptN, dataKeyScryptR, dataKeyScryptP, dataKeyLength)
+}
+
+// decodeDataKey 解析数据密钥文件内容
+func decodeDataKey(content []byte) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != dataKeyLength {
+		return nil, fmt.Errorf("data key file is invalid")
+	}
+	return key, nil
+}
+
+// isEncryptedSecret 字段是否已加密
+func isEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+// encryptSecret 使用数据密钥AES-GCM加密字段，aad绑定字段所属的记录，防止密文被替换到其它记录
+func encryptSecret(key []byte, plain, aad string) (string, error) {
+
+	aead, err := newSecretAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(aad))
+
+	return encryptedSecretPrefix + hex.EncodeToString(sealed), nil
+}
+
+// decryptSecret 解密字段，没有加密前缀的旧数据原样返回
+func decryptSecret(key []byte, value, aad string) (string, error) {
+
+	if !isEncryptedSecret(value) {
+		return value, nil
+	}
+
+	sealed, err := hex.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("encrypted secret is invalid")
+	}
+
+	aead, err := newSecretAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted secret is invalid")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("encrypted secret can not be decrypted, data key is not match")
+	}
+
+	return string(plain), nil
+}
+
+// newSecretAEAD 创建AES-GCM加密器
+func newSecretAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,226 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/log"
+)
+
+// unlockSession 钱包解锁会话，缓存已解密的种子（外部签名后端只有钱包标识），超时或空闲后自动锁定
+type unlockSession struct {
+	walletID   string
+	key        *hdkeystore.HDKey
+	expireTime time.Time //为零值时不会超时
+	lastAccess time.Time
+}
+
+// expired 会话是否已过期
+func (s *unlockSession) expired(now time.Time, idleTimeout time.Duration) bool {
+	if !s.expireTime.IsZero() && now.After(s.expireTime) {
+		return true
+	}
+	if idleTimeout > 0 && now.Sub(s.lastAccess) > idleTimeout {
+		return true
+	}
+	return false
+}
+
+// UnlockWallet 解锁钱包，ttl为0时使用配置的unlockttl，配置也为0则直到手动锁定
+func (cli *CLI) UnlockWallet(wallet *openwsdk.Wallet, password string, ttl time.Duration) error {
+
+	if len(password) == 0 {
+		return fmt.Errorf("wallet password is empty. ")
+	}
+
+	//外部签名后端的会话不缓存种子，只记录已通过密码校验
+	key, err := cli.getSignerKey(wallet, password)
+	if err != nil {
+		return err
+	}
+
+	if ttl == 0 {
+		ttl = cli.config.unlockttl
+	}
+
+	now := time.Now()
+	session := &unlockSession{
+		walletID:   wallet.WalletID,
+		key:        key,
+		lastAccess: now,
+	}
+	if ttl > 0 {
+		session.expireTime = now.Add(ttl)
+	}
+
+	cli.sessionMu.Lock()
+	cli.unlockSessions[wallet.WalletID] = session
+	cli.sessionMu.Unlock()
+
+	if ttl > 0 {
+		log.Infof("Wallet: %s has been unlocked until %s", wallet.WalletID, session.expireTime.Format("2006-01-02 15:04:05"))
+	} else {
+		log.Infof("Wallet: %s has been unlocked until it is locked", wallet.WalletID)
+	}
+
+	return nil
+}
+
+// LockWallet 锁定钱包，walletID为空锁定全部钱包
+func (cli *CLI) LockWallet(walletID string) {
+	cli.sessionMu.Lock()
+	defer cli.sessionMu.Unlock()
+
+	if len(walletID) == 0 {
+		cli.unlockSessions = make(map[string]*unlockSession)
+		log.Infof("All wallets have been locked")
+		return
+	}
+
+	if _, exist := cli.unlockSessions[walletID]; exist {
+		delete(cli.unlockSessions, walletID)
+		log.Infof("Wallet: %s has been locked", walletID)
+	}
+}
+
+// getUnlockedKey 获取已解锁钱包的种子，过期的会话会被锁定
+func (cli *CLI) getUnlockedKey(walletID string) *hdkeystore.HDKey {
+	cli.sessionMu.Lock()
+	defer cli.sessionMu.Unlock()
+
+	session, exist := cli.unlockSessions[walletID]
+	if !exist {
+		return nil
+	}
+
+	now := time.Now()
+	if session.expired(now, cli.config.unlockidletimeout) {
+		delete(cli.unlockSessions, walletID)
+		log.Infof("Wallet: %s unlock session expired, it has been locked", walletID)
+		return nil
+	}
+
+	session.lastAccess = now
+	return session.key
+}
+
+// relockExpiredWallets 定时锁定已过期的钱包
+func (cli *CLI) relockExpiredWallets() {
+	cli.sessionMu.Lock()
+	defer cli.sessionMu.Unlock()
+
+	now := time.Now()
+	for walletID, session := range cli.unlockSessions {
+		if session.expired(now, cli.config.unlockidletimeout) {
+			delete(cli.unlockSessions, walletID)
+			log.Infof("Wallet: %s unlock session expired, it has been locked", walletID)
+		}
+	}
+}
+
+// UnlockedWallets 已解锁的钱包及过期时间
+func (cli *CLI) UnlockedWallets() map[string]int64 {
+	cli.sessionMu.RLock()
+	defer cli.sessionMu.RUnlock()
+
+	unlocked := make(map[string]int64)
+	for walletID, session := range cli.unlockSessions {
+		if session.expireTime.IsZero() {
+			unlocked[walletID] = 0
+		} else {
+			unlocked[walletID] = session.expireTime.Unix()
+		}
+	}
+	return unlocked
+}
+
+const (
+	//守护进程解锁和锁定钱包会话的接口路径
+	daemonUnlockWalletPath = "/wallet/unlock"
+	daemonLockWalletPath   = "/wallet/lock"
+)
+
+// daemonWalletSessionRequest 通过守护进程本地socket解锁或锁定钱包
+type daemonWalletSessionRequest struct {
+	WalletID string `json:"walletID"`
+	Password string `json:"password"`
+	//会话有效秒数，0使用守护进程配置的unlockttl
+	TTL int64 `json:"ttl"`
+}
+
+// serveDaemonWalletSession 守护进程处理本地unlockwallet和lockwallet命令
+func (cli *CLI) serveDaemonWalletSession(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req daemonWalletSessionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "request is invalid", http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case daemonUnlockWalletPath:
+		wallet, findErr := cli.GetWalletByWalletIDOnLocal(req.WalletID)
+		if findErr != nil {
+			http.Error(w, findErr.Error(), http.StatusBadRequest)
+			return
+		}
+		err = cli.UnlockWallet(wallet, req.Password, time.Duration(req.TTL)*time.Second)
+	case daemonLockWalletPath:
+		cli.LockWallet(req.WalletID)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cli.UnlockedWallets())
+}
+
+// requestDaemonWalletSession 请求运行中的守护进程解锁或锁定钱包，返回已解锁的钱包及过期时间
+func (cli *CLI) requestDaemonWalletSession(path string, req *daemonWalletSessionRequest) (map[string]int64, error) {
+
+	if !isUnixSocketAlive(cli.daemonSocket()) {
+		return nil, fmt.Errorf("openw-cli daemon is not running on %s, unlock sessions are kept by trustserver, startsum or daemon", cli.daemonSocket())
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	client := newUnixHTTPClient(cli.daemonSocket(), time.Duration(cli.config.requesttimeout)*time.Second)
+	resp, err := client.Post("http://unix"+path, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("daemon response status: %d, %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	unlocked := make(map[string]int64)
+	err = json.NewDecoder(resp.Body).Decode(&unlocked)
+	if err != nil {
+		return nil, err
+	}
+
+	return unlocked, nil
+}
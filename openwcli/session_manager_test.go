@@ -0,0 +1,127 @@
+package openwcli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego/config"
+)
+
+func TestUnlockSession_Expired(t *testing.T) {
+
+	now := time.Now()
+
+	//不会超时的会话
+	session := &unlockSession{
+		walletID:   "W1",
+		lastAccess: now,
+	}
+	if session.expired(now.Add(24*time.Hour), 0) {
+		t.Errorf("session without ttl should not be expired")
+	}
+
+	//超过有效时间
+	session.expireTime = now.Add(2 * time.Hour)
+	if session.expired(now.Add(1*time.Hour), 0) {
+		t.Errorf("session should not be expired before ttl")
+	}
+	if !session.expired(now.Add(3*time.Hour), 0) {
+		t.Errorf("session should be expired after ttl")
+	}
+
+	//空闲超时
+	if !session.expired(now.Add(31*time.Minute), 30*time.Minute) {
+		t.Errorf("session should be expired after idle timeout")
+	}
+	session.lastAccess = now.Add(20 * time.Minute)
+	if session.expired(now.Add(31*time.Minute), 30*time.Minute) {
+		t.Errorf("session should not be expired after accessed")
+	}
+}
+
+func TestCLI_LockWallet(t *testing.T) {
+
+	cli := &CLI{
+		config:         &Config{},
+		unlockSessions: make(map[string]*unlockSession),
+	}
+
+	now := time.Now()
+	cli.unlockSessions["W1"] = &unlockSession{walletID: "W1", lastAccess: now}
+	cli.unlockSessions["W2"] = &unlockSession{walletID: "W2", lastAccess: now, expireTime: now.Add(-time.Second)}
+
+	if cli.getUnlockedKey("W2") != nil {
+		t.Errorf("expired session should return nil key")
+	}
+	if _, exist := cli.unlockSessions["W2"]; exist {
+		t.Errorf("expired session should be removed")
+	}
+
+	cli.LockWallet("W1")
+	if len(cli.unlockSessions) != 0 {
+		t.Errorf("wallet W1 should be locked")
+	}
+}
+
+func TestCLI_ServeDaemonWalletSession(t *testing.T) {
+
+	cli := &CLI{
+		config:         &Config{},
+		unlockSessions: make(map[string]*unlockSession),
+	}
+	cli.unlockSessions["W1"] = &unlockSession{walletID: "W1", lastAccess: time.Now()}
+	cli.unlockSessions["W2"] = &unlockSession{walletID: "W2", lastAccess: time.Now()}
+
+	w := httptest.NewRecorder()
+	cli.serveDaemonWalletSession(w, httptest.NewRequest(http.MethodPost, daemonLockWalletPath, strings.NewReader(`{"walletID":"W1"}`)))
+	if w.Code != http.StatusOK || len(cli.unlockSessions) != 1 {
+		t.Errorf("wallet W1 should be locked by daemon socket, status: %d", w.Code)
+		return
+	}
+
+	//只接受POST请求
+	w = httptest.NewRecorder()
+	cli.serveDaemonWalletSession(w, httptest.NewRequest(http.MethodGet, daemonLockWalletPath, nil))
+	if w.Code != http.StatusMethodNotAllowed || len(cli.unlockSessions) != 1 {
+		t.Errorf("GET request should not lock wallet")
+		return
+	}
+
+	w = httptest.NewRecorder()
+	cli.serveDaemonWalletSession(w, httptest.NewRequest(http.MethodPost, daemonLockWalletPath, strings.NewReader(`{}`)))
+	if w.Code != http.StatusOK || len(cli.unlockSessions) != 0 {
+		t.Errorf("all wallets should be locked")
+		return
+	}
+}
+
+func TestParseConfigDuration(t *testing.T) {
+
+	c, err := config.NewConfigData("ini", []byte("unlockttl = 2hh\nunlockidletimeout = -1m\n"))
+	if err != nil {
+		t.Errorf("NewConfigData unexpected error: %v", err)
+		return
+	}
+
+	//时长写错不能当作0，否则钱包会一直保持解锁
+	if _, err = parseConfigDuration(c, "unlockttl", defaultUnlockTTL); err == nil {
+		t.Errorf("invalid unlockttl should return error")
+		return
+	}
+	if _, err = parseConfigDuration(c, "unlockidletimeout", defaultUnlockIdleTimeout); err == nil {
+		t.Errorf("negative unlockidletimeout should return error")
+		return
+	}
+	if checkConfig(c) == nil {
+		t.Errorf("checkConfig should return error")
+		return
+	}
+
+	if d, err := parseConfigDuration(c, "notexist", defaultUnlockTTL); err != nil || d != 2*time.Hour {
+		t.Errorf("default duration is not match: %v, %v", d, err)
+		return
+	}
+}
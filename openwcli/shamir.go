@@ -0,0 +1,296 @@
+package openwcli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	//种子分片的校验码长度
+	shareChecksumLength = 4
+	//分片文本的前缀
+	shareTextPrefix = "owshare"
+)
+
+// GF(256)运算表，不可约多项式 x^8 + x^4 + x^3 + x + 1，生成元3
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		x = gfMulNoTable(x, 3)
+	}
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMulNoTable(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// ShamirSplit 把秘密拆分为total个分片，任意threshold个分片可以恢复
+// 每个分片的第一个字节为x坐标，后面为各字节多项式在x处的值
+func ShamirSplit(secret []byte, total, threshold int) ([][]byte, error) {
+
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret is empty")
+	}
+
+	if threshold < 2 || threshold > total || total > 255 {
+		return nil, fmt.Errorf("threshold should be between 2 and shares, shares should not be more than 255")
+	}
+
+	shares := make([][]byte, total)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	for idx, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			x := shares[i][0]
+			//霍纳法则计算多项式
+			var y byte
+			for c := threshold - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coeffs[c]
+			}
+			shares[i][idx+1] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// ShamirCombine 通过拉格朗日插值恢复秘密
+func ShamirCombine(shares [][]byte) ([]byte, error) {
+
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least 2 shares are required")
+	}
+
+	length := len(shares[0])
+	if length < 2 {
+		return nil, fmt.Errorf("share is too short")
+	}
+
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) != length {
+			return nil, fmt.Errorf("shares have different length")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, fmt.Errorf("share index is invalid or duplicated")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, length-1)
+	for i, si := range shares {
+		//计算x=0处的拉格朗日基
+		basis := byte(1)
+		for j, sj := range shares {
+			if i == j {
+				continue
+			}
+			basis = gfMul(basis, gfDiv(sj[0], sj[0]^si[0]))
+		}
+		for idx := range secret {
+			secret[idx] ^= gfMul(si[idx+1], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+// WalletShare 钱包种子分片
+type WalletShare struct {
+	WalletID  string
+	Threshold int
+	Index     int
+	Data      []byte
+}
+
+// String 分片文本：owshare:walletID:threshold:index:hex
+func (s *WalletShare) String() string {
+	return fmt.Sprintf("%s:%s:%d:%d:%s", shareTextPrefix, s.WalletID, s.Threshold, s.Index, hex.EncodeToString(s.Data))
+}
+
+// ParseWalletShare 解析分片文本
+func ParseWalletShare(text string) (*WalletShare, error) {
+
+	parts := strings.Split(strings.TrimSpace(text), ":")
+	if len(parts) != 5 || parts[0] != shareTextPrefix {
+		return nil, fmt.Errorf("share text is invalid")
+	}
+
+	threshold, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("share threshold is invalid")
+	}
+
+	index, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("share index is invalid")
+	}
+
+	data, err := hex.DecodeString(parts[4])
+	if err != nil || len(data) < 2 || int(data[0]) != index {
+		return nil, fmt.Errorf("share data is invalid")
+	}
+
+	return &WalletShare{
+		WalletID:  parts[1],
+		Threshold: threshold,
+		Index:     index,
+		Data:      data,
+	}, nil
+}
+
+// SplitSeed 拆分钱包种子，种子末尾附加校验码，恢复时可以检查分片是否正确
+func SplitSeed(walletID string, seed []byte, total, threshold int) ([]*WalletShare, error) {
+
+	checksum := sha256.Sum256(seed)
+	secret := append(append([]byte{}, seed...), checksum[:shareChecksumLength]...)
+
+	data, err := ShamirSplit(secret, total, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]*WalletShare, 0, total)
+	for _, d := range data {
+		shares = append(shares, &WalletShare{
+			WalletID:  walletID,
+			Threshold: threshold,
+			Index:     int(d[0]),
+			Data:      d,
+		})
+	}
+
+	return shares, nil
+}
+
+// CombineSeed 通过分片恢复钱包种子
+func CombineSeed(shares []*WalletShare) ([]byte, error) {
+
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("shares are empty")
+	}
+
+	first := shares[0]
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("at least %d shares are required", first.Threshold)
+	}
+
+	data := make([][]byte, 0, len(shares))
+	for _, s := range shares {
+		if s.WalletID != first.WalletID || s.Threshold != first.Threshold {
+			return nil, fmt.Errorf("shares are not from the same wallet split")
+		}
+		data = append(data, s.Data)
+	}
+
+	secret, err := ShamirCombine(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(secret) <= shareChecksumLength {
+		return nil, fmt.Errorf("share data is too short")
+	}
+
+	seed := secret[:len(secret)-shareChecksumLength]
+	checksum := sha256.Sum256(seed)
+	if !bytes.Equal(checksum[:shareChecksumLength], secret[len(secret)-shareChecksumLength:]) {
+		return nil, fmt.Errorf("shares are incorrect, seed checksum is not match")
+	}
+
+	return seed, nil
+}
+
+// SaveWalletShares 把分片分别保存到目录中，每个分片一个文件，只有本用户可读写，不覆盖已存在的文件
+func SaveWalletShares(dir string, shares []*WalletShare) ([]string, error) {
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(shares))
+	for _, share := range shares {
+		path := filepath.Join(dir, fmt.Sprintf("%s-share-%d-of-%d.txt", share.WalletID, share.Index, len(shares)))
+		err = writeShareFile(path, share)
+		if err != nil {
+			//部分分片写入失败时删除已写入的文件，避免留下不完整的分片集合
+			for _, f := range files {
+				os.Remove(f)
+			}
+			return nil, err
+		}
+		files = append(files, path)
+	}
+
+	return files, nil
+}
+
+// writeShareFile 以0600权限新建分片文件
+func writeShareFile(path string, share *WalletShare) error {
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(share.String() + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
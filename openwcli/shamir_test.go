@@ -0,0 +1,124 @@
+package openwcli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShamirSplit(t *testing.T) {
+
+	seed := []byte("0123456789abcdef0123456789abcdef")
+	total, threshold := 5, 3
+
+	shares, err := SplitSeed("W1", seed, total, threshold)
+	if err != nil {
+		t.Errorf("SplitSeed unexpected error: %v", err)
+		return
+	}
+
+	//遍历所有分片组合，达到门限的组合都可以恢复
+	for mask := uint(1); mask < 1<<uint(total); mask++ {
+		subset := make([]*WalletShare, 0)
+		for i := uint(0); i < uint(total); i++ {
+			if mask&(1<<i) == 0 {
+				continue
+			}
+			share, parseErr := ParseWalletShare(shares[i].String())
+			if parseErr != nil {
+				t.Errorf("ParseWalletShare unexpected error: %v", parseErr)
+				return
+			}
+			subset = append(subset, share)
+		}
+
+		recovered, combineErr := CombineSeed(subset)
+		if len(subset) >= threshold {
+			if combineErr != nil || !bytes.Equal(recovered, seed) {
+				t.Errorf("subset: %b combine failed, err: %v", mask, combineErr)
+				return
+			}
+		} else if combineErr == nil {
+			t.Errorf("subset: %b should not recover with %d shares", mask, len(subset))
+			return
+		}
+	}
+}
+
+func TestShamirCombine_Insufficient(t *testing.T) {
+
+	seed := []byte("0123456789abcdef0123456789abcdef")
+
+	shares, err := SplitSeed("W1", seed, 5, 3)
+	if err != nil {
+		t.Errorf("SplitSeed unexpected error: %v", err)
+		return
+	}
+
+	//伪造门限，少于门限的分片无法通过校验
+	subset := []*WalletShare{shares[0], shares[1]}
+	for _, s := range subset {
+		s.Threshold = 2
+	}
+	_, err = CombineSeed(subset)
+	if err == nil {
+		t.Errorf("CombineSeed should failed with insufficient shares")
+		return
+	}
+}
+
+func TestSaveWalletShares(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "openwcli-shares")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	seed := []byte("0123456789abcdef0123456789abcdef")
+	shares, err := SplitSeed("W1", seed, 3, 2)
+	if err != nil {
+		t.Errorf("SplitSeed unexpected error: %v", err)
+		return
+	}
+
+	outDir := filepath.Join(dir, "shares")
+	files, err := SaveWalletShares(outDir, shares)
+	if err != nil || len(files) != 3 {
+		t.Errorf("SaveWalletShares unexpected error: %v", err)
+		return
+	}
+
+	//每个分片文件只有本用户可读写，可以直接用于恢复
+	loaded := make([]*WalletShare, 0)
+	for _, f := range files {
+		info, statErr := os.Stat(f)
+		if statErr != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("share file: %s permission is incorrect", f)
+			return
+		}
+		content, _ := ioutil.ReadFile(f)
+		share, parseErr := ParseWalletShare(string(content))
+		if parseErr != nil {
+			t.Errorf("ParseWalletShare unexpected error: %v", parseErr)
+			return
+		}
+		loaded = append(loaded, share)
+	}
+
+	recovered, err := CombineSeed(loaded[1:])
+	if err != nil || !bytes.Equal(recovered, seed) {
+		t.Errorf("seed recovered from share files is not match")
+		return
+	}
+
+	//不覆盖已存在的分片文件
+	_, err = SaveWalletShares(outDir, shares)
+	if err == nil {
+		t.Errorf("existing share files should not be overwritten")
+		return
+	}
+}
@@ -0,0 +1,354 @@
+package openwcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/log"
+)
+
+const (
+	//签名后端
+	SignerLocal  = "local"
+	SignerRemote = "remote"
+	SignerPKCS11 = "pkcs11"
+
+	//远程签名服务的接口路径
+	remoteSignerPath = "/sign"
+	//远程签名服务校验钱包密码的接口路径
+	remoteVerifyPath = "/verify"
+)
+
+// remoteSignRequest 远程签名请求，开启联合签名时附带审批的请求和联合签名节点的审批签名
+type remoteSignRequest struct {
+	WalletID   string                              `json:"walletID"`
+	Signatures map[string][]*openwsdk.KeySignature `json:"signatures"`
+	CoSign     *CoSignRequest                      `json:"coSign,omitempty"`
+	Approvals  []*CoSignApproval                   `json:"approvals,omitempty"`
+}
+
+// remoteVerifyRequest 远程签名服务校验钱包密码的请求
+type remoteVerifyRequest struct {
+	WalletID string `json:"walletID"`
+	Password string `json:"password"`
+}
+
+// remoteSignResponse 远程签名响应
+type remoteSignResponse struct {
+	Signatures map[string][]*openwsdk.KeySignature `json:"signatures"`
+	Error      string                              `json:"error"`
+}
+
+// newSignerBackend 根据配置创建签名方法，local使用keystore解密的种子签名，
+// remote和pkcs11的私钥不在CLI进程内，签名时传入的key只有WalletID
+func newSignerBackend(conf *Config) (SignTxHashFunc, error) {
+	switch conf.signer {
+	case "", SignerLocal:
+		return openwsdk.SignTxHash, nil
+	case SignerRemote:
+		if len(conf.signersocket) == 0 {
+			return nil, fmt.Errorf("signersocket is empty. ")
+		}
+		return newRemoteSigner(conf.signersocket, time.Duration(conf.requesttimeout)*time.Second), nil
+	case SignerPKCS11:
+		return newPKCS11Signer(conf.pkcs11module, conf.pkcs11tokenlabel, conf.pkcs11pin)
+	default:
+		return nil, fmt.Errorf("signer: %s is not supported, it should be %s, %s or %s",
+			conf.signer, SignerLocal, SignerRemote, SignerPKCS11)
+	}
+}
+
+// isLocalSigner 是否使用本地keystore签名
+func (cli *CLI) isLocalSigner() bool {
+	return cli.config.signer == "" || cli.config.signer == SignerLocal
+}
+
+// getSignerKey 获取交易签名使用的key，本地签名时解密keystore，
+// 外部签名后端不解密种子，但同样需要钱包授权：密码为空时需要已解锁的钱包会话，否则校验钱包密码
+func (cli *CLI) getSignerKey(wallet *openwsdk.Wallet, password string) (*hdkeystore.HDKey, error) {
+
+	if cli.isLocalSigner() {
+		return cli.getLocalKeyByWallet(wallet, password)
+	}
+
+	if err := cli.checkNotWatchOnlyWallet(wallet.WalletID); err != nil {
+		return nil, err
+	}
+
+	if len(password) == 0 {
+		if key := cli.getUnlockedKey(wallet.WalletID); key != nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("wallet: %s is locked, password is empty", wallet.WalletID)
+	}
+
+	err := cli.verifySignerPassword(wallet, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hdkeystore.HDKey{
+		Alias: wallet.Alias,
+		KeyID: wallet.WalletID,
+	}, nil
+}
+
+// verifySignerPassword 外部签名后端校验钱包密码，本地有keystore时解密校验，
+// remote没有本地keystore时由远程签名服务用它的keystore校验
+func (cli *CLI) verifySignerPassword(wallet *openwsdk.Wallet, password string) error {
+
+	if _, err := cli.getKeystoreWallet(wallet.WalletID); err == nil {
+		_, err = cli.getLocalKeyByWallet(wallet, password)
+		return err
+	}
+
+	if cli.config.signer == SignerRemote {
+		return verifyRemoteSignerPassword(cli.config.signersocket, time.Duration(cli.config.requesttimeout)*time.Second, wallet.WalletID, password)
+	}
+
+	return fmt.Errorf("wallet: %s has no local keystore to verify password", wallet.WalletID)
+}
+
+// newRemoteSigner 通过unix socket上的HTTP接口请求远程签名服务
+func newRemoteSigner(socket string, timeout time.Duration) SignTxHashFunc {
+	return func(signatures map[string][]*openwsdk.KeySignature, key *hdkeystore.HDKey) (map[string][]*openwsdk.KeySignature, error) {
+
+		if key == nil {
+			return nil, fmt.Errorf("sign key is nil")
+		}
+
+		return remoteSignTxHash(socket, timeout, &remoteSignRequest{
+			WalletID:   key.KeyID,
+			Signatures: signatures,
+		})
+	}
+}
+
+// remoteSignTxHash 发送签名请求到远程签名服务，开启联合签名时请求附带联合签名审批
+func remoteSignTxHash(socket string, timeout time.Duration, req *remoteSignRequest) (map[string][]*openwsdk.KeySignature, error) {
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	client := newUnixHTTPClient(socket, timeout)
+
+	//unix socket不使用host，固定为unix
+	resp, err := client.Post("http://unix"+remoteSignerPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("remote signer is unavailable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result remoteSignResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer response is invalid: %v", err)
+	}
+
+	if len(result.Error) > 0 {
+		return nil, fmt.Errorf("remote signer: %s", result.Error)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote signer response status: %d", resp.StatusCode)
+	}
+
+	return result.Signatures, nil
+}
+
+// verifyRemoteSignerPassword 请求远程签名服务用它的keystore校验钱包密码
+func verifyRemoteSignerPassword(socket string, timeout time.Duration, walletID, password string) error {
+
+	body, err := json.Marshal(&remoteVerifyRequest{
+		WalletID: walletID,
+		Password: password,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := newUnixHTTPClient(socket, timeout)
+	resp, err := client.Post("http://unix"+remoteVerifyPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("remote signer is unavailable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result remoteSignResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("remote signer response is invalid: %v", err)
+	}
+
+	if len(result.Error) > 0 {
+		return fmt.Errorf("remote signer: %s", result.Error)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("remote signer response status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// newRemoteSignerHandler 远程签名服务的HTTP处理器，authorize校验请求并返回钱包已解锁的key，verify校验钱包密码
+func newRemoteSignerHandler(authorize func(req *remoteSignRequest) (*hdkeystore.HDKey, error), verify func(walletID, password string) error, signer SignTxHashFunc) http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(remoteVerifyPath, func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(&remoteSignResponse{Error: "method is not allowed"})
+			return
+		}
+
+		var req remoteVerifyRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || len(req.WalletID) == 0 || len(req.Password) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(&remoteSignResponse{Error: "request is invalid"})
+			return
+		}
+
+		err = verify(req.WalletID, req.Password)
+		if err != nil {
+			log.Warningf("remote signer verify password for wallet: %s failed", req.WalletID)
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(&remoteSignResponse{Error: "wallet password is incorrect"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&remoteSignResponse{})
+	})
+	mux.HandleFunc(remoteSignerPath, func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response := func(status int, result *remoteSignResponse) {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+		}
+
+		if r.Method != http.MethodPost {
+			response(http.StatusMethodNotAllowed, &remoteSignResponse{Error: "method is not allowed"})
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			response(http.StatusBadRequest, &remoteSignResponse{Error: err.Error()})
+			return
+		}
+
+		var req remoteSignRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil || len(req.WalletID) == 0 {
+			response(http.StatusBadRequest, &remoteSignResponse{Error: "request is invalid"})
+			return
+		}
+
+		key, err := authorize(&req)
+		if err != nil {
+			response(http.StatusForbidden, &remoteSignResponse{Error: err.Error()})
+			return
+		}
+
+		signatures, err := signer(req.Signatures, key)
+		if err != nil {
+			response(http.StatusInternalServerError, &remoteSignResponse{Error: err.Error()})
+			return
+		}
+
+		log.Infof("remote signer signed transaction for wallet: %s", req.WalletID)
+
+		response(http.StatusOK, &remoteSignResponse{Signatures: signatures})
+	})
+
+	return mux
+}
+
+// ServeRemoteSigner 在unix socket上启动远程签名服务，只为已解锁的钱包签名，
+// 私钥只保存在签名服务进程，其它节点配置signer = remote即可使用。
+// 签名服务配置了cosignthreshold和cosigners时，没有达到门限审批的请求不签名
+func (cli *CLI) ServeRemoteSigner(socket string) error {
+
+	if len(socket) == 0 {
+		return fmt.Errorf("signersocket is empty. ")
+	}
+
+	listener, err := listenUnixSocket(socket)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	authorize := func(req *remoteSignRequest) (*hdkeystore.HDKey, error) {
+		key := cli.getUnlockedKey(req.WalletID)
+		if key == nil {
+			return nil, fmt.Errorf("wallet: %s is locked", req.WalletID)
+		}
+		if cli.coSignEnabled() {
+			err := cli.checkRemoteSignCoSign(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return key, nil
+	}
+
+	verify := func(walletID, password string) error {
+		wallet, err := cli.getKeystoreWallet(walletID)
+		if err != nil {
+			return err
+		}
+		_, err = cli.getLocalKeyByWallet(wallet, password)
+		return err
+	}
+
+	log.Infof("Remote signer is listening on %s", socket)
+
+	return http.Serve(listener, newRemoteSignerHandler(authorize, verify, openwsdk.SignTxHash))
+}
+
+// checkRemoteSignCoSign 远程签名服务开启联合签名时，签名请求需要附带k个不同联合签名节点的有效审批，
+// 并且只签名审批请求中的哈希
+func (cli *CLI) checkRemoteSignCoSign(req *remoteSignRequest) error {
+
+	if req.CoSign == nil {
+		return fmt.Errorf("co-sign approvals are required")
+	}
+
+	if req.CoSign.WalletID != req.WalletID || req.CoSign.AppID != cli.config.appid {
+		return fmt.Errorf("co-sign request is not match with sign request")
+	}
+
+	skew := time.Since(time.Unix(req.CoSign.Time, 0))
+	if skew > coSignRequestMaxSkew || skew < -coSignRequestMaxSkew {
+		return fmt.Errorf("co-sign request time is expired")
+	}
+
+	approved := make(map[string]bool)
+	for _, message := range req.CoSign.Messages {
+		approved[message] = true
+	}
+	for _, keySignatures := range req.Signatures {
+		for _, ks := range keySignatures {
+			if !approved[ks.Message] {
+				return fmt.Errorf("hash: %s is not approved by co-signers", ks.Message)
+			}
+		}
+	}
+
+	return cli.VerifyCoSignApprovals(req.CoSign, req.Approvals)
+}
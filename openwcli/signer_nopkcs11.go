@@ -0,0 +1,13 @@
+//go:build !pkcs11
+// +build !pkcs11
+
+package openwcli
+
+import (
+	"fmt"
+)
+
+// newPKCS11Signer PKCS#11需要cgo，使用 go build -tags pkcs11 编译才支持
+func newPKCS11Signer(module, tokenLabel, pin string) (SignTxHashFunc, error) {
+	return nil, fmt.Errorf("pkcs11 signer is not supported, rebuild with -tags pkcs11")
+}
@@ -0,0 +1,169 @@
+//go:build pkcs11
+// +build pkcs11
+
+package openwcli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/miekg/pkcs11"
+)
+
+// secp256k1曲线的阶，用于把签名的s规范为low-S
+var secp256k1N, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+
+// pkcs11Signer 通过PKCS#11模块签名，私钥保存在HSM中，以地址作为私钥对象的CKA_LABEL
+type pkcs11Signer struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	//PKCS#11会话不能并发使用
+	mu sync.Mutex
+}
+
+// newPKCS11Signer 加载PKCS#11模块并登录指定标签的token
+func newPKCS11Signer(module, tokenLabel, pin string) (SignTxHashFunc, error) {
+
+	if len(module) == 0 {
+		return nil, fmt.Errorf("pkcs11module is empty. ")
+	}
+
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("can not load pkcs11 module: %s", module)
+	}
+
+	err := ctx.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, slot := range slots {
+		info, infoErr := ctx.GetTokenInfo(slot)
+		if infoErr != nil || info.Label != tokenLabel {
+			continue
+		}
+
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ctx.Login(session, pkcs11.CKU_USER, pin)
+		if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			ctx.CloseSession(session)
+			return nil, fmt.Errorf("pkcs11 token login failed: %v", err)
+		}
+
+		signer := &pkcs11Signer{
+			ctx:     ctx,
+			session: session,
+		}
+		return signer.SignTxHash, nil
+	}
+
+	return nil, fmt.Errorf("can not find pkcs11 token: %s", tokenLabel)
+}
+
+// SignTxHash 实现SignTxHashFunc，key只用于标识钱包
+func (s *pkcs11Signer) SignTxHash(signatures map[string][]*openwsdk.KeySignature, key *hdkeystore.HDKey) (map[string][]*openwsdk.KeySignature, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, keySignatures := range signatures {
+		for _, keySignature := range keySignatures {
+
+			if keySignature.Address == nil {
+				return nil, fmt.Errorf("key signature has no address")
+			}
+
+			if keySignature.EccType != owcrypt.ECC_CURVE_SECP256K1 && keySignature.EccType != owcrypt.ECC_CURVE_SECP256R1 {
+				return nil, fmt.Errorf("pkcs11 signer does not support ecc type: %d", keySignature.EccType)
+			}
+
+			hash, err := hex.DecodeString(keySignature.Message)
+			if err != nil {
+				return nil, err
+			}
+
+			signature, err := s.sign(keySignature.Address.Address, hash)
+			if err != nil {
+				return nil, fmt.Errorf("address: %s sign failed: %v", keySignature.Address.Address, err)
+			}
+
+			if keySignature.EccType == owcrypt.ECC_CURVE_SECP256K1 {
+				signature = normalizeLowS(signature)
+			}
+
+			keySignature.Signature = hex.EncodeToString(signature)
+		}
+	}
+
+	return signatures, nil
+}
+
+// sign 查找地址对应的私钥对象，使用CKM_ECDSA签名哈希，返回r||s
+func (s *pkcs11Signer) sign(address string, hash []byte) ([]byte, error) {
+
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, address),
+	}
+
+	err := s.ctx.FindObjectsInit(s.session, template)
+	if err != nil {
+		return nil, err
+	}
+	objects, _, err := s.ctx.FindObjects(s.session, 1)
+	s.ctx.FindObjectsFinal(s.session)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("private key is not found in token")
+	}
+
+	err = s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, objects[0])
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := s.ctx.Sign(s.session, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signature) != 64 {
+		return nil, fmt.Errorf("signature length: %d is invalid", len(signature))
+	}
+
+	return signature, nil
+}
+
+// normalizeLowS s大于n/2时替换为n-s，避免链上拒绝高S值的签名
+func normalizeLowS(signature []byte) []byte {
+
+	halfN := new(big.Int).Rsh(secp256k1N, 1)
+	sValue := new(big.Int).SetBytes(signature[32:])
+	if sValue.Cmp(halfN) <= 0 {
+		return signature
+	}
+
+	sValue.Sub(secp256k1N, sValue)
+	normalized := make([]byte, 64)
+	copy(normalized, signature[:32])
+	sBytes := sValue.Bytes()
+	copy(normalized[64-len(sBytes):], sBytes)
+	return normalized
+}
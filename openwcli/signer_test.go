@@ -0,0 +1,160 @@
+package openwcli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+)
+
+func TestRemoteSigner(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "signer.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Errorf("Listen unexpected error: %v", err)
+		return
+	}
+	defer listener.Close()
+
+	authorize := func(req *remoteSignRequest) (*hdkeystore.HDKey, error) {
+		if req.WalletID != "W1" {
+			return nil, fmt.Errorf("wallet: %s is locked", req.WalletID)
+		}
+		return &hdkeystore.HDKey{KeyID: req.WalletID}, nil
+	}
+
+	//模拟签名，签名结果为消息加钱包ID
+	fakeSigner := func(signatures map[string][]*openwsdk.KeySignature, key *hdkeystore.HDKey) (map[string][]*openwsdk.KeySignature, error) {
+		for _, keySignatures := range signatures {
+			for _, ks := range keySignatures {
+				ks.Signature = ks.Message + key.KeyID
+			}
+		}
+		return signatures, nil
+	}
+
+	verify := func(walletID, password string) error {
+		if walletID != "W1" || password != "12345678" {
+			return fmt.Errorf("wallet password is incorrect")
+		}
+		return nil
+	}
+
+	go http.Serve(listener, newRemoteSignerHandler(authorize, verify, fakeSigner))
+
+	signer := newRemoteSigner(socket, 5*time.Second)
+
+	signatures := map[string][]*openwsdk.KeySignature{
+		"A1": {{Message: "hash"}},
+	}
+
+	signed, err := signer(signatures, &hdkeystore.HDKey{KeyID: "W1"})
+	if err != nil {
+		t.Errorf("remote signer unexpected error: %v", err)
+		return
+	}
+
+	if len(signed["A1"]) != 1 || signed["A1"][0].Signature != "hashW1" {
+		t.Errorf("remote signer signatures are not match")
+		return
+	}
+
+	_, err = signer(signatures, &hdkeystore.HDKey{KeyID: "W2"})
+	if err == nil {
+		t.Errorf("remote signer should failed with locked wallet")
+		return
+	}
+	t.Logf("locked wallet error: %v", err)
+
+	err = verifyRemoteSignerPassword(socket, 5*time.Second, "W1", "12345678")
+	if err != nil {
+		t.Errorf("verifyRemoteSignerPassword unexpected error: %v", err)
+		return
+	}
+
+	err = verifyRemoteSignerPassword(socket, 5*time.Second, "W1", "87654321")
+	if err == nil {
+		t.Errorf("verifyRemoteSignerPassword should failed with incorrect password")
+		return
+	}
+}
+
+func TestCLI_GetSignerKey_RemoteNeedsAuthorization(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{
+		config: &Config{
+			appid:          "test",
+			dbdir:          dir,
+			keydir:         dir,
+			signer:         SignerPKCS11,
+			requesttimeout: 5,
+		},
+		unlockSessions: make(map[string]*unlockSession),
+	}
+
+	wallet := &openwsdk.Wallet{WalletID: "W1"}
+
+	//没有解锁会话，也没有密码
+	_, err = cli.getSignerKey(wallet, "")
+	if err == nil {
+		t.Errorf("getSignerKey should failed without unlock session")
+		return
+	}
+
+	//没有本地keystore无法校验密码
+	_, err = cli.getSignerKey(wallet, "12345678")
+	if err == nil {
+		t.Errorf("getSignerKey should failed when password can not be verified")
+		return
+	}
+
+	cli.unlockSessions["W1"] = &unlockSession{walletID: "W1", key: &hdkeystore.HDKey{KeyID: "W1"}, lastAccess: time.Now()}
+	key, err := cli.getSignerKey(wallet, "")
+	if err != nil || key.KeyID != "W1" {
+		t.Errorf("getSignerKey unexpected error: %v", err)
+		return
+	}
+}
+
+func TestNewSignerBackend(t *testing.T) {
+
+	_, err := newSignerBackend(&Config{signer: SignerLocal})
+	if err != nil {
+		t.Errorf("local signer unexpected error: %v", err)
+		return
+	}
+
+	_, err = newSignerBackend(&Config{signer: SignerRemote})
+	if err == nil {
+		t.Errorf("remote signer should failed without socket")
+		return
+	}
+
+	_, err = newSignerBackend(&Config{signer: "unknown"})
+	if err == nil {
+		t.Errorf("unknown signer should failed")
+		return
+	}
+}
@@ -1,7 +1,6 @@
 package openwcli
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/asdine/storm"
 	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
@@ -10,6 +9,7 @@ import (
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/blocktree/openwallet/v2/owtp"
+	"github.com/blocktree/openwallet/v2/timer"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"time"
@@ -25,11 +25,11 @@ func (cli *CLI) TransferAll(wallet *openwsdk.Wallet, account *openwsdk.Account,
 	)
 
 	//:检查目标地址是否信任名单
-	if !cli.IsTrustAddress(to, account.Symbol) {
+	if !cli.checkTrustAddress(to, account.Symbol) {
 		return openwallet.Errorf(openwallet.ErrUnknownException, "%s is not in trust address list", to)
 	}
 
-	key, err := cli.getLocalKeyByWallet(wallet, password)
+	key, err := cli.getSignerKey(wallet, password)
 	if err != nil {
 		return err
 	}
@@ -57,12 +57,20 @@ func (cli *CLI) TransferAll(wallet *openwsdk.Wallet, account *openwsdk.Account,
 		balance = tokenBalance.Balance
 	} else {
 		balance = "0"
-		cli.api.GetBalanceByAccount(symbol, account.AccountID, "",
-			true, func(status uint64, msg string, accBalance *openwsdk.BalanceResult) {
-				if status == owtp.StatusSuccess {
-					balance = accBalance.Balance
-				}
-			})
+		cli.callAPI("GetBalanceByAccount", func() error {
+			var statusErr error
+			err := cli.api.GetBalanceByAccount(symbol, account.AccountID, "",
+				true, func(status uint64, msg string, accBalance *openwsdk.BalanceResult) {
+					statusErr = apiStatusError(status, msg)
+					if status == owtp.StatusSuccess {
+						balance = accBalance.Balance
+					}
+				})
+			if err != nil {
+				return err
+			}
+			return statusErr
+		})
 
 	}
 	coin := openwsdk.Coin{
@@ -71,7 +79,7 @@ func (cli *CLI) TransferAll(wallet *openwsdk.Wallet, account *openwsdk.Account,
 		ContractID: contractID,
 	}
 
-	log.Infof("Summary account[%s] Symbol: %s, token: %s ", account.AccountID, symbol, tokenSymbol)
+	log.Infof("Summary token: %s, %s", tokenSymbol, LogFields("accountID", account.AccountID, "symbol", symbol))
 
 	//汇总账户
 	err = cli.summaryAccount(account, accountTask, key, balance, *accountTask.SummarySetting, coin, "", decimal.Zero)
@@ -87,6 +95,13 @@ func (cli *CLI) SummaryTask() {
 
 	log.Infof("[Summary Task Start]------%s", common.TimeFormat("2006-01-02 15:04:05"))
 
+	start := time.Now()
+	defer func() {
+		cli.Metrics().Inc(MetricSummaryCycles)
+		cli.Metrics().Observe(MetricSummaryCycleDuration, time.Since(start).Seconds())
+		cli.Metrics().Set(MetricSummaryLastCycle, float64(time.Now().Unix()))
+	}()
+
 	//更新币种信息，保证完整
 	cli.UpdateSymbols()
 
@@ -98,15 +113,15 @@ func (cli *CLI) SummaryTask() {
 		if task.Wallet == nil {
 			w, err := cli.GetWalletByWalletIDOnLocal(task.WalletID)
 			if err != nil {
-				log.Errorf("Summary wallet[%s] unexpected error: %v", task.WalletID, err)
+				log.Errorf("Summary wallet unexpected error: %v, %s", err, LogFields("walletID", task.WalletID))
 				continue
 			}
 			task.Wallet = w
 		}
 
-		key, err := cli.getLocalKeyByWallet(task.Wallet, task.Password)
+		key, err := cli.getSignerKey(task.Wallet, task.Password)
 		if err != nil {
-			log.Errorf("Summary wallet[%s] unexpected error: %v", task.WalletID, err)
+			log.Errorf("Summary wallet unexpected error: %v, %s", err, LogFields("walletID", task.WalletID))
 			continue
 		}
 
@@ -120,14 +135,14 @@ func (cli *CLI) SummaryTask() {
 			//汇总账户主币
 			err = cli.SummaryAccountTokenContracts(accountTask, account, key)
 			if err != nil {
-				log.Errorf("Summary wallet[%s] account[%s] token contracts unexpected error: %v", task.WalletID, account.AccountID, err)
+				log.Errorf("Summary token contracts unexpected error: %v, %s", err, LogFields("walletID", task.WalletID, "accountID", account.AccountID))
 			}
 
 			if !accountTask.OnlyContracts {
 				//汇总账户主币
 				err = cli.SummaryAccountMainCoin(accountTask, account, key)
 				if err != nil {
-					log.Errorf("Summary wallet[%s] account[%s] main coin unexpected error: %v", task.WalletID, account.AccountID, err)
+					log.Errorf("Summary main coin unexpected error: %v, %s", err, LogFields("walletID", task.WalletID, "accountID", account.AccountID))
 				}
 			}
 
@@ -148,12 +163,20 @@ func (cli *CLI) SummaryAccountMainCoin(accountTask *openwsdk.SummaryAccountTask,
 		balance = "0"
 	)
 
-	cli.api.GetBalanceByAccount(account.Symbol, account.AccountID, "",
-		true, func(status uint64, msg string, accBalance *openwsdk.BalanceResult) {
-			if status == owtp.StatusSuccess {
-				balance = accBalance.Balance
-			}
-		})
+	cli.callAPI("GetBalanceByAccount", func() error {
+		var statusErr error
+		err := cli.api.GetBalanceByAccount(account.Symbol, account.AccountID, "",
+			true, func(status uint64, msg string, accBalance *openwsdk.BalanceResult) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					balance = accBalance.Balance
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 
 	//读取汇总信息
 	sumSets, err = cli.getSummarySettingByAccount(account.AccountID)
@@ -163,7 +186,7 @@ func (cli *CLI) SummaryAccountMainCoin(accountTask *openwsdk.SummaryAccountTask,
 	}
 
 	if sumSets.SumAddress == "" {
-		log.Errorf("Summary account[%s] summary address is empty!", account.AccountID)
+		log.Errorf("Summary address is empty! %s", LogFields("accountID", account.AccountID))
 		return err
 	}
 
@@ -182,11 +205,11 @@ func (cli *CLI) SummaryAccountMainCoin(accountTask *openwsdk.SummaryAccountTask,
 		IsContract: false,
 	}
 
-	log.Infof("Summary account[%s] Symbol: %s start", account.AccountID, symbol)
+	log.Infof("Summary start, %s", LogFields("accountID", account.AccountID, "symbol", symbol))
 
 	err = cli.summaryAccountProcess(account, accountTask, key, balance, *accountTask.SummarySetting, coin)
 
-	log.Infof("Summary account[%s] Symbol: %s end", account.AccountID, symbol)
+	log.Infof("Summary end, %s", LogFields("accountID", account.AccountID, "symbol", symbol))
 	log.Infof("----------------------------------------------------------------------------------------")
 
 	if err != nil {
@@ -245,7 +268,7 @@ func (cli *CLI) SummaryAccountTokenContracts(accountTask *openwsdk.SummaryAccoun
 	}
 
 	if sumSets.SumAddress == "" {
-		log.Errorf("Summary account[%s] summary address is empty!")
+		log.Errorf("Summary address is empty! %s", LogFields("accountID", account.AccountID))
 		return err
 	}
 
@@ -272,11 +295,11 @@ func (cli *CLI) SummaryAccountTokenContracts(accountTask *openwsdk.SummaryAccoun
 			ContractID: token.ContractID,
 		}
 
-		log.Infof("Summary account[%s] Symbol: %s, token: %s start", account.AccountID, symbol, token.ContractToken)
+		log.Infof("Summary token: %s start, %s", token.ContractToken, LogFields("accountID", account.AccountID, "symbol", symbol))
 
 		err = cli.summaryAccountProcess(account, accountTask, key, token.Balance, *contrackTask.SummarySetting, coin)
 
-		log.Infof("Summary account[%s] Symbol: %s, token: %s end", account.AccountID, symbol, token.ContractToken)
+		log.Infof("Summary token: %s end, %s", token.ContractToken, LogFields("accountID", account.AccountID, "symbol", symbol))
 
 		if err != nil {
 			continue
@@ -297,7 +320,7 @@ func (cli *CLI) summaryAccountProcess(account *openwsdk.Account, task *openwsdk.
 	balanceDec, _ := decimal.NewFromString(balance)
 	threshold, _ := decimal.NewFromString(sumSets.Threshold)
 
-	log.Infof("Summary account[%s] Current Balance: %v, threshold: %v", account.AccountID, balance, threshold)
+	log.Infof("Summary Current Balance: %v, threshold: %v, %s", balance, threshold, LogFields("accountID", account.AccountID))
 
 	// 查询手续费账户是否存在，是否在当前钱包下，相同的symbol，并且检查手续费账户余额是否报警
 	if task.FeesSupportAccount != nil && coin.IsContract {
@@ -324,19 +347,38 @@ func (cli *CLI) summaryAccountProcess(account *openwsdk.Account, task *openwsdk.
 		} else {
 			//主币作为手续费
 			feesSupportBalance = decimal.Zero
-			cli.api.GetBalanceByAccount(feesSupportAccounInfo.Symbol, feesSupportAccounInfo.AccountID, "",
-				true, func(status uint64, msg string, balance *openwsdk.BalanceResult) {
-					if status == owtp.StatusSuccess {
-						feesSupportBalance, _ = decimal.NewFromString(balance.Balance)
-					}
-				})
+			cli.callAPI("GetBalanceByAccount", func() error {
+				var statusErr error
+				err := cli.api.GetBalanceByAccount(feesSupportAccounInfo.Symbol, feesSupportAccounInfo.AccountID, "",
+					true, func(status uint64, msg string, balance *openwsdk.BalanceResult) {
+						statusErr = apiStatusError(status, msg)
+						if status == owtp.StatusSuccess {
+							feesSupportBalance, _ = decimal.NewFromString(balance.Balance)
+						}
+					})
+				if err != nil {
+					return err
+				}
+				return statusErr
+			})
 
 		}
 
+		supportBalance, _ := feesSupportBalance.Float64()
+		cli.Metrics().Set(MetricFeesSupportBalance, supportBalance, feesSupportAccountID, feesSupportSymbol)
+
 		lowBalanceWarning, _ := decimal.NewFromString(task.FeesSupportAccount.LowBalanceWarning)
 		lowBalanceStop, _ := decimal.NewFromString(task.FeesSupportAccount.LowBalanceStop)
 		if feesSupportBalance.LessThan(lowBalanceWarning) {
 			log.Warningf("fees support account balance: %s is less then %s", feesSupportBalance.String(), lowBalanceWarning.String())
+			cli.notifyLimited(feesSupportAccountID+"/"+feesSupportSymbol, notifyLowBalanceInterval, NotifyEventFeesSupportLowBalance, map[string]interface{}{
+				"accountID":         feesSupportAccountID,
+				"symbol":            feesSupportSymbol,
+				"balance":           feesSupportBalance.String(),
+				"lowBalanceWarning": lowBalanceWarning.String(),
+				"lowBalanceStop":    lowBalanceStop.String(),
+				"stopped":           feesSupportBalance.LessThan(lowBalanceStop),
+			})
 		}
 		if feesSupportBalance.LessThan(lowBalanceStop) {
 			return fmt.Errorf("fees support account: %s stop work", feesSupportBalance.String())
@@ -368,6 +410,12 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 		retRawTxs            []*openwsdk.RawTransaction
 		retRawFeesSupportTxs []*openwsdk.RawTransaction
 		addressLimit         = 0
+		//本次汇总的统计，完成后通知
+		sumSuccessCount = 0
+		sumFailCount    = 0
+		sumAmount       = decimal.Zero
+		sumFees         = decimal.Zero
+		sumTxIDs        = make([]string, 0)
 	)
 
 	_, err = cli.getDB()
@@ -376,9 +424,9 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 	}
 	defer cli.closeDB()
 
-	log.Infof("Summary account[%s] Current Balance = %v ", account.AccountID, balance)
-	log.Infof("Summary account[%s] Summary Address = %v ", account.AccountID, sumSets.SumAddress)
-	log.Infof("Summary account[%s] Start Create Summary Transaction", account.AccountID)
+	log.Infof("Summary Current Balance = %v, %s", balance, LogFields("accountID", account.AccountID))
+	log.Infof("Summary Address = %v, %s", sumSets.SumAddress, LogFields("accountID", account.AccountID))
+	log.Infof("Summary Start Create Summary Transaction, %s", LogFields("accountID", account.AccountID))
 
 	if sumSets.AddressLimit == 0 {
 		addressLimit = defaultLimit
@@ -399,37 +447,45 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 
 		//:记录汇总批次号
 		sid := uuid.New().String()
-		log.Infof("SID: %s", sid)
-		err = cli.api.CreateSummaryTx(account.AccountID, sumSets.SumAddress, coin,
-			task.FeeRate, sumSets.MinTransfer, sumSets.RetainedBalance,
-			i, addressLimit, sumSets.Confirms, sid, task.FeesSupportAccount, task.Memo, true,
-			func(status uint64, msg string, rawTxs []*openwsdk.RawTransaction) {
-				log.Debugf("status: %d, msg: %s", status, msg)
-				for _, rawTx := range rawTxs {
-					//log.Debugf("rawTx.ErrorMsg: %s", rawTx.ErrorMsg.Err)
-					if rawTx.ErrorMsg != nil && rawTx.ErrorMsg.Code != "" {
-						log.Warning(rawTx.ErrorMsg.Err)
-					} else {
-
-						switch rawTx.AccountID {
-						case account.AccountID:
-							retRawTxs = append(retRawTxs, rawTx)
-						case feesSupportAccountID:
-							retRawFeesSupportTxs = append(retRawFeesSupportTxs, rawTx)
-						}
-						//if rawTx.AccountID == feesSupportAccountID {
-						//	retRawFeesSupportTxs = append(retRawFeesSupportTxs, rawTx)
-						//	log.Notice("create fees support account transaction for summary task")
-						//}
+		log.Infof("%s", LogFields("sid", sid))
+		err = cli.callAPI("CreateSummaryTx", func() error {
+			var statusErr error
+			err := cli.api.CreateSummaryTx(account.AccountID, sumSets.SumAddress, coin,
+				task.FeeRate, sumSets.MinTransfer, sumSets.RetainedBalance,
+				i, addressLimit, sumSets.Confirms, sid, task.FeesSupportAccount, task.Memo, true,
+				func(status uint64, msg string, rawTxs []*openwsdk.RawTransaction) {
+					statusErr = apiStatusError(status, msg)
+					log.Debugf("status: %d, msg: %s", status, msg)
+					for _, rawTx := range rawTxs {
+						//log.Debugf("rawTx.ErrorMsg: %s", rawTx.ErrorMsg.Err)
+						if rawTx.ErrorMsg != nil && rawTx.ErrorMsg.Code != "" {
+							log.Warning(rawTx.ErrorMsg.Err)
+						} else {
+
+							switch rawTx.AccountID {
+							case account.AccountID:
+								retRawTxs = append(retRawTxs, rawTx)
+							case feesSupportAccountID:
+								retRawFeesSupportTxs = append(retRawFeesSupportTxs, rawTx)
+							}
+							//if rawTx.AccountID == feesSupportAccountID {
+							//	retRawFeesSupportTxs = append(retRawFeesSupportTxs, rawTx)
+							//	log.Notice("create fees support account transaction for summary task")
+							//}
 
-						//retRawTxs = append(retRawTxs, rawTx)
+							//retRawTxs = append(retRawTxs, rawTx)
+						}
 					}
-				}
 
-				if status != owtp.StatusSuccess {
-					createErr = fmt.Errorf(msg)
-				}
-			})
+					if status != owtp.StatusSuccess {
+						createErr = fmt.Errorf(msg)
+					}
+				})
+			if err != nil {
+				return err
+			}
+			return statusErr
+		})
 
 		if err != nil {
 			log.Warn("CreateSummaryTransaction unexpected error: %v", err)
@@ -451,24 +507,9 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 			for _, rawTx := range retRawTxs {
 
 				//签名交易
-				signatures, sigErr := cli.txSigner(rawTx.Signatures, key)
+				signatures, sigErr := cli.signRawTransaction(rawTx, key)
 				if sigErr != nil {
-					for accountID, signatures := range rawTx.Signatures {
-						log.Error("[Sign Failed] sign accountID: %s", accountID)
-						for _, keySignature := range signatures {
-							signaturesJSON, jsonErr := json.Marshal(keySignature)
-							if jsonErr == nil {
-								log.Warningf("[Failed] keySignature: %s", string(signaturesJSON))
-							}
-							//childKey, _ := key.DerivedKeyWithPath(keySignature.DerivedPath, keySignature.EccType)
-							//keyBytes, _ := childKey.GetPrivateKeyBytes()
-							//hexKey := hex.EncodeToString(keyBytes)
-							//public_key, _ := owcrypt.GenPubkey(keyBytes, keySignature.EccType)
-							//public := hex.EncodeToString(public_key)
-							//log.Warningf("[Failed] Pub: %s", string(public))
-							//log.Warningf("[Failed] Key: %s", string(hexKey))
-						}
-					}
+					logFailedSignatures("", rawTx.Signatures)
 					log.Warn("SignRawTransaction unexpected error: %v", sigErr)
 					continue
 				}
@@ -493,18 +534,26 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 			}
 
 			//	广播交易单
-			err = cli.api.SubmitTrade(signedRawTxs, true,
-				func(status uint64, msg string, successTx []*openwsdk.Transaction, failedRawTxs []*openwsdk.FailedRawTransaction) {
-
-					//log.Debugf("status: %d, msg: %s", status, msg)
-					if status != owtp.StatusSuccess {
-						createErr = fmt.Errorf(msg)
-						return
-					}
+			err = cli.callAPI("SubmitTrade", func() error {
+				var statusErr error
+				err := cli.api.SubmitTrade(signedRawTxs, true,
+					func(status uint64, msg string, successTx []*openwsdk.Transaction, failedRawTxs []*openwsdk.FailedRawTransaction) {
+						statusErr = apiStatusError(status, msg)
+
+						//log.Debugf("status: %d, msg: %s", status, msg)
+						if status != owtp.StatusSuccess {
+							createErr = fmt.Errorf(msg)
+							return
+						}
 
-					retTx = successTx
-					retFailed = failedRawTxs
-				})
+						retTx = successTx
+						retFailed = failedRawTxs
+					})
+				if err != nil {
+					return err
+				}
+				return statusErr
+			})
 			if err != nil {
 				log.Warningf("SubmitRawTransaction unexpected error: %v", err)
 				continue
@@ -521,7 +570,7 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 			for _, tx := range retTx {
 
 				//只计算汇总账户的 总的汇总数量，手续费
-				log.Infof("[Success] txid: %s", tx.TxID)
+				log.Infof("[Success] %s", LogFields("txid", tx.TxID))
 
 				fees, _ := decimal.NewFromString(tx.Fees)
 
@@ -540,28 +589,31 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 			for _, tx := range retFailed {
 				log.Warningf("[Failed] reason: %s", tx.Reason)
 				if tx.RawTx != nil {
-					log.Warningf("[Failed] rawHex: %s", tx.RawTx.RawHex)
-					for accountID, signatures := range tx.RawTx.Signatures {
-						log.Warningf("[Failed] signature accountID: %s", accountID)
-						for _, keySignature := range signatures {
-							signaturesJSON, jsonErr := json.Marshal(keySignature)
-							if jsonErr == nil {
-								log.Warningf("[Failed] keySignature: %s", string(signaturesJSON))
-							}
-							//childKey, _ := key.DerivedKeyWithPath(keySignature.DerivedPath, keySignature.EccType)
-							//keyBytes, _ := childKey.GetPrivateKeyBytes()
-							//hexKey := hex.EncodeToString(keyBytes)
-							//public_key, _ := owcrypt.GenPubkey(keyBytes, keySignature.EccType)
-							//public := hex.EncodeToString(public_key)
-							//log.Warningf("[Failed] Pub: %s", string(public))
-							//log.Warningf("[Failed] Key: %s", string(hexKey))
-						}
-					}
+					logFailedSignatures(tx.RawTx.RawHex, tx.RawTx.Signatures)
 				}
 			}
 
-			//:记录汇总情况
-			totalSumAmount = totalSumAmount.Sub(totalCostFees)
+			//:记录汇总情况，代币的手续费是主币，不能从汇总数量中扣除
+			if !coin.IsContract {
+				totalSumAmount = totalSumAmount.Sub(totalCostFees)
+			}
+
+			//计数器只能增加，手续费大于汇总数量时不计入
+			sweptAmount := float64(0)
+			if totalSumAmount.IsPositive() {
+				sweptAmount, _ = totalSumAmount.Float64()
+			}
+			costFees, _ := totalCostFees.Float64()
+			cli.Metrics().Add(MetricSummaryTransactions, float64(len(retTx)), coin.Symbol, coin.ContractID, MetricStatusSuccess)
+			cli.Metrics().Add(MetricSummaryTransactions, float64(len(retFailed)), coin.Symbol, coin.ContractID, MetricStatusFailed)
+			cli.Metrics().Add(MetricSummarySweptAmount, sweptAmount, coin.Symbol, coin.ContractID)
+			cli.Metrics().Add(MetricSummaryFees, costFees, coin.Symbol, coin.ContractID)
+
+			sumSuccessCount += len(retTx)
+			sumFailCount += len(retFailed)
+			sumAmount = sumAmount.Add(totalSumAmount)
+			sumFees = sumFees.Add(totalCostFees)
+			sumTxIDs = append(sumTxIDs, txIDs...)
 			summaryTaskLog := openwsdk.SummaryTaskLog{
 				Sid:            sid,
 				WalletID:       account.WalletID,
@@ -594,7 +646,7 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 			signedRawTxs := make([]*openwsdk.RawTransaction, 0)
 			for _, rawTx := range retRawFeesSupportTxs {
 				//签名交易
-				signatures, sigErr := cli.txSigner(rawTx.Signatures, key)
+				signatures, sigErr := cli.signRawTransaction(rawTx, key)
 				if sigErr != nil {
 					log.Warn("SignRawTransaction unexpected error: %v", sigErr)
 					continue
@@ -608,16 +660,24 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 			}
 
 			//	广播交易单
-			err = cli.api.SubmitTrade(signedRawTxs, true,
-				func(status uint64, msg string, successTx []*openwsdk.Transaction, failedRawTxs []*openwsdk.FailedRawTransaction) {
-					if status != owtp.StatusSuccess {
-						createErr = fmt.Errorf(msg)
-						return
-					}
+			err = cli.callAPI("SubmitTrade", func() error {
+				var statusErr error
+				err := cli.api.SubmitTrade(signedRawTxs, true,
+					func(status uint64, msg string, successTx []*openwsdk.Transaction, failedRawTxs []*openwsdk.FailedRawTransaction) {
+						statusErr = apiStatusError(status, msg)
+						if status != owtp.StatusSuccess {
+							createErr = fmt.Errorf(msg)
+							return
+						}
 
-					retTx = successTx
-					retFailed = failedRawTxs
-				})
+						retTx = successTx
+						retFailed = failedRawTxs
+					})
+				if err != nil {
+					return err
+				}
+				return statusErr
+			})
 			if err != nil {
 				log.Warningf("SubmitRawTransaction unexpected error: %v", err)
 				continue
@@ -645,6 +705,21 @@ func (cli *CLI) summaryAccount(account *openwsdk.Account, task *openwsdk.Summary
 		}
 	}
 
+	if sumSuccessCount+sumFailCount > 0 {
+		cli.Notify(NotifyEventSummaryCompleted, map[string]interface{}{
+			"walletID":       account.WalletID,
+			"accountID":      account.AccountID,
+			"symbol":         coin.Symbol,
+			"contractID":     coin.ContractID,
+			"sumAddress":     sumSets.SumAddress,
+			"successCount":   sumSuccessCount,
+			"failCount":      sumFailCount,
+			"totalSumAmount": sumAmount.String(),
+			"totalCostFees":  sumFees.String(),
+			"txids":          sumTxIDs,
+		})
+	}
+
 	return nil
 }
 
@@ -652,7 +727,7 @@ func (cli *CLI) signSummaryRawTransaction(retRawTxs []*openwsdk.RawTransaction,
 	signedRawTxs := make([]*openwsdk.RawTransaction, 0)
 	for _, rawTx := range retRawTxs {
 		//签名交易
-		signatures, sigErr := cli.txSigner(rawTx.Signatures, key)
+		signatures, sigErr := cli.signRawTransaction(rawTx, key)
 		if sigErr != nil {
 			log.Warn("SignRawTransaction unexpected error: %v", sigErr)
 			return nil, sigErr
@@ -697,7 +772,7 @@ func (cli *CLI) checkSummaryTaskIsHaveSettings(task *openwsdk.SummaryTask) error
 		}
 
 		//解锁密码是否正确
-		_, err = cli.getLocalKeyByWallet(wallet, w.Password)
+		_, err = cli.getSignerKey(wallet, w.Password)
 		if err != nil {
 			return fmt.Errorf("unlock wallet with ID: %s, failedpassword is invalid", w.WalletID)
 		}
@@ -718,7 +793,7 @@ func (cli *CLI) checkSummaryTaskIsHaveSettings(task *openwsdk.SummaryTask) error
 			}
 
 			if sumSets.SumAddress == "" {
-				log.Errorf("Summary account[%s] summary address is empty!", account.AccountID)
+				log.Errorf("Summary address is empty! %s", LogFields("accountID", account.AccountID))
 				return err
 			}
 
@@ -792,13 +867,13 @@ func (cli *CLI) appendSummaryTasks(sums *openwsdk.SummaryTask) {
 					}
 				} else {
 					executingWallet.Accounts = append(executingWallet.Accounts, newAccountTask)
-					log.Infof("Summary account[%s] task has been appended ", newAccountTask.AccountID)
+					log.Infof("Summary task has been appended, %s", LogFields("accountID", newAccountTask.AccountID))
 				}
 			}
 
 		} else {
 			cli.summaryTask.Wallets = append(cli.summaryTask.Wallets, newWalletTask)
-			log.Infof("Summary wallet[%s] task has been appended ", newWalletTask.WalletID)
+			log.Infof("Summary task has been appended, %s", LogFields("walletID", newWalletTask.WalletID))
 		}
 	}
 
@@ -815,12 +890,12 @@ func (cli *CLI) removeSummaryWalletTasks(walletID string, accountID string) {
 			if executingAccount != nil {
 				//移除汇总账户任务
 				executingWallet.Accounts = append(executingWallet.Accounts[:indexAccount], executingWallet.Accounts[indexAccount+1:]...)
-				log.Infof("Summary account[%s] task has been removed ", accountID)
+				log.Infof("Summary task has been removed, %s", LogFields("accountID", accountID))
 			}
 		} else {
 			//移除汇总钱包任务
 			cli.summaryTask.Wallets = append(cli.summaryTask.Wallets[:indexWallet], cli.summaryTask.Wallets[indexWallet+1:]...)
-			log.Infof("Summary wallet[%s] task has been removed ", walletID)
+			log.Infof("Summary task has been removed, %s", LogFields("walletID", walletID))
 		}
 	}
 }
@@ -862,5 +937,126 @@ func (cli *CLI) getSummarySettingByAccount(accountID string) (*openwsdk.SummaryS
 		return nil, err
 	}
 
+	err = cli.decryptSummarySettings(&sumSets)
+	if err != nil {
+		return nil, err
+	}
+
 	return &sumSets, nil
 }
+
+// isSummaryTaskRunning 汇总任务定时器是否运行中
+func (cli *CLI) isSummaryTaskRunning() bool {
+	return cli.summaryTaskTimer != nil && cli.summaryTaskTimer.Running()
+}
+
+// startSummaryTimer 启动汇总任务定时器，并马上执行一次汇总
+func (cli *CLI) startSummaryTimer(cycle time.Duration) {
+
+	log.Infof("The timer for summary task start now. Execute by every %v seconds.", cycle.Seconds())
+
+	//启动钱包汇总程序
+	sumTask := cli.superviseJob("summary", cycle, cli.SummaryTask)
+	sumTimer := timer.NewTask(cycle, sumTask)
+	sumTimer.Start()
+	cli.summaryTaskTimer = sumTimer
+
+	//马上执行一次汇总
+	go sumTask()
+}
+
+// StartSummaryTask 重置或追加汇总任务，定时器没有运行时按cycle启动
+func (cli *CLI) StartSummaryTask(summaryTask *openwsdk.SummaryTask, operateType int64, cycle time.Duration) *openwallet.Error {
+
+	if cycle <= 0 {
+		return openwallet.Errorf(openwallet.ErrUnknownException, "cycleSec must be greater than 0")
+	}
+
+	//:先检查汇总任务是否有汇总配置
+	err := cli.checkSummaryTaskIsHaveSettings(summaryTask)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrUnknownException, err.Error())
+	}
+
+	switch operateType {
+	case openwsdk.SummaryTaskOperateTypeReset:
+
+		cli.mu.Lock()
+		cli.summaryTask = summaryTask
+		cli.mu.Unlock()
+
+	case openwsdk.SummaryTaskOperateTypeAdd:
+		cli.appendSummaryTasks(summaryTask)
+	}
+
+	if cli.isSummaryTaskRunning() {
+		log.Warning("summary task timer is running")
+		return nil
+	}
+
+	cli.startSummaryTimer(cycle)
+
+	return nil
+}
+
+// StopSummaryTask 停止汇总任务定时器
+func (cli *CLI) StopSummaryTask() {
+
+	if cli.isSummaryTaskRunning() {
+		cli.summaryTaskTimer.Stop()
+		cli.summaryTaskTimer = nil
+	}
+
+	log.Infof("The timer for summary task has been stopped.")
+}
+
+// AppendSummaryTask 追加运行中的汇总任务
+func (cli *CLI) AppendSummaryTask(summaryTask *openwsdk.SummaryTask) *openwallet.Error {
+
+	if !cli.isSummaryTaskRunning() {
+		return openwallet.Errorf(ErrorSummaryTaskTimerIsNotStart, "summary task timer is not start")
+	}
+
+	//:先检查汇总任务是否有汇总配置
+	err := cli.checkSummaryTaskIsHaveSettings(summaryTask)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrUnknownException, err.Error())
+	}
+
+	cli.appendSummaryTasks(summaryTask)
+
+	return nil
+}
+
+// RemoveSummaryTask 从运行中的汇总任务移除钱包或账户
+func (cli *CLI) RemoveSummaryTask(walletID, accountID string) *openwallet.Error {
+
+	if !cli.isSummaryTaskRunning() {
+		return openwallet.Errorf(ErrorSummaryTaskTimerIsNotStart, "summary task timer is not start")
+	}
+
+	cli.removeSummaryWalletTasks(walletID, accountID)
+
+	return nil
+}
+
+// CurrentSummaryTask 运行中的汇总任务，不包含钱包密码
+func (cli *CLI) CurrentSummaryTask() (*openwsdk.SummaryTask, *openwallet.Error) {
+
+	if !cli.isSummaryTaskRunning() {
+		return nil, openwallet.Errorf(ErrorSummaryTaskTimerIsNotStart, "summary task timer is not start")
+	}
+
+	cli.mu.RLock()
+	defer cli.mu.RUnlock()
+
+	retTask := openwsdk.SummaryTask{Wallets: make([]*openwsdk.SummaryWalletTask, 0)}
+	for _, wt := range cli.summaryTask.Wallets {
+		newWt := *wt
+		newWt.Password = ""
+		newWt.Wallet = nil
+		retTask.Wallets = append(retTask.Wallets, &newWt)
+	}
+
+	return &retTask, nil
+}
@@ -1,7 +1,6 @@
 package openwcli
 
 import (
-	"encoding/json"
 	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
@@ -11,12 +10,20 @@ import (
 // GetTokenBalance 获取代币余额
 func (cli *CLI) GetTokenBalance(account *openwsdk.Account, contractID string) string {
 	getBalance := "0"
-	cli.api.GetBalanceByAccount(account.Symbol, account.AccountID, contractID, true,
-		func(status uint64, msg string, balance *openwsdk.BalanceResult) {
-			if status == owtp.StatusSuccess {
-				getBalance = balance.Balance
-			}
-		})
+	cli.callAPI("GetBalanceByAccount", func() error {
+		var statusErr error
+		err := cli.api.GetBalanceByAccount(account.Symbol, account.AccountID, contractID, true,
+			func(status uint64, msg string, balance *openwsdk.BalanceResult) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					getBalance = balance.Balance
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	return getBalance
 }
 
@@ -32,15 +39,23 @@ func (cli *CLI) GetTokenBalanceByContractAddress(account *openwsdk.Account, symb
 		return nil, findErr
 	}
 	contractID := token[0].ContractID
-	err := cli.api.GetBalanceByAccount(symbol, account.AccountID, contractID, true,
-		func(status uint64, msg string, balance *openwsdk.BalanceResult) {
-			if status == owtp.StatusSuccess {
-				getBalance = balance
-				getBalance.ContractToken = token[0].Token
-			} else {
-				callErr = openwallet.Errorf(status, msg)
-			}
-		})
+	err := cli.callAPI("GetBalanceByAccount", func() error {
+		var statusErr error
+		err := cli.api.GetBalanceByAccount(symbol, account.AccountID, contractID, true,
+			func(status uint64, msg string, balance *openwsdk.BalanceResult) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					getBalance = balance
+					getBalance.ContractToken = token[0].Token
+				} else {
+					callErr = openwallet.Errorf(status, msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -56,64 +71,45 @@ func (cli *CLI) Transfer(wallet *openwsdk.Wallet, account *openwsdk.Account, sym
 }
 
 // TransferExt 转账交易 + 扩展参数
-func (cli *CLI) TransferExt(wallet *openwsdk.Wallet, account *openwsdk.Account, symbol, contractAddress, to, amount, sid, feeRate, memo, extParam, password string) ([]*openwsdk.Transaction, []*openwsdk.FailedRawTransaction, *openwallet.Error) {
+func (cli *CLI) TransferExt(wallet *openwsdk.Wallet, account *openwsdk.Account, symbol, contractAddress, to, amount, sid, feeRate, memo, extParam, password string) (retTx []*openwsdk.Transaction, retFailed []*openwsdk.FailedRawTransaction, transferErr *openwallet.Error) {
 
 	var (
-		isContract  bool
-		retTx       []*openwsdk.Transaction
-		retFailed   []*openwsdk.FailedRawTransaction
 		retRawTx    *openwsdk.RawTransaction
 		err         error
 		createErr   *openwallet.Error
-		contractID  string
 		tokenSymbol string
+		status      = MetricStatusFailed
 	)
 
+	defer func() {
+		cli.Metrics().Inc(MetricTransfers, symbol, contractAddress, status)
+		if status == MetricStatusFailed && transferErr != nil {
+			cli.Notify(NotifyEventTransferFailed, map[string]interface{}{
+				"sid":             sid,
+				"walletID":        account.WalletID,
+				"accountID":       account.AccountID,
+				"symbol":          symbol,
+				"contractAddress": contractAddress,
+				"to":              to,
+				"amount":          amount,
+				"reason":          transferErr.Error(),
+			})
+		}
+	}()
+
 	//:检查目标地址是否信任名单
-	if !cli.IsTrustAddress(to, symbol) {
+	if !cli.checkTrustAddress(to, symbol) {
+		status = MetricStatusRejected
 		return nil, nil, openwallet.Errorf(openwallet.ErrUnknownException, "%s is not in trust address list", to)
 	}
 
-	if len(password) == 0 {
-		return nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "unlock wallet password is empty. ")
-	}
-
 	//获取种子文件
-	key, err := cli.getLocalKeyByWallet(wallet, password)
+	key, err := cli.getSignerKey(wallet, password)
 	if err != nil {
 		return nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, err.Error())
 	}
 
-	if len(contractAddress) > 0 {
-		isContract = true
-		token, findErr := cli.GetTokenContractList("Symbol", symbol, "Address", contractAddress)
-		if findErr != nil {
-			return nil, nil, openwallet.ConvertError(findErr)
-		}
-		if len(token) == 0 {
-			return nil, nil, openwallet.Errorf(openwallet.ErrSystemException, "can not find contract address")
-		}
-		contractID = token[0].ContractID
-		tokenSymbol = token[0].Token
-	}
-	coin := openwsdk.Coin{
-		Symbol:     symbol,
-		IsContract: isContract,
-		ContractID: contractID,
-	}
-
-	api := cli.api
-	err = api.CreateTrade(account.AccountID, sid, coin, map[string]string{to: amount}, feeRate, memo, extParam, true,
-		func(status uint64, msg string, rawTx *openwsdk.RawTransaction) {
-			if status != owtp.StatusSuccess {
-				createErr = openwallet.Errorf(status, msg)
-				return
-			}
-			retRawTx = rawTx
-		})
-	if err != nil {
-		return nil, nil, openwallet.ConvertError(err)
-	}
+	retRawTx, tokenSymbol, createErr = cli.createTransferRawTx(account, symbol, contractAddress, to, amount, sid, feeRate, memo, extParam)
 	if createErr != nil {
 		return nil, nil, createErr
 	}
@@ -121,7 +117,7 @@ func (cli *CLI) TransferExt(wallet *openwsdk.Wallet, account *openwsdk.Account,
 	//:打印交易单明细
 	log.Infof("-----------------------------------------------")
 	log.Infof("[%s %s Transfer]", symbol, tokenSymbol)
-	log.Infof("SID: %s", retRawTx.Sid)
+	log.Infof("%s", LogFields("sid", retRawTx.Sid))
 	log.Infof("From Account: %s", account.AccountID)
 	log.Infof("To Address: %s", to)
 	log.Infof("Send Amount: %s", amount)
@@ -131,23 +127,31 @@ func (cli *CLI) TransferExt(wallet *openwsdk.Wallet, account *openwsdk.Account,
 	log.Infof("-----------------------------------------------")
 
 	//签名交易单
-	signatures, sigErr := cli.txSigner(retRawTx.Signatures, key)
+	signatures, sigErr := cli.signRawTransaction(retRawTx, key)
 	if sigErr != nil {
 		return nil, nil, openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, sigErr.Error())
 	}
 	retRawTx.Signatures = signatures
 
 	//广播交易单
-	err = api.SubmitTrade([]*openwsdk.RawTransaction{retRawTx}, true,
-		func(status uint64, msg string, successTx []*openwsdk.Transaction, failedRawTxs []*openwsdk.FailedRawTransaction) {
-			if status != owtp.StatusSuccess {
-				createErr = openwallet.Errorf(status, msg)
-				return
-			}
-
-			retTx = successTx
-			retFailed = failedRawTxs
-		})
+	err = cli.callAPI("SubmitTrade", func() error {
+		var statusErr error
+		err := cli.api.SubmitTrade([]*openwsdk.RawTransaction{retRawTx}, true,
+			func(status uint64, msg string, successTx []*openwsdk.Transaction, failedRawTxs []*openwsdk.FailedRawTransaction) {
+				statusErr = apiStatusError(status, msg)
+				if status != owtp.StatusSuccess {
+					createErr = openwallet.Errorf(status, msg)
+					return
+				}
+
+				retTx = successTx
+				retFailed = failedRawTxs
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, nil, openwallet.ConvertError(err)
 	}
@@ -158,27 +162,86 @@ func (cli *CLI) TransferExt(wallet *openwsdk.Wallet, account *openwsdk.Account,
 	if len(retTx) > 0 {
 		//打印交易单
 		log.Info("send transaction successfully.")
-		log.Info("transaction id:", retTx[0].TxID)
+		log.Infof("transaction has been sent, %s", LogFields("txid", retTx[0].TxID))
+		cli.Notify(NotifyEventTransferSent, map[string]interface{}{
+			"sid":             retRawTx.Sid,
+			"walletID":        account.WalletID,
+			"accountID":       account.AccountID,
+			"symbol":          symbol,
+			"contractAddress": contractAddress,
+			"to":              to,
+			"amount":          amount,
+			"txid":            retTx[0].TxID,
+			"fees":            retTx[0].Fees,
+		})
 	} else if len(retFailed) > 0 {
 		//打印交易单
 		log.Errorf("send transaction failed.")
 		tx := retFailed[0]
 		log.Warningf("[Failed] reason: %s", tx.Reason)
 		if tx.RawTx != nil {
-			log.Warningf("[Failed] rawHex: %s", tx.RawTx.RawHex)
-			for accountID, signatures := range tx.RawTx.Signatures {
-				log.Warningf("[Failed] signature accountID: %s", accountID)
-				for _, keySignature := range signatures {
-					signaturesJSON, jsonErr := json.Marshal(keySignature)
-					if jsonErr == nil {
-						log.Warningf("[Failed] keySignature: %s", string(signaturesJSON))
-					}
-				}
-			}
+			logFailedSignatures(tx.RawTx.RawHex, tx.RawTx.Signatures)
 		}
 
 		return retTx, retFailed, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, tx.Reason)
 	}
 
+	status = MetricStatusSuccess
+
 	return retTx, retFailed, nil
 }
+
+// createTransferRawTx 创建转账交易单，返回待签名的交易单和代币symbol
+func (cli *CLI) createTransferRawTx(account *openwsdk.Account, symbol, contractAddress, to, amount, sid, feeRate, memo, extParam string) (*openwsdk.RawTransaction, string, *openwallet.Error) {
+
+	var (
+		isContract  bool
+		retRawTx    *openwsdk.RawTransaction
+		createErr   *openwallet.Error
+		contractID  string
+		tokenSymbol string
+	)
+
+	if len(contractAddress) > 0 {
+		isContract = true
+		token, findErr := cli.GetTokenContractList("Symbol", symbol, "Address", contractAddress)
+		if findErr != nil {
+			return nil, "", openwallet.ConvertError(findErr)
+		}
+		if len(token) == 0 {
+			return nil, "", openwallet.Errorf(openwallet.ErrSystemException, "can not find contract address")
+		}
+		contractID = token[0].ContractID
+		tokenSymbol = token[0].Token
+	}
+	coin := openwsdk.Coin{
+		Symbol:     symbol,
+		IsContract: isContract,
+		ContractID: contractID,
+	}
+
+	err := cli.callAPI("CreateTrade", func() error {
+		var statusErr error
+		err := cli.api.CreateTrade(account.AccountID, sid, coin, map[string]string{to: amount}, feeRate, memo, extParam, true,
+			func(status uint64, msg string, rawTx *openwsdk.RawTransaction) {
+				statusErr = apiStatusError(status, msg)
+				if status != owtp.StatusSuccess {
+					createErr = openwallet.Errorf(status, msg)
+					return
+				}
+				retRawTx = rawTx
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
+	if err != nil {
+		return nil, "", openwallet.ConvertError(err)
+	}
+	if createErr != nil {
+		return nil, "", createErr
+	}
+
+	return retRawTx, tokenSymbol, nil
+}
@@ -0,0 +1,203 @@
+package openwcli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/owtp"
+)
+
+// TrustPermission 授信服务调用路由需要的权限
+type TrustPermission int
+
+const (
+	TrustPermissionNone                TrustPermission = iota //无需额外权限
+	TrustPermissionTransfer                                   //需要开启enablerequesttransfer
+	TrustPermissionExecuteSummaryTask                         //需要开启enableexecutesummarytask
+	TrustPermissionEditSummarySettings                        //需要开启enableeditsummarysettings
+)
+
+// String 权限名称
+func (p TrustPermission) String() string {
+	switch p {
+	case TrustPermissionTransfer:
+		return "transfer"
+	case TrustPermissionExecuteSummaryTask:
+		return "execute summary task"
+	case TrustPermissionEditSummarySettings:
+		return "edit summary settings"
+	default:
+		return "none"
+	}
+}
+
+// TrustRoute 托管节点提供给授信服务的路由
+type TrustRoute struct {
+	Name       string
+	Permission TrustPermission
+	handler    owtp.HandlerFunc
+}
+
+// TrustMiddleware 路由中间件，返回false表示已响应请求，不再继续执行
+type TrustMiddleware func(ctx *owtp.Context, route *TrustRoute) bool
+
+// RegisterTrustRoute 注册授信服务路由，同名路由会被覆盖，所有路由统一经过中间件检查
+func (cli *CLI) RegisterTrustRoute(name string, handler owtp.HandlerFunc, permission TrustPermission) error {
+
+	if len(name) == 0 {
+		return fmt.Errorf("trust route name is empty")
+	}
+
+	if handler == nil {
+		return fmt.Errorf("trust route: %s handler is nil", name)
+	}
+
+	route := &TrustRoute{
+		Name:       name,
+		Permission: permission,
+		handler:    handler,
+	}
+
+	cli.routeMu.Lock()
+	if _, exist := cli.trustRoutes[name]; !exist {
+		cli.trustRouteNames = append(cli.trustRouteNames, name)
+	}
+	cli.trustRoutes[name] = route
+	cli.routeMu.Unlock()
+
+	//节点已启动，直接绑定
+	if cli.transmitNode != nil {
+		cli.transmitNode.HandleFunc(name, cli.wrapTrustRoute(name))
+	}
+
+	return nil
+}
+
+// UseTrustMiddleware 添加路由中间件，在内置的权限和appID检查之后执行
+func (cli *CLI) UseTrustMiddleware(middleware TrustMiddleware) {
+	cli.routeMu.Lock()
+	cli.trustMiddlewares = append(cli.trustMiddlewares, middleware)
+	cli.routeMu.Unlock()
+}
+
+// TrustRoutes 已注册的路由
+func (cli *CLI) TrustRoutes() []*TrustRoute {
+	cli.routeMu.RLock()
+	defer cli.routeMu.RUnlock()
+
+	routes := make([]*TrustRoute, 0, len(cli.trustRouteNames))
+	for _, name := range cli.trustRouteNames {
+		routes = append(routes, cli.trustRoutes[name])
+	}
+	return routes
+}
+
+// bindTrustRoutes 绑定所有已注册的路由到节点
+func (cli *CLI) bindTrustRoutes(node *owtp.OWTPNode) {
+	for _, route := range cli.TrustRoutes() {
+		node.HandleFunc(route.Name, cli.wrapTrustRoute(route.Name))
+	}
+}
+
+// wrapTrustRoute 执行中间件后调用路由，每次请求时查找路由，使覆盖注册即时生效
+func (cli *CLI) wrapTrustRoute(name string) owtp.HandlerFunc {
+	return func(ctx *owtp.Context) {
+
+		cli.routeMu.RLock()
+		route := cli.trustRoutes[name]
+		middlewares := append([]TrustMiddleware{
+			cli.checkTrustPermission,
+			cli.checkTrustAppID,
+		}, cli.trustMiddlewares...)
+		cli.routeMu.RUnlock()
+
+		//守护进程退出时等待正在处理的请求，如转账
+		if !cli.beginDaemonRequest() {
+			ctx.Response(nil, ErrorNodeShuttingDown, "the node is shutting down")
+			return
+		}
+		defer cli.endDaemonRequest()
+
+		start := time.Now()
+		defer func() {
+			status := MetricStatusSuccess
+			if ctx.Resp.Status != owtp.StatusSuccess {
+				status = MetricStatusFailed
+			}
+			cli.Metrics().Inc(MetricTrustRouteCalls, name, status)
+			cli.Metrics().Observe(MetricTrustRouteDuration, time.Since(start).Seconds(), name)
+			log.Debugf("trust route call finished, %s status=%d", LogFields("route", name, "peer", ctx.PeerID), ctx.Resp.Status)
+		}()
+
+		for _, middleware := range middlewares {
+			if !middleware(ctx, route) {
+				return
+			}
+		}
+
+		route.handler(ctx)
+	}
+}
+
+// checkTrustPermission 检查授信服务是否有路由需要的权限
+func (cli *CLI) checkTrustPermission(ctx *owtp.Context, route *TrustRoute) bool {
+
+	server := cli.getTrustServer(ctx.PeerID)
+
+	var enable bool
+	switch route.Permission {
+	case TrustPermissionNone:
+		enable = true
+	case TrustPermissionTransfer:
+		enable = server.enablerequesttransfer
+	case TrustPermissionExecuteSummaryTask:
+		enable = server.enableexecutesummarytask
+	case TrustPermissionEditSummarySettings:
+		enable = server.enableeditsummarysettings
+	}
+
+	if !enable {
+		ctx.Response(nil, ErrorNodeAbilityDisabled, fmt.Sprintf("the node has disabled [%s] ability", route.Permission))
+		return false
+	}
+
+	return true
+}
+
+// checkTrustAppID 检查请求的appID
+func (cli *CLI) checkTrustAppID(ctx *owtp.Context, route *TrustRoute) bool {
+
+	appID := ctx.Params().Get("appID").String()
+
+	if appID != cli.config.appid {
+		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
+		return false
+	}
+
+	return true
+}
+
+// registerDefaultTrustRoutes 注册内置的路由
+func (cli *CLI) registerDefaultTrustRoutes() {
+	cli.RegisterTrustRoute("getTrustNodeInfo", cli.getTrustNodeInfo, TrustPermissionNone)
+	cli.RegisterTrustRoute("createWalletViaTrustNode", cli.createWalletViaTrustNode, TrustPermissionNone)
+	cli.RegisterTrustRoute("createAccountViaTrustNode", cli.createAccountViaTrustNode, TrustPermissionNone)
+	cli.RegisterTrustRoute("sendTransactionViaTrustNode", cli.sendTransactionViaTrustNode, TrustPermissionTransfer)
+	cli.RegisterTrustRoute("setSummaryInfoViaTrustNode", cli.setSummaryInfoViaTrustNode, TrustPermissionEditSummarySettings)
+	cli.RegisterTrustRoute("findSummaryInfoByWalletIDViaTrustNode", cli.findSummaryInfoByWalletIDViaTrustNode, TrustPermissionNone)
+	cli.RegisterTrustRoute("startSummaryTaskViaTrustNode", cli.startSummaryTaskViaTrustNode, TrustPermissionExecuteSummaryTask)
+	cli.RegisterTrustRoute("stopSummaryTaskViaTrustNode", cli.stopSummaryTaskViaTrustNode, TrustPermissionExecuteSummaryTask)
+	cli.RegisterTrustRoute("updateInfoViaTrustNode", cli.updateInfoViaTrustNode, TrustPermissionNone)
+	cli.RegisterTrustRoute("appendSummaryTaskViaTrustNode", cli.appendSummaryTaskViaTrustNode, TrustPermissionExecuteSummaryTask)
+	cli.RegisterTrustRoute("removeSummaryTaskViaTrustNode", cli.removeSummaryTaskViaTrustNode, TrustPermissionExecuteSummaryTask)
+	cli.RegisterTrustRoute("getCurrentSummaryTaskViaTrustNode", cli.getCurrentSummaryTaskViaTrustNode, TrustPermissionExecuteSummaryTask)
+	cli.RegisterTrustRoute("getSummaryTaskLogViaTrustNode", cli.getSummaryTaskLogViaTrustNode, TrustPermissionExecuteSummaryTask)
+	cli.RegisterTrustRoute("getLocalWalletListViaTrustNode", cli.getLocalWalletListViaTrustNode, TrustPermissionNone)
+	cli.RegisterTrustRoute("getTrustAddressListViaTrustNode", cli.getTrustAddressListViaTrustNode, TrustPermissionNone)
+	cli.RegisterTrustRoute("signTransactionViaTrustNode", cli.signTransactionViaTrustNode, TrustPermissionTransfer)
+	cli.RegisterTrustRoute("triggerABIViaTrustNode", cli.triggerABIViaTrustNode, TrustPermissionTransfer)
+	cli.RegisterTrustRoute("signHashViaTrustNode", cli.signHashViaTrustNode, TrustPermissionTransfer)
+	cli.RegisterTrustRoute("unlockWalletViaTrustNode", cli.unlockWalletViaTrustNode, TrustPermissionTransfer)
+	cli.RegisterTrustRoute("lockWalletViaTrustNode", cli.lockWalletViaTrustNode, TrustPermissionTransfer)
+}
@@ -0,0 +1,52 @@
+package openwcli
+
+import (
+	"testing"
+
+	"github.com/blocktree/openwallet/v2/owtp"
+)
+
+func TestCLI_RegisterTrustRoute(t *testing.T) {
+
+	cli := &CLI{
+		trustRoutes: make(map[string]*TrustRoute),
+	}
+	cli.registerDefaultTrustRoutes()
+
+	count := len(cli.TrustRoutes())
+
+	err := cli.RegisterTrustRoute("", func(ctx *owtp.Context) {}, TrustPermissionNone)
+	if err == nil {
+		t.Errorf("RegisterTrustRoute should failed with empty name")
+		return
+	}
+
+	err = cli.RegisterTrustRoute("getBalanceViaTrustNode", func(ctx *owtp.Context) {}, TrustPermissionNone)
+	if err != nil {
+		t.Errorf("RegisterTrustRoute unexpected error: %v", err)
+		return
+	}
+
+	//覆盖内置路由
+	err = cli.RegisterTrustRoute("getTrustNodeInfo", func(ctx *owtp.Context) {}, TrustPermissionTransfer)
+	if err != nil {
+		t.Errorf("RegisterTrustRoute unexpected error: %v", err)
+		return
+	}
+
+	routes := cli.TrustRoutes()
+	if len(routes) != count+1 {
+		t.Errorf("routes count: %d, want: %d", len(routes), count+1)
+		return
+	}
+
+	if routes[0].Name != "getTrustNodeInfo" || routes[0].Permission != TrustPermissionTransfer {
+		t.Errorf("getTrustNodeInfo is not overridden")
+		return
+	}
+
+	if routes[count].Name != "getBalanceViaTrustNode" {
+		t.Errorf("custom route is not registered")
+		return
+	}
+}
@@ -0,0 +1,243 @@
+package openwcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/console"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/owtp"
+)
+
+const (
+	defaultTrustClientAddress = ":9088"
+	trustClientJoinTimeout    = 5 * time.Minute
+)
+
+// TrustClientServer 本地模拟的授信服务，托管节点连接后可以调用节点的所有路由方法，用于本机联调配置和权限
+type TrustClientServer struct {
+	node      *owtp.OWTPNode
+	cert      owtp.Certificate
+	address   string
+	publicKey string
+	joined    chan string
+	mu        sync.RWMutex
+	nodes     map[string]string //已加入的节点ID -> 节点名
+}
+
+// NewTrustClientServer 创建本地模拟的授信服务
+func NewTrustClientServer(address string) *TrustClientServer {
+
+	if len(address) == 0 {
+		address = defaultTrustClientAddress
+	}
+
+	cert := owtp.NewRandomCertificate()
+	_, publicKey := cert.KeyPair()
+
+	s := &TrustClientServer{
+		node: owtp.NewNode(owtp.NodeConfig{
+			Cert:       cert,
+			TimeoutSEC: 60,
+		}),
+		cert:      cert,
+		address:   address,
+		publicKey: publicKey,
+		joined:    make(chan string, 1),
+		nodes:     make(map[string]string),
+	}
+
+	s.node.HandleFunc("newNodeJoin", s.newNodeJoin)
+	s.node.HandleFunc(pendingTransferResultMethod, s.pendingTransferResult)
+
+	return s
+}
+
+// Listen 启动websocket监听
+func (s *TrustClientServer) Listen() error {
+	return s.node.Listen(owtp.ConnectConfig{
+		Address:     s.address,
+		ConnectType: owtp.Websocket,
+	})
+}
+
+// Close 关闭监听
+func (s *TrustClientServer) Close() {
+	s.node.CloseListener()
+}
+
+// PublicKey 模拟服务的公钥，可配置到publickey测试固定公钥
+func (s *TrustClientServer) PublicKey() string {
+	return s.publicKey
+}
+
+// ConnectAddress 托管节点连接本服务的地址
+func (s *TrustClientServer) ConnectAddress() string {
+	host, port, err := net.SplitHostPort(s.address)
+	if err != nil {
+		return s.address
+	}
+	if len(host) == 0 {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// WaitNodeJoin 等待托管节点加入，返回节点ID
+func (s *TrustClientServer) WaitNodeJoin(timeout time.Duration) (string, error) {
+	select {
+	case nodeID := <-s.joined:
+		return nodeID, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("wait for node join timeout")
+	}
+}
+
+// Call 调用托管节点的路由方法
+func (s *TrustClientServer) Call(nodeID, method string, params map[string]interface{}) (*owtp.Response, error) {
+
+	var ret *owtp.Response
+
+	err := s.node.Call(nodeID, method, params, true, func(resp owtp.Response) {
+		ret = &resp
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+/*********** 模拟授信服务的路由方法 ***********/
+
+func (s *TrustClientServer) newNodeJoin(ctx *owtp.Context) {
+
+	nodeName := ctx.Params().Get("nodeInfo.nodeName").String()
+
+	s.mu.Lock()
+	s.nodes[ctx.PeerID] = nodeName
+	s.mu.Unlock()
+
+	log.Infof("[TrustClient] node: %s (%s) joined", ctx.PeerID, nodeName)
+
+	//签名节点的挑战值，节点配置固定公钥时校验
+	signature, err := SignNodeDigest(s.cert, TrustChallengeDigest(ctx.Params().Get("challenge").String(), ctx.PeerID))
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+
+	ctx.Response(map[string]interface{}{
+		"publicKey": s.publicKey,
+		"signature": signature,
+	}, owtp.StatusSuccess, "success")
+
+	select {
+	case s.joined <- ctx.PeerID:
+	default:
+	}
+}
+
+func (s *TrustClientServer) pendingTransferResult(ctx *owtp.Context) {
+
+	log.Infof("[TrustClient] node: %s pending transfer result: %s", ctx.PeerID, ctx.Params().Raw)
+
+	ctx.Response(nil, owtp.StatusSuccess, "success")
+}
+
+// TrustClientFlow 启动本地模拟的授信服务，调用托管节点的路由方法
+// withLocalNode为true时，在同一进程启动托管节点连接到模拟服务
+func (cli *CLI) TrustClientFlow(address, method, params string, withLocalNode bool) error {
+
+	server := NewTrustClientServer(address)
+	err := server.Listen()
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	log.Infof("[TrustClient] listening on %s, public key: %s", server.address, server.PublicKey())
+
+	if withLocalNode {
+		//使用第一个授信服务的权限配置，连接到本地模拟服务
+		loopback := &TrustServerConfig{
+			name:                      "loopback",
+			hostID:                    trustHostID,
+			enablerequesttransfer:     cli.config.enablerequesttransfer,
+			enableexecutesummarytask:  cli.config.enableexecutesummarytask,
+			enableeditsummarysettings: cli.config.enableeditsummarysettings,
+		}
+		if len(cli.config.trustservers) > 0 {
+			*loopback = *cli.config.trustservers[0]
+			loopback.name = "loopback"
+		}
+		loopback.address = server.ConnectAddress()
+		loopback.enablessl = false
+		cli.config.trustservers = []*TrustServerConfig{loopback}
+
+		err = cli.ServeTransmitNode(false)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Infof("[TrustClient] set trustedserver = %s and start trustserver to join", server.ConnectAddress())
+	}
+
+	nodeID, err := server.WaitNodeJoin(trustClientJoinTimeout)
+	if err != nil {
+		return err
+	}
+
+	//命令行指定方法，调用一次后退出
+	if len(method) > 0 {
+		return cli.callTrustClient(server, nodeID, method, params)
+	}
+
+	for {
+		method, err = console.InputText("Enter method (empty to exit): ", false)
+		if err != nil || len(method) == 0 {
+			return nil
+		}
+
+		params, err = console.InputText("Enter params JSON: ", false)
+		if err != nil {
+			return err
+		}
+
+		err = cli.callTrustClient(server, nodeID, method, params)
+		if err != nil {
+			log.Error("unexpected error: ", err)
+		}
+	}
+}
+
+// callTrustClient 通过模拟服务调用托管节点，appID默认使用本地配置
+func (cli *CLI) callTrustClient(server *TrustClientServer, nodeID, method, params string) error {
+
+	reqParams := make(map[string]interface{})
+	if len(params) > 0 {
+		err := json.Unmarshal([]byte(params), &reqParams)
+		if err != nil {
+			return fmt.Errorf("params is not a json object: %v", err)
+		}
+	}
+	if _, exist := reqParams["appID"]; !exist {
+		reqParams["appID"] = cli.config.appid
+	}
+
+	resp, err := server.Call(nodeID, method, reqParams)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("--------------- %s ---------------\n", method)
+	fmt.Printf("status: %d\n", resp.Status)
+	fmt.Printf("msg: %s\n", resp.Msg)
+	fmt.Printf("result: %s\n", resp.JsonData().Raw)
+
+	return nil
+}
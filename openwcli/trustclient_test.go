@@ -0,0 +1,123 @@
+package openwcli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/owtp"
+)
+
+func TestTrustClientServer_ConnectAddress(t *testing.T) {
+	server := NewTrustClientServer(":9088")
+	if addr := server.ConnectAddress(); addr != "127.0.0.1:9088" {
+		t.Errorf("ConnectAddress = %s, want 127.0.0.1:9088", addr)
+	}
+	server = NewTrustClientServer("192.168.1.2:9000")
+	if addr := server.ConnectAddress(); addr != "192.168.1.2:9000" {
+		t.Errorf("ConnectAddress = %s, want 192.168.1.2:9000", addr)
+	}
+}
+
+func TestTrustClientServer_LocalNode(t *testing.T) {
+
+	cli := getTestOpenwCLI()
+	if cli == nil {
+		return
+	}
+
+	server := NewTrustClientServer("127.0.0.1:19088")
+	err := server.Listen()
+	if err != nil {
+		t.Errorf("Listen error: %v", err)
+		return
+	}
+	defer server.Close()
+
+	cli.config.trustservers = []*TrustServerConfig{
+		{
+			name:      "loopback",
+			hostID:    trustHostID,
+			address:   server.ConnectAddress(),
+			publickey: server.PublicKey(),
+		},
+	}
+
+	err = cli.ServeTransmitNode(false)
+	if err != nil {
+		t.Fatalf("ServeTransmitNode error: %v", err)
+	}
+
+	nodeID, err := server.WaitNodeJoin(10 * time.Second)
+	if err != nil {
+		t.Errorf("WaitNodeJoin error: %v", err)
+		return
+	}
+
+	resp, err := server.Call(nodeID, "getTrustNodeInfo", map[string]interface{}{
+		"appID": cli.config.appid,
+	})
+	if err != nil {
+		t.Errorf("Call error: %v", err)
+		return
+	}
+	log.Infof("getTrustNodeInfo: %s", resp.JsonData().Raw)
+
+	//没有转账权限
+	resp, err = server.Call(nodeID, "sendTransactionViaTrustNode", map[string]interface{}{
+		"appID": cli.config.appid,
+	})
+	if err != nil {
+		t.Errorf("Call error: %v", err)
+		return
+	}
+	if resp.Status != ErrorNodeAbilityDisabled {
+		t.Errorf("sendTransactionViaTrustNode status = %d, want %d", resp.Status, ErrorNodeAbilityDisabled)
+	}
+}
+
+func TestTrustChallengeSignature(t *testing.T) {
+
+	cert := owtp.NewRandomCertificate()
+	_, publicKey := cert.KeyPair()
+
+	challenge, err := newTrustChallenge()
+	if err != nil {
+		t.Errorf("newTrustChallenge unexpected error: %v", err)
+		return
+	}
+
+	signature, err := SignNodeDigest(cert, TrustChallengeDigest(challenge, "node1"))
+	if err != nil {
+		t.Errorf("SignNodeDigest unexpected error: %v", err)
+		return
+	}
+
+	err = VerifyNodeSignature(publicKey, TrustChallengeDigest(challenge, "node1"), signature)
+	if err != nil {
+		t.Errorf("VerifyNodeSignature unexpected error: %v", err)
+		return
+	}
+
+	//其他节点的挑战签名、其他服务的公钥、空签名都不能通过
+	other := owtp.NewRandomCertificate()
+	_, otherPublicKey := other.KeyPair()
+	if VerifyNodeSignature(publicKey, TrustChallengeDigest(challenge, "node2"), signature) == nil ||
+		VerifyNodeSignature(otherPublicKey, TrustChallengeDigest(challenge, "node1"), signature) == nil ||
+		VerifyNodeSignature(publicKey, TrustChallengeDigest(challenge, "node1"), "") == nil {
+		t.Errorf("VerifyNodeSignature should fail")
+	}
+}
+
+func TestDrainDisconnected(t *testing.T) {
+	ch := make(chan struct{}, 1)
+	notifyDisconnected(ch)
+	//通道已满时不阻塞
+	notifyDisconnected(ch)
+	drainDisconnected(ch)
+	select {
+	case <-ch:
+		t.Errorf("disconnected channel should be drained")
+	default:
+	}
+}
@@ -1,13 +1,19 @@
 package openwcli
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/blocktree/openwallet/v2/owtp"
-	"github.com/blocktree/openwallet/v2/timer"
+	"github.com/mr-tron/base58/base58"
+	"github.com/shopspring/decimal"
+	"sync"
 	"time"
 )
 
@@ -30,52 +36,45 @@ func (cli *CLI) ServeTransmitNode(autoReconnect bool) error {
 	cli.transmitNode = node
 
 	//绑定本地路由方法
-	cli.transmitNode.HandleFunc("getTrustNodeInfo", cli.getTrustNodeInfo)
-	cli.transmitNode.HandleFunc("createWalletViaTrustNode", cli.createWalletViaTrustNode)
-	cli.transmitNode.HandleFunc("createAccountViaTrustNode", cli.createAccountViaTrustNode)
-	cli.transmitNode.HandleFunc("sendTransactionViaTrustNode", cli.sendTransactionViaTrustNode)
-	cli.transmitNode.HandleFunc("setSummaryInfoViaTrustNode", cli.setSummaryInfoViaTrustNode)
-	cli.transmitNode.HandleFunc("findSummaryInfoByWalletIDViaTrustNode", cli.findSummaryInfoByWalletIDViaTrustNode)
-	cli.transmitNode.HandleFunc("startSummaryTaskViaTrustNode", cli.startSummaryTaskViaTrustNode)
-	cli.transmitNode.HandleFunc("stopSummaryTaskViaTrustNode", cli.stopSummaryTaskViaTrustNode)
-	cli.transmitNode.HandleFunc("updateInfoViaTrustNode", cli.updateInfoViaTrustNode)
-	cli.transmitNode.HandleFunc("appendSummaryTaskViaTrustNode", cli.appendSummaryTaskViaTrustNode)
-	cli.transmitNode.HandleFunc("removeSummaryTaskViaTrustNode", cli.removeSummaryTaskViaTrustNode)
-	cli.transmitNode.HandleFunc("getCurrentSummaryTaskViaTrustNode", cli.getCurrentSummaryTaskViaTrustNode)
-	cli.transmitNode.HandleFunc("getSummaryTaskLogViaTrustNode", cli.getSummaryTaskLogViaTrustNode)
-	cli.transmitNode.HandleFunc("getLocalWalletListViaTrustNode", cli.getLocalWalletListViaTrustNode)
-	cli.transmitNode.HandleFunc("getTrustAddressListViaTrustNode", cli.getTrustAddressListViaTrustNode)
-	cli.transmitNode.HandleFunc("signTransactionViaTrustNode", cli.signTransactionViaTrustNode)
-	cli.transmitNode.HandleFunc("triggerABIViaTrustNode", cli.triggerABIViaTrustNode)
-	cli.transmitNode.HandleFunc("signHashViaTrustNode", cli.signHashViaTrustNode)
+	cli.bindTrustRoutes(node)
+
+	if len(cli.config.trustservers) == 0 {
+		return fmt.Errorf("trusted server is not configured")
+	}
 
 	//自动连接
 	if autoReconnect {
-		go cli.autoReconnectTransmitNode()
+		if cli.config.trustservermode == trustServerModeFailover {
+			go cli.autoFailoverTransmitNode()
+		} else {
+			go cli.autoReconnectTransmitNode()
+		}
 		return nil
 	}
 
-	//单独连接
-	err = cli.connectTransmitNode()
-	if err != nil {
-		return err
+	//单独连接，所有授信服务
+	for _, server := range cli.config.trustservers {
+		err = cli.connectTransmitNode(server)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// connectTransmitNode
-func (cli *CLI) connectTransmitNode() error {
+// connectTransmitNode 连接授信服务
+func (cli *CLI) connectTransmitNode(server *TrustServerConfig) error {
 
 	connectCfg := owtp.ConnectConfig{}
-	connectCfg.Address = cli.config.trustedserver
+	connectCfg.Address = server.address
 	connectCfg.ConnectType = owtp.Websocket
-	connectCfg.EnableSSL = cli.config.enabletrustserverssl
+	connectCfg.EnableSSL = server.enablessl
 	connectCfg.EnableSignature = false
 	connectCfg.EnableKeyAgreement = cli.config.enablekeyagreement
 
 	//建立连接
-	_, err := cli.transmitNode.Connect(trustHostID, connectCfg)
+	_, err := cli.transmitNode.Connect(server.hostID, connectCfg)
 	if err != nil {
 		return err
 	}
@@ -88,68 +87,195 @@ func (cli *CLI) connectTransmitNode() error {
 	//}
 
 	//向服务器发送连接成功
-	err = cli.nodeDidConnectedServer()
+	err = cli.nodeDidConnectedServer(server)
 	if err != nil {
+		cli.transmitNode.ClosePeer(server.hostID)
 		return err
 	}
 
+	cli.setTrustPeerState(server.hostID, true)
+
 	return nil
 }
 
-// Run 运行商户节点管理
+// autoReconnectTransmitNode 同时连接所有授信服务，断开后各自重连
 func (cli *CLI) autoReconnectTransmitNode() error {
 
 	var (
-		err error
-		//连接状态通道
-		reconnect = make(chan bool, 1)
-		//断开状态通道
-		disconnected = make(chan struct{}, 1)
 		//重连时的等待时间
 		reconnectWait = 5
+		//断开状态通道
+		disconnected = make(map[string]chan struct{})
 	)
 
-	defer func() {
-		close(reconnect)
-		close(disconnected)
-	}()
+	for _, server := range cli.config.trustservers {
+		disconnected[server.hostID] = make(chan struct{}, 1)
+	}
 
-	//断开连接通知
+	//断开连接通知，不阻塞关闭连接的协程
 	cli.transmitNode.SetCloseHandler(func(n *owtp.OWTPNode, peer owtp.PeerInfo) {
-		disconnected <- struct{}{}
+		cli.setTrustPeerState(peer.ID, false)
+		if ch, ok := disconnected[peer.ID]; ok {
+			notifyDisconnected(ch)
+		}
 	})
 
-	//启动连接
-	reconnect <- true
+	reconnectFunc := func(server *TrustServerConfig) {
+		for !cli.isDaemonStopping() {
+			//清除上次连接失败关闭连接留下的通知，避免新连接被当作已断开
+			drainDisconnected(disconnected[server.hostID])
 
-	//节点运行时
-	for {
-		select {
-		case <-reconnect:
 			//重新连接
-			log.Info("Connecting to", cli.config.trustedserver)
-			err = cli.connectTransmitNode()
+			log.Info("Connecting to", server.address)
+			err := cli.connectTransmitNode(server)
 			if err != nil {
-				log.Errorf("Connect %s node failed unexpected error: %v", trustHostID, err)
-				disconnected <- struct{}{}
+				log.Errorf("Connect %s node failed unexpected error: %v", server.hostID, err)
 			} else {
-				log.Infof("Connect %s node successfully.", trustHostID)
+				log.Infof("Connect %s node successfully.", server.hostID)
+				<-disconnected[server.hostID]
+				log.Warningf("%s node disconnected.", server.hostID)
 			}
 
-		case <-disconnected:
 			//重新连接，前等待
 			log.Info("Auto reconnect after", reconnectWait, "seconds...")
 			time.Sleep(time.Duration(reconnectWait) * time.Second)
-			reconnect <- true
 		}
 	}
 
+	for _, server := range cli.config.trustservers {
+		go reconnectFunc(server)
+	}
+
+	return nil
+}
+
+// autoFailoverTransmitNode 按顺序连接第一个可用的授信服务，断开后从主服务开始重新选择
+func (cli *CLI) autoFailoverTransmitNode() {
+
+	var (
+		//重连时的等待时间
+		reconnectWait = 5
+		//断开状态通道
+		disconnected = make(chan struct{}, 1)
+		//当前连接的授信服务
+		current   string
+		currentMu sync.Mutex
+	)
+
+	//断开连接通知，只通知当前使用的授信服务，其他服务加入失败关闭连接不触发切换
+	cli.transmitNode.SetCloseHandler(func(n *owtp.OWTPNode, peer owtp.PeerInfo) {
+		cli.setTrustPeerState(peer.ID, false)
+		currentMu.Lock()
+		isCurrent := peer.ID == current
+		currentMu.Unlock()
+		if isCurrent {
+			notifyDisconnected(disconnected)
+		}
+	})
+
+	for {
+		var connected *TrustServerConfig
+		drainDisconnected(disconnected)
+		for _, server := range cli.config.trustservers {
+			log.Info("Connecting to", server.address)
+			currentMu.Lock()
+			current = server.hostID
+			currentMu.Unlock()
+			err := cli.connectTransmitNode(server)
+			if err != nil {
+				log.Errorf("Connect %s node failed unexpected error: %v", server.hostID, err)
+				drainDisconnected(disconnected)
+				continue
+			}
+			log.Infof("Connect %s node successfully.", server.hostID)
+			connected = server
+			break
+		}
+
+		if connected != nil {
+			<-disconnected
+			log.Warningf("%s node disconnected, fail over to next available server.", connected.hostID)
+		}
+
+		//守护进程退出时不再重连
+		if cli.isDaemonStopping() {
+			return
+		}
+
+		//重新连接，前等待
+		log.Info("Auto reconnect after", reconnectWait, "seconds...")
+		time.Sleep(time.Duration(reconnectWait) * time.Second)
+	}
+}
+
+// SignNodeDigest 使用节点证书私钥签名摘要
+func SignNodeDigest(cert owtp.Certificate, digest []byte) (string, error) {
+	signature, _, sigErr := owcrypt.Signature(cert.PrivateKeyBytes(), nil, digest, owcrypt.ECC_CURVE_SM2_STANDARD)
+	if sigErr != owcrypt.SUCCESS {
+		return "", fmt.Errorf("sign digest failed")
+	}
+	return hex.EncodeToString(signature), nil
+}
+
+// VerifyNodeSignature 使用节点证书公钥校验签名，公钥为base58编码
+func VerifyNodeSignature(publicKey string, digest []byte, signature string) error {
+
+	pub, err := base58.Decode(publicKey)
+	if err != nil || len(pub) == 0 {
+		return fmt.Errorf("public key is invalid")
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) == 0 {
+		return fmt.Errorf("signature is invalid")
+	}
+
+	if owcrypt.Verify(pub, nil, digest, sig, owcrypt.ECC_CURVE_SM2_STANDARD) != owcrypt.SUCCESS {
+		return fmt.Errorf("signature verify failed")
+	}
+
 	return nil
 }
 
+// notifyDisconnected 发送断开通知，通道已有通知时丢弃
+func notifyDisconnected(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// drainDisconnected 清除未处理的断开通知
+func drainDisconnected(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+	}
+}
+
+// getTrustServer 根据连接的节点ID查找授信服务配置，找不到返回没有任何权限的配置
+func (cli *CLI) getTrustServer(peerID string) *TrustServerConfig {
+	for _, server := range cli.config.trustservers {
+		if server.hostID == peerID {
+			return server
+		}
+	}
+	return &TrustServerConfig{}
+}
+
 /*********** 客户服务平台业务方法调用 ***********/
 
-func (cli *CLI) nodeDidConnectedServer() error {
+func (cli *CLI) nodeDidConnectedServer(server *TrustServerConfig) error {
+
+	var (
+		retErr error
+	)
+
+	//随机挑战值，授信服务需要用证书私钥签名，证明持有固定公钥对应的私钥
+	challenge, err := newTrustChallenge()
+	if err != nil {
+		return err
+	}
 
 	params := map[string]interface{}{
 		"appID": cli.config.appid,
@@ -158,28 +284,54 @@ func (cli *CLI) nodeDidConnectedServer() error {
 			NodeName:    cli.config.localname,
 			ConnectType: owtp.Websocket,
 		},
+		"challenge": challenge,
 	}
 
-	err := cli.transmitNode.Call(trustHostID, "newNodeJoin", params,
+	err = cli.transmitNode.Call(server.hostID, "newNodeJoin", params,
 		true, func(resp owtp.Response) {
 			if resp.Status != owtp.StatusSuccess {
 				log.Error(resp.Msg)
+				//固定公钥时，没有完成校验不能加入
+				if len(server.publickey) > 0 {
+					retErr = fmt.Errorf("%s join failed: %s", server.hostID, resp.Msg)
+				}
+				return
+			}
+			//检查授信服务对挑战值的签名，不能只比较服务返回的公钥
+			if len(server.publickey) > 0 {
+				signature := resp.JsonData().Get("signature").String()
+				digest := TrustChallengeDigest(challenge, cli.transmitNode.NodeID())
+				if verifyErr := VerifyNodeSignature(server.publickey, digest, signature); verifyErr != nil {
+					retErr = fmt.Errorf("%s is not the pinned server: %v", server.hostID, verifyErr)
+				}
 			}
 		})
+	if err != nil {
+		return err
+	}
 
-	return err
+	return retErr
 }
 
-/*********** 本地路由方法实现 ***********/
+// newTrustChallenge 生成加入授信服务时的随机挑战值
+func newTrustChallenge() (string, error) {
+	nonce := make([]byte, 32)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
 
-func (cli *CLI) getTrustNodeInfo(ctx *owtp.Context) {
-	appID := ctx.Params().Get("appID").String()
+// TrustChallengeDigest 授信服务签名的挑战摘要，绑定加入的节点ID，防止转发其他节点的签名
+func TrustChallengeDigest(challenge, nodeID string) []byte {
+	digest := sha256.Sum256([]byte("newNodeJoin|" + challenge + "|" + nodeID))
+	return digest[:]
+}
 
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
+/*********** 本地路由方法实现 ***********/
 
+func (cli *CLI) getTrustNodeInfo(ctx *owtp.Context) {
 	info := openwsdk.TrustNodeInfo{
 		NodeID:      cli.transmitNode.NodeID(),
 		NodeName:    cli.config.localname,
@@ -193,16 +345,13 @@ func (cli *CLI) getTrustNodeInfo(ctx *owtp.Context) {
 }
 
 func (cli *CLI) createWalletViaTrustNode(ctx *owtp.Context) {
-	appID := ctx.Params().Get("appID").String()
+	alias := ctx.Params().Get("alias").String()
+	password := ctx.Params().Get("password").String()
 
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
+	if cli.isPasswordParamRejected(ctx, password) {
 		return
 	}
 
-	alias := ctx.Params().Get("alias").String()
-	password := ctx.Params().Get("password").String()
-
 	wallet, err := cli.CreateWalletOnServer(alias, password)
 	if err != nil {
 		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
@@ -213,23 +362,13 @@ func (cli *CLI) createWalletViaTrustNode(ctx *owtp.Context) {
 
 func (cli *CLI) createAccountViaTrustNode(ctx *owtp.Context) {
 
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	alias := ctx.Params().Get("alias").String()
 	walletID := ctx.Params().Get("walletID").String()
 	symbol := ctx.Params().Get("symbol").String()
 	password := ctx.Params().Get("password").String()
 
-	if len(password) == 0 {
-		//钱包是否已经解锁
-		if p, exist := cli.unlockWallets[walletID]; exist {
-			password = p
-		}
+	if cli.isPasswordParamRejected(ctx, password) {
+		return
 	}
 
 	wallet, err := cli.GetWalletByWalletID(walletID)
@@ -252,18 +391,6 @@ func (cli *CLI) createAccountViaTrustNode(ctx *owtp.Context) {
 
 func (cli *CLI) sendTransactionViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enablerequesttransfer {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [transfer] ability")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	accountID := ctx.Params().Get("accountID").String()
 	sid := ctx.Params().Get("sid").String()
 	contractAddress := ctx.Params().Get("contractAddress").String()
@@ -275,6 +402,10 @@ func (cli *CLI) sendTransactionViaTrustNode(ctx *owtp.Context) {
 	extParam := ctx.Params().Get("extParam").String()
 	symbol := ctx.Params().Get("symbol").String()
 
+	if cli.isPasswordParamRejected(ctx, password) {
+		return
+	}
+
 	account, err := cli.GetAccountByAccountID(symbol, accountID)
 	if err != nil {
 		ctx.Response(nil, openwallet.ErrAccountNotFound, err.Error())
@@ -287,11 +418,34 @@ func (cli *CLI) sendTransactionViaTrustNode(ctx *owtp.Context) {
 		return
 	}
 
-	if len(password) == 0 {
-		//钱包是否已经解锁
-		if p, exist := cli.unlockWallets[wallet.WalletID]; exist {
-			password = p
+	//超过阈值的转账等待人工审批，数量不能解析时拒绝
+	amountDec, err := parseTransferAmount(amount)
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+	needApproval, err := cli.isNeedApproval(symbol, contractAddress, amountDec)
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+	if needApproval {
+		pending := &PendingTransfer{
+			Type:            PendingTypeTransfer,
+			PeerID:          ctx.PeerID,
+			Sid:             sid,
+			WalletID:        wallet.WalletID,
+			AccountID:       accountID,
+			Symbol:          symbol,
+			ContractAddress: contractAddress,
+			Address:         address,
+			Amount:          amount,
+			FeeRate:         feeRate,
+			Memo:            memo,
+			ExtParam:        extParam,
 		}
+		cli.responsePendingTransfer(ctx, pending)
+		return
 	}
 
 	retTx, retFailed, exErr := cli.TransferExt(wallet, account, symbol, contractAddress, address, amount, sid, feeRate, memo, extParam, password)
@@ -308,18 +462,6 @@ func (cli *CLI) sendTransactionViaTrustNode(ctx *owtp.Context) {
 
 func (cli *CLI) setSummaryInfoViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enableeditsummarysettings {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [edit summary settings] ability")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	summarySetting := openwsdk.NewSummarySetting(ctx.Params().Get("summarySetting"))
 
 	//汇总配置是否已初始化，若初始化后不能再有信任节点设置
@@ -353,12 +495,6 @@ func (cli *CLI) findSummaryInfoByWalletIDViaTrustNode(ctx *owtp.Context) {
 	}
 	defer cli.closeDB()
 
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
 	walletID := ctx.Params().Get("walletID").String()
 
 	//读取汇总配置
@@ -368,24 +504,19 @@ func (cli *CLI) findSummaryInfoByWalletIDViaTrustNode(ctx *owtp.Context) {
 	//	return
 	//}
 
+	err = cli.decryptSummarySettings(sumSets...)
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+
 	ctx.Response(sumSets, owtp.StatusSuccess, "success")
 }
 
 func (cli *CLI) startSummaryTaskViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enableexecutesummarytask {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [execute summary task] ability")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
 	operateType := ctx.Params().Get("operateType").Int()
 
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	summaryTask := openwsdk.NewSummaryTask(ctx.Params().Get("summaryTask"))
 	cycleSec := ctx.Params().Get("cycleSec").Int()
 
@@ -394,88 +525,32 @@ func (cli *CLI) startSummaryTaskViaTrustNode(ctx *owtp.Context) {
 		return
 	}
 
-	//检查汇总任务的参数是否传入密码
+	//检查汇总任务的参数是否传入密码，没有密码使用已解锁的钱包会话
 	for _, summaryWalletTask := range summaryTask.Wallets {
-		if len(summaryWalletTask.Password) == 0 {
-			//钱包是否已经解锁
-			if p, exist := cli.unlockWallets[summaryWalletTask.WalletID]; exist {
-				summaryWalletTask.Password = p
-			}
+		if cli.isPasswordParamRejected(ctx, summaryWalletTask.Password) {
+			return
 		}
 	}
 
-	//:先检查汇总任务是否有汇总配置
-	err := cli.checkSummaryTaskIsHaveSettings(summaryTask)
-	if err != nil {
-		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+	exErr := cli.StartSummaryTask(summaryTask, operateType, time.Duration(cycleSec)*time.Second)
+	if exErr != nil {
+		ctx.Response(nil, exErr.Code(), exErr.Error())
 		return
 	}
 
-	switch operateType {
-	case openwsdk.SummaryTaskOperateTypeReset:
-
-		cli.mu.Lock()
-		cli.summaryTask = summaryTask
-		cli.mu.Unlock()
-
-	case openwsdk.SummaryTaskOperateTypeAdd:
-		cli.appendSummaryTasks(summaryTask)
-	}
-
-	if cli.summaryTaskTimer != nil && cli.summaryTaskTimer.Running() {
-		log.Warning("summary task timer is running")
-		//ctx.Response(nil, ErrorSummaryTaskTimerIsRunning, "summary task timer is running")
-		//return
-	} else {
-
-		log.Infof("The timer for summary task start now. Execute by every %v seconds.", cycleSec)
-
-		//启动钱包汇总程序
-		sumTimer := timer.NewTask(time.Duration(cycleSec)*time.Second, cli.SummaryTask)
-		sumTimer.Start()
-		cli.summaryTaskTimer = sumTimer
-		//马上执行一次汇总
-		go cli.SummaryTask()
-
-	}
-
 	ctx.Response(nil, owtp.StatusSuccess, "The timer for summary task start running")
 
 }
 
 func (cli *CLI) stopSummaryTaskViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enableexecutesummarytask {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [execute summary task] ability")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
-	if cli.summaryTaskTimer != nil && cli.summaryTaskTimer.Running() {
-		cli.summaryTaskTimer.Stop()
-		cli.summaryTaskTimer = nil
-	}
-
-	log.Infof("The timer for summary task has been stopped.")
+	cli.StopSummaryTask()
 
 	ctx.Response(nil, owtp.StatusSuccess, "success")
 }
 
 func (cli *CLI) updateInfoViaTrustNode(ctx *owtp.Context) {
 
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	err := cli.UpdateSymbols()
 	if err != nil {
 		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
@@ -487,121 +562,56 @@ func (cli *CLI) updateInfoViaTrustNode(ctx *owtp.Context) {
 
 func (cli *CLI) appendSummaryTaskViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enableexecutesummarytask {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [execute summary task] ability")
-		return
-	}
-
-	if cli.summaryTaskTimer == nil || !cli.summaryTaskTimer.Running() {
-		ctx.Response(nil, ErrorSummaryTaskTimerIsNotStart, "summary task timer is not start")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	summaryTask := openwsdk.NewSummaryTask(ctx.Params().Get("summaryTask"))
 
-	//检查汇总任务的参数是否传入密码
+	//检查汇总任务的参数是否传入密码，没有密码使用已解锁的钱包会话
 	for _, summaryWalletTask := range summaryTask.Wallets {
-		if len(summaryWalletTask.Password) == 0 {
-			//钱包是否已经解锁
-			if p, exist := cli.unlockWallets[summaryWalletTask.WalletID]; exist {
-				summaryWalletTask.Password = p
-			}
+		if cli.isPasswordParamRejected(ctx, summaryWalletTask.Password) {
+			return
 		}
 	}
 
-	//:先检查汇总任务是否有汇总配置
-	err := cli.checkSummaryTaskIsHaveSettings(summaryTask)
-	if err != nil {
-		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+	exErr := cli.AppendSummaryTask(summaryTask)
+	if exErr != nil {
+		ctx.Response(nil, exErr.Code(), exErr.Error())
 		return
 	}
 
-	cli.appendSummaryTasks(summaryTask)
-
 	ctx.Response(nil, owtp.StatusSuccess, "success")
 
 }
 
 func (cli *CLI) removeSummaryTaskViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enableexecutesummarytask {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [execute summary task] ability")
-		return
-	}
-
-	if cli.summaryTaskTimer == nil || !cli.summaryTaskTimer.Running() {
-		ctx.Response(nil, ErrorSummaryTaskTimerIsNotStart, "summary task timer is not start")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
 	walletID := ctx.Params().Get("walletID").String()
 	accountID := ctx.Params().Get("accountID").String()
 
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
+	exErr := cli.RemoveSummaryTask(walletID, accountID)
+	if exErr != nil {
+		ctx.Response(nil, exErr.Code(), exErr.Error())
 		return
 	}
 
-	cli.removeSummaryWalletTasks(walletID, accountID)
-
 	ctx.Response(nil, owtp.StatusSuccess, "success")
 
 }
 
 func (cli *CLI) getCurrentSummaryTaskViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enableexecutesummarytask {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [execute summary task] ability")
-		return
-	}
-
-	if cli.summaryTaskTimer == nil || !cli.summaryTaskTimer.Running() {
-		ctx.Response(nil, ErrorSummaryTaskTimerIsNotStart, "summary task timer is not start")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
+	retTask, exErr := cli.CurrentSummaryTask()
+	if exErr != nil {
+		ctx.Response(nil, exErr.Code(), exErr.Error())
 		return
 	}
 
-	retTask := openwsdk.SummaryTask{Wallets: make([]*openwsdk.SummaryWalletTask, 0)}
-	for _, wt := range cli.summaryTask.Wallets {
-		newWt := *wt
-		newWt.Password = ""
-		newWt.Wallet = nil
-		retTask.Wallets = append(retTask.Wallets, &newWt)
-	}
-
 	ctx.Response(retTask, owtp.StatusSuccess, "success")
 }
 
 func (cli *CLI) getSummaryTaskLogViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enableexecutesummarytask {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [execute summary task] ability")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
 	offset := ctx.Params().Get("offset").Int()
 	limit := ctx.Params().Get("limit").Int()
 
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	logs, err := cli.GetSummaryTaskLog(offset, limit)
 	if err != nil {
 		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
@@ -613,13 +623,6 @@ func (cli *CLI) getSummaryTaskLogViaTrustNode(ctx *owtp.Context) {
 
 func (cli *CLI) getLocalWalletListViaTrustNode(ctx *owtp.Context) {
 
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	wallets, err := cli.GetWalletsOnServer()
 	if err != nil {
 		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
@@ -631,14 +634,8 @@ func (cli *CLI) getLocalWalletListViaTrustNode(ctx *owtp.Context) {
 
 func (cli *CLI) getTrustAddressListViaTrustNode(ctx *owtp.Context) {
 
-	appID := ctx.Params().Get("appID").String()
 	symbol := ctx.Params().Get("symbol").String()
 
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	list, err := cli.ListTrustAddress(symbol)
 	if err != nil {
 		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
@@ -656,18 +653,11 @@ func (cli *CLI) getTrustAddressListViaTrustNode(ctx *owtp.Context) {
 
 func (cli *CLI) signTransactionViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enablerequesttransfer {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [transfer] ability")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
 	walletID := ctx.Params().Get("walletID").String()
 	password := ctx.Params().Get("password").String()
 	jsonRawTx := ctx.Params().Get("rawTx")
 
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
+	if cli.isPasswordParamRejected(ctx, password) {
 		return
 	}
 
@@ -680,15 +670,22 @@ func (cli *CLI) signTransactionViaTrustNode(ctx *owtp.Context) {
 
 	destination := ""
 	amount := ""
+	totalAmount := decimal.Zero
 	for to, a := range rawTx.To {
 		//:检查目标地址是否信任名单
-		if !cli.IsTrustAddress(to, rawTx.Coin.Symbol) {
+		if !cli.checkTrustAddress(to, rawTx.Coin.Symbol) {
 			msg := fmt.Sprintf("%s is not in trust address list", to)
 			ctx.Response(nil, openwallet.ErrUnknownException, msg)
 			return
 		}
 		destination = to
 		amount = a
+		amountDec, parseErr := parseTransferAmount(a)
+		if parseErr != nil {
+			ctx.Response(nil, openwallet.ErrUnknownException, parseErr.Error())
+			return
+		}
+		totalAmount = totalAmount.Add(amountDec)
 	}
 
 	wallet, err := cli.GetWalletByWalletID(walletID)
@@ -697,15 +694,31 @@ func (cli *CLI) signTransactionViaTrustNode(ctx *owtp.Context) {
 		return
 	}
 
-	if len(password) == 0 {
-		//钱包是否已经解锁
-		if p, exist := cli.unlockWallets[wallet.WalletID]; exist {
-			password = p
+	//超过阈值的交易单等待人工审批
+	needApproval, err := cli.isNeedApproval(rawTx.Coin.Symbol, rawTx.Coin.ContractAddress, totalAmount)
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+	if needApproval {
+		pending := &PendingTransfer{
+			Type:      PendingTypeSignTransaction,
+			PeerID:    ctx.PeerID,
+			Sid:       rawTx.Sid,
+			WalletID:  wallet.WalletID,
+			AccountID: rawTx.AccountID,
+			Symbol:    rawTx.Coin.Symbol,
+			Address:   destination,
+			Amount:    totalAmount.String(),
+			FeeRate:   rawTx.FeeRate,
+			RawTx:     jsonRawTx.Raw,
 		}
+		cli.responsePendingTransfer(ctx, pending)
+		return
 	}
 
 	//获取种子文件
-	key, err := cli.getLocalKeyByWallet(wallet, password)
+	key, err := cli.getSignerKey(wallet, password)
 	if err != nil {
 		ctx.Response(nil, openwallet.ErrSignRawTransactionFailed, err.Error())
 		return
@@ -722,7 +735,7 @@ func (cli *CLI) signTransactionViaTrustNode(ctx *owtp.Context) {
 	//:打印交易单明细
 	log.Infof("-----------------------------------------------")
 	log.Infof("[%s %s Sign Transaction]", rawTx.Coin.Symbol, tokenSymbol)
-	log.Infof("SID: %s", rawTx.Sid)
+	log.Infof("%s", LogFields("sid", rawTx.Sid))
 	log.Infof("From Account: %s", rawTx.AccountID)
 	log.Infof("To Address: %s", destination)
 	log.Infof("Send Amount: %s", amount)
@@ -731,7 +744,7 @@ func (cli *CLI) signTransactionViaTrustNode(ctx *owtp.Context) {
 	log.Infof("-----------------------------------------------")
 
 	//签名交易
-	signature, sigErr := cli.txSigner(rawTx.Signatures, key)
+	signature, sigErr := cli.signRawTransaction(&rawTx, key)
 	if sigErr != nil {
 		ctx.Response(nil, openwallet.ErrSignRawTransactionFailed, sigErr.Error())
 		return
@@ -744,6 +757,32 @@ func (cli *CLI) signTransactionViaTrustNode(ctx *owtp.Context) {
 	}, owtp.StatusSuccess, "success")
 }
 
+// isPasswordParamRejected 配置拒绝携带密码的请求时，响应错误
+func (cli *CLI) isPasswordParamRejected(ctx *owtp.Context, password string) bool {
+	if cli.config.rejectpasswordparam && len(password) > 0 {
+		ctx.Response(nil, ErrorPasswordParamRejected, "the node rejects request carrying password, please unlock wallet on local node")
+		return true
+	}
+	return false
+}
+
+// responsePendingTransfer 保存待审批请求，并响应请求方等待审批
+func (cli *CLI) responsePendingTransfer(ctx *owtp.Context, pending *PendingTransfer) {
+
+	err := cli.SavePendingTransfer(pending)
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+
+	log.Infof("[%s] request from %s is waiting for approval, pending ID: %s", pending.Type, pending.PeerID, pending.ID)
+
+	ctx.Response(map[string]interface{}{
+		"pendingID": pending.ID,
+		"status":    pending.Status,
+	}, ErrorTransferIsPending, "the request is waiting for approval")
+}
+
 // TriggerABIViaTrustNode 触发ABI上链调用
 // @param nodeID 必填 节点ID
 // @param accountID 必填 账户ID
@@ -757,18 +796,6 @@ func (cli *CLI) signTransactionViaTrustNode(ctx *owtp.Context) {
 // @param rawType 可选 原始交易单编码类型，0：hex字符串，1：json字符串，2：base64字符串
 func (cli *CLI) triggerABIViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enablerequesttransfer {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [transfer] ability")
-		return
-	}
-
-	appID := ctx.Params().Get("appID").String()
-
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	accountID := ctx.Params().Get("accountID").String()
 	sid := ctx.Params().Get("sid").String()
 	contractAddress := ctx.Params().Get("contractAddress").String()
@@ -782,6 +809,10 @@ func (cli *CLI) triggerABIViaTrustNode(ctx *owtp.Context) {
 	awaitResult := ctx.Params().Get("awaitResult").Bool()
 	symbol := ctx.Params().Get("symbol").String()
 
+	if cli.isPasswordParamRejected(ctx, password) {
+		return
+	}
+
 	abiParam := make([]string, 0)
 	for _, s := range abiArr.Array() {
 		abiParam = append(abiParam, s.String())
@@ -799,11 +830,29 @@ func (cli *CLI) triggerABIViaTrustNode(ctx *owtp.Context) {
 		return
 	}
 
-	if len(password) == 0 {
-		//钱包是否已经解锁
-		if p, exist := cli.unlockWallets[wallet.WalletID]; exist {
-			password = p
+	//开启审批时，合约调用等待人工审批
+	if cli.isSigningNeedApproval() {
+		pending := &PendingTransfer{
+			Type:            PendingTypeTriggerABI,
+			PeerID:          ctx.PeerID,
+			Sid:             sid,
+			WalletID:        wallet.WalletID,
+			AccountID:       accountID,
+			Symbol:          symbol,
+			ContractAddress: contractAddress,
+			Address:         contractAddress,
+			Amount:          amount,
+			FeeRate:         feeRate,
 		}
+		pending.setPendingParams(&pendingTriggerABIParams{
+			ContractABI: contractABI,
+			AbiParam:    abiParam,
+			Raw:         raw,
+			RawType:     rawType,
+			AwaitResult: awaitResult,
+		})
+		cli.responsePendingTransfer(ctx, pending)
+		return
 	}
 
 	retTx, exErr := cli.TriggerABI(wallet, account, symbol, contractAddress, contractABI, amount, sid, feeRate, password, abiParam, raw, rawType, awaitResult)
@@ -818,18 +867,8 @@ func (cli *CLI) triggerABIViaTrustNode(ctx *owtp.Context) {
 // signHashViaTrustNode 通过节点签名哈希消息
 func (cli *CLI) signHashViaTrustNode(ctx *owtp.Context) {
 
-	if !cli.config.enablerequesttransfer {
-		ctx.Response(nil, ErrorNodeAbilityDisabled, "the node has disabled [transfer] ability")
-		return
-	}
-
 	appID := ctx.Params().Get("appID").String()
 
-	if appID != cli.config.appid {
-		ctx.Response(nil, ErrorAppIDIncorrect, "appID is incorrect")
-		return
-	}
-
 	walletID := ctx.Params().Get("walletID").String()
 	accountID := ctx.Params().Get("accountID").String()
 	message := ctx.Params().Get("message").String()
@@ -839,11 +878,27 @@ func (cli *CLI) signHashViaTrustNode(ctx *owtp.Context) {
 	hdPath := ctx.Params().Get("hdPath").String()
 	rsv := ctx.Params().Get("rsv").Bool()
 
-	if len(password) == 0 {
-		//钱包是否已经解锁
-		if p, exist := cli.unlockWallets[walletID]; exist {
-			password = p
+	if cli.isPasswordParamRejected(ctx, password) {
+		return
+	}
+
+	//开启审批时，哈希签名等待人工审批
+	if cli.isSigningNeedApproval() {
+		pending := &PendingTransfer{
+			Type:      PendingTypeSignHash,
+			PeerID:    ctx.PeerID,
+			WalletID:  walletID,
+			AccountID: accountID,
+			Symbol:    symbol,
+			Address:   address,
 		}
+		pending.setPendingParams(&pendingSignHashParams{
+			Message: message,
+			HdPath:  hdPath,
+			Rsv:     rsv,
+		})
+		cli.responsePendingTransfer(ctx, pending)
+		return
 	}
 
 	addr := &openwsdk.Address{
@@ -865,3 +920,46 @@ func (cli *CLI) signHashViaTrustNode(ctx *owtp.Context) {
 		"signature": signature,
 	}, owtp.StatusSuccess, "success")
 }
+
+// unlockWalletViaTrustNode 通过节点解锁钱包会话
+// @param walletID 必填 钱包ID
+// @param password 必填 钱包解锁密码
+// @param ttl 可选 会话有效秒数，默认使用配置的unlockttl
+func (cli *CLI) unlockWalletViaTrustNode(ctx *owtp.Context) {
+
+	walletID := ctx.Params().Get("walletID").String()
+	password := ctx.Params().Get("password").String()
+	ttl := ctx.Params().Get("ttl").Int()
+
+	if cli.isPasswordParamRejected(ctx, password) {
+		return
+	}
+
+	wallet, err := cli.GetWalletByWalletIDOnLocal(walletID)
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+
+	err = cli.UnlockWallet(wallet, password, time.Duration(ttl)*time.Second)
+	if err != nil {
+		ctx.Response(nil, openwallet.ErrUnknownException, err.Error())
+		return
+	}
+
+	ctx.Response(map[string]interface{}{
+		"walletID":   walletID,
+		"expireTime": cli.UnlockedWallets()[walletID],
+	}, owtp.StatusSuccess, "success")
+}
+
+// lockWalletViaTrustNode 通过节点锁定钱包会话
+// @param walletID 可选 钱包ID，为空锁定全部钱包
+func (cli *CLI) lockWalletViaTrustNode(ctx *owtp.Context) {
+
+	walletID := ctx.Params().Get("walletID").String()
+
+	cli.LockWallet(walletID)
+
+	ctx.Response(nil, owtp.StatusSuccess, "success")
+}
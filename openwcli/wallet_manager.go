@@ -4,6 +4,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/blocktree/go-owcrypt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -17,15 +19,14 @@ import (
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/blocktree/openwallet/v2/owtp"
 	"github.com/bndr/gotabulate"
+	"github.com/tyler-smith/go-bip39"
 )
 
 // CreateWalletOnServer
 func (cli *CLI) CreateWalletOnServer(name, password string) (*openwsdk.Wallet, error) {
 
 	var (
-		key       *hdkeystore.HDKey
-		retWallet *openwsdk.Wallet
-		retErr    error
+		key *hdkeystore.HDKey
 	)
 
 	if len(name) == 0 {
@@ -49,47 +50,235 @@ func (cli *CLI) CreateWalletOnServer(name, password string) (*openwsdk.Wallet, e
 		return nil, err
 	}
 
+	return cli.registerWalletOnServer(name, key, filePath, false)
+}
+
+// CreateWalletWithSeedOnServer 通过种子生成keystore并登记到openw-server，用于助记词创建和导入钱包
+// 种子相同则WalletID相同，已在openw-server登记的钱包直接使用
+func (cli *CLI) CreateWalletWithSeedOnServer(name, password string, seed []byte) (*openwsdk.Wallet, error) {
+	return cli.createWalletWithSeedOnServer(name, password, seed, "")
+}
+
+// createWalletWithSeedOnServer 先在临时目录生成keystore，walletID不为空时校验种子对应的WalletID，
+// 校验通过且本地没有相同的钱包，才移动到keydir并登记到openw-server
+func (cli *CLI) createWalletWithSeedOnServer(name, password string, seed []byte, walletID string) (*openwsdk.Wallet, error) {
+
+	if len(name) == 0 {
+		return nil, fmt.Errorf("wallet name is empty. ")
+	}
+
+	if len(password) == 0 {
+		return nil, fmt.Errorf("wallet password is empty. ")
+	}
+
+	tmpDir, err := ioutil.TempDir(cli.config.datadir, "newkey-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	key, tmpPath, err := hdkeystore.StoreHDKeyWithSeed(
+		tmpDir,
+		name,
+		password,
+		seed,
+		hdkeystore.StandardScryptN,
+		hdkeystore.StandardScryptP,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(walletID) > 0 && key.KeyID != walletID {
+		return nil, fmt.Errorf("seed wallet: %s is not match with wallet: %s", key.KeyID, walletID)
+	}
+
+	//本地已存在相同的钱包
+	localWallets, err := openwallet.GetWalletsByKeyDir(cli.config.keydir)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range localWallets {
+		if w.WalletID == key.KeyID {
+			return nil, fmt.Errorf("wallet: %s already exists, key path: %s", key.KeyID, w.KeyFile)
+		}
+	}
+
+	filePath := filepath.Join(cli.config.keydir, filepath.Base(tmpPath))
+	err = os.Rename(tmpPath, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.registerWalletOnServer(name, key, filePath, true)
+}
+
+// registerWalletOnServer 登记钱包到openw-server，失败时删除key文件
+func (cli *CLI) registerWalletOnServer(name string, key *hdkeystore.HDKey, filePath string, allowExisted bool) (*openwsdk.Wallet, error) {
+
+	var (
+		retWallet *openwsdk.Wallet
+		retErr    error
+	)
+
 	walletParam := &openwsdk.Wallet{
 		Alias:    name,
 		WalletID: key.KeyID,
 	}
 
-	//登记钱包的openw-server
-	err = cli.api.CreateWallet(walletParam, true,
-		func(status uint64, msg string, wallet *openwsdk.Wallet) {
-			if status == owtp.StatusSuccess {
-				log.Info("Wallet create successfully, key path:", filePath)
-				retWallet = wallet
-			} else {
-				log.Error("create wallet on server failed, unexpected error:", msg)
-				retErr = openwallet.Errorf(status, msg)
-				//创建失败，删除key文件
-				file.Delete(filePath)
+	//导入的钱包可能已登记过
+	if allowExisted {
+		cli.callAPI("FindWalletByWalletID", func() error {
+			var statusErr error
+			err := cli.api.FindWalletByWalletID(key.KeyID, true,
+				func(status uint64, msg string, wallet *openwsdk.Wallet) {
+					statusErr = apiStatusError(status, msg)
+					if status == owtp.StatusSuccess && wallet != nil {
+						retWallet = wallet
+					}
+				})
+			if err != nil {
+				return err
 			}
+			return statusErr
 		})
+		if retWallet != nil {
+			log.Info("Wallet has been registered, key path:", filePath)
+			return retWallet, nil
+		}
+	}
+
+	//登记钱包的openw-server
+	err := cli.callAPI("CreateWallet", func() error {
+		var statusErr error
+		err := cli.api.CreateWallet(walletParam, true,
+			func(status uint64, msg string, wallet *openwsdk.Wallet) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess && wallet != nil {
+					log.Info("Wallet create successfully, key path:", filePath)
+					retWallet = wallet
+				} else {
+					log.Error("create wallet on server failed, unexpected error:", msg)
+					retErr = openwallet.Errorf(status, msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
+	if err == nil && retWallet == nil {
+		err = retErr
+		if err == nil {
+			err = fmt.Errorf("create wallet on server failed, no wallet is returned")
+		}
+	}
 	if err != nil {
+		//登记失败，删除key文件
+		file.Delete(filePath)
 		return nil, err
 	}
 
-	return retWallet, retErr
+	return retWallet, nil
+}
+
+// NewMnemonic 生成24个单词的BIP39助记词
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// ParseWalletSeed 解析助记词或十六进制种子
+func ParseWalletSeed(input string) ([]byte, error) {
+
+	input = strings.Join(strings.Fields(input), " ")
+
+	if len(input) == 0 {
+		return nil, fmt.Errorf("mnemonic or seed is empty. ")
+	}
+
+	//keystore只能保存种子，扩展私钥不包含种子，也无法推导出相同的WalletID，暂不支持导入
+	if strings.HasPrefix(input, "xprv") || strings.HasPrefix(input, "tprv") {
+		return nil, fmt.Errorf("extended private key import is not supported, the keystore can only save a seed, please import by mnemonic or hex seed")
+	}
+
+	//助记词
+	if strings.Contains(input, " ") {
+		seed, err := bip39.NewSeedWithErrorChecking(strings.ToLower(input), "")
+		if err != nil {
+			return nil, fmt.Errorf("mnemonic is invalid: %v", err)
+		}
+		return seed, nil
+	}
+
+	//十六进制种子
+	seed, err := hex.DecodeString(strings.TrimPrefix(input, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("seed is not a valid mnemonic or hex string")
+	}
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed length should be between 16 and 64 bytes")
+	}
+	return seed, nil
 }
 
 // GetWalletsByKeyDir 通过给定的文件路径加载keystore文件得到钱包列表
 func (cli *CLI) GetWalletsOnServer() ([]*openwsdk.Wallet, error) {
-	localWallets, err := openwallet.GetWalletsByKeyDir(cli.config.keydir)
+	localWallets, err := getKeyDirWallets(cli.config.keydir)
 	if err != nil {
 		return nil, err
 	}
 	serverWallets := make([]*openwsdk.Wallet, 0)
 
 	for _, w := range localWallets {
-		callErr := cli.api.FindWalletByWalletID(w.WalletID, true,
-			func(status uint64, msg string, wallet *openwsdk.Wallet) {
-				if status == owtp.StatusSuccess && wallet != nil {
-					serverWallets = append(serverWallets, wallet)
-				}
-			})
-		if callErr != nil {
+		alias := w.Alias
+		var statusErr error
+		callErr := cli.callAPI("FindWalletByWalletID", func() error {
+			err := cli.api.FindWalletByWalletID(w.WalletID, true,
+				func(status uint64, msg string, wallet *openwsdk.Wallet) {
+					statusErr = apiStatusError(status, msg)
+					if status == owtp.StatusSuccess && wallet != nil {
+						//本地改名后以keystore的别名为准
+						wallet.Alias = alias
+						serverWallets = append(serverWallets, wallet)
+					}
+				})
+			if err != nil {
+				return err
+			}
+			return statusErr
+		})
+		//没有登记的钱包跳过
+		if callErr != nil && callErr != statusErr {
+			return nil, callErr
+		}
+	}
+
+	//观察钱包
+	watchWallets, err := cli.GetWatchOnlyWallets()
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range watchWallets {
+		var statusErr error
+		callErr := cli.callAPI("FindWalletByWalletID", func() error {
+			err := cli.api.FindWalletByWalletID(w.WalletID, true,
+				func(status uint64, msg string, wallet *openwsdk.Wallet) {
+					statusErr = apiStatusError(status, msg)
+					if status == owtp.StatusSuccess && wallet != nil {
+						serverWallets = append(serverWallets, wallet)
+					}
+				})
+			if err != nil {
+				return err
+			}
+			return statusErr
+		})
+		//没有登记的钱包跳过
+		if callErr != nil && callErr != statusErr {
 			return nil, callErr
 		}
 	}
@@ -109,14 +298,22 @@ func (cli *CLI) GetWalletByWalletID(walletID string) (*openwsdk.Wallet, error) {
 		return nil, err
 	}
 
-	err = cli.api.FindWalletByWalletID(walletID, true,
-		func(status uint64, msg string, wallet *openwsdk.Wallet) {
-			if status == owtp.StatusSuccess && wallet != nil {
-				localWallet = wallet
-			} else {
-				findErr = fmt.Errorf(msg)
-			}
-		})
+	err = cli.callAPI("FindWalletByWalletID", func() error {
+		var statusErr error
+		err := cli.api.FindWalletByWalletID(walletID, true,
+			func(status uint64, msg string, wallet *openwsdk.Wallet) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess && wallet != nil {
+					localWallet = wallet
+				} else {
+					findErr = fmt.Errorf(msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +327,27 @@ func (cli *CLI) GetWalletByWalletID(walletID string) (*openwsdk.Wallet, error) {
 
 // GetWalletByWalletIDOnLocal 查找本地种子目录的钱包对象
 func (cli *CLI) GetWalletByWalletIDOnLocal(walletID string) (*openwsdk.Wallet, error) {
-	localWallets, err := openwallet.GetWalletsByKeyDir(cli.config.keydir)
+
+	wallet, err := cli.getKeystoreWallet(walletID)
+	if err == nil {
+		return wallet, nil
+	}
+
+	//观察钱包
+	watchWallet, watchErr := cli.getWatchOnlyWallet(walletID)
+	if watchErr == nil {
+		return &openwsdk.Wallet{
+			WalletID: watchWallet.WalletID,
+			Alias:    watchWallet.Alias,
+		}, nil
+	}
+
+	return nil, err
+}
+
+// getKeystoreWallet 查找本地有keystore的钱包
+func (cli *CLI) getKeystoreWallet(walletID string) (*openwsdk.Wallet, error) {
+	localWallets, err := getKeyDirWallets(cli.config.keydir)
 	if err != nil {
 		return nil, err
 	}
@@ -154,15 +371,27 @@ func (cli *CLI) printWalletList(list []*openwsdk.Wallet) {
 	if list != nil && len(list) > 0 {
 		tableInfo := make([][]interface{}, 0)
 
+		//一次读取观察钱包，读取失败时类型显示为unknown
+		watchOnlyIDs, err := cli.getWatchOnlyWalletIDs()
+		if err != nil {
+			log.Warningf("load watch-only wallets failed: %v", err)
+		}
+
 		for i, w := range list {
+			walletType := "local"
+			if err != nil {
+				walletType = "unknown"
+			} else if watchOnlyIDs[w.WalletID] {
+				walletType = "watch-only"
+			}
 			tableInfo = append(tableInfo, []interface{}{
-				i, w.Alias, w.WalletID, w.AccountIndex + 1,
+				i, w.Alias, w.WalletID, w.AccountIndex + 1, walletType,
 			})
 		}
 
 		t := gotabulate.Create(tableInfo)
 		// Set Headers
-		t.SetHeaders([]string{"No.", "Name", "WalletID", "Accounts"})
+		t.SetHeaders([]string{"No.", "Name", "WalletID", "Accounts", "Type"})
 
 		//打印信息
 		fmt.Println(t.Render("simple"))
@@ -187,28 +416,12 @@ func (cli *CLI) CreateAccountOnServer(name, password, symbol string, wallet *ope
 		return nil, nil, fmt.Errorf("acount name is empty. ")
 	}
 
-	if len(password) == 0 {
-		return nil, nil, fmt.Errorf("wallet password is empty. ")
-	}
-
 	selectedSymbol, err = cli.GetSymbolInfo(symbol)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	keystore := hdkeystore.NewHDKeystore(
-		cli.config.keydir,
-		hdkeystore.StandardScryptN,
-		hdkeystore.StandardScryptP,
-	)
-
-	fileName := fmt.Sprintf("%s-%s.key", wallet.Alias, wallet.WalletID)
-
-	key, err = keystore.GetKey(
-		wallet.WalletID,
-		fileName,
-		password,
-	)
+	key, err = cli.getLocalKeyByWallet(wallet, password)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -219,22 +432,30 @@ func (cli *CLI) CreateAccountOnServer(name, password, symbol string, wallet *ope
 	}
 
 	//登记钱包的openw-server
-	err = cli.api.CreateNormalAccount(newaccount, true,
-		func(status uint64, msg string, account *openwsdk.Account, addresses []*openwsdk.Address) {
-			if status == owtp.StatusSuccess {
-				log.Infof("create [%s] account successfully", selectedSymbol.Symbol)
-				log.Infof("new accountID: %s", account.AccountID)
-				if len(addresses) > 0 {
-					log.Infof("new address: %s", addresses[0].Address)
-				}
+	err = cli.callAPI("CreateNormalAccount", func() error {
+		var statusErr error
+		err := cli.api.CreateNormalAccount(newaccount, true,
+			func(status uint64, msg string, account *openwsdk.Account, addresses []*openwsdk.Address) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					log.Infof("create [%s] account successfully", selectedSymbol.Symbol)
+					log.Infof("new account, %s", LogFields("accountID", account.AccountID))
+					if len(addresses) > 0 {
+						log.Infof("new address: %s", addresses[0].Address)
+					}
 
-				retAccount = account
-				retAddresses = addresses
-			} else {
-				log.Error("create account on server failed, unexpected error:", msg)
-				retErr = fmt.Errorf(msg)
-			}
-		})
+					retAccount = account
+					retAddresses = addresses
+				} else {
+					log.Error("create account on server failed, unexpected error:", msg)
+					retErr = fmt.Errorf(msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 
 	if err != nil {
 		return nil, nil, err
@@ -255,14 +476,22 @@ func (cli *CLI) GetAccountByAccountID(symbol, accountID string) (*openwsdk.Accou
 		retErr     error
 	)
 
-	err = cli.api.FindAccountByAccountID(symbol, accountID, 0, true,
-		func(status uint64, msg string, account *openwsdk.Account) {
-			if status == owtp.StatusSuccess {
-				getAccount = account
-			} else {
-				retErr = fmt.Errorf(msg)
-			}
-		})
+	err = cli.callAPI("FindAccountByAccountID", func() error {
+		var statusErr error
+		err := cli.api.FindAccountByAccountID(symbol, accountID, 0, true,
+			func(status uint64, msg string, account *openwsdk.Account) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					getAccount = account
+				} else {
+					retErr = fmt.Errorf(msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -284,14 +513,22 @@ func (cli *CLI) GetAccountsOnServer(walletID string) ([]*openwsdk.Account, error
 		limit  = int64(200)
 	)
 
-	err = cli.api.FindAccountByWalletID("", walletID, lastID, limit, true,
-		func(status uint64, msg string, accounts []*openwsdk.Account) {
-			if status == owtp.StatusSuccess && len(accounts) > 0 {
-				list = append(list, accounts...)
-			} else {
-				retErr = fmt.Errorf(msg)
-			}
-		})
+	err = cli.callAPI("FindAccountByWalletID", func() error {
+		var statusErr error
+		err := cli.api.FindAccountByWalletID("", walletID, lastID, limit, true,
+			func(status uint64, msg string, accounts []*openwsdk.Account) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess && len(accounts) > 0 {
+					list = append(list, accounts...)
+				} else {
+					retErr = fmt.Errorf(msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 
 	if err != nil {
 		return nil, err
@@ -300,7 +537,8 @@ func (cli *CLI) GetAccountsOnServer(walletID string) ([]*openwsdk.Account, error
 		return nil, retErr
 	}
 
-	return list, nil
+	//观察钱包只返回已登记的账户
+	return cli.filterWatchOnlyAccounts(walletID, list)
 }
 
 // printAccountList 打印账户列表
@@ -328,14 +566,22 @@ func (cli *CLI) printAccountList(list []*openwsdk.Account) {
 			}
 			balanceStr := "0"
 			//查询账户余额
-			cli.api.GetBalanceByAccount(w.Symbol, w.AccountID, "",
-				true, func(status uint64, msg string, balance *openwsdk.BalanceResult) {
-					if status == owtp.StatusSuccess {
-						balanceStr = balance.Balance
-					} else {
-						balanceStr = "N/A"
-					}
-				})
+			cli.callAPI("GetBalanceByAccount", func() error {
+				var statusErr error
+				err := cli.api.GetBalanceByAccount(w.Symbol, w.AccountID, "",
+					true, func(status uint64, msg string, balance *openwsdk.BalanceResult) {
+						statusErr = apiStatusError(status, msg)
+						if status == owtp.StatusSuccess {
+							balanceStr = balance.Balance
+						} else {
+							balanceStr = "N/A"
+						}
+					})
+				if err != nil {
+					return err
+				}
+				return statusErr
+			})
 
 			tableInfo = append(tableInfo, []interface{}{
 				i, w.Id, w.Alias, w.AccountID, w.Symbol, balanceStr, w.AddressIndex + 1, sumTips,
@@ -371,6 +617,12 @@ func (cli *CLI) printAccountSummaryInfo() {
 		return
 	}
 
+	err = cli.decryptSummarySettings(sum...)
+	if err != nil {
+		log.Error("decrypt summary info failed, unexpected error: ", err)
+		return
+	}
+
 	tableInfo := make([][]interface{}, 0)
 
 	for _, s := range sum {
@@ -406,24 +658,32 @@ func (cli *CLI) CreateAddressOnServer(walletID, accountID, symbol string, count
 		return fmt.Errorf("create address count can not 0. ")
 	}
 
-	err := cli.api.CreateAddress(symbol, walletID, accountID, count, true,
-		func(status uint64, msg string, addresses []*openwsdk.Address) {
-			if status == owtp.StatusSuccess {
-				log.Infof("create [%d] addresses successfully", len(addresses))
-				//:保存到本地数据库，导出到文件夹
-				timestamp := time.Now()
-				filename := "[" + accountID + "]-" + common.TimeFormat("20060102150405", timestamp) + ".txt"
-				filePath := filepath.Join(cli.config.exportaddressdir, filename)
-				if flag := cli.exportAddressToFile(addresses, filePath); flag {
-					log.Infof("addresses has been exported into: %s", filePath)
+	err := cli.callAPI("CreateAddress", func() error {
+		var statusErr error
+		err := cli.api.CreateAddress(symbol, walletID, accountID, count, true,
+			func(status uint64, msg string, addresses []*openwsdk.Address) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					log.Infof("create [%d] addresses successfully", len(addresses))
+					//:保存到本地数据库，导出到文件夹
+					timestamp := time.Now()
+					filename := "[" + accountID + "]-" + common.TimeFormat("20060102150405", timestamp) + ".txt"
+					filePath := filepath.Join(cli.config.exportaddressdir, filename)
+					if flag := cli.exportAddressToFile(addresses, filePath); flag {
+						log.Infof("addresses has been exported into: %s", filePath)
+					} else {
+						log.Infof("addresses export failed")
+					}
 				} else {
-					log.Infof("addresses export failed")
+					log.Error("create account on server failed, unexpected error:", msg)
+					retErr = openwallet.Errorf(status, msg)
 				}
-			} else {
-				log.Error("create account on server failed, unexpected error:", msg)
-				retErr = openwallet.Errorf(status, msg)
-			}
-		})
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 
 	if err != nil {
 		return err
@@ -459,15 +719,23 @@ func (cli *CLI) SearchAddressOnServer(symbol, address string) (*openwsdk.Address
 
 	var addr *openwsdk.Address
 
-	err := cli.api.FindAddressByAddress(symbol, address, true,
-		func(status uint64, msg string, address *openwsdk.Address) {
-			if status == owtp.StatusSuccess {
-				addr = address
-			} else {
-				log.Error("search address on server failed, unexpected error:", msg)
-				retErr = openwallet.Errorf(status, msg)
-			}
-		})
+	err := cli.callAPI("FindAddressByAddress", func() error {
+		var statusErr error
+		err := cli.api.FindAddressByAddress(symbol, address, true,
+			func(status uint64, msg string, address *openwsdk.Address) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					addr = address
+				} else {
+					log.Error("search address on server failed, unexpected error:", msg)
+					retErr = openwallet.Errorf(status, msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -492,15 +760,23 @@ func (cli *CLI) GetAddressesOnServer(walletID, accountID, symbol string, lastId,
 		return nil, fmt.Errorf("walleID is empty. ")
 	}
 
-	err := cli.api.FindAddressByAccountID(symbol, accountID, lastId, limit, true,
-		func(status uint64, msg string, addresses []*openwsdk.Address) {
-			if status == owtp.StatusSuccess {
-				list = addresses
-			} else {
-				log.Error("get address on server failed, unexpected error:", msg)
-				retErr = openwallet.Errorf(status, msg)
-			}
-		})
+	err := cli.callAPI("FindAddressByAccountID", func() error {
+		var statusErr error
+		err := cli.api.FindAddressByAccountID(symbol, accountID, lastId, limit, true,
+			func(status uint64, msg string, addresses []*openwsdk.Address) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					list = addresses
+				} else {
+					log.Error("get address on server failed, unexpected error:", msg)
+					retErr = openwallet.Errorf(status, msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -534,7 +810,7 @@ func (cli *CLI) printAddressList(walletID, symbol string, list []*openwsdk.Addre
 			return err
 		}
 
-		fileName := fmt.Sprintf("%s-%s.key", w.Alias, w.WalletID)
+		fileName := cli.keyFileName(w)
 
 		key, err = keystore.GetKey(
 			w.WalletID,
@@ -552,14 +828,22 @@ func (cli *CLI) printAddressList(walletID, symbol string, list []*openwsdk.Addre
 		for _, a := range list {
 
 			balanceStr := "0"
-			cli.api.GetBalanceByAddress(symbol, a.Address, "",
-				true, func(status uint64, msg string, balance *openwsdk.BalanceResult) {
-					if status == owtp.StatusSuccess {
-						balanceStr = balance.Balance
-					} else {
-						balanceStr = "N/A"
-					}
-				})
+			cli.callAPI("GetBalanceByAddress", func() error {
+				var statusErr error
+				err := cli.api.GetBalanceByAddress(symbol, a.Address, "",
+					true, func(status uint64, msg string, balance *openwsdk.BalanceResult) {
+						statusErr = apiStatusError(status, msg)
+						if status == owtp.StatusSuccess {
+							balanceStr = balance.Balance
+						} else {
+							balanceStr = "N/A"
+						}
+					})
+				if err != nil {
+					return err
+				}
+				return statusErr
+			})
 
 			if isShowPrivateKey && key != nil {
 
@@ -639,10 +923,18 @@ func (cli *CLI) UpdateSymbols() error {
 	defer cli.closeDB()
 
 	var getSymbols []*openwsdk.Symbol
-	err = cli.api.GetSymbolList("", 0, limit, 0, true,
-		func(status uint64, msg string, total int, symbols []*openwsdk.Symbol) {
-			getSymbols = symbols
-		})
+	err = cli.callAPI("GetSymbolList", func() error {
+		var statusErr error
+		err := cli.api.GetSymbolList("", 0, limit, 0, true,
+			func(status uint64, msg string, total int, symbols []*openwsdk.Symbol) {
+				statusErr = apiStatusError(status, msg)
+				getSymbols = symbols
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return err
 	}
@@ -659,10 +951,18 @@ func (cli *CLI) UpdateSymbols() error {
 		for {
 
 			var getTokenContract []*openwsdk.TokenContract
-			err = cli.api.GetContracts(s.Symbol, "", i, limit, true,
-				func(status uint64, msg string, tokenContract []*openwsdk.TokenContract) {
-					getTokenContract = tokenContract
-				})
+			err = cli.callAPI("GetContracts", func() error {
+				var statusErr error
+				err := cli.api.GetContracts(s.Symbol, "", i, limit, true,
+					func(status uint64, msg string, tokenContract []*openwsdk.TokenContract) {
+						statusErr = apiStatusError(status, msg)
+						getTokenContract = tokenContract
+					})
+				if err != nil {
+					return err
+				}
+				return statusErr
+			})
 			if err != nil || len(getTokenContract) == 0 {
 				break
 			}
@@ -694,10 +994,18 @@ func (cli *CLI) UpdateSymbols() error {
 // UpdateSymbols 更新主链
 func (cli *CLI) UpdateTokenContracts(symbol string) error {
 	var getTokenContract []*openwsdk.TokenContract
-	err := cli.api.GetContracts(symbol, "", 0, 5000, true,
-		func(status uint64, msg string, tokenContract []*openwsdk.TokenContract) {
-			getTokenContract = tokenContract
-		})
+	err := cli.callAPI("GetContracts", func() error {
+		var statusErr error
+		err := cli.api.GetContracts(symbol, "", 0, 5000, true,
+			func(status uint64, msg string, tokenContract []*openwsdk.TokenContract) {
+				statusErr = apiStatusError(status, msg)
+				getTokenContract = tokenContract
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return err
 	}
@@ -910,18 +1218,30 @@ func (cli *CLI) SetSummaryInfo(obj *openwsdk.SummarySetting) error {
 	}
 	defer cli.closeDB()
 
-	return cli.db.Save(obj)
+	return cli.saveSummarySetting(obj)
 }
 
-// getLocalKeyByWallet
+// getLocalKeyByWallet 解密钱包种子，密码为空时使用已解锁的钱包会话
 func (cli *CLI) getLocalKeyByWallet(wallet *openwsdk.Wallet, password string) (*hdkeystore.HDKey, error) {
+
+	if err := cli.checkNotWatchOnlyWallet(wallet.WalletID); err != nil {
+		return nil, err
+	}
+
+	if len(password) == 0 {
+		if key := cli.getUnlockedKey(wallet.WalletID); key != nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("wallet: %s is locked, password is empty", wallet.WalletID)
+	}
+
 	keystore := hdkeystore.NewHDKeystore(
 		cli.config.keydir,
 		hdkeystore.StandardScryptN,
 		hdkeystore.StandardScryptP,
 	)
 
-	fileName := fmt.Sprintf("%s-%s.key", wallet.Alias, wallet.WalletID)
+	fileName := cli.keyFileName(wallet)
 
 	key, err := keystore.GetKey(
 		wallet.WalletID,
@@ -934,6 +1254,38 @@ func (cli *CLI) getLocalKeyByWallet(wallet *openwsdk.Wallet, password string) (*
 	return key, nil
 }
 
+// getLocalSeedByWallet 解密钱包种子
+func (cli *CLI) getLocalSeedByWallet(wallet *openwsdk.Wallet, password string) ([]byte, error) {
+	key, err := cli.getLocalKeyByWallet(wallet, password)
+	if err != nil {
+		return nil, err
+	}
+	return key.Seed(), nil
+}
+
+// SplitWallet 把钱包种子拆分为total个分片，任意threshold个可以恢复
+// 分片不写入文件和日志，由调用者逐个交给不同的保管人
+func (cli *CLI) SplitWallet(wallet *openwsdk.Wallet, password string, total, threshold int) ([]*WalletShare, error) {
+
+	seed, err := cli.getLocalSeedByWallet(wallet, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return SplitSeed(wallet.WalletID, seed, total, threshold)
+}
+
+// CombineWallet 通过分片恢复钱包种子，先校验种子对应的WalletID与分片一致，再生成keystore并登记到openw-server
+func (cli *CLI) CombineWallet(name, password string, shares []*WalletShare) (*openwsdk.Wallet, error) {
+
+	seed, err := CombineSeed(shares)
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.createWalletWithSeedOnServer(name, password, seed, shares[0].WalletID)
+}
+
 // GetAllTokenContractBalance 查询账户合约余额
 func (cli *CLI) GetAllTokenContractBalance(walletID, accountID string, symbol string) ([]*openwsdk.BalanceResult, error) {
 
@@ -941,14 +1293,22 @@ func (cli *CLI) GetAllTokenContractBalance(walletID, accountID string, symbol st
 		getErr      error
 		getBalances []*openwsdk.BalanceResult
 	)
-	err := cli.api.GetAllTokenBalanceByAccount(walletID, accountID, symbol, true,
-		func(status uint64, msg string, balance []*openwsdk.BalanceResult) {
-			if status == owtp.StatusSuccess {
-				getBalances = balance
-			} else {
-				getErr = fmt.Errorf(msg)
-			}
-		})
+	err := cli.callAPI("GetAllTokenBalanceByAccount", func() error {
+		var statusErr error
+		err := cli.api.GetAllTokenBalanceByAccount(walletID, accountID, symbol, true,
+			func(status uint64, msg string, balance []*openwsdk.BalanceResult) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					getBalances = balance
+				} else {
+					getErr = fmt.Errorf(msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -967,14 +1327,22 @@ func (cli *CLI) GetAllTokenContractBalanceByAddress(walletID, accountID, address
 		getErr      error
 		getBalances []*openwsdk.BalanceResult
 	)
-	err := cli.api.GetAllTokenBalanceByAddress(walletID, accountID, address, symbol, true,
-		func(status uint64, msg string, balance []*openwsdk.BalanceResult) {
-			if status == owtp.StatusSuccess {
-				getBalances = balance
-			} else {
-				getErr = fmt.Errorf(msg)
-			}
-		})
+	err := cli.callAPI("GetAllTokenBalanceByAddress", func() error {
+		var statusErr error
+		err := cli.api.GetAllTokenBalanceByAddress(walletID, accountID, address, symbol, true,
+			func(status uint64, msg string, balance []*openwsdk.BalanceResult) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					getBalances = balance
+				} else {
+					getErr = fmt.Errorf(msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -1050,12 +1418,62 @@ func (cli *CLI) AddTrustAddress(trustAddress *openwsdk.TrustAddress) error {
 	if err != nil {
 		return err
 	}
+	err = cli.saveTrustAddress(trustAddress)
+	cli.closeDB()
+	if err != nil {
+		return err
+	}
+
+	//关闭数据库后通知，单次执行的命令可以马上发送
+	cli.Notify(NotifyEventTrustListChanged, map[string]interface{}{
+		"action":  "add",
+		"address": trustAddress.Address,
+		"symbol":  trustAddress.Symbol,
+		"memo":    trustAddress.Memo,
+	})
+	return nil
+}
+
+// RemoveTrustAddress 删除白名单地址
+func (cli *CLI) RemoveTrustAddress(address, symbol string) error {
+
+	err := cli.deleteTrustAddress(address, symbol)
+	if err != nil {
+		return err
+	}
+
+	cli.Notify(NotifyEventTrustListChanged, map[string]interface{}{
+		"action":  "remove",
+		"address": address,
+		"symbol":  symbol,
+	})
+	return nil
+}
+
+// deleteTrustAddress 从数据库删除白名单地址
+func (cli *CLI) deleteTrustAddress(address, symbol string) error {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return err
+	}
 	defer cli.closeDB()
 
-	err = cli.db.Save(trustAddress)
+	//地址加密保存，解密比较后按ID删除
+	matched, err := cli.findTrustAddresses(address, symbol)
 	if err != nil {
 		return err
 	}
+	if len(matched) == 0 {
+		return fmt.Errorf("%s %s is not in trust address list", symbol, address)
+	}
+	for _, t := range matched {
+		err = cli.db.DeleteStruct(t)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1082,6 +1500,11 @@ func (cli *CLI) ListTrustAddress(symbol string) ([]*openwsdk.TrustAddress, error
 	if err != nil {
 		return nil, nil
 	}
+
+	err = cli.decryptTrustAddresses(list...)
+	if err != nil {
+		return nil, err
+	}
 	return list, nil
 }
 
@@ -1123,6 +1546,10 @@ func (cli *CLI) importSummaryAddressToTrustAddress() error {
 	//读取汇总信息
 	var sum []*openwsdk.SummarySetting
 	cli.db.All(&sum)
+	err = cli.decryptSummarySettings(sum...)
+	if err != nil {
+		return err
+	}
 	if len(sum) > 0 {
 		for _, s := range sum {
 
@@ -1150,6 +1577,20 @@ func (cli *CLI) importSummaryAddressToTrustAddress() error {
 // EnableTrustAddress
 func (cli *CLI) EnableTrustAddress() error {
 
+	err := cli.enableTrustAddress()
+	if err != nil {
+		return err
+	}
+
+	cli.Notify(NotifyEventTrustListChanged, map[string]interface{}{
+		"action": "enable",
+	})
+	return nil
+}
+
+// enableTrustAddress 保存开启状态，第一次开启时导入汇总地址
+func (cli *CLI) enableTrustAddress() error {
+
 	_, err := cli.getDB()
 	if err != nil {
 		return err
@@ -1177,6 +1618,7 @@ func (cli *CLI) EnableTrustAddress() error {
 	if err != nil {
 		return fmt.Errorf("Enable Trust Address, unexpected error: %v ", err)
 	}
+
 	return nil
 }
 
@@ -1187,12 +1629,15 @@ func (cli *CLI) DisableTrustAddress() error {
 	if err != nil {
 		return err
 	}
-	defer cli.closeDB()
-
 	err = cli.db.Set(CLIBucket, EnableTrustAddress, false)
+	cli.closeDB()
 	if err != nil {
 		return fmt.Errorf("Enable Trust Address, unexpected error: %v ", err)
 	}
+
+	cli.Notify(NotifyEventTrustListChanged, map[string]interface{}{
+		"action": "disable",
+	})
 	return nil
 }
 
@@ -1223,26 +1668,22 @@ func (cli *CLI) printTrustAddressStatus() {
 
 // IsTrustAddress
 func (cli *CLI) IsTrustAddress(address, symbol string) bool {
-	var (
-		list []*openwsdk.TrustAddress
-		err  error
-	)
 
 	if cli.TrustAddressStatus() {
 
-		_, err = cli.getDB()
+		_, err := cli.getDB()
 		if err != nil {
-			fmt.Errorf("cli database open failed")
+			log.Errorf("cli database open failed")
 			return false
 		}
 		defer cli.closeDB()
 
-		err = cli.db.Select(
-			q.And(
-				q.Eq("Address", address),
-				q.Eq("Symbol", symbol),
-			)).Find(&list)
+		matched, err := cli.findTrustAddresses(address, symbol)
 		if err != nil {
+			log.Errorf("find trust address failed: %v", err)
+			return false
+		}
+		if len(matched) == 0 {
 			return false
 		}
 	}
@@ -1263,6 +1704,12 @@ func (cli *CLI) SignHash(address *openwsdk.Address, symbol, message, password st
 		return "", err
 	}
 
+	//开启联合签名时，哈希签名同样需要联合签名节点审批
+	err = cli.approveSignHash(wallet.WalletID, address, symbol, message)
+	if err != nil {
+		return "", err
+	}
+
 	symbolInfo, err := cli.GetSymbolInfo(symbol)
 	if err != nil {
 		return "", err
@@ -1312,15 +1759,23 @@ func (cli *CLI) GetAddressesBalance(walletID, accountID, symbol string, opType,
 		return nil, fmt.Errorf("walleID is empty. ")
 	}
 
-	err := cli.api.GetAddressBalanceList(walletID, accountID, "", symbol, "", opType, lastId, limit,
-		true, func(status uint64, msg string, balances []*openwsdk.BalanceResult) {
-			if status == owtp.StatusSuccess {
-				list = balances
-			} else {
-				log.Error("get address on server failed, unexpected error:", msg)
-				retErr = openwallet.Errorf(status, msg)
-			}
-		})
+	err := cli.callAPI("GetAddressBalanceList", func() error {
+		var statusErr error
+		err := cli.api.GetAddressBalanceList(walletID, accountID, "", symbol, "", opType, lastId, limit,
+			true, func(status uint64, msg string, balances []*openwsdk.BalanceResult) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess {
+					list = balances
+				} else {
+					log.Error("get address on server failed, unexpected error:", msg)
+					retErr = openwallet.Errorf(status, msg)
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
 	if err != nil {
 		return nil, err
 	}
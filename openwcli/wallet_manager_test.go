@@ -1,8 +1,10 @@
 package openwcli
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
@@ -460,3 +462,43 @@ func TestJSONUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestParseWalletSeed(t *testing.T) {
+
+	//BIP39测试向量，密码为空
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	seed, err := ParseWalletSeed(mnemonic)
+	if err != nil {
+		t.Errorf("ParseWalletSeed unexpected error: %v", err)
+		return
+	}
+	want := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	if hex.EncodeToString(seed) != want {
+		t.Errorf("seed: %x, want: %s", seed, want)
+		return
+	}
+
+	_, err = ParseWalletSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")
+	if err == nil {
+		t.Errorf("ParseWalletSeed should failed with invalid checksum")
+		return
+	}
+
+	seed, err = ParseWalletSeed("000102030405060708090a0b0c0d0e0f")
+	if err != nil || len(seed) != 16 {
+		t.Errorf("ParseWalletSeed hex seed failed, err: %v", err)
+		return
+	}
+
+	_, err = ParseWalletSeed("xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi")
+	if err == nil {
+		t.Errorf("ParseWalletSeed should failed with extended private key")
+		return
+	}
+
+	mnemonic, err = NewMnemonic()
+	if err != nil || len(strings.Fields(mnemonic)) != 24 {
+		t.Errorf("NewMnemonic failed, err: %v", err)
+		return
+	}
+}
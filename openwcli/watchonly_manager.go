@@ -0,0 +1,297 @@
+package openwcli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/owtp"
+)
+
+// AddWatchOnlyWallet 登记观察钱包，publicKeys为需要观察的账户公钥，为空则观察钱包在openw-server的全部账户
+func (cli *CLI) AddWatchOnlyWallet(walletID string, publicKeys []string) (*WatchOnlyWallet, []*WatchOnlyAccount, error) {
+
+	var (
+		serverWallet *openwsdk.Wallet
+	)
+
+	if len(walletID) == 0 {
+		return nil, nil, fmt.Errorf("walletID is empty. ")
+	}
+
+	if _, err := cli.getKeystoreWallet(walletID); err == nil {
+		return nil, nil, fmt.Errorf("wallet: %s has local keystore, it can not be watch-only", walletID)
+	}
+
+	err := cli.callAPI("FindWalletByWalletID", func() error {
+		var statusErr error
+		err := cli.api.FindWalletByWalletID(walletID, true,
+			func(status uint64, msg string, wallet *openwsdk.Wallet) {
+				statusErr = apiStatusError(status, msg)
+				if status == owtp.StatusSuccess && wallet != nil {
+					serverWallet = wallet
+				}
+			})
+		if err != nil {
+			return err
+		}
+		return statusErr
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if serverWallet == nil {
+		return nil, nil, fmt.Errorf("can not find wallet: %s on server", walletID)
+	}
+
+	accounts, err := cli.GetAccountsOnServer(walletID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watchAccounts, err := newWatchOnlyAccounts(walletID, accounts, publicKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watchWallet := &WatchOnlyWallet{
+		WalletID:   walletID,
+		Alias:      serverWallet.Alias,
+		CreateTime: time.Now().Unix(),
+	}
+
+	_, err = cli.getDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cli.closeDB()
+
+	tx, err := cli.db.Begin(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.Save(watchWallet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, a := range watchAccounts {
+		err = tx.Save(a)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return watchWallet, watchAccounts, nil
+}
+
+// newWatchOnlyAccounts 选择publicKeys对应的账户，publicKeys为空时选择全部账户，有公钥找不到账户时返回错误
+func newWatchOnlyAccounts(walletID string, accounts []*openwsdk.Account, publicKeys []string) ([]*WatchOnlyAccount, error) {
+
+	watchAccounts := make([]*WatchOnlyAccount, 0)
+	matched := make(map[string]bool)
+	for _, a := range accounts {
+		if len(publicKeys) > 0 && !containsString(publicKeys, a.PublicKey) {
+			continue
+		}
+		matched[a.PublicKey] = true
+		watchAccounts = append(watchAccounts, &WatchOnlyAccount{
+			AccountID: a.AccountID,
+			WalletID:  walletID,
+			Symbol:    a.Symbol,
+			PublicKey: a.PublicKey,
+		})
+	}
+
+	//多个账户使用同一个公钥时数量不能说明每个公钥都找到了
+	missing := make([]string, 0)
+	for _, key := range publicKeys {
+		if !matched[key] {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("public keys: %s can not be found in wallet: %s accounts", strings.Join(missing, ", "), walletID)
+	}
+
+	return watchAccounts, nil
+}
+
+// RemoveWatchOnlyWallet 删除观察钱包
+func (cli *CLI) RemoveWatchOnlyWallet(walletID string) error {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return err
+	}
+	defer cli.closeDB()
+
+	var watchWallet WatchOnlyWallet
+	err = cli.db.One("WalletID", walletID, &watchWallet)
+	if err != nil {
+		return fmt.Errorf("can not find watch-only wallet: %s", walletID)
+	}
+
+	var accounts []*WatchOnlyAccount
+	cli.db.Find("WalletID", walletID, &accounts)
+
+	tx, err := cli.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range accounts {
+		err = tx.DeleteStruct(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.DeleteStruct(&watchWallet)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWatchOnlyWallets 观察钱包列表
+func (cli *CLI) GetWatchOnlyWallets() ([]*WatchOnlyWallet, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	var list []*WatchOnlyWallet
+	err = cli.db.All(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+// getWatchOnlyWallet 查找观察钱包
+func (cli *CLI) getWatchOnlyWallet(walletID string) (*WatchOnlyWallet, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	var watchWallet WatchOnlyWallet
+	err = cli.db.One("WalletID", walletID, &watchWallet)
+	if err != nil {
+		return nil, err
+	}
+	return &watchWallet, nil
+}
+
+// getWatchOnlyWalletIDs 一次读取全部观察钱包的WalletID
+func (cli *CLI) getWatchOnlyWalletIDs() (map[string]bool, error) {
+
+	list, err := cli.GetWatchOnlyWallets()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, w := range list {
+		ids[w.WalletID] = true
+	}
+	return ids, nil
+}
+
+// IsWatchOnlyWallet 是否观察钱包，读取数据库失败时返回错误，调用者不能当作普通钱包处理
+func (cli *CLI) IsWatchOnlyWallet(walletID string) (bool, error) {
+
+	_, err := cli.getWatchOnlyWallet(walletID)
+	if err == storm.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkNotWatchOnlyWallet 签名前检查钱包不是观察钱包
+func (cli *CLI) checkNotWatchOnlyWallet(walletID string) error {
+
+	watchOnly, err := cli.IsWatchOnlyWallet(walletID)
+	if err != nil {
+		return fmt.Errorf("check watch-only wallet: %s failed: %v", walletID, err)
+	}
+	if watchOnly {
+		return fmt.Errorf("wallet: %s is watch-only, it has no seed to sign", walletID)
+	}
+	return nil
+}
+
+// filterWatchOnlyAccounts 观察钱包只返回已登记的账户，并检查账户公钥与登记时一致，不是观察钱包时原样返回
+func (cli *CLI) filterWatchOnlyAccounts(walletID string, accounts []*openwsdk.Account) ([]*openwsdk.Account, error) {
+
+	_, err := cli.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.closeDB()
+
+	var watchWallet WatchOnlyWallet
+	err = cli.db.One("WalletID", walletID, &watchWallet)
+	if err == storm.ErrNotFound {
+		return accounts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var watchAccounts []*WatchOnlyAccount
+	err = cli.db.Find("WalletID", walletID, &watchAccounts)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	pinned := make(map[string]string)
+	for _, a := range watchAccounts {
+		pinned[a.AccountID] = a.PublicKey
+	}
+
+	list := make([]*openwsdk.Account, 0)
+	for _, a := range accounts {
+		publicKey, exist := pinned[a.AccountID]
+		if !exist {
+			continue
+		}
+		if publicKey != a.PublicKey {
+			log.Warningf("watch-only account: %s public key is not match, it is ignored", a.AccountID)
+			continue
+		}
+		list = append(list, a)
+	}
+
+	return list, nil
+}
+
+// containsString 切片是否包含字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
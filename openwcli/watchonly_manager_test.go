@@ -0,0 +1,118 @@
+package openwcli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/blocktree/go-openw-sdk/v2/openwsdk"
+)
+
+func TestCLI_WatchOnlyWallet(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "openwcli-watch")
+	if err != nil {
+		t.Errorf("TempDir unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{
+		config: &Config{appid: "test", dbdir: dir, keydir: dir},
+	}
+
+	_, err = cli.getDB()
+	if err != nil {
+		t.Errorf("getDB unexpected error: %v", err)
+		return
+	}
+	cli.db.Save(&WatchOnlyWallet{WalletID: "W1", Alias: "watch"})
+	cli.db.Save(&WatchOnlyAccount{AccountID: "A1", WalletID: "W1", PublicKey: "pub1"})
+	cli.db.Save(&WatchOnlyAccount{AccountID: "A2", WalletID: "W1", PublicKey: "pub2"})
+	cli.closeDB()
+
+	isW1, err1 := cli.IsWatchOnlyWallet("W1")
+	isW2, err2 := cli.IsWatchOnlyWallet("W2")
+	if err1 != nil || err2 != nil || !isW1 || isW2 {
+		t.Errorf("IsWatchOnlyWallet is incorrect")
+		return
+	}
+
+	ids, err := cli.getWatchOnlyWalletIDs()
+	if err != nil || len(ids) != 1 || !ids["W1"] {
+		t.Errorf("getWatchOnlyWalletIDs is incorrect, err: %v", err)
+		return
+	}
+
+	wallet, err := cli.GetWalletByWalletIDOnLocal("W1")
+	if err != nil || wallet.Alias != "watch" {
+		t.Errorf("GetWalletByWalletIDOnLocal failed, err: %v", err)
+		return
+	}
+
+	//观察钱包不能签名
+	_, err = cli.getLocalKeyByWallet(wallet, "12345678")
+	if err == nil {
+		t.Errorf("getLocalKeyByWallet should failed with watch-only wallet")
+		return
+	}
+
+	accounts, err := cli.filterWatchOnlyAccounts("W1", []*openwsdk.Account{
+		{AccountID: "A1", PublicKey: "pub1"},
+		{AccountID: "A2", PublicKey: "changed"},
+		{AccountID: "A3", PublicKey: "pub3"},
+	})
+	if err != nil || len(accounts) != 1 || accounts[0].AccountID != "A1" {
+		t.Errorf("filterWatchOnlyAccounts returns %d accounts, err: %v", len(accounts), err)
+		return
+	}
+
+	//不是观察钱包时原样返回
+	accounts, err = cli.filterWatchOnlyAccounts("W2", []*openwsdk.Account{{AccountID: "A3"}})
+	if err != nil || len(accounts) != 1 {
+		t.Errorf("filterWatchOnlyAccounts should not filter normal wallet, err: %v", err)
+		return
+	}
+
+	err = cli.RemoveWatchOnlyWallet("W1")
+	isW1, _ = cli.IsWatchOnlyWallet("W1")
+	if err != nil || isW1 {
+		t.Errorf("RemoveWatchOnlyWallet failed, err: %v", err)
+		return
+	}
+
+	//数据库无法打开时不能当作普通钱包
+	cli.config.dbdir = "/dev/null/db"
+	if _, err = cli.getLocalKeyByWallet(&openwsdk.Wallet{WalletID: "W2"}, "12345678"); err == nil {
+		t.Errorf("getLocalKeyByWallet should failed when database can not be opened")
+		return
+	}
+}
+
+func TestNewWatchOnlyAccounts(t *testing.T) {
+
+	//两个账户使用同一个公钥
+	accounts := []*openwsdk.Account{
+		{AccountID: "A1", Symbol: "BTC", PublicKey: "pub1"},
+		{AccountID: "A2", Symbol: "ETH", PublicKey: "pub1"},
+		{AccountID: "A3", Symbol: "TRX", PublicKey: "pub3"},
+	}
+
+	_, err := newWatchOnlyAccounts("W1", accounts, []string{"pub1", "pub2"})
+	if err == nil {
+		t.Errorf("missing public key should return error")
+		return
+	}
+
+	list, err := newWatchOnlyAccounts("W1", accounts, []string{"pub1"})
+	if err != nil || len(list) != 2 {
+		t.Errorf("newWatchOnlyAccounts unexpected result: %d, %v", len(list), err)
+		return
+	}
+
+	list, err = newWatchOnlyAccounts("W1", accounts, nil)
+	if err != nil || len(list) != 3 {
+		t.Errorf("empty public keys should select all accounts")
+		return
+	}
+}